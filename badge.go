@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// shieldsBadge is the JSON document from which shields.io renders
+// a badge, see https://shields.io/badges/endpoint-badge.
+type shieldsBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// badgeThresholds are the percentages from which on
+// the badge is yellow and green, respectively.
+type badgeThresholds struct {
+	yellow int
+	green  int
+}
+
+// parseBadgeThresholds parses the -badge-thresholds option,
+// which has the form "yellow,green", such as "60,80".
+func parseBadgeThresholds(s string) (badgeThresholds, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) == 2 {
+		yellow, yellowErr := strconv.Atoi(strings.TrimSpace(fields[0]))
+		green, greenErr := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if yellowErr == nil && greenErr == nil && 0 <= yellow && yellow <= green && green <= 100 {
+			return badgeThresholds{yellow, green}, nil
+		}
+	}
+	return badgeThresholds{}, fmt.Errorf("error: -badge-thresholds must have "+
+		"the form \"yellow,green\", such as \"60,80\", not %q", s)
+}
+
+func newShieldsBadge(branch bool, covered, total int, thresholds badgeThresholds) shieldsBadge {
+	label := "condition coverage"
+	if branch {
+		label = "branch coverage"
+	}
+
+	// Rounding down ensures that 100% means full coverage.
+	percent := 100
+	if total > 0 {
+		percent = 100 * covered / total
+	}
+
+	color := "red"
+	if percent >= thresholds.green {
+		color = "green"
+	} else if percent >= thresholds.yellow {
+		color = "yellow"
+	}
+
+	return shieldsBadge{1, label, fmt.Sprintf("%d%%", percent), color}
+}
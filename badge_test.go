@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_newShieldsBadge(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	thresholds := badgeThresholds{60, 80}
+	test := func(branch bool, covered, total int, expected shieldsBadge) {
+		s.CheckEquals(newShieldsBadge(branch, covered, total, thresholds), expected)
+	}
+
+	test(true, 73, 100, shieldsBadge{1, "branch coverage", "73%", "yellow"})
+	test(false, 59, 100, shieldsBadge{1, "condition coverage", "59%", "red"})
+	test(false, 60, 100, shieldsBadge{1, "condition coverage", "60%", "yellow"})
+	test(false, 80, 100, shieldsBadge{1, "condition coverage", "80%", "green"})
+	test(false, 999, 1000, shieldsBadge{1, "condition coverage", "99%", "green"})
+	test(false, 0, 0, shieldsBadge{1, "condition coverage", "100%", "green"})
+}
+
+func Test_parseBadgeThresholds(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(str string, expected badgeThresholds, expectedErr string) {
+		actual, err := parseBadgeThresholds(str)
+		s.CheckEquals(actual, expected)
+		if expectedErr == "" {
+			s.CheckEquals(err, nil)
+		} else {
+			s.CheckEquals(err.Error(), expectedErr)
+		}
+	}
+
+	test("60,80", badgeThresholds{60, 80}, "")
+	test("50, 90", badgeThresholds{50, 90}, "")
+	test("0,100", badgeThresholds{0, 100}, "")
+	test("80,60", badgeThresholds{},
+		"error: -badge-thresholds must have the form \"yellow,green\", such as \"60,80\", not \"80,60\"")
+	test("80", badgeThresholds{},
+		"error: -badge-thresholds must have the form \"yellow,green\", such as \"60,80\", not \"80\"")
+	test("60,101", badgeThresholds{},
+		"error: -badge-thresholds must have the form \"yellow,green\", such as \"60,80\", not \"60,101\"")
+}
+
+func Test_gobcoMain__format_shields(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	badge := filepath.Join(t.TempDir(), "badge.json")
+	stdout, stderr := s.RunMain(0, "gobco", "-format", "shields", "-output", badge,
+		"-branch", "-badge-thresholds", "40,60", "testdata/lenient")
+
+	s.CheckNotContains(stdout, "coverage")
+	s.CheckEquals(stderr, "")
+	content, err := os.ReadFile(badge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckEquals(string(content), ""+
+		`{"schemaVersion":1,"label":"branch coverage","message":"50%","color":"yellow"}`+"\n")
+}
+
+func Test_gobco_parseCommandLine__format_shields_without_output(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-format", "shields", "pkg"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -format shields requires -output, "+
+		"to keep the output of 'go test' out of the badge\n")
+}
+
+func Test_gobco_parseCommandLine__format_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-format", "svg"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -format must be \"text\", \"shields\", \"gocover\", \"markdown\", \"json\", \"jsonl\" or \"prometheus\", not \"svg\"\n")
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The instrumentation cache stores the instrumented files of a package,
+// so that repeated runs on unchanged code only need to run 'go test'.
+//
+// Each entry is a directory named after the hash of all inputs
+// to the instrumentation, see cacheKey.
+// It contains the files that differ from the uncovered package.
+
+// cacheMaxAge is the time after which unused entries are removed.
+const cacheMaxAge = 5 * 24 * time.Hour
+
+// cacheDir returns the directory of the instrumentation cache,
+// which is $GOBCO_CACHE or the 'gobco' directory in the user's cache.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("GOBCO_CACHE"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gobco"), nil
+}
+
+// useCache returns whether the instrumentation of the argument
+// may come from the cache.
+//
+// The cache is only used if all inputs to the instrumentation are known.
+// For traditional packages and for modules that refer to code outside
+// the module, the types of the imported packages are not covered by the
+// cache key. The files covered by -since depend on the current time.
+// Some options need the details of the actual instrumentation.
+func (g *gobco) useCache(arg argInfo) bool {
+	return !g.noCache &&
+		!g.coverDeps &&
+		!g.showDiff &&
+		g.since == 0 &&
+		g.debugDumpFilename == "" &&
+		!g.reportSkipped &&
+		!g.keep &&
+		arg.module &&
+		!refersOutsideModule(arg.copySrc)
+}
+
+// refersOutsideModule returns whether the types of the module may depend
+// on code outside the module, which is either a 'replace' directive
+// that points to a directory or a go.work file.
+func refersOutsideModule(moduleRoot string) bool {
+	if gowork := os.Getenv("GOWORK"); gowork != "" && gowork != "off" {
+		return true
+	}
+	for dir, _ := filepath.Abs(moduleRoot); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+			return true
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	goMod, err := os.ReadFile(filepath.Join(moduleRoot, "go.mod"))
+	if err != nil {
+		return true
+	}
+	for _, line := range strings.Split(string(goMod), "\n") {
+		idx := strings.Index(line, "=>")
+		if idx < 0 {
+			continue
+		}
+		target := strings.TrimSpace(line[idx+len("=>"):])
+		if strings.HasPrefix(target, ".") || filepath.IsAbs(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey hashes everything that influences the instrumentation
+// of the argument: the gobco executable, the Go installation,
+// the options, and the names and contents of all files in the module.
+func (g *gobco) cacheKey(arg argInfo, changed changedLines) (string, error) {
+	h := sha256.New()
+
+	// The version alone doesn't cover local modifications to gobco.
+	exe, err := os.Executable()
+	if err == nil {
+		err = hashFile(h, exe)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	absArgDir, err := filepath.Abs(arg.argDir)
+	if err != nil {
+		return "", err
+	}
+
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%s\n",
+		version, runtime.Version(), build.Default.GOROOT,
+		build.Default.GOOS, build.Default.GOARCH, os.Getenv("GOFLAGS"))
+	_, _ = fmt.Fprintf(h, "%v\x00%v\x00%v\x00%v\x00%v\x00%v\x00%v\x00%v\x00%v\n",
+		g.branch, g.coverTest, g.immediately, g.listAll, g.statsCompact,
+		g.attributeTests, g.exportedOnly, g.skipMain, g.strictJSON)
+	_, _ = fmt.Fprintf(h, "%q\x00%q\x00%q\x00%q\x00%v\x00%d\x00%v\x00%d\n",
+		arg.argDir, absArgDir, arg.instrFile, g.goTestArgs, changed, g.flushInterval, g.kinds,
+		g.maxConditions)
+
+	err = filepath.Walk(arg.copySrc, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir // only relevant via -diff-base
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(arg.copySrc, path)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(h, "%q %v\n", filepath.ToSlash(rel), info.Mode())
+		return hashFile(h, path)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// cacheEntry returns the cache directory and the key
+// for the instrumentation of the argument,
+// or an empty key if the instrumentation cannot be cached.
+func (g *gobco) cacheEntry(arg argInfo, changed changedLines) (string, string) {
+	if !g.useCache(arg) {
+		return "", ""
+	}
+	dir, err := cacheDir()
+	if err == nil {
+		var key string
+		key, err = g.cacheKey(arg, changed)
+		if err == nil {
+			return dir, key
+		}
+	}
+	g.infof("Not using the cache: %s", err)
+	return "", ""
+}
+
+// cacheResultFile is the file in each cache entry
+// that records the cachedResult.
+// Since its name starts with a dot, 'go test' would ignore it,
+// but it is not copied to the instrumented package anyway.
+const cacheResultFile = ".gobco-result.json"
+
+// cachedResult records what gobco checks after instrumenting a package,
+// so that a cache hit reports the same warnings and errors
+// as the instrumentation that created the cache entry.
+//
+// With -keep-going, the files that cannot be printed only cause a warning,
+// so they are recorded as well. The other checks after the
+// instrumentation, checkGeneratedCode and checkUniqueConditions,
+// stop gobco before the cache entry is stored,
+// so they need not be recorded.
+type cachedResult struct {
+	Conds       int
+	Skipped     []cachedFile
+	Unprintable []cachedFile
+}
+
+type cachedFile struct {
+	Filename string
+	Conds    int    `json:",omitempty"`
+	Err      string `json:",omitempty"`
+}
+
+func newCachedResult(in *instrumenter) cachedResult {
+	result := cachedResult{Conds: len(in.conds)}
+	for _, file := range in.skipped {
+		result.Skipped = append(result.Skipped, cachedFile{Filename: file.filename, Conds: file.conds})
+	}
+	for _, file := range in.unprintable {
+		result.Unprintable = append(result.Unprintable, cachedFile{Filename: file.filename, Err: file.err.Error()})
+	}
+	return result
+}
+
+// instrumenter returns an instrumenter that has the recorded results,
+// for the checks that follow the instrumentation.
+func (r *cachedResult) instrumenter() *instrumenter {
+	in := &instrumenter{conds: make([]cond, r.Conds)}
+	for _, file := range r.Skipped {
+		in.skipped = append(in.skipped, skippedFile{file.Filename, file.Conds})
+	}
+	for _, file := range r.Unprintable {
+		in.unprintable = append(in.unprintable, unprintableFile{file.Filename, errors.New(file.Err)})
+	}
+	return in
+}
+
+// loadCached copies the cached instrumented files to instrDst
+// and returns the recorded result of the instrumentation,
+// or nil if the cache had no entry for the key.
+// Since the cache is only an optimization, errors are not fatal.
+func (g *gobco) loadCached(dir, key, instrDst string) *cachedResult {
+	result, err := loadCached(dir, key, instrDst)
+	if err != nil {
+		g.infof("Cannot load from the cache: %s", err)
+		return nil
+	}
+	return result
+}
+
+// storeCached saves the instrumented files to the cache,
+// together with the result of the instrumentation.
+// Since the cache is only an optimization, errors are not fatal.
+func (g *gobco) storeCached(dir, key, srcDir, instrDst string, result cachedResult) {
+	err := storeCached(dir, key, srcDir, instrDst, result)
+	if err == nil {
+		err = trimCache(dir)
+	}
+	if err != nil {
+		g.infof("Cannot store in the cache: %s", err)
+	}
+}
+
+// loadCached copies the files of the cache entry to instrDst
+// and returns the recorded result of the instrumentation.
+func loadCached(dir, key, instrDst string) (*cachedResult, error) {
+	entry := filepath.Join(dir, key)
+	content, err := os.ReadFile(filepath.Join(entry, cacheResultFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result cachedResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(entry)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name() == cacheResultFile {
+			continue
+		}
+		src := filepath.Join(entry, file.Name())
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		err = copyFile(src, filepath.Join(instrDst, file.Name()), info.Mode())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	return &result, os.Chtimes(entry, now, now)
+}
+
+// storeCached saves the files from instrDst that the instrumentation
+// created or changed, compared to the files in srcDir,
+// together with the result of the instrumentation.
+func storeCached(dir, key, srcDir, instrDst string, result cachedResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, cacheResultFile), content, 0o644); err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(instrDst)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		// The go.mod file refers to the temporary directory of the
+		// current run, see provideSink, and is prepared in each run anyway.
+		if !file.Type().IsRegular() || file.Name() == "go.mod" {
+			continue
+		}
+		dst := filepath.Join(instrDst, file.Name())
+		same, err := sameContent(filepath.Join(srcDir, file.Name()), dst)
+		if err != nil {
+			return err
+		}
+		if same {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		err = copyFile(dst, filepath.Join(tmp, file.Name()), info.Mode())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Another gobco process may have stored the same entry in the meantime,
+	// which has the same content, so it's ok to keep either of them.
+	if err := os.Rename(tmp, filepath.Join(dir, key)); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, key)); statErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameContent returns whether both files exist and have the same content.
+func sameContent(a, b string) (bool, error) {
+	ca, err := os.ReadFile(a)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cb, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ca, cb), nil
+}
+
+// trimCache removes the entries that have not been used for a while.
+func trimCache(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) > cacheMaxAge {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_refersOutsideModule(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(goMod string, expected bool) {
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{"go.mod": goMod})
+		s.CheckEquals(refersOutsideModule(dir), expected)
+	}
+
+	test("module example.org/m\n", false)
+	test("module example.org/m\nreplace example.org/a => example.org/b v1.0.0\n", false)
+	test("module example.org/m\nreplace example.org/a => ../a\n", true)
+	test("module example.org/m\nreplace (\n\texample.org/a v1.0.0 => ./a\n)\n", true)
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.work":  "go 1.18\n",
+		"m/go.mod": "module example.org/m\n",
+	})
+	s.CheckEquals(refersOutsideModule(filepath.Join(dir, "m")), true)
+}
+
+func Test_storeCached(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	cache, src, instr := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{
+		"same.go":    "package p\n",
+		"changed.go": "package p\n",
+	})
+	writeTree(t, instr, map[string]string{
+		"same.go":        "package p\n",
+		"changed.go":     "package p // instrumented\n",
+		"gobco_fixed.go": "package p\n",
+	})
+
+	result := cachedResult{
+		Conds:   3,
+		Skipped: []cachedFile{{Filename: "large.go", Conds: 200}},
+	}
+	s.CheckEquals(storeCached(cache, "key", src, instr, result), nil)
+
+	// Only the files that differ from the source are stored.
+	entries, err := os.ReadDir(filepath.Join(cache, "key"))
+	s.CheckEquals(err, nil)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	s.CheckEquals(names, []string{cacheResultFile, "changed.go", "gobco_fixed.go"})
+
+	dst := t.TempDir()
+	writeTree(t, dst, map[string]string{
+		"same.go":    "package p\n",
+		"changed.go": "package p\n",
+	})
+	loaded, err := loadCached(cache, "key", dst)
+	s.CheckEquals(loaded, &result)
+	s.CheckEquals(err, nil)
+	content, err := os.ReadFile(filepath.Join(dst, "changed.go"))
+	s.CheckEquals(string(content), "package p // instrumented\n")
+	s.CheckEquals(err, nil)
+	_, err = os.Stat(filepath.Join(dst, cacheResultFile))
+	s.CheckEquals(os.IsNotExist(err), true)
+
+	loaded, err = loadCached(cache, "other", dst)
+	s.CheckEquals(loaded, (*cachedResult)(nil))
+	s.CheckEquals(err, nil)
+}
+
+func Test_cachedResult(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	in := &instrumenter{
+		conds:       make([]cond, 2),
+		skipped:     []skippedFile{{"large.go", 200}},
+		unprintable: []unprintableFile{{"odd.go", errors.New("cannot print")}},
+	}
+	result := newCachedResult(in)
+	s.CheckEquals(result.instrumenter(), in)
+
+	// A cache hit counts its conditions towards the total limit.
+	g := s.newGobco()
+	g.maxConditions = 3
+	g.checkConditionLimit(result.instrumenter())
+	s.CheckPanics(func() { g.checkConditionLimit(result.instrumenter()) }, exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		"gobco: not instrumenting large.go, as its 200 conditions are more than -max-conditions=3\n"+
+		"gobco: not instrumenting large.go, as its 200 conditions are more than -max-conditions=3\n"+
+		"error: the packages have more than -max-conditions=3 conditions\n")
+
+	// Without -keep-going, an unprintable file is an error.
+	s.CheckPanics(func() { g.checkUnprintable(result.instrumenter()) }, exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: cannot print the instrumented code of odd.go: cannot print; "+
+		"this is a bug in gobco, please report it\n")
+}
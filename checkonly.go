@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// checkInstrumentation implements -check-only, which instruments
+// the packages and compiles them together with their tests,
+// without running the tests, to find the code that gobco cannot handle.
+func (g *gobco) checkInstrumentation() {
+	g.instrument()
+
+	if len(g.matrix) > 0 {
+		args := g.args
+		g.forEachTagSet(func(i int) {
+			g.args = g.matrixArgs[i]
+			g.checkCompiles()
+		})
+		g.args = args
+	} else {
+		g.checkCompiles()
+	}
+
+	g.reportFailedPackages()
+}
+
+// checkCompiles compiles each instrumented package together with its tests,
+// printing a line per package, like 'go test'.
+func (g *gobco) checkCompiles() {
+	for _, arg := range g.args {
+		gopaths := ""
+		if !arg.module {
+			gopaths = g.gopaths()
+		}
+		instrDir := g.file(arg.instrDir)
+		env := goTest{extraEnv: g.testEnv}.env(g.tmpdir, gopaths, "")
+		out, err := g.goTestCompile(instrDir, buildFlags(g.goTestArgs), env)
+		if err == nil {
+			g.outf("ok  \t%s", arg.arg)
+			continue
+		}
+
+		g.outf("FAIL\t%s", arg.arg)
+		g.fail(exitBuild)
+		if _, err := g.goTestCompile(arg.argDir, buildFlags(g.goTestArgs), os.Environ()); err != nil {
+			g.errf("error: the code in %s does not compile, even without instrumentation:", arg.arg)
+			g.errf("%s", strings.TrimSuffix(out, "\n"))
+			continue
+		}
+
+		// Like with -verify-compile, the temporary directory
+		// is kept for investigation.
+		g.keep = true
+		g.errf("error: the instrumented code of %s does not compile, "+
+			"although the original code does, which is probably a bug in gobco", arg.arg)
+		g.errf("The instrumented code is in %s:", instrDir)
+		g.errf("%s", strings.TrimSuffix(out, "\n"))
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+)
+
+// comparison is the result of the -compare mode,
+// which is printed either as text or as JSON.
+type comparison struct {
+	Kind    string            `json:"kind"` // "condition" or "branch"
+	Old     coverageTotal     `json:"old"`
+	New     coverageTotal     `json:"new"`
+	Delta   float64           `json:"delta"` // In percentage points.
+	Added   []conditionChange `json:"added"`
+	Removed []conditionChange `json:"removed"`
+	Changed []conditionChange `json:"changed"`
+}
+
+type coverageTotal struct {
+	Covered int     `json:"covered"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// conditionChange describes a single condition in a comparison.
+// For removed conditions, the counts are those of the old run.
+type conditionChange struct {
+	Start      string `json:"start"`
+	Code       string `json:"code"`
+	OldCovered int    `json:"oldCovered"`
+	NewCovered int    `json:"newCovered"`
+	Outcomes   int    `json:"outcomes"`
+}
+
+func newComparison(branch bool, old, cur []condition, lenientErrors bool) *comparison {
+	kind := "condition"
+	if branch {
+		kind = "branch"
+	}
+
+	c := comparison{
+		Kind:    kind,
+		Added:   []conditionChange{},
+		Removed: []conditionChange{},
+		Changed: []conditionChange{},
+	}
+	for _, cond := range old {
+		c.Old.Covered += coveredOutcomes(cond, lenientErrors)
+		c.Old.Total += countedOutcomes(cond)
+	}
+
+	deltas, removed := compareConditions(old, cur, lenientErrors)
+	for _, delta := range deltas {
+		c.New.Covered += delta.NewCovered
+		c.New.Total += delta.Outcomes
+
+		change := conditionChange{delta.Start, delta.Code,
+			delta.OldCovered, delta.NewCovered, delta.Outcomes}
+		if delta.Added {
+			c.Added = append(c.Added, change)
+		} else if delta.Status != "same" {
+			c.Changed = append(c.Changed, change)
+		}
+	}
+	for _, cond := range removed {
+		covered := coveredOutcomes(cond, lenientErrors)
+		c.Removed = append(c.Removed, conditionChange{cond.Start, cond.Code,
+			covered, 0, countedOutcomes(cond)})
+	}
+
+	c.Old.Percent = coveragePercent(c.Old.Covered, c.Old.Total)
+	c.New.Percent = coveragePercent(c.New.Covered, c.New.Total)
+	// Avoid deltas like 12.499999999999998.
+	c.Delta = math.Round(10*(c.New.Percent-c.Old.Percent)) / 10
+	return &c
+}
+
+// compareStats implements the -compare mode,
+// which prints the differences between the old and the new stats file,
+// without running any tests.
+func (g *gobco) compareStats() {
+	old, err := g.load(g.diffStats[0])
+	g.check(err)
+	cur, err := g.load(g.diffStats[1])
+	g.check(err)
+
+	c := newComparison(g.branch, old, cur, g.lenientErrors)
+	if g.format == "json" {
+		js, err := json.Marshal(c)
+		g.check(err)
+		g.outf("%s", js)
+		return
+	}
+
+	kind := "Condition coverage"
+	if g.branch {
+		kind = "Branch coverage"
+	}
+	g.outf("%s: %d/%d (%.1f%%) -> %d/%d (%.1f%%), %+.1f",
+		kind, c.Old.Covered, c.Old.Total, c.Old.Percent,
+		c.New.Covered, c.New.Total, c.New.Percent, c.Delta)
+	for _, change := range c.Added {
+		g.outf("added: %s: %s %d/%d",
+			g.location(change.Start), change.Code, change.NewCovered, change.Outcomes)
+	}
+	for _, change := range c.Removed {
+		g.outf("removed: %s: %s %d/%d",
+			g.location(change.Start), change.Code, change.OldCovered, change.Outcomes)
+	}
+	for _, change := range c.Changed {
+		g.outf("changed: %s: %s %d/%d -> %d/%d",
+			g.location(change.Start), change.Code,
+			change.OldCovered, change.Outcomes, change.NewCovered, change.Outcomes)
+	}
+}
+
+// newlyUncovered returns the conditions that are not fully covered,
+// and that either don't exist in the baseline
+// or had more covered outcomes there.
+func newlyUncovered(baseline, conds []condition, lenientErrors bool) []condition {
+	deltas, _ := compareConditions(baseline, conds, lenientErrors)
+	var uncovered []condition
+	for _, delta := range deltas {
+		if fullyCovered(delta.condition, lenientErrors) {
+			continue
+		}
+		if delta.Added || delta.NewCovered < delta.OldCovered {
+			uncovered = append(uncovered, delta.condition)
+		}
+	}
+	return uncovered
+}
+
+// printNewUncovered implements -new-uncovered, which only reports
+// the conditions that became uncovered since the -baseline,
+// for gating pull requests without requiring full coverage.
+func (g *gobco) printNewUncovered(conds []condition) {
+	if g.baseline == "" {
+		g.outf("No baseline in %s yet, so no condition counts as new", g.baselineAuto)
+		return
+	}
+
+	baseline, err := g.load(g.baseline)
+	g.check(err)
+
+	uncovered := newlyUncovered(baseline, conds, g.lenientErrors)
+	if len(uncovered) == 0 {
+		g.outf("No new uncovered conditions compared to %s", g.baseline)
+		return
+	}
+
+	g.outf("New uncovered conditions compared to %s: %d", g.baseline, len(uncovered))
+	for _, cond := range uncovered {
+		g.printCond(cond)
+	}
+	if g.failOnNewUncovered {
+		g.fail(exitRegression)
+	}
+}
+
+// skipCoveredPackages implements -skip-above, which only instruments
+// the packages whose coverage in the -baseline is below the target,
+// to focus the costly run on the weakest packages of a large codebase.
+// Packages without conditions in the baseline are always instrumented,
+// as their coverage is unknown.
+func (g *gobco) skipCoveredPackages() {
+	if g.skipAbove == 0 || g.baseline == "" {
+		return
+	}
+
+	baseline, err := g.load(g.baseline)
+	g.check(err)
+
+	var args []argInfo
+	for _, arg := range g.args {
+		covered, total := baselineCoverage(arg, baseline, g.lenientErrors)
+		percent := coveragePercent(covered, total)
+		if total > 0 && percent >= g.skipAbove {
+			g.errf("gobco: skipping %s, as its coverage in %s is %d/%d (%.1f%%)",
+				arg.arg, g.baseline, covered, total, percent)
+			continue
+		}
+		args = append(args, arg)
+	}
+	g.args = args
+}
+
+// baselineCoverage returns the coverage of the conditions
+// from the baseline that belong to the argument,
+// which is either a package directory or a single file.
+func baselineCoverage(arg argInfo, baseline []condition, lenientErrors bool) (covered, total int) {
+	abs := func(path string) string {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+		return filepath.Clean(path)
+	}
+
+	dir := abs(arg.argDir)
+	file := ""
+	if arg.instrFile != "" {
+		file = filepath.Join(dir, arg.instrFile)
+	}
+	for _, cond := range baseline {
+		condFile := abs(cond.File)
+		if file != "" && condFile != file || file == "" && filepath.Dir(condFile) != dir {
+			continue
+		}
+		covered += coveredOutcomes(cond, lenientErrors)
+		total += countedOutcomes(cond)
+	}
+	return covered, total
+}
+
+// updateBaseline implements -baseline-auto, which makes the stats
+// of a passing run the baseline of the next run,
+// so that a failing run, such as from -fail-on-new-uncovered,
+// never lowers the bar.
+func (g *gobco) updateBaseline() {
+	if g.baselineAuto == "" || g.exitCode != 0 {
+		return
+	}
+
+	conds, err := g.load(g.statsFilename)
+	g.check(err)
+	g.check(checkWritable(g.baselineAuto))
+	g.writeStats(g.baselineAuto, conds)
+	g.infof("Updated the baseline in %s", g.baselineAuto)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_newComparison(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	old := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", Func: "f", Depth: 1, ID: "id-c"},
+		{Start: "a.go:6:4", File: "a.go", Line: 6, Col: 4, Code: "d", TrueCount: 1, Func: "f", Depth: 1, ID: "id-d"},
+	}
+	cur := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", Func: "f", Depth: 1, ID: "id-c"},
+		{Start: "a.go:7:4", File: "a.go", Line: 7, Col: 4, Code: "e", FalseCount: 1, Func: "f", Depth: 1, ID: "id-e"},
+	}
+
+	c := newComparison(false, old, cur, false)
+
+	s.CheckEquals(*c, comparison{
+		Kind:    "condition",
+		Old:     coverageTotal{4, 8, 50},
+		New:     coverageTotal{5, 8, 62.5},
+		Delta:   12.5,
+		Added:   []conditionChange{{"a.go:7:4", "e", 0, 1, 2}},
+		Removed: []conditionChange{{"a.go:6:4", "d", 1, 0, 2}},
+		Changed: []conditionChange{{"a.go:4:4", "b", 1, 2, 2}},
+	})
+}
+
+func Test_gobcoMain__compare(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	write := func(name string, conds []condition) string {
+		filename := filepath.Join(dir, name)
+		data, err := json.Marshal(conds)
+		s.CheckEquals(err, nil)
+		s.CheckEquals(os.WriteFile(filename, data, 0o666), nil)
+		return filename
+	}
+	oldStats := write("old.json", []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, FalseCount: 1, ID: "id-b"},
+	})
+	newStats := write("new.json", []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, ID: "id-a"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", ID: "id-c"},
+	})
+
+	stdout, stderr := s.RunMain(0, "gobco", "-compare", oldStats, newStats)
+	s.CheckEquals(stdout, ""+
+		"Condition coverage: 3/4 (75.0%) -> 2/4 (50.0%), -25.0\n"+
+		"added: a.go:5:4: c 0/2\n"+
+		"removed: a.go:4:4: b 2/2\n"+
+		"changed: a.go:3:4: a 1/2 -> 2/2\n")
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-compare", "-format", "json",
+		oldStats, newStats)
+	s.CheckEquals(stdout, ""+
+		"{\"kind\":\"condition\","+
+		"\"old\":{\"covered\":3,\"total\":4,\"percent\":75},"+
+		"\"new\":{\"covered\":2,\"total\":4,\"percent\":50},"+
+		"\"delta\":-25,"+
+		"\"added\":[{\"start\":\"a.go:5:4\",\"code\":\"c\",\"oldCovered\":0,\"newCovered\":0,\"outcomes\":2}],"+
+		"\"removed\":[{\"start\":\"a.go:4:4\",\"code\":\"b\",\"oldCovered\":2,\"newCovered\":0,\"outcomes\":2}],"+
+		"\"changed\":[{\"start\":\"a.go:3:4\",\"code\":\"a\",\"oldCovered\":1,\"newCovered\":2,\"outcomes\":2}]}\n")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__compare_stdin(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	newStats := filepath.Join(dir, "new.json")
+	s.CheckEquals(os.WriteFile(newStats, []byte(`[`+
+		`{"Start":"a.go:3:4","Code":"a","TrueCount":1,"FalseCount":1}]`), 0o666), nil)
+	stdin = strings.NewReader(`[` +
+		`{"Start":"a.go:3:4","Code":"a","TrueCount":1,"FalseCount":0}]`)
+
+	stdout, stderr := s.RunMain(0, "gobco", "-compare", "-", newStats)
+	s.CheckEquals(stdout, ""+
+		"Condition coverage: 1/2 (50.0%) -> 2/2 (100.0%), +50.0\n"+
+		"changed: a.go:3:4: a 1/2 -> 2/2\n")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobco_parseCommandLine__compare(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-compare", "old.json"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(),
+		"error: -compare requires the old and the new stats file as arguments\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-format", "json", "."}) },
+		exited(2))
+	s.CheckContains(s.Stderr(), "error: -format json requires -output, "+
+		"to keep the output of 'go test' out of the report\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-compare", "-", "-"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(),
+		"error: only one of the stats files can be read from stdin\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-stats", "-", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(),
+		"error: -stats cannot persist the coverage data to stdin\n")
+}
+
+func Test_newlyUncovered(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	baseline := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", Func: "f", Depth: 1, ID: "id-c"},
+	}
+	conds := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", TrueCount: 1, Func: "f", Depth: 1, ID: "id-c"},
+		{Start: "a.go:6:4", File: "a.go", Line: 6, Col: 4, Code: "d", FalseCount: 1, Func: "f", Depth: 1, ID: "id-d"},
+		{Start: "a.go:7:4", File: "a.go", Line: 7, Col: 4, Code: "e", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-e"},
+	}
+
+	// The condition a lost an outcome, d is new and not fully covered.
+	// The condition b stayed the same, c improved, e is fully covered.
+	s.CheckEquals(newlyUncovered(baseline, conds, false), []condition{conds[0], conds[3]})
+}
+
+func Test_gobcoMain__new_uncovered(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	data, err := json.Marshal([]condition{
+		{Start: "testdata/exported/exported.go:5:15", Code: "len(os.Args) > 100", TrueCount: 1, FalseCount: 1},
+		{Start: "testdata/exported/exported.go:8:18", Code: "nonZero(x)", TrueCount: 1},
+		{Start: "testdata/exported/exported.go:12:9", Code: "x != 0"},
+		{Start: "testdata/exported/exported.go:17:36", Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "testdata/exported/exported.go:19:6", Code: "keep(x)", TrueCount: 2},
+		{Start: "testdata/exported/exported.go:33:41", Code: "c.n == 0"},
+		{Start: "testdata/exported/exported.go:35:40", Code: "c.n > 100"},
+	})
+	s.CheckEquals(err, nil)
+	s.CheckEquals(os.WriteFile(baseline, data, 0o666), nil)
+
+	stdout, stderr := s.RunMain(4, "gobco", "-new-uncovered", "-baseline", baseline, "testdata/exported")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 11/20",
+		"New uncovered conditions compared to " + filepath.ToSlash(baseline) + ": 2",
+		"testdata/exported/exported.go:5:15: condition \"len(os.Args) > 100\" was once false but never true",
+		"testdata/exported/exported.go:17:36: condition \"x > 0\" was 2 times true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, _ = s.RunMain(0, "gobco", "-new-uncovered", "-fail-on-new-uncovered=false",
+		"-baseline", baseline, "testdata/exported")
+
+	s.CheckEquals(s.GobcoLines(stdout)[1],
+		"New uncovered conditions compared to "+filepath.ToSlash(baseline)+": 2")
+}
+
+func Test_gobco_parseCommandLine__new_uncovered(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-new-uncovered", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -new-uncovered requires -baseline\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-new-uncovered", "-baseline", "old.json",
+				"-format", "gocover", "."})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -new-uncovered requires -format text\n")
+}
+
+func Test_gobcoMain__baseline_auto(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+
+	// The first run has nothing to compare with and creates the baseline.
+	stdout, stderr := s.RunMain(0, "gobco", "-new-uncovered", "-baseline-auto", baseline, "testdata/exported")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 11/20",
+		"No baseline in " + baseline + " yet, so no condition counts as new",
+	})
+	s.CheckEquals(stderr, "")
+	conds, err := s.newGobco().load(baseline)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(len(conds), 10)
+
+	// The next run compares with the previous one.
+	stdout, _ = s.RunMain(0, "gobco", "-new-uncovered", "-baseline-auto", baseline, "testdata/exported")
+
+	s.CheckEquals(s.GobcoLines(stdout)[1],
+		"No new uncovered conditions compared to "+baseline)
+
+	// A failing run leaves the baseline as it is.
+	conds[0].TrueCount, conds[0].FalseCount = 1, 1
+	s.newGobco().writeStats(baseline, conds)
+	before, err := os.ReadFile(baseline)
+	s.CheckEquals(err, nil)
+
+	stdout, _ = s.RunMain(4, "gobco", "-new-uncovered", "-baseline-auto", baseline, "testdata/exported")
+
+	s.CheckEquals(s.GobcoLines(stdout)[1],
+		"New uncovered conditions compared to "+baseline+": 1")
+	after, err := os.ReadFile(baseline)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(after), string(before))
+}
+
+func Test_gobco_parseCommandLine__baseline_auto(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-baseline-auto", "auto.json", "-baseline", "old.json", "."})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -baseline-auto cannot be combined with -baseline\n")
+
+	// Until the file exists, there is no baseline to compare with.
+	g = s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-new-uncovered", "-baseline-auto", "missing.json", "."})
+	s.CheckEquals(g.baseline, "")
+}
+
+func Test_baselineCoverage(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	baseline := []condition{
+		{File: filepath.FromSlash("p/a.go"), Code: "a", TrueCount: 1, FalseCount: 1},
+		{File: filepath.FromSlash("p/b.go"), Code: "b", TrueCount: 1},
+		{File: filepath.FromSlash("p/sub/c.go"), Code: "c"},
+		{File: "d.go", Code: "d", FalseCount: 1},
+	}
+
+	test := func(arg argInfo, expectedCovered, expectedTotal int) {
+		covered, total := baselineCoverage(arg, baseline, false)
+		s.CheckEquals([]int{covered, total}, []int{expectedCovered, expectedTotal})
+	}
+
+	test(argInfo{argDir: "p"}, 3, 4)
+	test(argInfo{argDir: "./p/"}, 3, 4)
+	test(argInfo{argDir: "p", instrFile: "b.go"}, 1, 2)
+	test(argInfo{argDir: filepath.Join("p", "sub")}, 0, 2)
+	test(argInfo{argDir: "."}, 1, 2)
+	test(argInfo{argDir: "q"}, 0, 0)
+}
+
+func Test_gobcoMain__skip_above(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	baseline := filepath.Join(t.TempDir(), "baseline.json")
+	data, err := json.Marshal([]condition{
+		{Start: "testdata/collision/kind.go:10:7", Code: "x == gobco0", TrueCount: 1, FalseCount: 1},
+		{Start: "testdata/oddeven/odd.go:4:9", Code: "x%2 != 0", TrueCount: 1},
+	})
+	s.CheckEquals(err, nil)
+	s.CheckEquals(os.WriteFile(baseline, data, 0o666), nil)
+
+	stdout, stderr := s.RunMain(0, "gobco", "-baseline", baseline, "-skip-above", "90",
+		"testdata/collision", "testdata/oddeven")
+
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 0/2")
+	s.CheckEquals(stderr, ""+
+		"gobco: skipping testdata/collision, as its coverage in "+baseline+" is 2/2 (100.0%)\n")
+
+	// If all packages are skipped, there is nothing left to do.
+	stdout, _ = s.RunMain(0, "gobco", "-baseline", baseline, "-skip-above", "50",
+		"testdata/collision", "testdata/oddeven")
+
+	s.CheckEquals(stdout, "nothing to instrument\n")
+}
+
+func Test_gobco_parseCommandLine__skip_above(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-skip-above", "80", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -skip-above requires -baseline\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-skip-above", "120", "-baseline", "old.json", "."})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -skip-above must be between 0 and 100, not 120\n")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// debugDump collects what gobco decided during a run,
+// to be written as JSON by the -debug-dump option,
+// for inclusion in bug reports.
+type debugDump struct {
+	Version      string
+	Args         []debugArg
+	TmpDir       string
+	Instrumented []string // The files in which conditions were instrumented.
+	Conditions   []debugCond
+	GoTest       []debugGoTest
+	ExitCode     int
+	Error        string `json:",omitempty"`
+}
+
+type debugArg struct {
+	Arg       string
+	ArgDir    string
+	Module    bool
+	CopySrc   string
+	CopyDst   string
+	InstrFile string
+	InstrDir  string
+}
+
+type debugCond struct {
+	Start string
+	Code  string
+	Func  string
+}
+
+type debugGoTest struct {
+	Dir       string
+	Command   []string
+	StatsFile string
+	ExitCode  int
+	Duration  time.Duration
+}
+
+// addInstrumented remembers the files and conditions
+// that the instrumenter found.
+func (d *debugDump) addInstrumented(in *instrumenter) {
+	d.Instrumented = append(d.Instrumented, in.files...)
+	for _, cond := range in.conds {
+		d.Conditions = append(d.Conditions, debugCond{cond.pos, cond.text, cond.fn})
+	}
+}
+
+// writeDebugDump writes the state of the run to the -debug-dump file.
+// Since it is also called when gobco fails,
+// it only reports its own errors instead of exiting.
+func (g *gobco) writeDebugDump(err error) {
+	if g.debugDumpFilename == "" {
+		return
+	}
+
+	d := g.dump
+	d.Version = version
+	d.TmpDir = g.tmpdir
+	d.ExitCode = g.exitCode
+	if err != nil {
+		d.Error = err.Error()
+		if d.ExitCode == 0 {
+			d.ExitCode = 1
+		}
+	}
+	for _, arg := range g.args {
+		d.Args = append(d.Args, debugArg{
+			arg.arg, arg.argDir, arg.module, arg.copySrc,
+			arg.copyDst, arg.instrFile, arg.instrDir,
+		})
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "\t")
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(d)
+	if err == nil {
+		err = os.WriteFile(g.debugDumpFilename, buf.Bytes(), 0o666)
+	}
+	if err != nil {
+		g.warnf("gobco: cannot write the debug dump: %s", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffLine is a single line of a line-based diff.
+type diffLine struct {
+	op   byte // ' ' for unchanged, '-' for removed, '+' for added
+	text string
+}
+
+// unifiedDiff returns the differences between the lines of old and new
+// in the unified format with 3 lines of context,
+// or "" if there are no differences.
+func unifiedDiff(oldName, newName, old, cur string) string {
+	lines := diffLines(splitLines(old), splitLines(cur))
+
+	const context = 3
+	var sb strings.Builder
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Extend the hunk as long as the next change is near enough.
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*context; j++ {
+			if lines[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		if end += context; end > len(lines) {
+			end = len(lines)
+		}
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		if sb.Len() == 0 {
+			_, _ = fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		_, _ = fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[start:end] {
+			_, _ = fmt.Fprintf(&sb, "%c%s\n", line.op, line.text)
+		}
+
+		for _, line := range lines[i:end] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the "15,4" part of a hunk header.
+// An empty range starts at the line before it, as in GNU diff.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script from a to b,
+// using the algorithm from Eugene W. Myers,
+// "An O(ND) Difference Algorithm and Its Variations".
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d] holds the furthest x for each diagonal k in [-d, d]
+	// after step d, at index k+d.
+	var trace [][]int
+	for d := 0; ; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return diffBacktrack(a, b, trace, d)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+}
+
+func diffBacktrack(a, b []string, trace [][]int, d int) []diffLine {
+	var rev []diffLine
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			rev = append(rev, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			rev = append(rev, diffLine{'+', b[y-1]})
+			y--
+		} else {
+			rev = append(rev, diffLine{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 {
+		rev = append(rev, diffLine{' ', a[x-1]})
+		x--
+	}
+
+	lines := make([]diffLine, len(rev))
+	for i, line := range rev {
+		lines[len(rev)-1-i] = line
+	}
+	return lines
+}
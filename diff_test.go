@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_unifiedDiff(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	lines := func(lines ...string) string {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	test := func(old, cur string, expected ...string) {
+		diff := unifiedDiff("old.go", "new.go", old, cur)
+		if len(expected) == 0 {
+			s.CheckEquals(diff, "")
+		} else {
+			s.CheckEquals(diff, lines(expected...))
+		}
+	}
+
+	test(
+		lines("a", "b", "c"),
+		lines("a", "b", "c"))
+
+	test(
+		lines("1", "2", "3", "4", "5", "6", "7"),
+		lines("1", "2", "3", "four", "5", "6", "7"),
+		"--- old.go",
+		"+++ new.go",
+		"@@ -1,7 +1,7 @@",
+		" 1",
+		" 2",
+		" 3",
+		"-4",
+		"+four",
+		" 5",
+		" 6",
+		" 7")
+
+	// Changes that are far apart get separate hunks.
+	test(
+		lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10"),
+		lines("one", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"),
+		"--- old.go",
+		"+++ new.go",
+		"@@ -1,4 +1,4 @@",
+		"-1",
+		"+one",
+		" 2",
+		" 3",
+		" 4",
+		"@@ -8,3 +8,4 @@",
+		" 8",
+		" 9",
+		" 10",
+		"+11")
+
+	// Changes that are near each other share a hunk.
+	test(
+		lines("1", "2", "3", "4", "5", "6", "7", "8"),
+		lines("2", "3", "4", "5", "6", "7"),
+		"--- old.go",
+		"+++ new.go",
+		"@@ -1,8 +1,6 @@",
+		"-1",
+		" 2",
+		" 3",
+		" 4",
+		" 5",
+		" 6",
+		" 7",
+		"-8")
+
+	test(
+		"",
+		lines("package p"),
+		"--- old.go",
+		"+++ new.go",
+		"@@ -0,0 +1,1 @@",
+		"+package p")
+}
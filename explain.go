@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// explainCondition gives a heuristic explanation of why the condition
+// is not fully covered, with a hint for the missing test,
+// or returns "" if the condition is fully covered.
+//
+// The tests and their inputs are unknown, so the explanation is based
+// on the pattern of the condition, such as a comparison between
+// an error and nil, a boundary comparison or a type switch case.
+func explainCondition(cond condition, lenientErrors bool) string {
+	if fullyCovered(cond, lenientErrors) {
+		return ""
+	}
+
+	if cond.TrueCount == 0 && cond.FalseCount == 0 {
+		if cond.Func != "" {
+			return fmt.Sprintf("never evaluated: no test reaches this code; "+
+				"call %s from a test, directly or indirectly", cond.Func)
+		}
+		return "never evaluated: no test reaches this code"
+	}
+
+	// Since the condition was evaluated, exactly one outcome is missing.
+	outcome := cond.TrueCount == 0 && !cond.IgnoreTrue
+	branch := "false"
+	if outcome {
+		branch = "true"
+	}
+	return fmt.Sprintf("%s branch never taken: %s",
+		branch, explainOutcome(cond.Code, cond.ErrorCheck, outcome))
+}
+
+// explainOutcome describes what a test needs to provide
+// to make the condition evaluate to the missing outcome.
+func explainOutcome(code string, errorCheck bool, outcome bool) string {
+	generic := fmt.Sprintf("no test provides an input where %s is %v", code, outcome)
+
+	expr, err := parser.ParseExpr(code)
+	if err != nil {
+		return generic
+	}
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.X
+	}
+	bin, ok := expr.(*ast.BinaryExpr)
+	if !ok {
+		return generic
+	}
+
+	// The parsed expression starts at position 1.
+	text := func(e ast.Expr) string { return code[e.Pos()-1 : e.End()-1] }
+
+	op := bin.Op
+	if !outcome {
+		op = negatedComparison[op]
+	}
+
+	operand := bin.X
+	if isNilIdent(bin.X) {
+		operand = bin.Y
+	}
+
+	switch {
+	case errorCheck && op == token.NEQ:
+		return fmt.Sprintf("no test provides an input where %s is non-nil; "+
+			"add a test for the error path", text(operand))
+	case errorCheck && op == token.EQL:
+		return fmt.Sprintf("every test makes %s non-nil; "+
+			"add a test for the success path", text(operand))
+
+	case isNilIdent(bin.X) || isNilIdent(bin.Y):
+		if op == token.EQL {
+			return fmt.Sprintf("no test provides an input where %s is nil", text(operand))
+		}
+		if op == token.NEQ {
+			return fmt.Sprintf("no test provides an input where %s is non-nil", text(operand))
+		}
+
+	case isTypeSwitchTag(bin.X):
+		if op == token.EQL {
+			return fmt.Sprintf("no test provides an input where %s has type %s",
+				text(bin.X.(*ast.TypeAssertExpr).X), text(bin.Y))
+		}
+		if op == token.NEQ {
+			return fmt.Sprintf("every test provides a %s in %s; "+
+				"add a test with another type",
+				text(bin.Y), text(bin.X.(*ast.TypeAssertExpr).X))
+		}
+
+	case op == token.LSS, op == token.LEQ, op == token.GTR, op == token.GEQ:
+		return fmt.Sprintf("no test provides an input where %s %s %s; "+
+			"test the boundary at %s == %s",
+			text(bin.X), op, text(bin.Y), text(bin.X), text(bin.Y))
+
+	case op == token.EQL, op == token.NEQ:
+		return fmt.Sprintf("no test provides an input where %s %s %s",
+			text(bin.X), op, text(bin.Y))
+	}
+
+	return generic
+}
+
+// negatedComparison maps each comparison operator to its opposite.
+var negatedComparison = map[token.Token]token.Token{
+	token.EQL: token.NEQ,
+	token.NEQ: token.EQL,
+	token.LSS: token.GEQ,
+	token.LEQ: token.GTR,
+	token.GTR: token.LEQ,
+	token.GEQ: token.LSS,
+}
+
+// isTypeSwitchTag returns whether the expression has the form x.(type),
+// as in the conditions from the case clauses of a type switch.
+func isTypeSwitchTag(expr ast.Expr) bool {
+	ta, ok := expr.(*ast.TypeAssertExpr)
+	return ok && ta.Type == nil
+}
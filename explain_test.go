@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func Test_explainCondition(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(code string, errorCheck bool, trueCount, falseCount int, expected string) {
+		cond := condition{
+			Code:       code,
+			TrueCount:  trueCount,
+			FalseCount: falseCount,
+			Func:       "pkg.Func",
+			ErrorCheck: errorCheck,
+		}
+		s.CheckEquals(explainCondition(cond, false), expected)
+	}
+
+	test("x > 0", false, 1, 1,
+		"")
+	test("x > 0", false, 0, 0,
+		"never evaluated: no test reaches this code; "+
+			"call pkg.Func from a test, directly or indirectly")
+
+	test("err != nil", true, 0, 3,
+		"true branch never taken: no test provides an input where err is non-nil; "+
+			"add a test for the error path")
+	test("nil == err", true, 3, 0,
+		"false branch never taken: no test provides an input where err is non-nil; "+
+			"add a test for the error path")
+	test("err != nil", true, 3, 0,
+		"false branch never taken: every test makes err non-nil; "+
+			"add a test for the success path")
+
+	test("p == nil", false, 0, 1,
+		"true branch never taken: no test provides an input where p is nil")
+	test("(p == nil)", false, 1, 0,
+		"false branch never taken: no test provides an input where p is non-nil")
+
+	test("x > 0", false, 2, 0,
+		"false branch never taken: no test provides an input where x <= 0; "+
+			"test the boundary at x == 0")
+	test("len(s) < max", false, 0, 2,
+		"true branch never taken: no test provides an input where len(s) < max; "+
+			"test the boundary at len(s) == max")
+
+	test("v.(type) == int", false, 0, 1,
+		"true branch never taken: no test provides an input where v has type int")
+	test("v.(type) == *T", false, 1, 0,
+		"false branch never taken: every test provides a *T in v; "+
+			"add a test with another type")
+
+	test("s == \"\"", false, 1, 0,
+		"false branch never taken: no test provides an input where s != \"\"")
+
+	test("a && b", false, 0, 1,
+		"true branch never taken: no test provides an input where a && b is true")
+	test("ok", false, 1, 0,
+		"false branch never taken: no test provides an input where ok is false")
+}
+
+func Test_explainCondition__ignored(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	cond := condition{Code: "x > 0", FalseCount: 1, IgnoreTrue: true}
+	s.CheckEquals(explainCondition(cond, false), "")
+
+	cond = condition{Code: "err != nil", FalseCount: 1, ErrorCheck: true}
+	s.CheckEquals(explainCondition(cond, true), "")
+}
+
+func Test_gobcoMain__explain(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-explain", "-path-style=relative", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"parse.go:10:5: condition \"err != nil\" was once false but never true",
+		"    true branch never taken: no test provides an input where err is non-nil; " +
+			"add a test for the error path",
+		"parse.go:13:5: condition \"n < 0\" was once false but never true",
+		"    true branch never taken: no test provides an input where n < 0; " +
+			"test the boundary at n == 0",
+	})
+	s.CheckEquals(stderr, "")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// focusLocation is the location from -focus.
+type focusLocation struct {
+	file string
+	line int
+	col  int // Or 0 for any column.
+}
+
+// parseFocusLocation parses a location of the form "file:line"
+// or "file:line:col".
+func parseFocusLocation(location string) (*focusLocation, error) {
+	if file, line, col, ok := splitStart(location); ok && file != "" {
+		return &focusLocation{filepath.FromSlash(file), line, col}, nil
+	}
+
+	if colon := strings.LastIndexByte(location, ':'); colon > 0 {
+		if line, err := strconv.Atoi(location[colon+1:]); err == nil {
+			return &focusLocation{filepath.FromSlash(location[:colon]), line, 0}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("error: -focus must be file:line or file:line:col, not %q", location)
+}
+
+func (loc *focusLocation) String() string {
+	if loc.col == 0 {
+		return fmt.Sprintf("%s:%d", loc.file, loc.line)
+	}
+	return fmt.Sprintf("%s:%d:%d", loc.file, loc.line, loc.col)
+}
+
+// matchesFile returns whether the file of the condition is the file
+// of the location. A location without a directory matches the files
+// of that name in any directory.
+func (loc *focusLocation) matchesFile(filename string) bool {
+	if filepath.Base(loc.file) == loc.file {
+		return filepath.Base(filename) == loc.file
+	}
+	want, err1 := filepath.Abs(loc.file)
+	got, err2 := filepath.Abs(filename)
+	return err1 == nil && err2 == nil && want == got
+}
+
+func (loc *focusLocation) matches(cond condition) bool {
+	return loc.matchesFile(cond.File) && cond.Line == loc.line &&
+		(loc.col == 0 || cond.Col == loc.col)
+}
+
+// printFocus prints the conditions at the -focus location,
+// even if they are fully covered.
+// If there are none, it prints the nearest conditions of the same file
+// instead, and the run fails.
+func (g *gobco) printFocus(conds []condition) {
+	found := false
+	for _, cond := range conds {
+		if g.focus.matches(cond) {
+			g.printCondDetails(cond)
+			found = true
+		}
+	}
+	if found {
+		return
+	}
+
+	g.errf("error: there is no condition at %s", g.focus)
+	g.fail(exitError)
+
+	var nearest []condition
+	for _, cond := range conds {
+		if g.focus.matchesFile(cond.File) {
+			nearest = append(nearest, cond)
+		}
+	}
+	distance := func(cond condition) int {
+		if cond.Line < g.focus.line {
+			return g.focus.line - cond.Line
+		}
+		return cond.Line - g.focus.line
+	}
+	sort.SliceStable(nearest, func(i, j int) bool {
+		return distance(nearest[i]) < distance(nearest[j])
+	})
+	if len(nearest) > 3 {
+		nearest = nearest[:3]
+	}
+	if len(nearest) > 0 {
+		g.errf("The nearest conditions are:")
+	}
+	for _, cond := range nearest {
+		g.errf("%s: condition %q", g.location(cond.Start), g.displayCode(cond.Code))
+	}
+}
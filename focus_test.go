@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseFocusLocation(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(location string, expected *focusLocation, expectedErr string) {
+		loc, err := parseFocusLocation(location)
+		s.CheckEquals(loc, expected)
+		if expectedErr == "" {
+			s.CheckEquals(err, nil)
+		} else {
+			s.CheckEquals(err.Error(), expectedErr)
+		}
+	}
+
+	test("a.go:12", &focusLocation{"a.go", 12, 0}, "")
+	test("a.go:12:5", &focusLocation{"a.go", 12, 5}, "")
+	test("dir/a.go:12", &focusLocation{filepath.FromSlash("dir/a.go"), 12, 0}, "")
+	test("C:\\src\\a.go:12", &focusLocation{filepath.FromSlash("C:\\src\\a.go"), 12, 0}, "")
+
+	test("a.go", nil, "error: -focus must be file:line or file:line:col, not \"a.go\"")
+	test(":12", nil, "error: -focus must be file:line or file:line:col, not \":12\"")
+	test("a.go:line", nil, "error: -focus must be file:line or file:line:col, not \"a.go:line\"")
+}
+
+func Test_gobcoMain__focus(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The fully covered conditions are reported as well.
+	stdout, stderr := s.RunMain(0, "gobco", "-focus", "exported.go:8", "testdata/exported")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 11/20",
+		"testdata/exported/exported.go:8:9: condition \"x > 0\" was once true and once false",
+		"testdata/exported/exported.go:8:18: condition \"nonZero(x)\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-focus", "testdata/exported/exported.go:8:18", "testdata/exported")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 11/20",
+		"testdata/exported/exported.go:8:18: condition \"nonZero(x)\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(1, "gobco", "-focus", "exported.go:14", "testdata/exported")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 11/20",
+	})
+	s.CheckEquals(stderr, ""+
+		"error: there is no condition at exported.go:14\n"+
+		"The nearest conditions are:\n"+
+		"testdata/exported/exported.go:12:9: condition \"x != 0\"\n"+
+		"testdata/exported/exported.go:17:36: condition \"x > 0\"\n"+
+		"testdata/exported/exported.go:19:6: condition \"keep(x)\"\n")
+}
+
+func Test_gobco_parseCommandLine__focus(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-focus", "a.go", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(),
+		"error: -focus must be file:line or file:line:col, not \"a.go\"\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-focus", "a.go:3", "-format", "shields", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -focus requires -format text\n")
+}
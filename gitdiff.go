@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lineRange is a range of line numbers, both ends inclusive.
+type lineRange struct {
+	from, to int
+}
+
+// changedLines maps an absolute filename to the lines that changed in it.
+type changedLines map[string][]lineRange
+
+// contains returns whether the given line of the file has changed.
+// The filename may be relative to the current working directory.
+func (c changedLines) contains(filename string, line int) bool {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	for _, r := range c[abs] {
+		if r.from <= line && line <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// coverage counts the covered and the total outcomes
+// of the conditions on the changed lines.
+func (c changedLines) coverage(conds []condition, lenientErrors bool) (cnt, total int) {
+	for _, cond := range conds {
+		if c.contains(cond.File, cond.Line) {
+			cnt += coveredOutcomes(cond, lenientErrors)
+			total += countedOutcomes(cond)
+		}
+	}
+	return cnt, total
+}
+
+// gitChangedLines determines the lines that changed between the git ref
+// and the working tree, including untracked files.
+// The directories may be in different repositories or worktrees,
+// each of which is compared to its own version of the ref.
+func gitChangedLines(dirs []string, ref string) (changedLines, error) {
+	changed := changedLines{}
+	done := map[string]bool{}
+	for _, dir := range dirs {
+		root, err := runGit(dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("error: %q is not in a git repository", dir)
+		}
+		root = strings.TrimSpace(root)
+		if done[root] {
+			continue
+		}
+		done[root] = true
+
+		repoChanged, err := gitRepoChangedLines(root, ref)
+		if err != nil {
+			return nil, err
+		}
+		for filename, ranges := range repoChanged {
+			changed[filename] = append(changed[filename], ranges...)
+		}
+	}
+	return changed, nil
+}
+
+// gitRepoChangedLines determines the changed lines
+// in the git repository or worktree whose top-level directory is root.
+func gitRepoChangedLines(root, ref string) (changedLines, error) {
+	diff, err := runGit(root, "diff", "--unified=0", "--no-color",
+		"--no-ext-diff", "--find-renames", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("error: git diff %s in %s: %s", ref, root, err)
+	}
+	changed := parseGitDiff(root, diff)
+
+	// With -z, the filenames are neither quoted nor split at spaces.
+	untracked, err := runGit(root, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(untracked, "\x00") {
+		if name == "" {
+			continue
+		}
+		abs := filepath.Join(root, filepath.FromSlash(name))
+		changed[abs] = []lineRange{{1, int(^uint(0) >> 1)}}
+	}
+
+	return changed, nil
+}
+
+// parseGitDiff extracts the changed lines from the output of
+// 'git diff --unified=0', relative to the new version of each file.
+// Renamed files are recorded under their new name,
+// deleted files are skipped.
+func parseGitDiff(root, diff string) changedLines {
+	changed := changedLines{}
+
+	filename := ""
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "+++ ") {
+			filename = ""
+			if name := gitDiffFilename(line[4:]); strings.HasPrefix(name, "b/") {
+				rel := filepath.FromSlash(strings.TrimPrefix(name, "b/"))
+				filename = filepath.Join(root, rel)
+			}
+			continue
+		}
+
+		if filename == "" || !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+
+		// @@ -12,3 +15,4 @@ optional context
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+			continue
+		}
+		start, count := parseHunkRange(strings.TrimPrefix(fields[2], "+"))
+		if count > 0 {
+			changed[filename] = append(changed[filename],
+				lineRange{start, start + count - 1})
+		}
+	}
+
+	return changed
+}
+
+// gitDiffFilename returns the filename from the "+++ " line of a diff.
+// Git appends a tab to filenames that contain spaces,
+// and it quotes filenames that contain unusual characters.
+func gitDiffFilename(s string) string {
+	s = strings.TrimSuffix(s, "\t")
+	if strings.HasPrefix(s, "\"") {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+	}
+	return s
+}
+
+// parseHunkRange parses the "15,4" or "15" part of a hunk header.
+func parseHunkRange(s string) (start, count int) {
+	count = 1
+	if comma := strings.IndexByte(s, ','); comma >= 0 {
+		count, _ = strconv.Atoi(s[comma+1:])
+		s = s[:comma]
+	}
+	start, _ = strconv.Atoi(s)
+	return start, count
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	return string(output), err
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseGitDiff(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	diff := "" +
+		"diff --git a/changed.go b/changed.go\n" +
+		"index 1234567..89abcde 100644\n" +
+		"--- a/changed.go\n" +
+		"+++ b/changed.go\n" +
+		"@@ -3,0 +4,2 @@ func f() {\n" +
+		"+\tif x > 0 {\n" +
+		"+\t}\n" +
+		"@@ -10 +12 @@ func g() {\n" +
+		"-\treturn 1\n" +
+		"+\treturn 2\n" +
+		"@@ -20,2 +21,0 @@ func h() {\n" +
+		"-\tx++\n" +
+		"-\tx++\n" +
+		"diff --git a/old.go b/dir/new.go\n" +
+		"similarity index 90%\n" +
+		"rename from old.go\n" +
+		"rename to dir/new.go\n" +
+		"--- a/old.go\n" +
+		"+++ b/dir/new.go\n" +
+		"@@ -1 +1 @@\n" +
+		"-package old\n" +
+		"+package new\n" +
+		"diff --git a/added.go b/added.go\n" +
+		"new file mode 100644\n" +
+		"--- /dev/null\n" +
+		"+++ b/added.go\n" +
+		"@@ -0,0 +1,3 @@\n" +
+		"+package added\n" +
+		"+\n" +
+		"+var x = 1\n" +
+		"diff --git a/with space.go b/with space.go\n" +
+		"--- a/with space.go\t\n" +
+		"+++ b/with space.go\t\n" +
+		"@@ -2 +2 @@\n" +
+		"-var x = 1\n" +
+		"+var x = 2\n" +
+		"diff --git \"a/\\303\\244.go\" \"b/\\303\\244.go\"\n" +
+		"--- \"a/\\303\\244.go\"\n" +
+		"+++ \"b/\\303\\244.go\"\n" +
+		"@@ -2 +2 @@\n" +
+		"-var x = 1\n" +
+		"+var x = 2\n" +
+		"diff --git a/deleted.go b/deleted.go\n" +
+		"deleted file mode 100644\n" +
+		"--- a/deleted.go\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-package deleted\n"
+
+	root := filepath.FromSlash("/root")
+	changed := parseGitDiff(root, diff)
+
+	s.CheckEquals(changed, changedLines{
+		filepath.Join(root, "changed.go"):    {{4, 5}, {12, 12}},
+		filepath.Join(root, "dir", "new.go"): {{1, 1}},
+		filepath.Join(root, "added.go"):      {{1, 3}},
+		filepath.Join(root, "with space.go"): {{2, 2}},
+		filepath.Join(root, "\u00e4.go"):     {{2, 2}},
+	})
+	s.CheckEquals(changed.contains(filepath.Join(root, "changed.go"), 3), false)
+	s.CheckEquals(changed.contains(filepath.Join(root, "changed.go"), 4), true)
+	s.CheckEquals(changed.contains(filepath.Join(root, "changed.go"), 12), true)
+	s.CheckEquals(changed.contains(filepath.Join(root, "deleted.go"), 1), false)
+}
+
+func Test_changedLines_coverage(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+		{Start: "a.go:9:2", File: "a.go", Line: 9, Col: 2, Code: "z"},
+		{Start: "b.go:4:2", File: "b.go", Line: 4, Col: 2, Code: "w"},
+	}
+	abs, err := filepath.Abs("a.go")
+	s.CheckEquals(err, nil)
+	changed := changedLines{abs: {{4, 9}}}
+
+	cnt, total := changed.coverage(conds, false)
+
+	s.CheckEquals(cnt, 1)
+	s.CheckEquals(total, 4)
+}
+
+func Test_gobcoMain__diff_coverage(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.16\n",
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Pos(x int) bool { return x > 0 }\n",
+		"p_test.go": "" +
+			"package p\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestPos(t *testing.T) {\n" +
+			"\tPos(1)\n" +
+			"\tPos(0)\n" +
+			"\tNeg(1)\n" +
+			"}\n",
+		"neg.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Neg(x int) bool { return x < 0 }\n",
+	})
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=gobco", "-c", "user.email=gobco@example.org",
+		}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		s.CheckEquals(err, nil)
+		if err != nil {
+			t.Log(string(out))
+		}
+	}
+	git("init", "-q")
+	git("add", "go.mod", "p.go", "p_test.go")
+	git("commit", "-q", "-m", "initial")
+
+	// Only neg.go is new since HEAD, its condition is half covered.
+	stdout, stderr := s.RunMain(0, "gobco", "-diff-coverage", "HEAD", dir)
+
+	s.CheckEquals(s.GobcoLines(stdout)[:2], []string{
+		"Condition coverage: 3/4",
+		"Diff condition coverage: 1/2 (50.0%)",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__diff_base(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.16\n",
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Pos(x int) bool { return x > 0 }\n",
+		"p_test.go": "" +
+			"package p\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestPos(t *testing.T) {\n" +
+			"\tPos(1)\n" +
+			"\tPos(0)\n" +
+			"\tBig(1)\n" +
+			"\tNeg(1)\n" +
+			"}\n",
+	})
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=gobco", "-c", "user.email=gobco@example.org",
+		}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		s.CheckEquals(err, nil)
+		if err != nil {
+			t.Log(string(out))
+		}
+	}
+	git("init", "-q")
+	git("add", "go.mod", "p.go", "p_test.go")
+	git("commit", "-q", "-m", "initial")
+
+	// Since HEAD, a line was added to p.go, and the untracked file
+	// has a space in its name, which must not split it.
+	writeTree(t, dir, map[string]string{
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Pos(x int) bool { return x > 0 }\n" +
+			"\n" +
+			"func Big(x int) bool { return x > 100 }\n",
+		"new file.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Neg(x int) bool { return x < 0 }\n",
+	})
+
+	stdout, stderr := s.RunMain(0, "gobco", "-diff-base", "HEAD", dir)
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		filepath.Join(dir, "new file.go") + ":3:31: " +
+			"condition \"x < 0\" was once false but never true",
+		filepath.Join(dir, "p.go") + ":5:31: " +
+			"condition \"x > 100\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__diff_coverage_several_repositories(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// Each argument is in its own repository,
+	// whose changed lines must be counted as well.
+	newRepo := func(name string) string {
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{
+			"go.mod": "module example.com/" + name + "\n\ngo 1.16\n",
+			"p.go": "" +
+				"package " + name + "\n" +
+				"\n" +
+				"func Pos(x int) bool { return x > 0 }\n",
+			"p_test.go": "" +
+				"package " + name + "\n" +
+				"\n" +
+				"import \"testing\"\n" +
+				"\n" +
+				"func TestPos(t *testing.T) {\n" +
+				"\tPos(1)\n" +
+				"\tNeg(1)\n" +
+				"}\n",
+		})
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "go.mod", "p.go", "p_test.go"},
+			{"commit", "-q", "-m", "initial"},
+		} {
+			cmd := exec.Command("git", append([]string{
+				"-c", "user.name=gobco", "-c", "user.email=gobco@example.org",
+			}, args...)...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			s.CheckEquals(err, nil)
+			if err != nil {
+				t.Log(string(out))
+			}
+		}
+		writeTree(t, dir, map[string]string{
+			"neg.go": "" +
+				"package " + name + "\n" +
+				"\n" +
+				"func Neg(x int) bool { return x < 0 }\n",
+		})
+		return dir
+	}
+	a := newRepo("a")
+	b := newRepo("b")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-diff-coverage", "HEAD", a, b)
+
+	s.CheckEquals(s.GobcoLines(stdout)[:2], []string{
+		"Condition coverage: 4/8",
+		"Diff condition coverage: 2/4 (50.0%)",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-diff-base", "HEAD", a, b)
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		filepath.Join(a, "neg.go") + ":3:31: " +
+			"condition \"x < 0\" was once false but never true",
+		filepath.Join(b, "neg.go") + ":3:31: " +
+			"condition \"x < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gobcoIgnore lists the files that are never instrumented,
+// using the patterns from the .gobcoignore files.
+//
+// As with .gitignore, a .gobcoignore file applies to its directory
+// and all subdirectories, and the patterns from deeper directories
+// take precedence. The patterns follow the rules of .gitignore:
+// Blank lines and lines starting with '#' are skipped.
+// A leading '!' re-includes a file that was ignored by an earlier pattern.
+// A trailing '/' only matches directories.
+// A pattern containing a '/' other than at its end is matched
+// against the path relative to the directory of the .gobcoignore file,
+// other patterns are matched against the name of the file
+// or any of its parent directories.
+// The wildcard '**' matches any number of directories.
+type gobcoIgnore struct {
+	root     string // absolute
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	base     string // the directory of the .gobcoignore file, relative to root
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// loadGobcoIgnore reads the .gobcoignore files from root
+// and each directory below it, down to dir,
+// returning nil if there are no such files.
+func loadGobcoIgnore(root, dir string) (*gobcoIgnore, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil {
+		return nil, err
+	}
+
+	bases := []string{""}
+	if rel != "." {
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		for i := range segments {
+			bases = append(bases, strings.Join(segments[:i+1], "/"))
+		}
+	}
+
+	var patterns []ignorePattern
+	for _, base := range bases {
+		filename := filepath.Join(absRoot, filepath.FromSlash(base), ".gobcoignore")
+		content, err := os.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, parseIgnorePatterns(base, string(content))...)
+	}
+
+	if patterns == nil {
+		return nil, nil
+	}
+	return &gobcoIgnore{absRoot, patterns}, nil
+}
+
+func parseIgnorePatterns(base, content string) []ignorePattern {
+	var patterns []ignorePattern
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.glob = line
+		patterns = append(patterns, p)
+	}
+
+	return patterns
+}
+
+// ignores returns whether the file is excluded from the instrumentation.
+// The filename may be relative to the current working directory.
+// Files outside the directory of the .gobcoignore file are never ignored.
+func (ig *gobcoIgnore) ignores(filename string) bool {
+	if ig == nil {
+		return false
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(ig.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	// As in git, a file in an ignored directory cannot be re-included.
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		isDir := i < len(segments)-1
+		if ig.matches(strings.Join(segments[:i+1], "/"), isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns whether the last matching pattern ignores the path.
+func (ig *gobcoIgnore) matches(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range ig.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(rel, p.base+"/")
+		}
+		if !p.anchored {
+			name = path.Base(name)
+		}
+		if matchGlob(strings.Split(p.glob, "/"), strings.Split(name, "/")) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchGlob matches the segments of a path against the segments
+// of a pattern, in which '**' matches any number of segments.
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	m, err := path.Match(pattern[0], segments[0])
+	return err == nil && m && matchGlob(pattern[1:], segments[1:])
+}
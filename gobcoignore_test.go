@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_gobcoIgnore_ignores(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	root := t.TempDir()
+	write := func(rel, content string) {
+		filename := filepath.Join(root, filepath.FromSlash(rel))
+		s.CheckEquals(os.MkdirAll(filepath.Dir(filename), 0o777), nil)
+		s.CheckEquals(os.WriteFile(filename, []byte(content), 0o666), nil)
+	}
+	write(".gobcoignore", ""+
+		"# comment\n"+
+		"\n"+
+		"*_gen.go\n"+
+		"!keep_gen.go\n"+
+		"/main.go\n"+
+		"mock/\n"+
+		"internal/**/legacy.go\n")
+	write("pkg/.gobcoignore", ""+
+		"!table_gen.go\n"+
+		"local.go\n")
+
+	ig, err := loadGobcoIgnore(root, filepath.Join(root, "pkg"))
+	s.CheckEquals(err, nil)
+
+	test := func(rel string, expected bool) {
+		filename := filepath.Join(root, filepath.FromSlash(rel))
+		s.CheckEquals(ig.ignores(filename), expected)
+	}
+
+	test("calc.go", false)
+	test("calc_gen.go", true)
+	test("keep_gen.go", false)
+	test("pkg/calc_gen.go", true)
+	test("pkg/table_gen.go", false)
+	test("main.go", true)
+	test("cmd/main.go", false)
+	test("mock/db.go", true)
+	test("pkg/mock/db.go", true)
+	test("mock.go", false)
+	test("internal/legacy.go", true)
+	test("internal/a/b/legacy.go", true)
+	test("legacy.go", false)
+	test("pkg/local.go", true)
+	test("local.go", false)
+	test("../outside_gen.go", false)
+
+	// The patterns from pkg/.gobcoignore only apply to that directory,
+	// and only if it is on the way from the root to the package.
+	ig, err = loadGobcoIgnore(root, root)
+	s.CheckEquals(err, nil)
+	test("pkg/local.go", false)
+
+	// Without a .gobcoignore file, nothing is ignored.
+	ig, err = loadGobcoIgnore(filepath.Join(root, "pkg", "mock"), filepath.Join(root, "pkg", "mock"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(ig == nil, true)
+	test("pkg/mock/db.go", false)
+}
@@ -0,0 +1,136 @@
+// Package gobcosink passes the coverage counters from the code that
+// gobco instruments to a sink, which by default writes them to the file
+// from which gobco creates its report.
+//
+// The instrumented code imports this package on its own.
+// To process the counters in a different way, such as sending them
+// to a collector, a test installs a custom sink using Set.
+// Outside of gobco, the custom sink is never called.
+package gobcosink
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cond is an alias for an unnamed struct type,
+// so that it is identical to the type of the counters
+// in the instrumented code.
+type Cond = struct {
+	Start      string
+	File       string
+	Line       int
+	Col        int
+	Code       string
+	TrueCount  int
+	FalseCount int
+	Func       string
+	Depth      int
+	ID         string
+	ErrorCheck bool
+	// The outcomes that are excluded from the coverage by the
+	// //gobco:ignore-true and //gobco:ignore-false directives.
+	IgnoreTrue  bool
+	IgnoreFalse bool
+	// Either "true" or "false" for a condition that is constant
+	// at compile time.
+	Constant string
+	// The tests that evaluated the condition, sorted by name,
+	// see -attribute-tests.
+	Tests []string `json:",omitempty"`
+	// Where the condition ends, exclusively.
+	EndLine int `json:",omitempty"`
+	EndCol  int `json:",omitempty"`
+}
+
+// Sink receives the coverage counters whenever they are persisted,
+// which is at the end of the tests, after each evaluated condition
+// with -immediately, and periodically with -flush-interval.
+// The counters always contain the counts of the whole run.
+type Sink interface {
+	Persist(conds []Cond) error
+}
+
+var (
+	mu      sync.Mutex
+	custom  Sink
+	current Sink
+)
+
+// Set installs a custom sink, which replaces the default sink.
+// To still get the gobco report, the custom sink passes the counters
+// on to Default.
+func Set(sink Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	custom = sink
+}
+
+// Default returns the sink that writes the counters to the file
+// from which gobco creates its report.
+func Default() Sink {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current == nil {
+		return FileSink{Filename: os.Getenv("GOBCO_STATS")}
+	}
+	return current
+}
+
+// Persist passes the counters to the custom sink, if any,
+// and otherwise to def, which then becomes the Default.
+// It is called by the instrumented code.
+func Persist(conds []Cond, def Sink) error {
+	mu.Lock()
+	current = def
+	sink := custom
+	mu.Unlock()
+
+	if sink == nil {
+		sink = def
+	}
+	return sink.Persist(conds)
+}
+
+// FileSink writes the counters as JSON to a file.
+type FileSink struct {
+	Filename string
+	// Whether to write the JSON without indentation, see -stats-compact.
+	Compact bool
+}
+
+func (s FileSink) Persist(conds []Cond) (err error) {
+	if err := os.MkdirAll(filepath.Dir(s.Filename), 0o777); err != nil {
+		return err
+	}
+
+	// TODO: First write to a temporary file.
+	file, err := os.Create(s.Filename)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	buf := bufio.NewWriter(file)
+
+	encoder := json.NewEncoder(buf)
+	if !s.Compact {
+		encoder.SetIndent("", "\t")
+	}
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(conds); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
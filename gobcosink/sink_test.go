@@ -0,0 +1,84 @@
+package gobcosink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type recorder struct{ conds []Cond }
+
+func (r *recorder) Persist(conds []Cond) error {
+	r.conds = conds
+	return nil
+}
+
+func TestFileSink_Persist(t *testing.T) {
+	test := func(compact bool, expected string) {
+		filename := filepath.Join(t.TempDir(), "sub", "stats.json")
+		conds := []Cond{{Start: "a.go:1:2", Code: "a < b", TrueCount: 1}}
+
+		if err := (FileSink{Filename: filename, Compact: compact}).Persist(conds); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("got %q, want %q", content, expected)
+		}
+	}
+
+	test(true, ""+
+		`[{"Start":"a.go:1:2","File":"","Line":0,"Col":0,"Code":"a < b",`+
+		`"TrueCount":1,"FalseCount":0,"Func":"","Depth":0,"ID":"",`+
+		`"ErrorCheck":false,"IgnoreTrue":false,"IgnoreFalse":false,"Constant":""}]`+"\n")
+	test(false, ""+
+		"[\n"+
+		"\t{\n"+
+		"\t\t\"Start\": \"a.go:1:2\",\n"+
+		"\t\t\"File\": \"\",\n"+
+		"\t\t\"Line\": 0,\n"+
+		"\t\t\"Col\": 0,\n"+
+		"\t\t\"Code\": \"a < b\",\n"+
+		"\t\t\"TrueCount\": 1,\n"+
+		"\t\t\"FalseCount\": 0,\n"+
+		"\t\t\"Func\": \"\",\n"+
+		"\t\t\"Depth\": 0,\n"+
+		"\t\t\"ID\": \"\",\n"+
+		"\t\t\"ErrorCheck\": false,\n"+
+		"\t\t\"IgnoreTrue\": false,\n"+
+		"\t\t\"IgnoreFalse\": false,\n"+
+		"\t\t\"Constant\": \"\"\n"+
+		"\t}\n"+
+		"]\n")
+}
+
+func TestPersist(t *testing.T) {
+	defer Set(nil)
+
+	def := &recorder{}
+	conds := []Cond{{Code: "a"}}
+
+	if err := Persist(conds, def); err != nil {
+		t.Fatal(err)
+	}
+	if len(def.conds) != 1 {
+		t.Errorf("without a custom sink, the default sink must be called")
+	}
+	if Default() != Sink(def) {
+		t.Errorf("the default sink must be the one from the last call")
+	}
+
+	custom := &recorder{}
+	def.conds = nil
+	Set(custom)
+	if err := Persist(conds, def); err != nil {
+		t.Fatal(err)
+	}
+	if len(custom.conds) != 1 || def.conds != nil {
+		t.Errorf("with a custom sink, only the custom sink must be called")
+	}
+}
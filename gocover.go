@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// writeGoCoverProfile writes the conditions in the format of the
+// coverage profiles from 'go test -coverprofile',
+// so that 'go tool cover -html' can show them.
+//
+// The mapping is lossy: each condition becomes a block that spans
+// the code of the condition and counts as a single statement.
+// The block is covered if all counted outcomes of the condition
+// were reached, otherwise it is uncovered.
+func writeGoCoverProfile(w io.Writer, conds []condition, lenientErrors bool) error {
+	if _, err := io.WriteString(w, "mode: set\n"); err != nil {
+		return err
+	}
+
+	for _, cond := range conds {
+		filename, line, col := cond.File, cond.Line, cond.Col
+		if filename == "" {
+			continue
+		}
+
+		// The tool locates relative file names via their import path,
+		// which is not known here.
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+
+		// Stats files from older versions of gobco don't record
+		// where the condition ends, so estimate it from the code,
+		// which may differ from the source code in its whitespace.
+		endLine, endCol := cond.EndLine, cond.EndCol
+		if endLine == 0 {
+			endLine, endCol = line, col+len(cond.Code)
+			if nl := strings.Count(cond.Code, "\n"); nl > 0 {
+				endLine += nl
+				endCol = len(cond.Code) - strings.LastIndexByte(cond.Code, '\n')
+			}
+		}
+
+		count := 0
+		if fullyCovered(cond, lenientErrors) {
+			count = 1
+		}
+
+		_, err = fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n",
+			filepath.ToSlash(abs), line, col, endLine, endCol, count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeStatementProfiles combines the statement coverage profiles
+// from the 'go test -coverprofile' run of each package into a single
+// profile, as for -go-cover.
+//
+// Since the instrumentation keeps the line and column numbers
+// of the original code, the blocks apply to the original files.
+// The blocks from the files that gobco adds to each package
+// are left out, as they would distort the coverage.
+// The profiles of packages whose tests did not run are missing.
+func mergeStatementProfiles(w io.Writer, filenames []string) error {
+	mode := ""
+	var blocks []string
+	for _, filename := range filenames {
+		content, err := os.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "mode: ") {
+				if mode == "" {
+					mode = line
+				}
+				continue
+			}
+			if colon := strings.LastIndexByte(line, ':'); colon > 0 {
+				if strings.HasPrefix(path.Base(line[:colon]), "gobco_") {
+					continue
+				}
+			}
+			if line != "" {
+				blocks = append(blocks, line)
+			}
+		}
+	}
+
+	if mode == "" {
+		mode = "mode: set"
+	}
+	var sb strings.Builder
+	sb.WriteString(mode + "\n")
+	for _, block := range blocks {
+		sb.WriteString(block + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_writeGoCoverProfile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+		{Start: "a.go:5:9", File: "a.go", Line: 5, Col: 9, Code: "y", TrueCount: 1, IgnoreFalse: true},
+		{Start: "a.go:7:2", File: "a.go", Line: 7, Col: 2, Code: "a &&\n\t\tbc"},
+		{Start: "a.go:9:5", File: "a.go", Line: 9, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1, EndLine: 10, EndCol: 3},
+	}
+
+	var sb strings.Builder
+	err := writeGoCoverProfile(&sb, conds, false)
+
+	abs, _ := filepath.Abs("a.go")
+	s.CheckEquals(err, nil)
+	s.CheckEquals(strings.Replace(sb.String(), filepath.ToSlash(abs), "ABS", -1), ""+
+		"mode: set\n"+
+		"ABS:3.5,3.10 1 1\n"+
+		"ABS:4.9,4.10 1 0\n"+
+		"ABS:5.9,5.10 1 1\n"+
+		"ABS:7.2,8.5 1 0\n"+
+		"ABS:9.5,10.3 1 1\n")
+}
+
+func Test_gobcoMain__format_gocover(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	profile := filepath.Join(t.TempDir(), "cover.out")
+	s.RunMain(0, "gobco", "-format", "gocover", "-output", profile, "testdata/oddeven")
+
+	// The profile can be read by the standard tool.
+	out, err := exec.Command("go", "tool", "cover", "-func", profile).CombinedOutput()
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(out), "odd.go:3:\tIsOdd\t\t0.0%\n")
+
+	content, err := os.ReadFile(profile)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "mode: set\n")
+}
+
+func Test_gobco_parseCommandLine__format_gocover_without_output(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-format", "gocover", "pkg"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -format gocover requires -output, "+
+		"to keep the output of 'go test' out of the profile\n")
+}
+
+func Test_mergeStatementProfiles(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.out": "" +
+			"mode: count\n" +
+			"example.com/a/gobco_fixed.go:87.2,89.1 3 0\n" +
+			"example.com/a/a.go:4.2,5.1 1 7\n",
+		"b.out": "" +
+			"mode: count\n" +
+			"example.com/b/b.go:9.2,10.16 2 1\n" +
+			"example.com/b/gobco_variable.go:3.2,4.1 1 1\n",
+	})
+
+	var sb strings.Builder
+	err := mergeStatementProfiles(&sb, []string{
+		filepath.Join(dir, "a.out"),
+		filepath.Join(dir, "missing.out"),
+		filepath.Join(dir, "b.out"),
+	})
+
+	s.CheckEquals(err, nil)
+	s.CheckEquals(sb.String(), ""+
+		"mode: count\n"+
+		"example.com/a/a.go:4.2,5.1 1 7\n"+
+		"example.com/b/b.go:9.2,10.16 2 1\n")
+}
+
+func Test_gobcoMain__go_cover(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	profile := filepath.Join(t.TempDir(), "cover.out")
+	stdout, _ := s.RunMain(0, "gobco", "-go-cover", profile,
+		"testdata/oddeven", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 2/6")
+
+	// The statement coverage of both packages is in the profile,
+	// without the files that gobco added to the packages.
+	content, err := os.ReadFile(profile)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(strings.Contains(string(content), "gobco_"), false)
+	s.CheckContains(string(content), "mode: set\n")
+
+	out, err := exec.Command("go", "tool", "cover", "-func", profile).CombinedOutput()
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(out), "testdata/oddeven/odd.go:3:\tIsOdd\t\t0.0%\n")
+	s.CheckContains(string(out), "testdata/lenient/parse.go:")
+}
+
+func Test_gobco_parseCommandLine__go_cover_with_coverprofile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-go-cover", "a.out",
+				"-test", "-coverprofile=b.out", "pkg"})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -go-cover cannot be combined with -test -coverprofile, "+
+		"as both write the profile\n")
+}
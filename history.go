@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// historyRecord is a single line in the -append-history file,
+// which tracks the coverage over time, one record per run.
+type historyRecord struct {
+	Timestamp string  `json:"timestamp"`
+	Commit    string  `json:"commit"`
+	Covered   int     `json:"covered"`
+	Total     int     `json:"total"`
+	Percent   float64 `json:"percent"`
+}
+
+func newHistoryRecord(now time.Time, commit string, covered, total int) historyRecord {
+	return historyRecord{
+		now.UTC().Format(time.RFC3339),
+		commit,
+		covered,
+		total,
+		coveragePercent(covered, total),
+	}
+}
+
+// coveragePercent returns the percentage, rounded down to 0.1,
+// so that 99.95% doesn't look like full coverage.
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(1000*covered/total) / 10
+}
+
+// recordHistory appends the coverage of this run to the -append-history
+// file and optionally prints how the coverage developed.
+func (g *gobco) recordHistory(covered, total int) {
+	// Outside a git repository, the commit stays empty.
+	commit, _ := runGit(g.args[0].argDir, "rev-parse", "HEAD")
+	record := newHistoryRecord(time.Now(), strings.TrimSpace(commit), covered, total)
+	g.check(appendHistory(g.historyFilename, record))
+
+	if g.historySummary {
+		records, err := loadHistory(g.historyFilename)
+		g.check(err)
+		g.outf("")
+		g.outf("%s", summarizeHistory(records))
+	}
+}
+
+// appendHistory appends the record to the newline-delimited JSON file.
+func appendHistory(filename string, record historyRecord) (err error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// loadHistory reads all records from the history file.
+func loadHistory(filename string) ([]historyRecord, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var record historyRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineno, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// historySummaryRuns is the number of recent runs in the history summary.
+const historySummaryRuns = 20
+
+// summarizeHistory describes how the coverage developed
+// during the most recent runs, for example:
+//
+//	Coverage history: ▁▂▅█ 61.2% -> 75.0% (+13.8) over the last 4 runs
+func summarizeHistory(records []historyRecord) string {
+	if len(records) > historySummaryRuns {
+		records = records[len(records)-historySummaryRuns:]
+	}
+	if len(records) == 0 {
+		return "Coverage history: no runs yet"
+	}
+
+	var percents []float64
+	for _, record := range records {
+		percents = append(percents, record.Percent)
+	}
+	first, last := percents[0], percents[len(percents)-1]
+
+	runs := "the last run"
+	if len(records) > 1 {
+		runs = fmt.Sprintf("the last %d runs", len(records))
+	}
+	return fmt.Sprintf("Coverage history: %s %.1f%% -> %.1f%% (%+.1f) over %s",
+		sparkline(percents), first, last, last-first, runs)
+}
+
+// sparkline draws the values as a sequence of bars,
+// scaled from the lowest to the highest value.
+func sparkline(values []float64) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		idx := len(bars) / 2
+		if max > min {
+			idx = int((v - min) / (max - min) * float64(len(bars)-1))
+		}
+		sb.WriteRune(bars[idx])
+	}
+	return sb.String()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_newHistoryRecord(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("", 3600))
+
+	s.CheckEquals(newHistoryRecord(now, "abc123", 2, 3),
+		historyRecord{"2024-03-01T11:30:00Z", "abc123", 2, 3, 66.6})
+	s.CheckEquals(newHistoryRecord(now, "", 0, 0),
+		historyRecord{"2024-03-01T11:30:00Z", "", 0, 0, 100})
+}
+
+func Test_appendHistory(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	filename := filepath.Join(t.TempDir(), "history.jsonl")
+	first := historyRecord{"2024-03-01T11:30:00Z", "abc123", 2, 4, 50}
+	second := historyRecord{"2024-03-02T11:30:00Z", "def456", 3, 4, 75}
+
+	s.CheckEquals(appendHistory(filename, first), nil)
+	s.CheckEquals(appendHistory(filename, second), nil)
+
+	content, err := os.ReadFile(filename)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(content), ""+
+		"{\"timestamp\":\"2024-03-01T11:30:00Z\",\"commit\":\"abc123\","+
+		"\"covered\":2,\"total\":4,\"percent\":50}\n"+
+		"{\"timestamp\":\"2024-03-02T11:30:00Z\",\"commit\":\"def456\","+
+		"\"covered\":3,\"total\":4,\"percent\":75}\n")
+
+	records, err := loadHistory(filename)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(records, []historyRecord{first, second})
+}
+
+func Test_loadHistory__invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	filename := filepath.Join(t.TempDir(), "history.jsonl")
+	writeTree(t, filepath.Dir(filename), map[string]string{
+		"history.jsonl": "{\"covered\":1}\n\nnot json\n",
+	})
+
+	_, err := loadHistory(filename)
+	s.CheckEquals(err.Error(),
+		filename+":3: invalid character 'o' in literal null (expecting 'u')")
+}
+
+func Test_summarizeHistory(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	records := func(percents ...float64) []historyRecord {
+		var result []historyRecord
+		for _, percent := range percents {
+			result = append(result, historyRecord{Percent: percent})
+		}
+		return result
+	}
+
+	s.CheckEquals(summarizeHistory(nil),
+		"Coverage history: no runs yet")
+	s.CheckEquals(summarizeHistory(records(50)),
+		"Coverage history: ▅ 50.0% -> 50.0% (+0.0) over the last run")
+	s.CheckEquals(summarizeHistory(records(61.2, 65, 70, 75)),
+		"Coverage history: ▁▂▅█ 61.2% -> 75.0% (+13.8) over the last 4 runs")
+	s.CheckEquals(summarizeHistory(records(80, 70)),
+		"Coverage history: █▁ 80.0% -> 70.0% (-10.0) over the last 2 runs")
+
+	// Only the most recent runs are summarized.
+	var many []float64
+	for i := 0; i < 30; i++ {
+		many = append(many, float64(i))
+	}
+	s.CheckEquals(summarizeHistory(records(many...)),
+		"Coverage history: ▁▁▁▂▂▂▃▃▃▄▄▅▅▅▆▆▆▇▇█ 10.0% -> 29.0% (+19.0) over the last 20 runs")
+}
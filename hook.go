@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// finishReport is the JSON document that the -on-finish command
+// reads from its stdin.
+type finishReport struct {
+	Kind       string            `json:"kind"` // "condition" or "branch"
+	Covered    int               `json:"covered"`
+	Total      int               `json:"total"`
+	Percent    float64           `json:"percent"`
+	ExitCode   int               `json:"exitCode"`
+	Conditions []conditionReport `json:"conditions"`
+}
+
+func newFinishReport(branch bool, conds []condition, lenientErrors bool) *finishReport {
+	kind := "condition"
+	if branch {
+		kind = "branch"
+	}
+
+	covered, total := 0, 0
+	reports := []conditionReport{}
+	for _, cond := range conds {
+		covered += coveredOutcomes(cond, lenientErrors)
+		total += countedOutcomes(cond)
+		reports = append(reports, newConditionReport(cond, lenientErrors))
+	}
+
+	percent := coveragePercent(covered, total)
+	return &finishReport{kind, covered, total, percent, 0, reports}
+}
+
+// runOnFinish runs the -on-finish command, passing it the coverage
+// in the environment and the complete report on stdin.
+// If the command fails, gobco fails as well,
+// otherwise the exit code of gobco stays the same.
+func (g *gobco) runOnFinish() {
+	if g.onFinish == "" || g.finishReport == nil {
+		return
+	}
+
+	report := *g.finishReport
+	report.ExitCode = g.exitCode
+	stdin, err := json.Marshal(report)
+	g.check(err)
+
+	// The command has already been checked in parseCommandLine.
+	args, _ := splitOptions(g.onFinish)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = g.stdout
+	cmd.Stderr = g.stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("GOBCO_COVERED=%d", report.Covered),
+		fmt.Sprintf("GOBCO_TOTAL=%d", report.Total),
+		fmt.Sprintf("GOBCO_PERCENT=%.1f", report.Percent),
+		fmt.Sprintf("GOBCO_EXIT=%d", report.ExitCode))
+
+	g.debugf("Running %q", g.onFinish)
+	if err := cmd.Run(); err != nil {
+		g.warnf("gobco: the -on-finish command failed: %s", err)
+		g.fail(exitError)
+	}
+}
+
+// runBefore runs the -before command, which prepares the resources
+// that the tests need, such as a database.
+// If the command fails, the tests are not run.
+func (g *gobco) runBefore() bool {
+	g.mu.Lock()
+	g.afterPending = g.after != ""
+	g.mu.Unlock()
+
+	if g.before == "" {
+		return true
+	}
+	if err := g.runHook(g.before); err != nil {
+		g.errf("error: the -before command failed: %s", err)
+		g.fail(exitError)
+		return false
+	}
+	return true
+}
+
+// runAfter runs the -after command, which releases the resources
+// from the -before command.
+// Like a deferred call, it also runs if the tests or the -before command
+// fail or if gobco is interrupted, but only once.
+func (g *gobco) runAfter() {
+	g.mu.Lock()
+	pending := g.afterPending
+	g.afterPending = false
+	g.mu.Unlock()
+	if !pending {
+		return
+	}
+
+	if err := g.runHook(g.after); err != nil {
+		g.warnf("gobco: the -after command failed: %s", err)
+		g.fail(exitError)
+	}
+}
+
+// runHook runs the command in the original working directory,
+// sharing the output with gobco.
+func (g *gobco) runHook(command string) error {
+	// The command has already been checked in parseCommandLine.
+	args, _ := splitOptions(command)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = g.stdout
+	cmd.Stderr = g.stderr
+
+	g.debugf("Running %q", command)
+	return cmd.Run()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func Test_newFinishReport(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:2:1", File: "a.go", Line: 2, Col: 1, Code: "y > 0", FalseCount: 3},
+		{Start: "a.go:3:1", File: "a.go", Line: 3, Col: 1, Code: "z > 0"},
+	}
+
+	report := newFinishReport(true, conds, false)
+
+	s.CheckEquals(report.Kind, "branch")
+	s.CheckEquals(report.Covered, 3)
+	s.CheckEquals(report.Total, 6)
+	s.CheckEquals(report.Percent, 50.0)
+	s.CheckEquals(len(report.Conditions), 3)
+	s.CheckEquals(report.Conditions[1].Description, "was 3 times false but never true")
+
+	empty := newFinishReport(false, nil, false)
+	s.CheckEquals(empty.Kind, "condition")
+	s.CheckEquals(empty.Percent, 100.0)
+
+	// An empty list is more convenient for the command than null.
+	js, err := json.Marshal(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckEquals(string(js), ""+
+		`{"kind":"condition","covered":0,"total":0,"percent":100,`+
+		`"exitCode":0,"conditions":[]}`)
+}
+
+func Test_gobcoMain__on_finish(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	script := "echo \"$GOBCO_COVERED/$GOBCO_TOTAL $GOBCO_PERCENT $GOBCO_EXIT\"; cat > " + report
+
+	stdout, stderr := s.RunMain(6, "gobco", "-on-finish", "sh -c '"+script+"'", "testdata/failing")
+
+	s.CheckEquals(s.GobcoLines(stdout)[3], "5/8 62.5 6")
+	s.CheckNotContains(stderr, "-on-finish")
+
+	content, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded finishReport
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	s.CheckEquals(decoded.Covered, 5)
+	s.CheckEquals(decoded.ExitCode, 6)
+	s.CheckEquals(len(decoded.Conditions), 4)
+}
+
+func Test_gobcoMain__on_finish_failing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(1, "gobco", "-on-finish", "sh -c 'exit 3'", "testdata/lenient")
+
+	s.CheckContains(stderr, "gobco: the -on-finish command failed: exit status 3\n")
+}
+
+func Test_gobco_parseCommandLine__on_finish_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-on-finish", "'unclosed"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -on-finish requires a command, not \"'unclosed\"\n")
+}
+
+func Test_gobcoMain__before_after(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	log := filepath.Join(t.TempDir(), "log")
+	before := "sh -c 'echo before >> " + log + "'"
+	after := "sh -c 'echo after >> " + log + "'"
+
+	// The -after command runs even if the tests fail.
+	stdout, _ := s.RunMain(6, "gobco", "-before", before, "-after", after, "testdata/failing")
+
+	s.CheckContains(stdout, "Condition coverage: 5/8\n")
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckEquals(string(content), "before\nafter\n")
+}
+
+func Test_gobcoMain__before_failing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	log := filepath.Join(t.TempDir(), "log")
+	after := "sh -c 'echo after >> " + log + "'"
+
+	stdout, stderr := s.RunMain(1, "gobco", "-before", "sh -c 'exit 3'", "-after", after, "testdata/lenient")
+
+	s.CheckNotContains(stdout, "Condition coverage")
+	s.CheckContains(stderr, "error: the -before command failed: exit status 3\n")
+
+	// The -after command cleans up what the -before command
+	// may have started before it failed.
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckEquals(string(content), "after\n")
+}
+
+func Test_gobco_parseCommandLine__before_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-before", "'unclosed"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -before requires a command, not \"'unclosed\"\n")
+}
@@ -5,24 +5,52 @@ import (
 	"fmt"
 	"go/ast"
 	"go/build"
+	"go/constant"
+	"go/format"
 	"go/importer"
 	"go/parser"
 	"go/printer"
 	"go/token"
 	"go/types"
+	"hash/fnv"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
-	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // cond is a condition from the code that is instrumented.
 type cond struct {
-	pos  string // for example "main.go:17:13"
-	text string // for example "i > 0"
+	pos   string         // for example "main.go:17:13"
+	start token.Position // the same as pos, in structured form
+	end   token.Position // where the condition ends, exclusively
+	text  string         // for example "i > 0"
+	fn    string         // for example "(*T).Method", or "" outside functions
+	// The number of control flow statements that enclose the condition,
+	// including the statement that the condition controls.
+	depth int
+	// Whether the condition compares an error to nil, such as 'err != nil'.
+	errorCheck bool
+	// The outcomes that are excluded from the coverage,
+	// from a //gobco:ignore-true or //gobco:ignore-false directive.
+	ignored ignoredOutcomes
+	// Either "true" or "false" if the condition is a constant expression
+	// that is evaluated at compile time, such as 'debug && x > 0'
+	// with 'const debug = false'.
+	constant string
+}
+
+// ignoredOutcomes are the outcomes of a condition
+// that are legitimately unreachable.
+type ignoredOutcomes struct {
+	ifTrue  bool
+	ifFalse bool
 }
 
 // exprSubst prepares to later replace '*ref' with 'expr'.
@@ -30,6 +58,7 @@ type exprSubst struct {
 	ref  *ast.Expr
 	expr ast.Expr
 	pos  token.Pos
+	end  token.Pos
 	text string
 }
 
@@ -40,11 +69,58 @@ type instrumenter struct {
 	coverTest   bool // also cover the test code
 	immediately bool // persist counts after each increment
 	listAll     bool // also list conditions that are covered
+	compact     bool // write the stats file without indentation
+	strictJSON  bool // fail on unknown fields in the stats file
 	debugTypes  bool
 
+	// Also collect the conditions from the files
+	// that are excluded from the build by build constraints.
+	allFiles bool
+	// The build tags from the options for 'go test',
+	// which decide which files are built.
+	buildTags []string
+
+	// Whether the test functions record their names
+	// in the conditions they evaluate, see -attribute-tests.
+	attributeTests bool
+
+	// If positive, the tests persist the counters at this interval,
+	// see -flush-interval.
+	flushInterval time.Duration
+
+	// If non-nil, the differences between the original and the
+	// instrumented code of each file are written to this writer.
+	diffOut io.Writer
+
+	// If non-nil, only the conditions in these lines are instrumented.
+	changed changedLines
+	// If non-zero, only the files modified after this time are instrumented.
+	since time.Time
+	// Whether to skip the conditions in unexported functions.
+	exportedOnly bool
+	// Whether to skip the conditions in the function main of package main.
+	skipMain bool
+	// If positive, the files with more conditions are not instrumented.
+	maxConds int
+	// The kinds of conditions to instrument, see conditionKinds.
+	// If nil, all kinds are instrumented.
+	kinds map[string]bool
+	// The files from .gobcoignore, which are left as they are.
+	ignore *gobcoIgnore
+
+	// For the -cover-deps option, the import path of the generated
+	// registry package, through which the instrumented dependencies
+	// make their counters available to the package under test.
+	registry string
+	// The import path under which a dependency registers its counters.
+	registerAs string
+	// The dependencies whose counters the package under test collects.
+	deps []string
+
 	fset *token.FileSet
 	pkg  map[*ast.Package]*types.Package
 	typ  map[ast.Expr]types.Type
+	val  map[ast.Expr]constant.Value
 
 	// While instrumenting of a file, the current package.
 	typePkg *types.Package
@@ -72,26 +148,113 @@ type instrumenter struct {
 
 	hasTestMain bool
 
+	// The top-level functions of the file that is currently instrumented.
+	funcs []*ast.FuncDecl
+	// The control flow statements of the file that is currently instrumented,
+	// recorded before the file is modified.
+	controls []ast.Node
+	// The outcomes to ignore in the file that is currently instrumented,
+	// by the line in which the conditions start.
+	ignored map[int]ignoredOutcomes
+	// The identifiers of the file that is currently instrumented,
+	// which the generated variables must not shadow.
+	idents map[string]bool
+
 	// The conditions from the original code that were instrumented,
 	// from all files from fset.
 	conds []cond
+
+	// The files in which the conditions were instrumented.
+	files []string
+	// The files that were not instrumented since they have too many
+	// conditions, see maxConds.
+	skipped []skippedFile
+	// A file from the package that gobco generated in an earlier run,
+	// which means that the package is already instrumented.
+	generated string
+	// The declarations from the original code whose names
+	// collide with those of the code that gobco adds,
+	// in the form "file:line:col: name".
+	clashes []string
+	// The files whose instrumented code could not be printed,
+	// which stay as they were copied.
+	unprintable []unprintableFile
+	// The files of the package under test that were not instrumented,
+	// together with the reason, see -report-skipped.
+	uninstrumented []uninstrumentedFile
+}
+
+type skippedFile struct {
+	filename string
+	conds    int
+}
+
+type unprintableFile struct {
+	filename string
+	err      error
+}
+
+type uninstrumentedFile struct {
+	filename string
+	reason   string // See skipReasons.
+}
+
+// skipReasons describes why a file was not instrumented,
+// by the reason code.
+var skipReasons = map[string]string{
+	"gobcoignore":       "matched by .gobcoignore",
+	"since":             "not modified within -since",
+	"build-constraints": "excluded by the build constraints",
+	"ignore-tag":        "excluded by the build tag ignore",
+	"max-conditions":    "more conditions than -max-conditions",
+	"unprintable":       "the instrumented code could not be printed",
+}
+
+// skip records that the file from the package under test
+// is not instrumented.
+func (i *instrumenter) skip(filename, reason string) {
+	if !strings.HasSuffix(filename, "_test.go") {
+		i.uninstrumented = append(i.uninstrumented, uninstrumentedFile{filename, reason})
+	}
 }
 
 // instrument modifies the code of the Go package from srcDir
 // by adding counters for code coverage,
 // writing the instrumented code to dstDir.
 // If singleFile is given, only that file is instrumented.
+// If dstDir is empty, the conditions are only collected in i.conds.
 func (i *instrumenter) instrument(srcDir, singleFile, dstDir string) bool {
 	i.fset = token.NewFileSet()
 
+	// Files with the build tag 'ignore' are not part of the package,
+	// they stay in dstDir as copied, without being instrumented.
+	// The files that gobco generated in an earlier run
+	// must not be instrumented again.
 	isRelevant := func(info os.FileInfo) bool {
-		return singleFile == "" || info.Name() == singleFile
+		filename := filepath.Join(srcDir, info.Name())
+		if isGeneratedByGobco(filename) {
+			if i.generated == "" {
+				i.generated = filename
+			}
+			return false
+		}
+		if singleFile != "" && info.Name() != singleFile {
+			return false
+		}
+		if isIgnored(filename) {
+			i.skip(filename, "ignore-tag")
+			return false
+		}
+		return true
 	}
 
 	// Comments are needed for build tags
 	// such as '//go:build 386' or '//go:embed'.
 	mode := parser.ParseComments
 	pkgsMap, err := parser.ParseDir(i.fset, srcDir, isRelevant, mode)
+	if i.generated != "" {
+		return false // see checkGeneratedCode
+	}
 	i.resolveTypes(pkgsMap)
 	ok(err)
 
@@ -99,6 +262,7 @@ func (i *instrumenter) instrument(srcDir, singleFile, dstDir string) bool {
 	if len(pkgs) == 0 {
 		return false
 	}
+	i.findClashes(pkgs)
 
 	for _, pkg := range pkgs {
 		forEachFile(pkg, func(name string, file *ast.File) {
@@ -106,12 +270,54 @@ func (i *instrumenter) instrument(srcDir, singleFile, dstDir string) bool {
 			i.instrumentFile(name, file, dstDir)
 		})
 	}
-	i.writeGobcoFiles(srcDir, dstDir, pkgs)
+	if dstDir != "" {
+		i.writeGobcoFiles(srcDir, dstDir, pkgs)
+	}
 	return true
 }
 
+// emit writes the instrumented code of the file to w, gofmt-formatted,
+// without writing any files. The other files of the package are only
+// needed for resolving the types.
+func (i *instrumenter) emit(filename string, w io.Writer) error {
+	i.fset = token.NewFileSet()
+
+	dir := filepath.Dir(filename)
+	isRelevant := func(info os.FileInfo) bool {
+		name := filepath.Join(dir, info.Name())
+		return !isIgnored(name) && !isGeneratedByGobco(name)
+	}
+	pkgsMap, err := parser.ParseDir(i.fset, dir, isRelevant, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	i.resolveTypes(pkgsMap)
+
+	for _, pkg := range sortedPkgs(pkgsMap) {
+		if f := pkg.Files[filepath.Join(dir, filepath.Base(filename))]; f != nil {
+			i.typePkg = i.pkg[pkg]
+			i.instrumentFileNode(f)
+			return format.Node(w, i.fset, f)
+		}
+	}
+	return fmt.Errorf("%s is not part of the package in %s", filename, dir)
+}
+
 func (i *instrumenter) resolveTypes(pkgsMap map[string]*ast.Package) {
-	imp := importer.ForCompiler(i.fset, "source", nil)
+	// In module mode, the source importer runs 'go list' in
+	// build.Default.Dir, which defaults to the current directory.
+	// To find the module or workspace of the package, it must run
+	// in the package directory instead.
+	if dir := packageDir(pkgsMap); dir != "" {
+		defer func(prev string) { build.Default.Dir = prev }(build.Default.Dir)
+		build.Default.Dir = dir
+	}
+
+	imp := &testedPkgImporter{
+		importer.ForCompiler(i.fset, "source", nil).(types.ImporterFrom),
+		"",
+		nil,
+	}
 	conf := types.Config{Importer: imp}
 	info := types.Info{
 		Types: make(map[ast.Expr]types.TypeAndValue),
@@ -127,6 +333,9 @@ func (i *instrumenter) resolveTypes(pkgsMap map[string]*ast.Package) {
 			return true
 		}
 		i.typ[expr] = tv.Type
+		if tv.Value != nil {
+			i.val[expr] = tv.Value
+		}
 		if i.debugTypes {
 			fmt.Printf("expression '%s' has type '%s'\n",
 				i.str(expr), tv.Type)
@@ -134,36 +343,223 @@ func (i *instrumenter) resolveTypes(pkgsMap map[string]*ast.Package) {
 		return true
 	}
 
-	for _, pkg := range pkgsMap {
-		var files []*ast.File
-		for _, file := range pkg.Files {
-			files = append(files, file)
+	// Check 'package x' before 'package x_test',
+	// as the black box tests import the former.
+	for _, pkg := range sortedPkgs(pkgsMap) {
+		// The files for other platforms may declare the same functions,
+		// such as a Go fallback for a function implemented in assembly,
+		// so they cannot be checked together with the others.
+		var files, excluded []*ast.File
+		forEachFile(pkg, func(name string, file *ast.File) {
+			if shouldBuild(name, i.buildTags) {
+				files = append(files, file)
+			} else {
+				excluded = append(excluded, file)
+			}
+		})
+		if imp.tested == nil && len(pkgsMap) > 1 {
+			imp.path = i.pkgPath(pkg)
 		}
 		typePkg, err := conf.Check(pkg.Name, i.fset, files, &info)
 		ok(err)
 		i.pkg[pkg] = typePkg
+		if imp.tested == nil {
+			imp.tested = typePkg
+		}
+
+		// The conditions from the excluded files are only discovered,
+		// therefore their types are resolved as far as possible.
+		if i.allFiles && len(excluded) > 0 {
+			lenient := conf
+			lenient.Error = func(error) {}
+			_, _ = lenient.Check(pkg.Name, i.fset, append(files, excluded...), &info)
+			files = append(files, excluded...)
+		}
+
 		for _, f := range files {
 			ast.Inspect(f, rememberType)
 		}
 	}
 }
 
+// packageDir returns the absolute directory of the parsed packages,
+// or "" if there are no files.
+func packageDir(pkgsMap map[string]*ast.Package) string {
+	for _, pkg := range pkgsMap {
+		for filename := range pkg.Files {
+			dir, err := filepath.Abs(filepath.Dir(filename))
+			ok(err)
+			return dir
+		}
+	}
+	return ""
+}
+
+// pkgPath returns the import path of the package,
+// or "" if it cannot be determined.
+func (i *instrumenter) pkgPath(pkg *ast.Package) string {
+	for filename := range pkg.Files {
+		pkgPath, err := findPackagePath(filepath.Dir(filename))
+		if err == nil {
+			return pkgPath
+		}
+		break
+	}
+	return ""
+}
+
+// testedPkgImporter resolves the import of the package under test
+// from a black box test to the package that has already been checked,
+// without asking the go command, which only works
+// inside the module of the package under test.
+type testedPkgImporter struct {
+	types.ImporterFrom
+	path   string
+	tested *types.Package
+}
+
+func (imp *testedPkgImporter) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, "", 0)
+}
+
+func (imp *testedPkgImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if imp.tested != nil && path == imp.path {
+		return imp.tested, nil
+	}
+	return imp.ImporterFrom.ImportFrom(path, dir, mode)
+}
+
 func (i *instrumenter) instrumentFile(filename string, astFile *ast.File, dstDir string) {
 	isTest := strings.HasSuffix(filename, "_test.go")
-	if (i.coverTest || !isTest) && shouldBuild(filename) {
+	ignored := i.ignore.ignores(filename) || !i.modifiedSince(filename)
+	if ignored && !isTest {
+		reason := "gobcoignore"
+		if !i.modifiedSince(filename) {
+			reason = "since"
+		}
+		i.skip(filename, reason)
+		return // The file stays as it was copied.
+	}
+	before := len(i.conds)
+	built := i.allFiles || shouldBuild(filename, i.buildTags)
+	if !built {
+		i.skip(filename, "build-constraints")
+	}
+	if (i.coverTest || !isTest) && !ignored && built {
 		i.instrumentFileNode(astFile)
+		if n := len(i.conds) - before; i.maxConds > 0 && n > i.maxConds {
+			// Machine-generated files may have so many conditions
+			// that the instrumented code and the stats file explode.
+			i.conds = i.conds[:before]
+			i.skipped = append(i.skipped, skippedFile{filename, n})
+			i.skip(filename, "max-conditions")
+			if !isTest {
+				return // The file stays as it was copied.
+			}
+			var err error
+			astFile, err = parser.ParseFile(i.fset, filename, nil, parser.ParseComments)
+			ok(err)
+		} else {
+			i.files = append(i.files, filename)
+		}
+	}
+	if dstDir == "" {
+		return
 	}
 	if isTest {
 		i.instrumentTestMain(astFile)
+		if i.attributeTests {
+			i.instrumentTestFuncs(astFile)
+		}
 	}
 
+	out, err := i.printFile(filename, astFile)
+	if err != nil {
+		// The file stays as it was copied, without its conditions.
+		i.conds = i.conds[:before]
+		if n := len(i.files); n > 0 && i.files[n-1] == filename {
+			i.files = i.files[:n-1]
+		}
+		i.unprintable = append(i.unprintable, unprintableFile{filename, err})
+		i.skip(filename, "unprintable")
+		return
+	}
+	dstFile := filepath.Join(dstDir, filepath.Base(filename))
+	if i.diffOut != nil {
+		i.writeDiff(filename, dstFile, out)
+	}
+	writeFile(dstFile, out)
+}
+
+// printFile prints the instrumented code of the file
+// and ensures that the printed code can be parsed again,
+// as the instrumentation may produce syntax trees
+// that the printer cannot handle.
+func (i *instrumenter) printFile(filename string, astFile *ast.File) (code string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
 	var out strings.Builder
-	ok(printer.Fprint(&out, i.fset, astFile))
-	writeFile(filepath.Join(dstDir, filepath.Base(filename)), out.String())
+	if err := printer.Fprint(&out, i.fset, astFile); err != nil {
+		return "", err
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), filename, out.String(), 0); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// modifiedSince returns whether the file has been modified recently
+// enough to be covered by -since.
+func (i *instrumenter) modifiedSince(filename string) bool {
+	if i.since.IsZero() {
+		return true
+	}
+	info, err := os.Stat(filename)
+	return err != nil || info.ModTime().After(i.since)
+}
+
+// writeDiff shows how the instrumentation changed the file,
+// comparing the copy of the original file in dstFile to the new content.
+func (i *instrumenter) writeDiff(filename, dstFile, instrumented string) {
+	original, err := os.ReadFile(dstFile)
+	ok(err)
+	diff := unifiedDiff(filename, dstFile, string(original), instrumented)
+	_, err = io.WriteString(i.diffOut, diff)
+	ok(err)
 }
 
 func (i *instrumenter) instrumentFileNode(f *ast.File) {
+	i.funcs = nil
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok {
+			i.funcs = append(i.funcs, decl)
+		}
+	}
+	i.ignored = i.ignoreDirectives(f)
+	i.idents = map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			i.idents[ident.Name] = true
+		}
+		return true
+	})
+	i.controls = nil
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt,
+			*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			i.controls = append(i.controls, n)
+		}
+		return true
+	})
+
 	ast.Inspect(f, i.markConds)
+	ast.Inspect(f, i.markChains)
+	i.unmarkKinds(f)
 	ast.Inspect(f, i.findRefs)
 	ast.Inspect(f, i.prepareStmts)
 	ast.Inspect(f, i.replace)
@@ -191,6 +587,7 @@ func (i *instrumenter) instrumentFileNode(f *ast.File) {
 // as the conditions for the complex conditions are redundant.
 // For example, in the condition 'a && !c', only 'a' and 'c' are instrumented,
 // but not the '!c' or the whole condition.
+// The chains of if statements are an exception, see markChains.
 //
 // In branch coverage mode,
 // only the whole controlling condition is instrumented.
@@ -252,6 +649,60 @@ func (i *instrumenter) markConds(n ast.Node) bool {
 	return true
 }
 
+// markChains marks the whole conditions of the if statements
+// in an 'if a {} else if b {} else {}' chain.
+//
+// In condition coverage mode, only the atomic conditions are marked,
+// which leaves the final else branch of the chain uncounted
+// if the last condition is a complex condition such as 'b || c'.
+// Marking the whole condition of each if statement in the chain
+// as well counts how often each branch of the chain was taken,
+// and the false outcome of the last condition counts the final else,
+// no matter whether it is written explicitly.
+//
+// In branch coverage mode, the whole conditions are already marked.
+func (i *instrumenter) markChains(n ast.Node) bool {
+	if i.branch {
+		return false
+	}
+	stmt, ok := n.(*ast.IfStmt)
+	if !ok {
+		return true
+	}
+
+	// Each if statement in the chain except for the last one
+	// has an if statement as its else branch.
+	if elif, ok := stmt.Else.(*ast.IfStmt); ok {
+		for _, cond := range []ast.Expr{stmt.Cond, elif.Cond} {
+			if isComplexCondition(cond) {
+				i.marked[cond] = true
+			}
+		}
+	}
+	return true
+}
+
+// isComplexCondition returns whether the condition is combined
+// from other conditions using '&&' or '||',
+// possibly negated or in parentheses.
+func isComplexCondition(cond ast.Expr) bool {
+	for {
+		switch e := cond.(type) {
+		case *ast.ParenExpr:
+			cond = e.X
+		case *ast.UnaryExpr:
+			if e.Op != token.NOT {
+				return false
+			}
+			cond = e.X
+		case *ast.BinaryExpr:
+			return e.Op == token.LAND || e.Op == token.LOR
+		default:
+			return false
+		}
+	}
+}
+
 // findRefs remembers, for each relevant expression or statement,
 // from which single location it is referenced.
 // This information is later used to replace expressions or statements
@@ -297,7 +748,7 @@ func (i *instrumenter) findRefsField(field reflect.Value) {
 			delete(i.marked, expr)
 			ref := field.Addr().Interface().(*ast.Expr)
 			i.exprSubst[expr] = &exprSubst{
-				ref, expr, expr.Pos(), i.str(expr),
+				ref, expr, expr.Pos(), expr.End(), i.str(expr),
 			}
 		}
 
@@ -306,7 +757,7 @@ func (i *instrumenter) findRefsField(field reflect.Value) {
 			if i.marked[expr] {
 				delete(i.marked, expr)
 				i.exprSubst[expr] = &exprSubst{
-					&val[ei], expr, expr.Pos(), i.str(expr),
+					&val[ei], expr, expr.Pos(), expr.End(), i.str(expr),
 				}
 			}
 		}
@@ -327,10 +778,14 @@ func (i *instrumenter) prepareStmts(n ast.Node) bool {
 	switch n := n.(type) {
 
 	case *ast.SwitchStmt:
-		i.prepareSwitchStmt(n)
+		if i.instrumentsKind("switch") {
+			i.prepareSwitchStmt(n)
+		}
 
 	case *ast.TypeSwitchStmt:
-		i.prepareTypeSwitchStmt(n)
+		if i.instrumentsKind("typeswitch") {
+			i.prepareTypeSwitchStmt(n)
+		}
 
 	case *ast.FuncDecl:
 		i.varname = 0
@@ -366,6 +821,7 @@ func (i *instrumenter) prepareSwitchStmt(n *ast.SwitchStmt) {
 				&clause.List[j],
 				gen.eql(tagExprName, expr),
 				expr.Pos(),
+				expr.End(),
 				i.strEql(n.Tag, expr),
 			}
 			tagExprUsed = true
@@ -418,6 +874,7 @@ func (i *instrumenter) prepareTypeSwitchStmt(ts *ast.TypeSwitchStmt) {
 	// to keep the following switch statement simple and uniform.
 	type typeTest struct {
 		pos     token.Pos
+		end     token.Pos
 		varname string
 		code    string
 	}
@@ -429,7 +886,7 @@ func (i *instrumenter) prepareTypeSwitchStmt(ts *ast.TypeSwitchStmt) {
 				tag = i.nextVarname()
 			}
 			v := i.nextVarname()
-			test := typeTest{typ.Pos(), v, i.strEql(tagExpr, typ)}
+			test := typeTest{typ.Pos(), typ.End(), v, i.strEql(tagExpr, typ)}
 			tests = append(tests, test)
 
 			posTyp := gen.reposition(typ)
@@ -470,7 +927,7 @@ func (i *instrumenter) prepareTypeSwitchStmt(ts *ast.TypeSwitchStmt) {
 
 			gen := codeGenerator{test.pos}
 			ident := gen.ident(test.varname)
-			wrapped := i.callCover(ident, test.pos, test.code)
+			wrapped := i.callCover(ident, test.pos, test.end, test.code)
 			newList = append(newList, wrapped)
 		}
 
@@ -507,7 +964,7 @@ func (i *instrumenter) replace(n ast.Node) bool {
 
 	case ast.Expr:
 		if s := i.exprSubst[n]; s != nil {
-			*s.ref = i.callCover(s.expr, s.pos, s.text)
+			*s.ref = i.callCover(s.expr, s.pos, s.end, s.text)
 		}
 
 	case ast.Stmt:
@@ -527,22 +984,187 @@ func (i *instrumenter) replace(n ast.Node) bool {
 // that is most closely related to the instrumented condition.
 // Especially for switch statements,
 // the position may differ from the expression that is wrapped.
-func (i *instrumenter) callCover(expr ast.Expr, pos token.Pos, code string) ast.Expr {
+//
+// The conditions are recorded at their physical position,
+// ignoring any '//line' directives, since the reports
+// and the changed lines refer to the physical files.
+func (i *instrumenter) callCover(expr ast.Expr, pos, end token.Pos, code string) ast.Expr {
 	assert(pos.IsValid(), "pos must refer to the code from before instrumentation")
 
-	start := i.fset.Position(pos)
-	if !strings.HasSuffix(start.Filename, ".go") {
+	if !strings.HasSuffix(i.fset.Position(pos).Filename, ".go") {
 		// don't instrument generated code, such as yacc parsers
 		return expr
 	}
+	start := i.fset.PositionFor(pos, false)
+	if i.changed != nil && !i.changed.contains(start.Filename, start.Line) {
+		return expr
+	}
+	if i.exportedOnly && !i.isExported(pos) {
+		return expr
+	}
+	if i.skipMain && i.isMainFunc(pos) {
+		return expr
+	}
 
-	i.conds = append(i.conds, cond{start.String(), code})
+	i.conds = append(i.conds, cond{
+		start.String(), start, i.fset.PositionFor(end, false), code, i.funcName(pos), i.depth(pos), i.isErrorCheck(expr),
+		i.ignored[start.Line], i.constant(expr),
+	})
 	idx := len(i.conds) - 1
 
 	gen := codeGenerator{pos}
 	return gen.callGobcoCover(idx, expr, i.typ[expr], i.typePkg)
 }
 
+// funcName returns the name of the function containing pos,
+// including its receiver type, such as "(*T).Method".
+func (i *instrumenter) funcName(pos token.Pos) string {
+	for _, decl := range i.funcs {
+		if decl.Pos() <= pos && pos < decl.End() {
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				return decl.Name.Name
+			}
+			return recvName(decl.Recv.List[0].Type) + "." + decl.Name.Name
+		}
+	}
+	return ""
+}
+
+// isExported returns whether pos is in an exported function or method,
+// including the function literals in their bodies,
+// or outside of any function.
+func (i *instrumenter) isExported(pos token.Pos) bool {
+	for _, decl := range i.funcs {
+		if decl.Pos() <= pos && pos < decl.End() {
+			return decl.Name.IsExported()
+		}
+	}
+	return true
+}
+
+// isMainFunc returns whether pos is in the function main of package main,
+// including the function literals inside it.
+func (i *instrumenter) isMainFunc(pos token.Pos) bool {
+	if i.typePkg == nil || i.typePkg.Name() != "main" {
+		return false
+	}
+	for _, decl := range i.funcs {
+		if decl.Pos() <= pos && pos < decl.End() {
+			return decl.Recv == nil && decl.Name.Name == "main"
+		}
+	}
+	return false
+}
+
+// ignoreDirectives collects the //gobco:ignore-true and
+// //gobco:ignore-false directives from the comments of the file,
+// which exclude an outcome of a condition from the coverage.
+// A directive at the end of a line applies to the conditions
+// that start in this line.
+// A directive on a line of its own applies to the conditions
+// that start in the next line.
+func (i *instrumenter) ignoreDirectives(f *ast.File) map[int]ignoredOutcomes {
+	line := func(pos token.Pos) int { return i.fset.PositionFor(pos, false).Line }
+
+	var codeLines map[int]bool
+	ignored := map[int]ignoredOutcomes{}
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			fields := strings.Fields(c.Text)
+			if len(fields) == 0 ||
+				fields[0] != "//gobco:ignore-true" && fields[0] != "//gobco:ignore-false" {
+				continue
+			}
+
+			if codeLines == nil {
+				codeLines = map[int]bool{}
+				ast.Inspect(f, func(n ast.Node) bool {
+					if n == nil {
+						return false
+					}
+					if _, isComment := n.(*ast.CommentGroup); isComment {
+						return false
+					}
+					codeLines[line(n.Pos())] = true
+					codeLines[line(n.End())] = true
+					return true
+				})
+			}
+
+			target := line(c.Pos())
+			if !codeLines[target] {
+				target++
+			}
+			outcomes := ignored[target]
+			if fields[0] == "//gobco:ignore-true" {
+				outcomes.ifTrue = true
+			} else {
+				outcomes.ifFalse = true
+			}
+			ignored[target] = outcomes
+		}
+	}
+	return ignored
+}
+
+// constant returns "true" or "false" if go/types evaluates the expression
+// to a constant, or "" otherwise.
+func (i *instrumenter) constant(expr ast.Expr) string {
+	if val, ok := i.val[expr]; ok && val.Kind() == constant.Bool {
+		return val.String()
+	}
+	return ""
+}
+
+// isErrorCheck returns whether the expression compares a value
+// of the predeclared type 'error' to nil.
+func (i *instrumenter) isErrorCheck(expr ast.Expr) bool {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.X
+	}
+	bin, ok := expr.(*ast.BinaryExpr)
+	if !ok || (bin.Op != token.EQL && bin.Op != token.NEQ) {
+		return false
+	}
+
+	isError := func(e ast.Expr) bool {
+		typ := i.typ[e]
+		return typ != nil && types.Identical(typ, types.Universe.Lookup("error").Type())
+	}
+	return isNilIdent(bin.Y) && isError(bin.X) ||
+		isNilIdent(bin.X) && isError(bin.Y)
+}
+
+// depth returns the number of control flow statements that contain pos.
+func (i *instrumenter) depth(pos token.Pos) int {
+	depth := 0
+	for _, n := range i.controls {
+		if n.Pos() <= pos && pos < n.End() {
+			depth++
+		}
+	}
+	return depth
+}
+
+// recvName returns the receiver type, without type parameters.
+func recvName(typ ast.Expr) string {
+	switch typ := typ.(type) {
+	case *ast.ParenExpr:
+		return recvName(typ.X)
+	case *ast.StarExpr:
+		return "(*" + recvName(typ.X) + ")"
+	case *ast.IndexExpr:
+		return recvName(typ.X)
+	case *ast.Ident:
+		return typ.Name
+	}
+	return "?"
+}
+
 // strEql returns the string representation of (lhs == rhs).
 func (i *instrumenter) strEql(lhs ast.Expr, rhs ast.Expr) string {
 	// Do not use printer.Fprint here,
@@ -587,36 +1209,155 @@ func needsParenthesesForEql(expr ast.Expr) bool {
 	return true
 }
 
+// instrumentTestMain makes the test code persist the counters
+// before the test binary exits.
+//
+// Each call to os.Exit in the test code persists the counters first,
+// not only those in TestMain, since TestMain may call os.Exit
+// from a helper function.
+// Since Go 1.15, TestMain may also return instead of calling os.Exit,
+// in which case a deferred call persists the counters.
 func (i *instrumenter) instrumentTestMain(astFile *ast.File) {
-	seenOsExit := false
-
-	wrapOsExit := func(n ast.Node) bool {
-		if call, ok := n.(*ast.CallExpr); ok {
-			if fn, ok := call.Fun.(*ast.SelectorExpr); ok {
-				if pkg, ok := fn.X.(*ast.Ident); ok {
-					if pkg.Name == "os" && fn.Sel.Name == "Exit" {
-						seenOsExit = true
-						gen := codeGenerator{n.Pos()}
-						call.Args[0] = gen.callFinish(call.Args[0])
+	if osName := importName(astFile, "os"); osName != "" {
+		ast.Inspect(astFile, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && len(call.Args) == 1 {
+				if fn, ok := call.Fun.(*ast.SelectorExpr); ok {
+					if pkg, ok := fn.X.(*ast.Ident); ok {
+						if pkg.Name == osName && fn.Sel.Name == "Exit" {
+							gen := codeGenerator{n.Pos()}
+							call.Args[0] = gen.callFinish(call.Args[0])
+						}
 					}
 				}
 			}
-		}
-		return true
+			return true
+		})
 	}
 
 	for _, decl := range astFile.Decls {
 		if decl, ok := decl.(*ast.FuncDecl); ok {
-			if decl.Recv == nil && decl.Name.Name == "TestMain" {
+			if decl.Recv == nil && decl.Name.Name == "TestMain" && decl.Body != nil {
 				i.hasTestMain = true
 
-				ast.Inspect(decl.Body, wrapOsExit)
-				assert(seenOsExit, "can only handle TestMain with explicit call to os.Exit")
+				// The counters from an earlier run are only loaded after
+				// the package has been initialized.
+				gen := codeGenerator{decl.Body.Lbrace}
+				start := &ast.ExprStmt{X: gen.callStart()}
+				finish := &ast.DeferStmt{Defer: gen.pos, Call: gen.callFinishReturn()}
+				decl.Body.List = append([]ast.Stmt{start, finish}, decl.Body.List...)
 			}
 		}
 	}
 }
 
+// importName returns the name under which the file imports the package,
+// or "" if the file doesn't import it by name.
+func importName(f *ast.File, pkgPath string) string {
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err != nil || path != pkgPath {
+			continue
+		}
+		if imp.Name == nil {
+			return pkgPath[strings.LastIndexByte(pkgPath, '/')+1:]
+		}
+		if imp.Name.Name != "_" && imp.Name.Name != "." {
+			return imp.Name.Name
+		}
+	}
+	return ""
+}
+
+// instrumentTestFuncs makes each test function, each subtest
+// and each example record its name while it runs,
+// so that the conditions it evaluates can be attributed to it.
+func (i *instrumenter) instrumentTestFuncs(astFile *ast.File) {
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if isTestFuncName(n.Name.Name) && n.Recv == nil && n.Body != nil {
+				i.enterTest(n.Type, n.Body)
+			}
+			if isExampleFuncName(n.Name.Name) && n.Recv == nil && n.Body != nil {
+				i.enterExample(n)
+			}
+		case *ast.FuncLit:
+			i.enterTest(n.Type, n.Body)
+		}
+		return true
+	})
+}
+
+// enterTest makes the function record the test name while it runs,
+// provided that the function has the form 'func(t *testing.T)'.
+func (i *instrumenter) enterTest(fn *ast.FuncType, body *ast.BlockStmt) {
+	params := fn.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 || !isTestingT(params[0].Type) {
+		return
+	}
+
+	param := params[0]
+	if len(param.Names) == 0 || param.Names[0].Name == "_" {
+		param.Names = []*ast.Ident{ast.NewIdent("gobcoT")}
+	}
+
+	gen := codeGenerator{body.Lbrace}
+	name := &ast.CallExpr{
+		Fun:    &ast.SelectorExpr{X: gen.ident(param.Names[0].Name), Sel: gen.ident("Name")},
+		Lparen: gen.pos,
+		Rparen: gen.pos,
+	}
+	enter := &ast.DeferStmt{Defer: gen.pos, Call: gen.callEnterTest(name)}
+	body.List = append([]ast.Stmt{enter}, body.List...)
+}
+
+// enterExample makes the example function record its name while it runs,
+// provided that it has the form 'func ExampleXxx()',
+// as 'go test' reports the examples by their function names.
+func (i *instrumenter) enterExample(fn *ast.FuncDecl) {
+	if fn.Type.Params.NumFields() > 0 || fn.Type.Results.NumFields() > 0 {
+		return
+	}
+
+	gen := codeGenerator{fn.Body.Lbrace}
+	name := &ast.BasicLit{ValuePos: gen.pos, Kind: token.STRING, Value: strconv.Quote(fn.Name.Name)}
+	enter := &ast.DeferStmt{Defer: gen.pos, Call: gen.callEnterTest(name)}
+	fn.Body.List = append([]ast.Stmt{enter}, fn.Body.List...)
+}
+
+// isTestFuncName returns whether the name is that of a test function,
+// such as TestXxx, but not TestMain or Testxxx.
+func isTestFuncName(name string) bool {
+	if !strings.HasPrefix(name, "Test") || name == "TestMain" {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
+
+// isExampleFuncName returns whether the name is that of an example,
+// such as Example, ExampleXxx or Example_suffix, but not Examplexxx.
+func isExampleFuncName(name string) bool {
+	if !strings.HasPrefix(name, "Example") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Example"):])
+	return !unicode.IsLower(r)
+}
+
+// isTestingT returns whether the type is '*testing.T'.
+func isTestingT(typ ast.Expr) bool {
+	star, ok := typ.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "testing" && sel.Sel.Name == "T"
+}
+
 //go:embed templates/gobco_fixed.go
 var fixedTemplate string
 
@@ -629,14 +1370,15 @@ func (i *instrumenter) writeGobcoFiles(srcDir, tmpDir string, pkgs []*ast.Packag
 		str = strings.TrimPrefix(str, "//go:build ignore\n// +build ignore\n\n")
 		return strings.Replace(str, "package main\n", "package "+pkgname+"\n", 1)
 	}
-	writeFile(filepath.Join(tmpDir, "gobco_fixed.go"), fixPkgname(fixedTemplate))
+	writeGeneratedFile(filepath.Join(tmpDir, "gobco_fixed.go"), fixPkgname(fixedTemplate))
 	i.writeGobcoGo(filepath.Join(tmpDir, "gobco_variable.go"), pkgname)
 
 	if !i.hasTestMain {
-		writeFile(filepath.Join(tmpDir, "gobco_no_testmain_test.go"), fixPkgname(noTestMainTemplate))
+		writeGeneratedFile(filepath.Join(tmpDir, "gobco_no_testmain_test.go"), fixPkgname(noTestMainTemplate))
 	}
 
 	i.writeGobcoBlackBox(pkgs, srcDir, tmpDir)
+	i.writeGobcoDeps(pkgname, tmpDir)
 }
 
 func (i *instrumenter) writeGobcoGo(filename, pkgname string) {
@@ -645,20 +1387,90 @@ func (i *instrumenter) writeGobcoGo(filename, pkgname string) {
 	sb.WriteString("package " + pkgname + "\n")
 	sb.WriteString("\n")
 	sb.WriteString("var gobcoOpts = gobcoOptions{\n")
-	sb.WriteString(fmt.Sprintf("\timmediately: %v,\n", i.immediately))
-	sb.WriteString(fmt.Sprintf("\tlistAll:     %v,\n", i.listAll))
+	sb.WriteString(fmt.Sprintf("\timmediately:    %v,\n", i.immediately))
+	sb.WriteString(fmt.Sprintf("\tlistAll:        %v,\n", i.listAll))
+	sb.WriteString(fmt.Sprintf("\tstatsCompact:   %v,\n", i.compact))
+	sb.WriteString(fmt.Sprintf("\tstrictJSON:     %v,\n", i.strictJSON))
+	sb.WriteString(fmt.Sprintf("\tattributeTests: %v,\n", i.attributeTests))
+	sb.WriteString(fmt.Sprintf("\tflushInterval:  %d,\n", int64(i.flushInterval)))
 	sb.WriteString("}\n")
 	sb.WriteString("\n")
 	sb.WriteString("var gobcoCounts = gobcoStats{\n")
 	sb.WriteString("\tconds: []gobcoCond{\n")
-	for _, cond := range i.conds {
-		sb.WriteString(fmt.Sprintf("\t\t{%q, %q, 0, 0},\n",
-			cond.pos, cond.text))
+	for _, cond := range i.conditions() {
+		sb.WriteString(fmt.Sprintf("\t\t{%q, %q, %d, %d, %q, 0, 0, %q, %d, %q, %v, %v, %v, %q, nil, %d, %d},\n",
+			cond.Start, cond.File, cond.Line, cond.Col, cond.Code, cond.Func, cond.Depth,
+			cond.ID, cond.ErrorCheck, cond.IgnoreTrue, cond.IgnoreFalse, cond.Constant,
+			cond.EndLine, cond.EndCol))
 	}
 	sb.WriteString("\t},\n")
 	sb.WriteString("}\n")
 
-	writeFile(filename, sb.String())
+	writeGeneratedFile(filename, sb.String())
+}
+
+// conditions returns the instrumented conditions,
+// in the form in which the instrumented code records them.
+func (i *instrumenter) conditions() []condition {
+	var conds []condition
+	ordinals := map[[2]string]int{}
+	for _, cond := range i.conds {
+		ordinal := ordinals[[2]string{cond.fn, cond.text}]
+		ordinals[[2]string{cond.fn, cond.text}]++
+		conds = append(conds, condition{
+			Start:       cond.pos,
+			File:        cond.start.Filename,
+			Line:        cond.start.Line,
+			Col:         cond.start.Column,
+			Code:        cond.text,
+			Func:        cond.fn,
+			Depth:       cond.depth,
+			ID:          conditionID(cond.fn, cond.text, ordinal),
+			ErrorCheck:  cond.errorCheck,
+			IgnoreTrue:  cond.ignored.ifTrue,
+			IgnoreFalse: cond.ignored.ifFalse,
+			Constant:    cond.constant,
+			EndLine:     cond.end.Line,
+			EndCol:      cond.end.Column,
+		})
+	}
+	return conds
+}
+
+// checkUniqueConditions ensures that no two conditions of the package
+// have the same location and code, or the same ID.
+// When the stats are merged, such conditions would be taken as one,
+// silently producing wrong counts, so this is a bug in gobco,
+// typically in computing the locations.
+func (i *instrumenter) checkUniqueConditions() error {
+	byLocation := map[[2]string]bool{}
+	byID := map[string]condition{}
+	for _, cond := range i.conditions() {
+		key := [2]string{cond.Start, cond.Code}
+		if byLocation[key] {
+			return fmt.Errorf("error: the condition %q at %s is instrumented twice, "+
+				"which is probably a bug in gobco", cond.Code, cond.Start)
+		}
+		byLocation[key] = true
+
+		if prev, found := byID[cond.ID]; found {
+			return fmt.Errorf("error: the conditions %q at %s and %q at %s "+
+				"have the same ID %s, which is probably a bug in gobco",
+				prev.Code, prev.Start, cond.Code, cond.Start, cond.ID)
+		}
+		byID[cond.ID] = cond
+	}
+	return nil
+}
+
+// conditionID identifies a condition independently of its location,
+// so that it stays the same when the code above the condition changes.
+// The ordinal distinguishes the conditions with the same code
+// in the same function, counting from 0.
+func conditionID(fn, code string, ordinal int) string {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%d", fn, code, ordinal)
+	return fmt.Sprintf("%016x", h.Sum64())
 }
 
 // writeGobcoBlackBox makes the function 'GobcoCover' available
@@ -671,10 +1483,18 @@ func (i *instrumenter) writeGobcoBlackBox(pkgs []*ast.Package, srcDir, dstDir st
 
 	pkgPath, err := findPackagePath(srcDir)
 	ok(err)
-	pkgName := filepath.Base(pkgPath)
 
-	text := "" +
-		"package " + pkgs[0].Name + "_test\n" +
+	// The directory name may differ from the package name,
+	// and it need not even be a valid identifier.
+	text := blackBoxBridge(pkgs[0].Name, pkgPath)
+	writeGeneratedFile(filepath.Join(dstDir, "gobco_bridge_test.go"), text)
+}
+
+// blackBoxBridge returns the code that delegates from the black box
+// test package to the functions and types of the main package.
+func blackBoxBridge(pkgName, pkgPath string) string {
+	return "" +
+		"package " + pkgName + "_test\n" +
 		"\n" +
 		"import " + pkgName + " \"" + pkgPath + "\"\n" +
 		"\n" +
@@ -682,21 +1502,104 @@ func (i *instrumenter) writeGobcoBlackBox(pkgs []*ast.Package, srcDir, dstDir st
 		"\t" + "return " + pkgName + ".GobcoCover(idx, cond)\n" +
 		"}\n" +
 		"\n" +
+		"func GobcoStart() {\n" +
+		"\t" + pkgName + ".GobcoStart()\n" +
+		"}\n" +
+		"\n" +
+		"func GobcoEnterTest(name string) func() {\n" +
+		"\t" + "return " + pkgName + ".GobcoEnterTest(name)\n" +
+		"}\n" +
+		"\n" +
 		"func GobcoFinish(code int) int {\n" +
 		"\t" + "return " + pkgName + ".GobcoFinish(code)\n" +
+		"}\n" +
+		"\n" +
+		"func GobcoFinishReturn() {\n" +
+		"\t" + pkgName + ".GobcoFinishReturn()\n" +
 		"}\n"
+}
 
-	writeFile(filepath.Join(dstDir, "gobco_bridge_test.go"), text)
+// writeGobcoDeps connects the counters of the instrumented dependencies
+// with the package under test, via the registry package.
+//
+// The package under test cannot import its dependencies directly,
+// as some of them may be internal to other parts of the module.
+func (i *instrumenter) writeGobcoDeps(pkgname, dstDir string) {
+	var sb strings.Builder
+
+	switch {
+	case i.registerAs != "":
+		sb.WriteString("package " + pkgname + "\n")
+		sb.WriteString("\n")
+		sb.WriteString("import gobcoregistry \"" + i.registry + "\"\n")
+		sb.WriteString("\n")
+		sb.WriteString("func init() {\n")
+		sb.WriteString(fmt.Sprintf("\tgobcoregistry.Deps[%q] = GobcoConds\n", i.registerAs))
+		sb.WriteString("}\n")
+
+	case len(i.deps) > 0:
+		sb.WriteString("package " + pkgname + "\n")
+		sb.WriteString("\n")
+		sb.WriteString("import gobcoregistry \"" + i.registry + "\"\n")
+		sb.WriteString("\n")
+		sb.WriteString("func init() {\n")
+		for _, dep := range i.deps {
+			sb.WriteString(fmt.Sprintf("\tgobcoDeps = append(gobcoDeps, gobcoregistry.Deps[%q])\n", dep))
+		}
+		sb.WriteString("}\n")
+
+	default:
+		return
+	}
+
+	writeGeneratedFile(filepath.Join(dstDir, "gobco_deps.go"), sb.String())
+}
+
+// writeGobcoRegistry writes the package through which
+// the instrumented dependencies register their counters.
+func writeGobcoRegistry(dstDir string) {
+	ok(os.MkdirAll(dstDir, 0o700))
+
+	text := "" +
+		"package gobcoregistry\n" +
+		"\n" +
+		"// Deps maps the import path of each instrumented dependency\n" +
+		"// to the function that passes its coverage counters to f,\n" +
+		"// see GobcoConds.\n" +
+		"var Deps = map[string]func(f func(conds []struct {\n" +
+		"\tStart       string\n" +
+		"\tFile        string\n" +
+		"\tLine        int\n" +
+		"\tCol         int\n" +
+		"\tCode        string\n" +
+		"\tTrueCount   int\n" +
+		"\tFalseCount  int\n" +
+		"\tFunc        string\n" +
+		"\tDepth       int\n" +
+		"\tID          string\n" +
+		"\tErrorCheck  bool\n" +
+		"\tIgnoreTrue  bool\n" +
+		"\tIgnoreFalse bool\n" +
+		"\tConstant    string\n" +
+		"\tTests       []string `json:\",omitempty\"`\n" +
+		"\tEndLine     int      `json:\",omitempty\"`\n" +
+		"\tEndCol      int      `json:\",omitempty\"`\n" +
+		"})){}\n"
+
+	writeGeneratedFile(filepath.Join(dstDir, "registry.go"), text)
 }
 
 // findPackagePath finds import path of a package that srcDir indicates
 func findPackagePath(srcDir string) (string, error) {
-	_, moduleRel, err := findInModule(srcDir)
+	moduleRoot, moduleRel, err := findInModule(srcDir)
 	if err != nil {
 		return "", err
 	}
+	if moduleRoot == "" {
+		return "", fmt.Errorf("%s is not inside a Go module", srcDir)
+	}
 
-	moduleName, err := getModuleName()
+	moduleName, err := getModuleName(moduleRoot)
 	if err != nil {
 		return "", err
 	}
@@ -704,30 +1607,56 @@ func findPackagePath(srcDir string) (string, error) {
 	if moduleRel == "." {
 		return moduleName, nil
 	} else {
-		pkgPath := fmt.Sprintf("%s/%s", moduleName, moduleRel)
+		pkgPath := fmt.Sprintf("%s/%s", moduleName, filepath.ToSlash(moduleRel))
 		return pkgPath, nil
 	}
 }
 
-func getModuleName() (string, error) {
-	cmd := exec.Command("go", "list", "-m")
-	output, err := cmd.Output()
+// getModuleName returns the module path from the go.mod file
+// in the given module root directory.
+func getModuleName(moduleRoot string) (string, error) {
+	goMod, err := os.ReadFile(filepath.Join(moduleRoot, "go.mod"))
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(string(output)), nil
+	for _, line := range strings.Split(string(goMod), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`"), nil
+		}
+	}
+	return "", fmt.Errorf("%s: missing module directive",
+		filepath.Join(moduleRoot, "go.mod"))
 }
 
+// str returns the code of the expression,
+// preferably on a single line.
 func (i *instrumenter) str(expr ast.Expr) string {
 	var sb strings.Builder
 	ok(printer.Fprint(&sb, i.fset, expr))
+	if !strings.Contains(sb.String(), "\n") {
+		return sb.String()
+	}
+
+	// Without the file set, the printer doesn't know about the line breaks
+	// in the original code. It still puts each statement of a function
+	// literal on a separate line, though.
+	sb.Reset()
+	ok(printer.Fprint(&sb, token.NewFileSet(), expr))
 	return sb.String()
 }
 
+// nextVarname returns a name for a generated variable
+// that doesn't occur in the original code of the file,
+// so that the variable doesn't shadow any identifier from there.
 func (i *instrumenter) nextVarname() string {
-	varname := fmt.Sprintf("gobco%d", i.varname)
-	i.varname++
-	return varname
+	for {
+		varname := fmt.Sprintf("gobco%d", i.varname)
+		i.varname++
+		if !i.idents[varname] {
+			return varname
+		}
+	}
 }
 
 // codeGenerator generates source code with correct position information.
@@ -762,6 +1691,27 @@ func (gen codeGenerator) typeAssertExpr(x string, typ ast.Expr) ast.Expr {
 	}
 }
 
+func (gen codeGenerator) callStart() ast.Expr {
+	return &ast.CallExpr{
+		Fun:      gen.ident("GobcoStart"),
+		Lparen:   gen.pos,
+		Ellipsis: token.NoPos,
+		Rparen:   gen.pos,
+	}
+}
+
+// callEnterTest generates 'GobcoEnterTest(name)()',
+// which records the test name until the test function returns.
+func (gen codeGenerator) callEnterTest(name ast.Expr) *ast.CallExpr {
+	enter := &ast.CallExpr{
+		Fun:    gen.ident("GobcoEnterTest"),
+		Lparen: gen.pos,
+		Args:   []ast.Expr{name},
+		Rparen: gen.pos,
+	}
+	return &ast.CallExpr{Fun: enter, Lparen: gen.pos, Rparen: gen.pos}
+}
+
 func (gen codeGenerator) callFinish(arg ast.Expr) ast.Expr {
 	return &ast.CallExpr{
 		Fun:      gen.ident("GobcoFinish"),
@@ -772,7 +1722,26 @@ func (gen codeGenerator) callFinish(arg ast.Expr) ast.Expr {
 	}
 }
 
+// callFinishReturn generates 'GobcoFinishReturn()',
+// which persists the counters when TestMain returns.
+func (gen codeGenerator) callFinishReturn() *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:    gen.ident("GobcoFinishReturn"),
+		Lparen: gen.pos,
+		Rparen: gen.pos,
+	}
+}
+
 func (gen codeGenerator) callGobcoCover(idx int, cond ast.Expr, typ types.Type, typePkg *types.Package) ast.Expr {
+	// For a condition that spans several lines, the closing parenthesis
+	// must be placed at its end, otherwise the printer would move
+	// backwards and add an empty line after the call.
+	// Identifiers don't span lines, and the generated ones
+	// don't have a meaningful end.
+	rparen := gen.pos
+	if _, isIdent := cond.(*ast.Ident); !isIdent && cond.Pos() == gen.pos {
+		rparen = cond.End()
+	}
 	convert := typ != nil && !types.Identical(typ, typ.Underlying())
 	if convert {
 		cond = gen.convert(cond, "bool")
@@ -788,7 +1757,7 @@ func (gen codeGenerator) callGobcoCover(idx int, cond ast.Expr, typ types.Type,
 			},
 			cond,
 		},
-		Rparen: gen.pos,
+		Rparen: rparen,
 	}
 	if convert {
 		typename := types.TypeString(typ, types.RelativeTo(typePkg))
@@ -969,13 +1938,140 @@ again:
 	return ok && ident.Name == "nil"
 }
 
-func shouldBuild(filename string) bool {
-	ctx := build.Context{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+func shouldBuild(filename string, tags []string) bool {
+	ctx := build.Context{GOOS: build.Default.GOOS, GOARCH: build.Default.GOARCH, BuildTags: tags}
 	m, err := ctx.MatchFile(filepath.Split(filename))
 	ok(err)
 	return m
 }
 
+// isIgnored returns whether the file is only excluded from the build
+// by the build tag 'ignore', which is common for code generators
+// and examples that are run using 'go run'.
+func isIgnored(filename string) bool {
+	ctx := build.Context{GOOS: build.Default.GOOS, GOARCH: build.Default.GOARCH}
+	dir, name := filepath.Split(filename)
+	m, err := ctx.MatchFile(dir, name)
+	ok(err)
+	if m {
+		return false
+	}
+	ctx.BuildTags = []string{"ignore"}
+	m, err = ctx.MatchFile(dir, name)
+	ok(err)
+	return m
+}
+
 func writeFile(filename string, content string) {
 	ok(os.WriteFile(filename, []byte(content), 0o666))
 }
+
+// generatedMarker marks the files that gobco adds to a package,
+// following the convention from 'go generate'.
+const generatedMarker = "// Code generated by gobco. DO NOT EDIT.\n"
+
+// writeGeneratedFile writes a file that gobco adds to a package,
+// marking it so that it is never instrumented itself.
+func writeGeneratedFile(filename string, content string) {
+	writeFile(filename, generatedMarker+"\n"+content)
+}
+
+// isGeneratedByGobco returns whether gobco generated the file,
+// for example when a package is instrumented whose directory
+// is the kept temporary directory of an earlier run.
+func isGeneratedByGobco(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	buf := make([]byte, len(generatedMarker))
+	_, err = io.ReadFull(f, buf)
+	return err == nil && string(buf) == generatedMarker
+}
+
+// reservedNames returns the names that the code from gobco declares
+// at the package level, in the package under test
+// and in its black box test package.
+func reservedNames() (internal, external map[string]bool) {
+	declared := func(src string) map[string]bool {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		ok(err)
+		names := map[string]bool{}
+		for _, decl := range f.Decls {
+			for _, name := range declaredIdents(decl) {
+				names[name.Name] = true
+			}
+		}
+		return names
+	}
+
+	internal = declared(fixedTemplate)
+	internal["gobcoOpts"] = true
+	internal["gobcoCounts"] = true
+	internal["gobcosink"] = true
+	external = declared(blackBoxBridge("p", "example.org/p"))
+	return internal, external
+}
+
+// declaredIdents returns the identifiers that a top-level declaration
+// declares at the package level, which excludes methods.
+func declaredIdents(decl ast.Decl) []*ast.Ident {
+	var idents []*ast.Ident
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv == nil {
+			idents = append(idents, decl.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				idents = append(idents, spec.Names...)
+			case *ast.TypeSpec:
+				idents = append(idents, spec.Name)
+			}
+		}
+	}
+	return idents
+}
+
+// findClashes records the package-level declarations from the original
+// code whose names collide with those from the code that gobco adds,
+// which would otherwise make the instrumented code fail to compile.
+func (i *instrumenter) findClashes(pkgs []*ast.Package) {
+	internal, external := reservedNames()
+	for _, pkg := range pkgs {
+		reserved := internal
+		if len(pkgs) > 1 && strings.HasSuffix(pkg.Name, "_test") {
+			reserved = external
+		}
+		forEachFile(pkg, func(name string, file *ast.File) {
+			for _, decl := range file.Decls {
+				for _, ident := range declaredIdents(decl) {
+					if reserved[ident.Name] {
+						i.clashes = append(i.clashes, fmt.Sprintf("%s: %s",
+							i.fset.PositionFor(ident.Pos(), false), ident.Name))
+					}
+				}
+			}
+		})
+	}
+}
+
+// checkGeneratedCode ensures that the code from gobco can be added
+// to the package: the package must not be instrumented already,
+// and the original code must not declare any of the names
+// that the code from gobco declares.
+func (i *instrumenter) checkGeneratedCode() error {
+	if i.generated != "" {
+		return fmt.Errorf("error: %s was generated by gobco, "+
+			"so its package is already instrumented", i.generated)
+	}
+	if len(i.clashes) > 0 {
+		return fmt.Errorf("error: %s collides with the code that gobco adds "+
+			"to the package; please rename it", i.clashes[0])
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/parser"
 	"go/printer"
 	"go/token"
@@ -10,6 +11,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -37,12 +39,15 @@ func Test_instrumenter(t *testing.T) {
 		{"FuncLit"},
 		{"GenDecl"},
 		{"GoStmt"},
+		{"GuardClause"},
 		{"IfStmt"},
 		{"IncDecStmt"},
 		{"IndexExpr"},
 		{"KeyValueExpr"},
 		{"LabeledStmt"},
+		{"LineDirective"},
 		{"ListExpr"},
+		{"MultiLine"},
 		{"ParenExpr"},
 		{"RangeStmt"},
 		{"ReturnStmt"},
@@ -81,29 +86,33 @@ func Test_instrumenter(t *testing.T) {
 		}
 
 		i := instrumenter{
-			branch,
-			false,
-			false,
-			false,
-			false,
-			fset,
-			map[*ast.Package]*types.Package{},
-			map[ast.Expr]types.Type{},
-			nil,
-			0,
-			map[ast.Expr]bool{},
-			map[ast.Expr]*exprSubst{},
-			map[ast.Stmt]*ast.Stmt{},
-			map[ast.Stmt]ast.Stmt{},
-			false,
-			nil,
+			branch:    branch,
+			fset:      fset,
+			pkg:       map[*ast.Package]*types.Package{},
+			typ:       map[ast.Expr]types.Type{},
+			val:       map[ast.Expr]constant.Value{},
+			marked:    map[ast.Expr]bool{},
+			exprSubst: map[ast.Expr]*exprSubst{},
+			stmtRef:   map[ast.Stmt]*ast.Stmt{},
+			stmtSubst: map[ast.Stmt]ast.Stmt{},
 		}
 		fileName := filepath.Clean(base + ".go")
 		f := pkgs["instrumenter"].Files[fileName]
 		assert(f != nil, fileName)
 		i.resolveTypes(pkgs)
 		i.typePkg = i.pkg[pkgs["instrumenter"]]
+		imports := importPaths(f)
 		i.instrumentFileNode(f)
+		if err := i.checkUniqueConditions(); err != nil {
+			t.Error(err)
+		}
+
+		// The instrumented code only refers to the declarations
+		// in gobco_fixed.go, which is in the same package,
+		// so the imports of the file stay the same.
+		if actual := importPaths(f); !reflect.DeepEqual(actual, imports) {
+			t.Errorf("imports of %s changed from %q to %q", fileName, imports, actual)
+		}
 
 		var sb strings.Builder
 		err = printer.Fprint(&sb, fset, f)
@@ -136,3 +145,212 @@ func Test_instrumenter(t *testing.T) {
 		})
 	}
 }
+
+// importPaths returns the import paths of the file, in source order.
+// It inspects the declarations instead of f.Imports,
+// since only the parser fills the latter.
+func importPaths(f *ast.File) []string {
+	var paths []string
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			for _, spec := range decl.Specs {
+				paths = append(paths, spec.(*ast.ImportSpec).Path.Value)
+			}
+		}
+	}
+	return paths
+}
+
+func Test_instrumenter_funcName(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	fset := token.NewFileSet()
+	src := "" +
+		"package p\n" +
+		"\n" +
+		"var v = 1 > 0\n" +
+		"\n" +
+		"type T[K any] struct{}\n" +
+		"\n" +
+		"func F(x int) bool { return x > 0 }\n" +
+		"func (T[K]) V(x int) bool { return x > 0 }\n" +
+		"func (*T[K]) P(x int) bool { return func() bool { return x > 0 }() }\n"
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := instrumenter{fset: fset}
+	var names []string
+	for _, decl := range f.Decls {
+		if decl, ok := decl.(*ast.FuncDecl); ok {
+			i.funcs = append(i.funcs, decl)
+		}
+	}
+	for _, decl := range f.Decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if n, ok := n.(*ast.BinaryExpr); ok {
+				names = append(names, i.funcName(n.Pos()))
+			}
+			return true
+		})
+	}
+
+	s.CheckEquals(names, []string{"", "F", "T.V", "(*T).P"})
+}
+
+func Test_conditionID(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	id := conditionID("(*T).Method", "x > 0", 0)
+
+	// The IDs end up in baselines and suppression files,
+	// therefore they must not change between gobco versions.
+	s.CheckEquals(id, "dbfa6231ef332801")
+	s.CheckEquals(conditionID("(*T).Method", "x > 0", 0), id)
+	s.CheckEquals(conditionID("(*T).Method", "x > 0", 1) != id, true)
+	s.CheckEquals(conditionID("T.Method", "x > 0", 0) != id, true)
+	s.CheckEquals(conditionID("(*T).Method", "x >= 0", 0) != id, true)
+}
+
+func Test_importName(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(imports string, expected string) {
+		src := "package p\n\n" + imports + "\n"
+		f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+		s.CheckEquals(err, nil)
+		s.CheckEquals(importName(f, "os"), expected)
+	}
+
+	test("import \"os\"", "os")
+	test("import goos \"os\"", "goos")
+	test("import _ \"os\"", "")
+	test("import . \"os\"", "")
+	test("import \"os/exec\"", "")
+	test("", "")
+}
+
+func Test_instrumenter_checkUniqueConditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	newCond := func(line, col int, code, fn string) cond {
+		start := token.Position{Filename: "a.go", Line: line, Column: col}
+		return cond{pos: start.String(), start: start, text: code, fn: fn}
+	}
+
+	// The condition 'a' and the whole 'a && b' start at the same location.
+	i := instrumenter{conds: []cond{
+		newCond(3, 5, "a && b", "f"),
+		newCond(3, 5, "a", "f"),
+		newCond(3, 10, "b", "f"),
+		newCond(4, 5, "a", "f"),
+	}}
+	s.CheckEquals(i.checkUniqueConditions(), nil)
+
+	i.conds = append(i.conds, newCond(3, 10, "b", "g"))
+	s.CheckEquals(i.checkUniqueConditions().Error(), ""+
+		"error: the condition \"b\" at a.go:3:10 is instrumented twice, "+
+		"which is probably a bug in gobco")
+}
+
+func Test_instrumenter_checkGeneratedCode(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"var gobcoCount = 1\n" +
+			"\n" +
+			"var gobcoCounts = 2\n",
+		"p_test.go": "" +
+			"package p_test\n" +
+			"\n" +
+			"// Only the black box tests get a function of this name.\n" +
+			"func GobcoCover(idx int, cond bool) bool { return cond }\n",
+	})
+
+	i := s.newGobco().newInstrumenter(false, nil)
+	i.instrument(dir, "", "")
+
+	s.CheckEquals(i.clashes, []string{
+		filepath.Join(dir, "p.go") + ":5:5: gobcoCounts",
+		filepath.Join(dir, "p_test.go") + ":4:6: GobcoCover",
+	})
+	s.CheckEquals(i.checkGeneratedCode().Error(), ""+
+		"error: "+filepath.Join(dir, "p.go")+":5:5: gobcoCounts "+
+		"collides with the code that gobco adds to the package; please rename it")
+}
+
+func Test_instrumenter__generated_files(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The generated files from an earlier run are not instrumented again.
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Pos(x int) bool { return x > 0 }\n",
+	})
+	dst := filepath.Join(t.TempDir(), "dst")
+	s.CheckEquals(copyDir(src, dst), nil)
+	i := s.newGobco().newInstrumenter(false, nil)
+	i.instrument(src, "", dst)
+
+	s.CheckEquals(isGeneratedByGobco(filepath.Join(dst, "p.go")), false)
+	s.CheckEquals(isGeneratedByGobco(filepath.Join(dst, "gobco_fixed.go")), true)
+	s.CheckEquals(isGeneratedByGobco(filepath.Join(dst, "gobco_variable.go")), true)
+
+	// Instrumenting the instrumented code again would count
+	// each condition twice, or instrument the code from gobco.
+	again := s.newGobco().newInstrumenter(false, nil)
+	s.CheckEquals(again.instrument(dst, "", ""), false)
+
+	s.CheckEquals(len(again.conds), 0)
+	s.CheckEquals(again.checkGeneratedCode().Error(), ""+
+		"error: "+filepath.Join(dst, "gobco_fixed.go")+" was generated by gobco, "+
+		"so its package is already instrumented")
+}
+
+func Test_instrumenter_instrumentFile__unprintable(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"var v = 1\n" +
+			"\n" +
+			"func Pos(x int) bool { return x > 0 }\n",
+	})
+	dst := t.TempDir()
+	filename := filepath.Join(src, "p.go")
+	i := s.newGobco().newInstrumenter(false, nil)
+	i.fset = token.NewFileSet()
+	f, err := parser.ParseFile(i.fset, filename, nil, parser.ParseComments)
+	s.CheckEquals(err, nil)
+
+	// Simulate a bug in the instrumenter,
+	// which results in code that cannot be parsed.
+	f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0] = &ast.BasicLit{Kind: token.INT, Value: "1 +"}
+	i.instrumentFile(filename, f, dst)
+
+	s.CheckEquals(len(i.unprintable), 1)
+	s.CheckEquals(i.unprintable[0].filename, filename)
+	s.CheckContains(i.unprintable[0].err.Error(), "p.go:5:6: expected '(', found Pos")
+	s.CheckEquals(len(i.conds), 0)
+	s.CheckEquals(len(i.files), 0)
+	_, err = os.Stat(filepath.Join(dst, "p.go"))
+	s.CheckEquals(os.IsNotExist(err), true)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonReport is the coverage of a single run in -format json.
+// Like the text report, it lists only the conditions that are not
+// fully covered, unless includeCovered is set,
+// while the totals always count all conditions.
+type jsonReport struct {
+	Kind       string        `json:"kind"` // "condition" or "branch"
+	Coverage   coverageTotal `json:"coverage"`
+	Conditions []condition   `json:"conditions"`
+}
+
+func writeJSONReport(w io.Writer, branch bool, conds []condition, lenientErrors, includeCovered bool) error {
+	kind := "condition"
+	if branch {
+		kind = "branch"
+	}
+
+	r := jsonReport{Kind: kind, Conditions: []condition{}}
+	for _, cond := range conds {
+		r.Coverage.Covered += coveredOutcomes(cond, lenientErrors)
+		r.Coverage.Total += countedOutcomes(cond)
+		if includeCovered || !fullyCovered(cond, lenientErrors) {
+			r.Conditions = append(r.Conditions, cond)
+		}
+	}
+	r.Coverage.Percent = coveragePercent(r.Coverage.Covered, r.Coverage.Total)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(r)
+}
+
+// writeJSONLines writes each condition as a JSON object on a line of its own,
+// for processing the conditions one at a time, such as with jq.
+// Like writeJSONReport, it lists only the conditions that are not fully
+// covered, unless includeCovered is set.
+func writeJSONLines(w io.Writer, conds []condition, lenientErrors, includeCovered bool) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, cond := range conds {
+		if !includeCovered && fullyCovered(cond, lenientErrors) {
+			continue
+		}
+		if err := encoder.Encode(cond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
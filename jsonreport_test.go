@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_writeJSONReport(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+	}
+
+	test := func(branch, includeCovered bool, expected string) {
+		var sb strings.Builder
+		err := writeJSONReport(&sb, branch, conds, false, includeCovered)
+
+		s.CheckEquals(err, nil)
+		s.CheckEquals(sb.String(), expected)
+	}
+
+	y := `{"Start":"a.go:4:9","File":"a.go","Line":4,"Col":9,"Code":"y",` +
+		`"TrueCount":1,"FalseCount":0,"Func":"","Depth":0,"ID":"",` +
+		`"ErrorCheck":false,"IgnoreTrue":false,"IgnoreFalse":false,"Constant":""}`
+	x := `{"Start":"a.go:3:5","File":"a.go","Line":3,"Col":5,"Code":"x > 0",` +
+		`"TrueCount":1,"FalseCount":1,"Func":"","Depth":0,"ID":"",` +
+		`"ErrorCheck":false,"IgnoreTrue":false,"IgnoreFalse":false,"Constant":""}`
+
+	// The fully covered condition is counted in the totals
+	// but is only listed with includeCovered.
+	test(false, false,
+		`{"kind":"condition","coverage":{"covered":3,"total":4,"percent":75},`+
+			`"conditions":[`+y+`]}`+"\n")
+	test(true, true,
+		`{"kind":"branch","coverage":{"covered":3,"total":4,"percent":75},`+
+			`"conditions":[`+x+`,`+y+`]}`+"\n")
+}
+
+func Test_gobcoMain__format_json(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	load := func(args ...string) jsonReport {
+		output := filepath.Join(t.TempDir(), "coverage.json")
+		argv := append([]string{"gobco", "-format", "json", "-output", output}, args...)
+		s.RunMain(0, argv...)
+
+		content, err := os.ReadFile(output)
+		s.CheckEquals(err, nil)
+		var r jsonReport
+		s.CheckEquals(json.Unmarshal(content, &r), nil)
+		return r
+	}
+
+	r := load("testdata/collision")
+	s.CheckEquals(r.Coverage, coverageTotal{2, 2, 100})
+	s.CheckEquals(len(r.Conditions), 0)
+
+	r = load("-include-covered", "testdata/collision")
+	s.CheckEquals(r.Coverage, coverageTotal{2, 2, 100})
+	s.CheckEquals(len(r.Conditions), 1)
+	s.CheckEquals(r.Conditions[0].Code, "x == gobco0")
+}
+
+func Test_writeJSONLines(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+	}
+
+	test := func(includeCovered bool, expected ...string) {
+		var sb strings.Builder
+		err := writeJSONLines(&sb, conds, false, includeCovered)
+
+		s.CheckEquals(err, nil)
+		s.CheckEquals(sb.String(), strings.Join(expected, ""))
+	}
+
+	y := `{"Start":"a.go:4:9","File":"a.go","Line":4,"Col":9,"Code":"y",` +
+		`"TrueCount":1,"FalseCount":0,"Func":"","Depth":0,"ID":"",` +
+		`"ErrorCheck":false,"IgnoreTrue":false,"IgnoreFalse":false,"Constant":""}` + "\n"
+	x := `{"Start":"a.go:3:5","File":"a.go","Line":3,"Col":5,"Code":"x > 0",` +
+		`"TrueCount":1,"FalseCount":1,"Func":"","Depth":0,"ID":"",` +
+		`"ErrorCheck":false,"IgnoreTrue":false,"IgnoreFalse":false,"Constant":""}` + "\n"
+
+	test(false, y)
+	test(true, x, y)
+}
+
+func Test_gobcoMain__format_jsonl(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	output := filepath.Join(t.TempDir(), "coverage.jsonl")
+	s.RunMain(0, "gobco", "-format", "jsonl", "-include-covered", "-output", output, "testdata/elsechain")
+
+	content, err := os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	lines := strings.SplitAfter(string(content), "\n")
+	s.CheckEquals(len(lines), 7) // 6 conditions and the empty string after the last newline
+	var cond condition
+	s.CheckEquals(json.Unmarshal([]byte(lines[3]), &cond), nil)
+	s.CheckEquals(cond.Code, "x < 0 || y < 0")
+	s.CheckEquals(cond.FalseCount, 0)
+}
+
+func Test_gobcoMain__embed_source(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "coverage.json")
+	html := filepath.Join(dir, "coverage.html")
+	s.RunMain(0, "gobco", "-format", "json", "-embed-source", "-context", "1",
+		"-html", html, "-output", output, "testdata/samecond")
+
+	content, err := os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	var r jsonReport
+	s.CheckEquals(json.Unmarshal(content, &r), nil)
+	s.CheckEquals(len(r.Conditions), 3)
+	s.CheckEquals(r.Conditions[0].Source, []sourceLine{
+		{5, "func Same(a, b bool) bool {"},
+		{6, "\treturn a && b || a && !b"},
+		{7, "}"},
+	})
+
+	content, err = os.ReadFile(html)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), ""+
+		"<tr class=\"source\"><td colspan=\"4\"><pre>"+
+		"    5  func Same(a, b bool) bool {\n"+
+		"    6  \treturn a &amp;&amp; b || a &amp;&amp; !b\n"+
+		"    7  }\n"+
+		"</pre></td></tr>")
+
+	// Without -embed-source, the reports don't include the source.
+	s.RunMain(0, "gobco", "-format", "json", "-output", output, "testdata/samecond")
+	content, err = os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	s.CheckNotContains(string(content), "\"Source\"")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-embed-source", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -embed-source requires -format json or jsonl, or an HTML report\n")
+}
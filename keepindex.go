@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// keptIndex describes the temporary directory that -keep preserves,
+// so that users and tools can find their way through the instrumented code.
+// It is written as index.json to the temporary directory.
+type keptIndex struct {
+	Files      []keptFile
+	StatsFiles []string // Relative to the temporary directory.
+}
+
+type keptFile struct {
+	Original     string // As given on the command line.
+	Instrumented string // Relative to the temporary directory.
+	Conditions   []debugCond
+}
+
+// addInstrumented remembers the files that the instrumenter
+// instrumented, which it saved to dstDir.
+func (k *keptIndex) addInstrumented(in *instrumenter, dstDir string) {
+	for _, filename := range in.files {
+		conds := []debugCond{}
+		for _, cond := range in.conds {
+			if cond.start.Filename == filename {
+				conds = append(conds, debugCond{cond.pos, cond.text, cond.fn})
+			}
+		}
+		instrumented := filepath.Join(dstDir, filepath.Base(filename))
+		k.Files = append(k.Files, keptFile{filename, instrumented, conds})
+	}
+}
+
+// writeKeptIndex writes index.json to the temporary directory
+// that -keep preserves.
+// Since it is called during cleanup,
+// it only reports its own errors instead of exiting.
+func (g *gobco) writeKeptIndex() {
+	index := keptIndex{Files: []keptFile{}, StatsFiles: []string{}}
+	for _, file := range g.kept.Files {
+		file.Instrumented = g.relToTmpdir(file.Instrumented)
+		index.Files = append(index.Files, file)
+	}
+
+	statsFiles, _ := filepath.Glob(g.file("gobco-counts*.json"))
+	for _, statsFile := range statsFiles {
+		index.StatsFiles = append(index.StatsFiles, g.relToTmpdir(statsFile))
+	}
+	sort.Strings(index.StatsFiles)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "\t")
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(index)
+	if err == nil {
+		err = os.WriteFile(g.file("index.json"), buf.Bytes(), 0o666)
+	}
+	if err != nil {
+		g.warnf("gobco: cannot write the index of the temporary files: %s", err)
+	}
+}
+
+// relToTmpdir returns the path relative to the temporary directory,
+// using forward slashes, or the path itself if that is not possible.
+func (g *gobco) relToTmpdir(path string) string {
+	rel, err := filepath.Rel(g.tmpdir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
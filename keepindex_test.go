@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_gobcoMain__keep_index(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(0, "gobco", "-keep", "testdata/collision")
+
+	const kept = "gobco: the temporary files are in "
+	s.CheckContains(stderr, kept)
+	tmpdir := strings.TrimSpace(stderr[strings.Index(stderr, kept)+len(kept):])
+	defer func() { s.CheckEquals(os.RemoveAll(tmpdir), nil) }()
+
+	content, err := os.ReadFile(filepath.Join(tmpdir, "index.json"))
+	s.CheckEquals(err, nil)
+	var index keptIndex
+	s.CheckEquals(json.Unmarshal(content, &index), nil)
+
+	s.CheckEquals(len(index.Files), 1)
+	file := index.Files[0]
+	s.CheckEquals(file.Original, filepath.FromSlash("testdata/collision/kind.go"))
+	s.CheckEquals(file.Conditions, []debugCond{
+		{"testdata/collision/kind.go:10:7", "x == gobco0", "Kind"},
+	})
+	instrumented, err := os.ReadFile(filepath.Join(tmpdir, filepath.FromSlash(file.Instrumented)))
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(instrumented), "GobcoCover(")
+
+	s.CheckEquals(index.StatsFiles, []string{"gobco-counts.json"})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// conditionKinds are the kinds of conditions that gobco instruments,
+// which -kinds selects from.
+//
+//	if          the condition of an if statement
+//	for         the condition of a for loop
+//	switch      the case expressions of an expression switch
+//	typeswitch  the case types of a type switch
+//	expr        the comparisons and the operands of '&&' and '||'
+//	            outside of the above, such as in 'return a == b'
+var conditionKinds = []string{"if", "for", "switch", "typeswitch", "expr"}
+
+// parseKinds parses the -kinds option,
+// which is a comma-separated list of conditionKinds.
+func parseKinds(s string) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, field := range strings.Split(s, ",") {
+		kind := strings.TrimSpace(field)
+		if !isConditionKind(kind) {
+			return nil, fmt.Errorf("error: -kinds must be a comma-separated list of "+
+				"%q, not %q", strings.Join(conditionKinds, ","), s)
+		}
+		kinds[kind] = true
+	}
+	return kinds, nil
+}
+
+func isConditionKind(kind string) bool {
+	for _, k := range conditionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarkKinds removes the marks from the conditions
+// whose kind was not selected by -kinds.
+//
+// The kind of a condition is determined by the statement
+// whose controlling expression contains the condition.
+// A condition in a function literal only belongs to the statements
+// inside that function literal.
+func (i *instrumenter) unmarkKinds(f *ast.File) {
+	kindOf := map[ast.Expr]string{}
+	within := func(expr ast.Expr, kind string) {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			if e, ok := n.(ast.Expr); ok {
+				kindOf[e] = kind
+			}
+			return true
+		})
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt:
+			within(n.Cond, "if")
+		case *ast.ForStmt:
+			if n.Cond != nil {
+				within(n.Cond, "for")
+			}
+		case *ast.SwitchStmt:
+			if n.Tag != nil {
+				within(n.Tag, "switch")
+			}
+			for _, clause := range n.Body.List {
+				for _, expr := range clause.(*ast.CaseClause).List {
+					within(expr, "switch")
+				}
+			}
+		}
+		return true
+	})
+
+	for expr := range i.marked {
+		kind, ok := kindOf[expr]
+		if !ok {
+			kind = "expr"
+		}
+		if !i.instrumentsKind(kind) {
+			delete(i.marked, expr)
+		}
+	}
+}
+
+// instrumentsKind returns whether the conditions of the kind
+// are instrumented.
+func (i *instrumenter) instrumentsKind(kind string) bool {
+	return i.kinds == nil || i.kinds[kind]
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func Test_parseKinds(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(str string, expected map[string]bool, expectedErr string) {
+		actual, err := parseKinds(str)
+		s.CheckEquals(actual, expected)
+		if expectedErr == "" {
+			s.CheckEquals(err, nil)
+		} else {
+			s.CheckEquals(err.Error(), expectedErr)
+		}
+	}
+
+	test("if", map[string]bool{"if": true}, "")
+	test("if, for,if", map[string]bool{"if": true, "for": true}, "")
+	test("if,for,switch,typeswitch,expr",
+		map[string]bool{"if": true, "for": true, "switch": true, "typeswitch": true, "expr": true}, "")
+	test("", nil,
+		"error: -kinds must be a comma-separated list of \"if,for,switch,typeswitch,expr\", not \"\"")
+	test("if,,for", nil,
+		"error: -kinds must be a comma-separated list of \"if,for,switch,typeswitch,expr\", not \"if,,for\"")
+	test("If", nil,
+		"error: -kinds must be a comma-separated list of \"if,for,switch,typeswitch,expr\", not \"If\"")
+}
+
+func Test_gobcoMain__kinds(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/kinds")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/10",
+		"testdata/kinds/kinds.go:4:5: condition \"n > 0\" was once true but never false",
+		"testdata/kinds/kinds.go:7:14: condition \"i < n\" was once false but never true",
+		"testdata/kinds/kinds.go:10:7: condition \"n == 1\" was once false but never true",
+		"testdata/kinds/kinds.go:13:7: condition \"x.(type) == int\" was once true but never false",
+		"testdata/kinds/kinds.go:15:9: condition \"n == 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-kinds", "if,for", "-list-all", "testdata/kinds")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/kinds/kinds.go:4:5: condition \"n > 0\" was once true but never false",
+		"testdata/kinds/kinds.go:7:14: condition \"i < n\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-kinds", "switch, typeswitch", "-list-all", "testdata/kinds")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/kinds/kinds.go:10:7: condition \"n == 1\" was once false but never true",
+		"testdata/kinds/kinds.go:13:7: condition \"x.(type) == int\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-kinds", "if,while", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -kinds must be a comma-separated list of "+
+		"\"if,for,switch,typeswitch,expr\", not \"if,while\"\n")
+}
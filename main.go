@@ -2,34 +2,119 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/token"
 	"go/types"
+	htmltemplate "html/template"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 var exit = os.Exit
 
+// The exit codes of gobco, on which scripts can rely.
+// If a run fails in several ways, the first failure determines the code.
+const (
+	exitOK          = 0
+	exitError       = 1 // Any other error, such as a failing -before command.
+	exitUsage       = 2 // Invalid options or arguments.
+	exitThreshold   = 3 // The coverage misses a required threshold.
+	exitRegression  = 4 // The coverage got worse, see -new-uncovered.
+	exitBuild       = 5 // The code cannot be instrumented or built.
+	exitTestFailure = 6 // The tests failed.
+	exitInterrupted = 130
+)
+
+// stdin is where the stats file "-" is read from.
+var stdin io.Reader = os.Stdin
+
 func main() {
 	exit(gobcoMain(os.Stdout, os.Stderr, os.Args...))
 }
 
 func gobcoMain(stdout, stderr io.Writer, args ...string) int {
 	g := newGobco(stdout, stderr)
+	defer g.handleSignals()()
 	g.parseCommandLine(args)
+	if g.listConditions {
+		g.printConditions()
+		return g.exitCode
+	}
+	if g.htmlDiff {
+		g.writeHTMLDiffReport()
+		return g.exitCode
+	}
+	if g.compare {
+		g.compareStats()
+		return g.exitCode
+	}
+	if g.emit {
+		g.emitInstrumented()
+		return g.exitCode
+	}
+	g.checkVersionPin()
+	g.skipCoveredPackages()
 	g.prepareTmp()
+	g.stopIfInterrupted()
+	if g.checkOnly {
+		g.checkInstrumentation()
+		g.stopIfInterrupted()
+		g.writeDebugDump(nil)
+		g.cleanUp()
+		return g.exitCode
+	}
 	if g.instrument() {
+		g.stopIfInterrupted()
+		if !g.runBefore() {
+			g.stopIfInterrupted()
+			g.runAfter()
+			g.writeDebugDump(nil)
+			g.cleanUp()
+			return g.exitCode
+		}
+		g.stopIfInterrupted()
 		g.runGoTest()
+		g.stopIfInterrupted()
+		g.warnOverhead()
+		g.runAfter()
+		g.mergeStats()
+		restoreOutput := g.redirectOutput()
+		g.printTimings()
 		g.printOutput()
+		restoreOutput()
+		g.reportFailedPackages()
+		g.updateBaseline()
+		g.runOnFinish()
 	} else {
 		_, _ = io.WriteString(g.stdout, "nothing to instrument\n")
+		g.reportFailedPackages()
 	}
+	g.writeDebugDump(nil)
 	g.cleanUp()
 	return g.exitCode
 }
@@ -40,12 +125,300 @@ type gobco struct {
 	immediately bool
 	keep        bool
 	coverTest   bool
+	failFast    bool
+	timings     bool
+	coverDeps   bool
+
+	// With -cover-deps, the directories of the dependencies that have
+	// already been instrumented for another argument from the same module,
+	// by the directory of their source code.
+	instrumentedDeps map[string]instrumentedDep
+
+	// Whether a package that cannot be instrumented
+	// stops gobco or only leaves out this package.
+	keepGoing bool
+	// The exit code for the errors from check,
+	// such as exitUsage while parsing the command line.
+	// The zero value means exitError.
+	checkCode int
+	// While instrumenting a package with -keep-going,
+	// errors are collected instead of exiting.
+	collecting bool
+	// The packages that could not be instrumented, for -keep-going.
+	failed []failedPackage
+
+	// Whether the stats file is written without indentation.
+	statsCompact bool
+	// Whether reading a stats file fails on unknown fields,
+	// instead of ignoring them.
+	strictJSON bool
+	// Whether a gobco version that doesn't match .gobco.version
+	// is an error instead of a warning.
+	strictVersion bool
+	// Only print the conditions, without running any tests.
+	listConditions bool
+	// Only instrument and compile the packages, without running any tests.
+	checkOnly bool
+	// Keep the temporary directory if the run fails.
+	keepOnFailure bool
+	// Instead of running the tests, compare the old and new stats files
+	// from diffStats in an HTML report.
+	htmlDiff  bool
+	diffStats []string
+	// Instead of running the tests, print the differences
+	// between the old and new stats files from diffStats.
+	compare bool
+
+	// Whether to report the conditions from the files that are not built,
+	// from the discovered conditions.
+	includeUntested bool
+	discovered      []condition
+
+	// Whether 'go test' writes its events as JSON to stdout,
+	// in which case the report goes to the outputFilename.
+	jsonTestOutput bool
+	outputFilename string
+
+	// The form of the report, either "text", "shields", "gocover" or "markdown",
+	// or "text" or "json" for -compare.
+	format          string
+	badgeThresholds badgeThresholds
+
+	// Whether the output of 'go test' to stdout is only shown
+	// if the tests fail.
+	hideTestStdout bool
+
+	// If set, the coverage of each run is appended to this file,
+	// and optionally the recent development of the coverage is printed.
+	historyFilename string
+	historySummary  bool
 
 	goTestArgs []string
 	args       []argInfo
 
+	// How long 'go test' took for each argument, in command line order.
+	durations []testDuration
+	// If positive, warn about the packages whose instrumented tests
+	// take more than this percentage longer than the original tests.
+	warnOverheadPct float64
+
+	// If set, only the lines that changed since this git ref are covered.
+	diffBase string
+
+	// If set, the coverage of the lines that changed since this git ref
+	// is reported in addition to the total coverage.
+	diffCoverage string
+
+	// If set, only the tests matching this regular expression run.
+	runPattern string
+	// How often each test runs, for accumulating the coverage
+	// of tests with randomized inputs.
+	count int
+
+	// The arguments after '--', which are passed to the test binary,
+	// while those from -test are passed to 'go test'.
+	testBinaryArgs []string
+	// If set, the command that runs the tests instead of 'go',
+	// such as "gotestsum --".
+	testRunner string
+	// The tag sets of -matrix, each a comma-separated list of build tags.
+	// The tests run once per tag set.
+	matrix []string
+	// The instrumented packages of each tag set of -matrix.
+	matrixArgs [][]argInfo
+
+	// The command to run after printing the report,
+	// and the report that it receives.
+	onFinish     string
+	finishReport *finishReport
+
+	// The commands to run before and after the tests,
+	// and whether the -after command still needs to run.
+	before       string
+	after        string
+	afterPending bool
+
+	// If positive, only the files that were modified in this period
+	// are covered.
+	since time.Duration
+
+	// Whether to only cover the conditions in exported functions.
+	exportedOnly bool
+
+	// Whether to skip the conditions in the function main of package main.
+	skipMain bool
+
+	// The kinds of conditions to cover, see conditionKinds.
+	kinds map[string]bool
+
+	// If positive, the files with more conditions are not instrumented,
+	// and gobco stops if all packages together have more conditions.
+	maxConditions int
+	// The number of conditions that have been instrumented so far.
+	instrumentedConds int
+
+	// The minimum number of evaluations after which a condition
+	// that was always true or always false is suspected to be constant.
+	suspectConstant int
+
+	// Whether to list the conditions that went both ways,
+	// but almost always the same way.
+	skew bool
+
+	// Whether to list the files that were not instrumented, and why.
+	reportSkipped bool
+	// The files of the packages under test that were not instrumented.
+	uninstrumented []uninstrumentedFile
+
+	// The minimum coverage in percent that each file must have,
+	// or 0 to not check the files.
+	perFileThreshold float64
+
+	// The minimum number of conditions in the report,
+	// or 0 to not check it.
+	minBranches int
+
+	// Either "branches", which counts both outcomes of each condition,
+	// or "conditions", which counts each condition once,
+	// as covered only if both of its outcomes are covered.
+	metric string
+
+	// Whether a comparison between an error and nil counts as covered
+	// if only one of its outcomes is covered.
+	lenientErrors bool
+
+	// Whether to explain why each uncovered condition is not covered.
+	explain bool
+
+	// If set, only the conditions at this location are reported.
+	focus *focusLocation
+
+	// The stats file of an earlier run, such as from the main branch.
+	baseline string
+	// The stats file that serves as the baseline if it exists
+	// and receives the stats of each passing run.
+	baselineAuto string
+	// Whether to only report the conditions that became uncovered
+	// since the baseline, and whether the run fails if there are any.
+	newUncovered       bool
+	failOnNewUncovered bool
+	// Whether a package without test files is an error.
+	requireTests bool
+	// If positive, the packages whose coverage in the baseline
+	// reaches this percentage are not instrumented.
+	skipAbove float64
+
+	// Whether the conditions that are constant at compile time
+	// are left out of the report and the total.
+	excludeConstant bool
+
+	// Whether to print a single line per file instead of the conditions.
+	byFile bool
+
+	// Whether to print the coverage of each directory and file
+	// as a tree instead of the conditions.
+	tree bool
+
+	// Whether to print the conditions as a table with aligned columns.
+	pretty bool
+
+	// Whether to never color the output, see useColor.
+	noColor bool
+
+	// Whether to browse the uncovered conditions in a terminal UI.
+	tui bool
+
+	// Whether to instrument the code even if the instrumented files
+	// are in the cache.
+	noCache bool
+
+	// Whether to build the instrumented code before running the tests.
+	verifyCompile bool
+
+	// The number of packages whose tests run at the same time.
+	parallel int
+
+	// Whether to record the names of the tests that evaluated
+	// each condition in the stats file.
+	attributeTests bool
+
+	// If positive, the instrumented tests persist the counters
+	// at this interval, in addition to the end of the tests.
+	flushInterval time.Duration
+
+	// Instead of running the tests, print the instrumented code
+	// of the emitFile.
+	emit     bool
+	emitFile string
+
+	// How to group the reported conditions, either "" or "func".
+	groupBy string
+	// How to order the reported conditions, either "" for their location
+	// or "depth" for the most deeply nested conditions first.
+	weight string
+
+	// If set, the coverage report is also written as HTML to this file.
+	htmlFilename string
+	// If set, the statement coverage from 'go test -coverprofile'
+	// is written to this file.
+	goCoverFilename string
+	// Whether to open the HTML report in a web browser.
+	open bool
+	// The templates for the HTML reports, from -report-template-dir,
+	// or nil for the built-in templates.
+	htmlTemplates *htmltemplate.Template
+
+	// The template for reporting a single condition, or nil.
+	template *template.Template
+
+	// The -profile options, of the form "kind=file".
+	profiles []string
+
+	// Whether to also print the coverage in the form of 'go test -cover'.
+	goCoverCompat bool
+
+	// Whether to print how the instrumentation changed each file.
+	showDiff bool
+
+	// How to print the file names of the conditions,
+	// either "original", "relative" or "absolute".
+	pathStyle string
+	// Whether the directories in the reports are replaced with a hash.
+	redactPaths bool
+
+	// The number of source lines to print around each reported condition.
+	context int
+	// The maximum number of runes of the code of a condition
+	// in the text report, or 0 for unlimited.
+	maxCodeWidth int
+	// Whether the JSON and HTML reports include the source code
+	// around each condition, to be readable without the source files.
+	embedSource bool
+	// The lines of the source files, for printing the context.
+	sources map[string][]string
+
 	statsFilename string
 
+	// If set, the decisions of this run are written as JSON to this file.
+	debugDumpFilename string
+	dump              debugDump
+	// With -keep, the instrumented files, for the index of the kept files.
+	kept keptIndex
+	// Whether to merge the counts of this run into the existing stats file.
+	appendStats bool
+	// With -append, the stats file given on the command line,
+	// while statsFilename is a fresh file for this run.
+	appendTo string
+
+	// Whether 'go test' uses its own module and build caches
+	// instead of those of the host.
+	isolated bool
+	// The target platform from -cross, in the form GOOS/GOARCH.
+	cross string
+	// The additional environment variables for 'go test',
+	// for the caches and the target platform.
+	testEnv []string
+
 	exitCode int
 
 	logger
@@ -55,46 +428,291 @@ type gobco struct {
 func newGobco(stdout io.Writer, stderr io.Writer) *gobco {
 	var g gobco
 	g.logger.init(stdout, stderr)
+	if seed := os.Getenv("GOBCO_SEED"); seed != "" {
+		seedRandom(seed)
+	}
 	g.buildEnv.init(&g.logger)
 	return &g
 }
 
 func (g *gobco) parseCommandLine(argv []string) {
+	defer g.checkAs(exitUsage)()
+
+	// The default options from the environment come first,
+	// so that the options from the command line override them.
+	envOpts, err := splitOptions(os.Getenv("GOBCO_OPTS"))
+	if err != nil {
+		g.check(fmt.Errorf("error: GOBCO_OPTS: %s", err))
+	}
+	argv, g.testBinaryArgs = splitTestBinaryArgs(argv)
+	argv = append(append(argv[:1:1], envOpts...), argv[1:]...)
+
 	args := g.parseOptions(argv)
+	if g.emit {
+		if len(args) != 1 || !strings.HasSuffix(args[0], ".go") {
+			g.check(fmt.Errorf("error: -emit requires a single Go file as argument"))
+		}
+		g.emitFile = args[0]
+		return
+	}
+	if g.htmlDiff {
+		if len(args) != 2 {
+			g.check(fmt.Errorf("error: -html-diff requires " +
+				"the old and the new stats file as arguments"))
+		}
+		g.checkStdinStats(args)
+		g.diffStats = args
+		return
+	}
+	if g.compare {
+		if len(args) != 2 {
+			g.check(fmt.Errorf("error: -compare requires " +
+				"the old and the new stats file as arguments"))
+		}
+		g.checkStdinStats(args)
+		g.diffStats = args
+		return
+	}
 	g.parseArgs(args)
 }
 
+// checkStdinStats ensures that at most one of the stats files
+// is read from stdin, which is written as "-".
+func (g *gobco) checkStdinStats(filenames []string) {
+	if len(filenames) == 2 && filenames[0] == "-" && filenames[1] == "-" {
+		g.check(fmt.Errorf("error: only one of the stats files can be read from stdin"))
+	}
+}
+
+// splitTestBinaryArgs splits the command line at the first '--',
+// after which the arguments are passed to the test binary,
+// like those after '-args' in 'go test'.
+func splitTestBinaryArgs(argv []string) ([]string, []string) {
+	for i, arg := range argv {
+		if i > 0 && arg == "--" {
+			return argv[:i:i], argv[i+1:]
+		}
+	}
+	return argv, nil
+}
+
 func (g *gobco) parseOptions(argv []string) []string {
-	var help, ver bool
+	var help, ver, verJSON bool
+	var templateName, templateDir, seed, tmpPrefix, config, levelName, thresholds, kinds, focus string
+	var quiet, statsPretty bool
 
 	flags := flag.NewFlagSet(filepath.Base(argv[0]), flag.ContinueOnError)
+	flags.BoolVar(&g.appendStats, "append", false,
+		"merge the coverage into the existing -stats file instead of overwriting it")
+	flags.StringVar(&g.historyFilename, "append-history", "",
+		"append the coverage of this run as a JSON line to this `file`")
+	flags.BoolVar(&g.historySummary, "history-summary", false,
+		"print how the coverage developed in the recent runs, requires -append-history")
+	flags.BoolVar(&g.byFile, "by-file", false,
+		"print the coverage of each file instead of the individual conditions")
+	flags.BoolVar(&g.tree, "tree", false,
+		"print the coverage of each directory and file as a tree instead of the individual conditions")
+	flags.BoolVar(&g.pretty, "pretty", false,
+		"print the conditions as a table with aligned columns")
+	flags.BoolVar(&g.noColor, "no-color", false,
+		"never color the output, same as setting NO_COLOR")
+	flags.BoolVar(&g.tui, "tui", false,
+		"browse the uncovered conditions and their source code in the terminal")
+	flags.StringVar(&g.format, "format", "text",
+		"print the report in this `format`: text, shields (a shields.io badge), gocover (a profile for 'go tool cover'), markdown, json, jsonl (a line per condition) or prometheus")
+	flags.StringVar(&thresholds, "badge-thresholds", "60,80",
+		"the `yellow,green` percentages for the color of the -format=shields badge")
+	flags.BoolVar(&g.goCoverCompat, "go-cover-compat", false,
+		"also print the coverage in the format of 'go test -cover'")
+	flags.StringVar(&g.groupBy, "group-by", "",
+		"group the reported conditions by `func`")
+	flags.BoolVar(&g.emit, "emit", false,
+		"only print the instrumented code of the single file from the arguments")
+	flags.BoolVar(&g.excludeConstant, "exclude-constant", false,
+		"leave out the conditions that are constant at compile time")
+	flags.BoolVar(&g.hideTestStdout, "hide-test-stdout", false,
+		"discard the output of 'go test' to stdout unless the tests fail")
 	flags.BoolVar(&help, "help", false,
 		"print the available command line options")
 	flags.BoolVar(&g.branch, "branch", false,
 		"cover branches, not conditions")
+	flags.StringVar(&g.htmlFilename, "html", "",
+		"write the coverage report as HTML to this `file`")
+	flags.StringVar(&g.goCoverFilename, "go-cover", "",
+		"also write the statement coverage profile of 'go test' to this `file`")
+	flags.StringVar(&templateDir, "report-template-dir", "",
+		"read the templates and styles of the HTML reports from this `dir`")
+	flags.BoolVar(&g.compare, "compare", false,
+		"print the differences between the old and new stats files from the arguments")
+	flags.BoolVar(&g.htmlDiff, "html-diff", false,
+		"compare the old and new stats files from the arguments in an HTML report")
+	flags.BoolVar(&g.open, "open", false,
+		"open the HTML report in a web browser")
 	flags.BoolVar(&g.immediately, "immediately", false,
 		"persist the coverage immediately at each check point")
+	flags.DurationVar(&g.flushInterval, "flush-interval", 0,
+		"persist the coverage every `duration` while the tests run, so that a crash loses at most one interval")
+	flags.BoolVar(&g.listAll, "include-covered", false,
+		"list also the fully covered conditions, in every -format; same as -list-all")
+	flags.BoolVar(&g.includeUntested, "include-untested", false,
+		"also report the conditions from files that are excluded from the build")
+	flags.BoolVar(&g.jsonTestOutput, "json-test-output", false,
+		"pass -json to 'go test' and forward its events to stdout, requires -output")
 	flags.BoolVar(&g.keep, "keep", false,
 		"don't remove the temporary working directory")
+	flags.BoolVar(&g.keepOnFailure, "keep-on-failure", false,
+		"don't remove the temporary working directory if gobco fails")
+	flags.BoolVar(&g.lenientErrors, "lenient-errors", false,
+		"count comparisons between an error and nil as covered if one outcome is covered")
 	flags.BoolVar(&g.listAll, "list-all", false,
 		"at finish, print also those conditions that are fully covered")
+	flags.BoolVar(&g.listConditions, "list-conditions", false,
+		"only print the conditions that would be instrumented, without running the tests")
+	flags.BoolVar(&g.checkOnly, "check-only", false,
+		"only instrument the packages and compile them with their tests, without running the tests")
+	flags.BoolVar(&g.showDiff, "show-diff", false,
+		"print the changes that the instrumentation made to each file")
+	flags.BoolVar(&g.noCache, "no-cache", false,
+		"instrument the code even if the instrumented files are cached")
+	flags.StringVar(&g.after, "after", "",
+		"run the `command` after the tests, even if they fail")
+	flags.StringVar(&g.before, "before", "",
+		"run the `command` before the tests, and only run the tests if it succeeds")
+	flags.StringVar(&g.onFinish, "on-finish", "",
+		"run the `command` after printing the report, passing it the report as JSON")
+	flags.StringVar(&g.outputFilename, "output", "",
+		"write the coverage report to this `file` instead of stdout")
+	flags.BoolVar(&g.redactPaths, "redact-paths", false,
+		"replace the directories in the reports with a hash, keeping the file names")
+	flags.StringVar(&g.pathStyle, "path-style", "original",
+		"print the locations in the `style` original, relative or absolute")
+	flags.Var(newSliceFlag(&g.profiles), "profile",
+		"write a profile of the instrumented tests, as `kind=file`, "+
+			"with kind one of cpu, mem, block, mutex")
+	flags.IntVar(&g.count, "count", 1,
+		"run each test `N` times, accumulating the coverage of all runs")
+	flags.StringVar(&g.runPattern, "run", "",
+		"only run the tests matching the `regexp`, still counting all conditions")
+	flags.Var(newSliceFlag(&g.matrix), "matrix",
+		"run the tests once per -matrix option, with these comma-separated build `tags`, "+
+			"and report the union of the coverage")
+	flags.StringVar(&g.testRunner, "test-runner", "",
+		"run the tests with this `command` followed by the arguments for 'go test', instead of 'go test'")
+	flags.StringVar(&seed, "seed", "",
+		"make the temporary directory names reproducible using the `seed`")
+	flags.StringVar(&tmpPrefix, "tmp-prefix", "",
+		"include the `prefix` in the name of the temporary directory, such as a CI job ID")
+	flags.StringVar(&g.weight, "weight", "",
+		"report the most deeply nested conditions first, by `depth`")
 	flags.StringVar(&g.statsFilename, "stats", "",
 		"load and persist the JSON coverage data to this `file`")
+	flags.BoolVar(&g.statsCompact, "stats-compact", false,
+		"write the JSON coverage data without indentation")
+	flags.BoolVar(&statsPretty, "stats-pretty", false,
+		"write the JSON coverage data indented by tabs, which is the default")
+	flags.BoolVar(&g.strictJSON, "strict-json", false,
+		"fail on unknown fields in the stats file instead of ignoring them")
+	flags.BoolVar(&g.strictVersion, "strict-version", false,
+		"fail if the gobco version doesn't match the .gobco.version file, instead of warning")
+	flags.Float64Var(&g.perFileThreshold, "per-file-threshold", 0,
+		"fail if the coverage of any file is below this `percent`")
+	flags.StringVar(&g.metric, "metric", "branches",
+		"count the coverage by `unit`, either branches (both outcomes of each condition) "+
+			"or conditions (only those with both outcomes covered)")
+	flags.IntVar(&g.maxCodeWidth, "max-code-width", 80,
+		"shorten the code of the conditions in the text report to `N` characters, 0 means unlimited")
+	flags.IntVar(&g.minBranches, "min-branches", 0,
+		"fail if fewer than `N` conditions were instrumented, which hints at files that were skipped by mistake")
+	flags.BoolVar(&g.requireTests, "require-tests", false,
+		"fail if a package has no test files, instead of reporting its conditions as uncovered")
+	flags.BoolVar(&g.reportSkipped, "report-skipped", false,
+		"list the files that were not instrumented, with the reason")
+	flags.BoolVar(&g.skew, "skew", false,
+		"list the conditions that went one way in more than 99% of their evaluations")
+	flags.IntVar(&g.suspectConstant, "suspect-constant", 0,
+		"fail for conditions that were evaluated at least `N` times "+
+			"but only ever one way")
+	flags.StringVar(&templateName, "template", "",
+		"report each condition using the `template`, "+
+			"either a file or one of default, oneline, tsv")
 	flags.Var(newSliceFlag(&g.goTestArgs), "test",
 		"pass the `option` to \"go test\", such as -vet=off")
+	flags.BoolVar(&g.timings, "timings", false,
+		"print how long the tests took for each package")
+	flags.Float64Var(&g.warnOverheadPct, "warn-overhead-pct", 0,
+		"warn if the instrumented tests of a package take more than `N` percent longer than the original tests")
+	flags.StringVar(&levelName, "log-level", "warn",
+		"log the messages up to this `level`: error, warn, info or debug")
+	flags.BoolVar(&quiet, "quiet", false,
+		"only log errors, same as -log-level=error")
 	flags.BoolVar(&g.verbose, "verbose", false,
-		"show progress messages")
+		"show progress messages, same as -log-level=debug")
+	flags.BoolVar(&g.attributeTests, "attribute-tests", false,
+		"record in the stats file which tests evaluated each condition")
+	flags.BoolVar(&g.verifyCompile, "verify-compile", true,
+		"build the instrumented code and its tests before running them, to detect errors in the instrumentation")
+	flags.IntVar(&g.context, "context", 0,
+		"print `N` lines of source code around each reported condition")
+	flags.BoolVar(&g.embedSource, "embed-source", false,
+		"include the source code around each condition in the JSON and HTML reports, "+
+			"with the number of lines from -context, or 2")
+	flags.StringVar(&g.cross, "cross", "",
+		"build and test for another `platform` of the form GOOS/GOARCH")
+	flags.BoolVar(&g.isolated, "isolated", false,
+		"use separate module and build caches for the tests, instead of those of the host")
+	flags.StringVar(&g.baseline, "baseline", "",
+		"the stats `file` of an earlier run, for -new-uncovered and -skip-above")
+	flags.StringVar(&g.baselineAuto, "baseline-auto", "",
+		"use this stats `file` as -baseline if it exists, and write the stats of a passing run to it")
+	flags.BoolVar(&g.newUncovered, "new-uncovered", false,
+		"only report the uncovered conditions that were covered in the -baseline or didn't exist there")
+	flags.BoolVar(&g.failOnNewUncovered, "fail-on-new-uncovered", true,
+		"with -new-uncovered, fail if there are any such conditions")
+	flags.Float64Var(&g.skipAbove, "skip-above", 0,
+		"don't instrument the packages whose coverage in the -baseline is at least this `percent`")
+	flags.StringVar(&focus, "focus", "",
+		"only report the conditions at this `location`, either file:line or file:line:col")
+	flags.BoolVar(&g.explain, "explain", false,
+		"explain why each uncovered condition is not covered, with a hint for the missing test")
+	flags.StringVar(&config, "config", "",
+		"read default options from this JSON `file` instead of .gobco.json")
+	flags.BoolVar(&g.coverDeps, "cover-deps", false,
+		"cover the packages from the same module that the package depends on")
 	flags.BoolVar(&g.coverTest, "cover-test", false,
 		"cover the test code as well")
+	flags.StringVar(&g.debugDumpFilename, "debug-dump", "",
+		"write the decisions of this run as JSON to this `file`, for bug reports")
+	flags.StringVar(&g.diffBase, "diff-base", "",
+		"only cover the lines that changed since the git `ref`")
+	flags.StringVar(&g.diffCoverage, "diff-coverage", "",
+		"also report the coverage of the lines that changed since the git `ref`")
+	flags.DurationVar(&g.since, "since", 0,
+		"only cover the files that were modified in the last `duration`, such as 24h")
+	flags.BoolVar(&g.skipMain, "skip-main", false,
+		"do not cover the conditions in the function main of package main")
+	flags.BoolVar(&g.exportedOnly, "exported-only", false,
+		"only cover the conditions in exported functions and methods")
+	flags.StringVar(&kinds, "kinds", strings.Join(conditionKinds, ","),
+		"only cover the conditions of these comma-separated `kinds`")
+	flags.IntVar(&g.maxConditions, "max-conditions", 100000,
+		"skip the files with more than `N` conditions, and stop if all packages have more, 0 means unlimited")
+	flags.BoolVar(&g.failFast, "fail-fast", false,
+		"fail if any condition is not fully covered, and stop the text report at the first one")
+	flags.IntVar(&g.parallel, "parallel", 0,
+		"run the tests of up to `N` packages at the same time, defaulting to the number of CPUs")
+	flags.BoolVar(&g.keepGoing, "keep-going", false,
+		"if a package cannot be instrumented, continue with the other packages")
 	flags.BoolVar(&ver, "version", false,
 		"print the gobco version")
+	flags.BoolVar(&verJSON, "version-json", false,
+		"print the gobco version, the Go version and the commit as JSON")
 
 	flags.SetOutput(g.stderr)
 	flags.Usage = func() {
 		_, _ = fmt.Fprintf(flags.Output(),
-			"usage: %s [options] package...\n", flags.Name())
+			"usage: %s [options] package... [-- test binary flags]\n", flags.Name())
 		flags.PrintDefaults()
-		g.exitCode = 2
+		g.exitCode = exitUsage
 	}
 
 	err := flags.Parse(argv[1:])
@@ -102,317 +720,2886 @@ func (g *gobco) parseOptions(argv []string) []string {
 		exit(g.exitCode)
 	}
 	g.check(err)
+	g.check(g.loadConfig(flags, config))
 
 	if help {
 		flags.SetOutput(g.stdout)
 		flags.Usage()
-		exit(0)
+		exit(exitOK)
 	}
 
+	if verJSON {
+		g.outf("%s", versionJSON())
+		exit(exitOK)
+	}
 	if ver {
 		g.outf("%s", version)
-		exit(0)
+		exit(exitOK)
+	}
+
+	if g.groupBy != "" && g.groupBy != "func" {
+		g.check(fmt.Errorf("error: -group-by must be \"func\", not %q", g.groupBy))
+	}
+	if g.weight != "" && g.weight != "depth" {
+		g.check(fmt.Errorf("error: -weight must be \"depth\", not %q", g.weight))
+	}
+	if g.metric != "branches" && g.metric != "conditions" {
+		g.check(fmt.Errorf("error: -metric must be \"branches\" or \"conditions\", not %q", g.metric))
+	}
+	if g.count < 1 {
+		g.check(fmt.Errorf("error: -count must be positive, not %d", g.count))
+	}
+	if _, err := regexp.Compile(g.runPattern); err != nil {
+		g.check(fmt.Errorf("error: -run: %s", err))
+	}
+
+	for _, hook := range []struct{ name, command string }{
+		{"-before", g.before},
+		{"-after", g.after},
+		{"-on-finish", g.onFinish},
+		{"-test-runner", g.testRunner},
+	} {
+		if hook.command == "" {
+			continue
+		}
+		if words, err := splitOptions(hook.command); err != nil || len(words) == 0 {
+			g.check(fmt.Errorf("error: %s requires a command, not %q", hook.name, hook.command))
+		}
+	}
+
+	if words, _ := splitOptions(g.testRunner); len(words) > 0 {
+		if _, err := exec.LookPath(words[0]); err != nil {
+			g.check(fmt.Errorf("error: -test-runner: %s", err))
+		}
+	}
+
+	level, err := parseLogLevel(levelName)
+	g.check(err)
+	if g.verbose && quiet {
+		g.check(fmt.Errorf("error: -verbose and -quiet contradict each other"))
+	}
+	if g.verbose {
+		level = levelDebug
+	}
+	if quiet {
+		level = levelError
+	}
+	g.level = level
+	g.verbose = level == levelDebug
+
+	if g.perFileThreshold < 0 || g.perFileThreshold > 100 {
+		g.check(fmt.Errorf("error: -per-file-threshold must be "+
+			"between 0 and 100, not %g", g.perFileThreshold))
+	}
+	if g.tree && g.byFile {
+		g.check(fmt.Errorf("error: -tree and -by-file contradict each other"))
+	}
+	if g.checkOnly {
+		// All packages that cannot be instrumented are reported.
+		g.keepGoing = true
+	}
+	if g.maxCodeWidth < 0 {
+		g.check(fmt.Errorf("error: -max-code-width must not be negative, not %d", g.maxCodeWidth))
+	}
+	if g.minBranches < 0 {
+		g.check(fmt.Errorf("error: -min-branches must not be negative, not %d", g.minBranches))
+	}
+	if g.warnOverheadPct < 0 {
+		g.check(fmt.Errorf("error: -warn-overhead-pct must not be negative, not %g", g.warnOverheadPct))
+	}
+	if g.flushInterval < 0 {
+		g.check(fmt.Errorf("error: -flush-interval must not be negative, not %s", g.flushInterval))
+	}
+	if g.flushInterval > 0 && g.immediately {
+		g.check(fmt.Errorf("error: -flush-interval cannot be combined with -immediately, " +
+			"which already persists the coverage at each check point"))
+	}
+	if g.parallel < 0 {
+		g.check(fmt.Errorf("error: -parallel must not be negative, not %d", g.parallel))
+	}
+	if g.parallel == 0 {
+		g.parallel = runtime.NumCPU()
+	}
+
+	switch g.pathStyle {
+	case "original", "relative", "absolute":
+	default:
+		g.check(fmt.Errorf("error: -path-style must be "+
+			"\"original\", \"relative\" or \"absolute\", not %q", g.pathStyle))
+	}
+	if focus != "" {
+		g.focus, err = parseFocusLocation(focus)
+		g.check(err)
+		if g.format != "text" {
+			g.check(fmt.Errorf("error: -focus requires -format text"))
+		}
+	}
+	if g.cross != "" {
+		slash := strings.IndexByte(g.cross, '/')
+		if slash <= 0 || slash == len(g.cross)-1 || strings.Count(g.cross, "/") != 1 {
+			g.check(fmt.Errorf("error: -cross must have the form GOOS/GOARCH, not %q", g.cross))
+		}
+		// The type checker and the selection of the files by their
+		// build constraints use the default build context.
+		build.Default.GOOS = g.cross[:slash]
+		build.Default.GOARCH = g.cross[slash+1:]
+	}
+	if g.baselineAuto != "" {
+		if g.baseline != "" {
+			g.check(fmt.Errorf("error: -baseline-auto cannot be combined with -baseline"))
+		}
+		if _, err := os.Stat(g.baselineAuto); err == nil {
+			g.baseline = g.baselineAuto
+		}
+	}
+	if g.newUncovered && g.baseline == "" && g.baselineAuto == "" {
+		g.check(fmt.Errorf("error: -new-uncovered requires -baseline"))
+	}
+	if g.skipAbove < 0 || g.skipAbove > 100 {
+		g.check(fmt.Errorf("error: -skip-above must be "+
+			"between 0 and 100, not %g", g.skipAbove))
+	}
+	if g.skipAbove > 0 && g.baseline == "" && g.baselineAuto == "" {
+		g.check(fmt.Errorf("error: -skip-above requires -baseline"))
+	}
+	if g.newUncovered && g.format != "text" {
+		g.check(fmt.Errorf("error: -new-uncovered requires -format text"))
+	}
+	if g.compare && g.format != "text" && g.format != "json" {
+		g.check(fmt.Errorf("error: -compare requires -format text or json, not %q", g.format))
+	}
+	if strings.EqualFold(filepath.Ext(g.outputFilename), ".html") && !g.compare {
+		// The HTML report is self-contained, including the source code
+		// around the conditions, so that it can be sent or archived.
+		if g.format != "text" {
+			g.check(fmt.Errorf("error: -output %s writes the report as HTML, "+
+				"which contradicts -format %s", g.outputFilename, g.format))
+		}
+		if g.htmlFilename != "" {
+			g.check(fmt.Errorf("error: -output %s writes the report as HTML, "+
+				"which contradicts -html", g.outputFilename))
+		}
+		g.htmlFilename, g.outputFilename = g.outputFilename, ""
+		g.embedSource = true
+	}
+	switch g.format {
+	case "text":
+	case "shields":
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format shields requires -output, " +
+				"to keep the output of 'go test' out of the badge"))
+		}
+	case "json":
+		if !g.compare && g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format json requires -output, " +
+				"to keep the output of 'go test' out of the report"))
+		}
+	case "gocover":
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format gocover requires -output, " +
+				"to keep the output of 'go test' out of the profile"))
+		}
+	case "markdown":
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format markdown requires -output, " +
+				"to keep the output of 'go test' out of the document"))
+		}
+	case "jsonl":
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format jsonl requires -output, " +
+				"to keep the output of 'go test' out of the conditions"))
+		}
+	case "prometheus":
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -format prometheus requires -output, " +
+				"to keep the output of 'go test' out of the metrics"))
+		}
+	default:
+		g.check(fmt.Errorf("error: -format must be "+
+			"\"text\", \"shields\", \"gocover\", \"markdown\", \"json\", \"jsonl\" "+
+			"or \"prometheus\", not %q", g.format))
+	}
+	g.badgeThresholds, err = parseBadgeThresholds(thresholds)
+	g.check(err)
+	g.kinds, err = parseKinds(kinds)
+	g.check(err)
+
+	if g.appendStats && g.statsFilename == "" {
+		g.check(fmt.Errorf("error: -append requires -stats"))
+	}
+	if g.statsCompact && statsPretty {
+		g.check(fmt.Errorf("error: -stats-compact and -stats-pretty are mutually exclusive"))
+	}
+	if g.statsFilename == "-" {
+		g.check(fmt.Errorf("error: -stats cannot persist the coverage data to stdin"))
+	}
+	if g.embedSource && g.format != "json" && g.format != "jsonl" &&
+		g.htmlFilename == "" && !g.open {
+		g.check(fmt.Errorf("error: -embed-source requires -format json or jsonl, or an HTML report"))
+	}
+	if g.historySummary && g.historyFilename == "" {
+		g.check(fmt.Errorf("error: -history-summary requires -append-history"))
+	}
+	if g.jsonTestOutput {
+		if g.outputFilename == "" {
+			g.check(fmt.Errorf("error: -json-test-output requires -output, " +
+				"to keep the report out of the JSON events"))
+		}
+		// The -v from -verbose and the -test.count from goTest.args
+		// are compatible with -json, which implies -v anyway.
+		g.goTestArgs = append(g.goTestArgs, "-json")
+		if g.hideTestStdout {
+			g.check(fmt.Errorf("error: -hide-test-stdout would discard " +
+				"the JSON events of -json-test-output"))
+		}
+	}
+
+	for _, tags := range g.matrix {
+		if !validTags(tags) {
+			g.check(fmt.Errorf("error: -matrix must be a comma-separated "+
+				"list of build tags, not %q", tags))
+		}
+	}
+
+	if g.goCoverFilename != "" {
+		for _, arg := range g.goTestArgs {
+			name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+			if name == "coverprofile" || strings.HasPrefix(name, "coverprofile=") {
+				g.check(fmt.Errorf("error: -go-cover cannot be combined with " +
+					"-test -coverprofile, as both write the profile"))
+			}
+		}
+	}
+
+	profileArgs, err := profileTestArgs(g.profiles)
+	g.check(err)
+	g.goTestArgs = append(g.goTestArgs, profileArgs...)
+	g.resolveOutputPaths()
+
+	if !validTmpPrefix(tmpPrefix) {
+		g.check(fmt.Errorf("error: -tmp-prefix must only contain "+
+			"letters, digits, '.', '_' and '-', not %q", tmpPrefix))
+	}
+	if seed != "" {
+		seedRandom(seed)
+	}
+	if seed != "" || tmpPrefix != "" {
+		g.buildEnv.reinit(tmpPrefix)
+	}
+
+	if templateName != "" {
+		tmpl, err := parseReportTemplate(templateName)
+		g.check(err)
+		g.template = tmpl
+	}
+	if templateDir != "" {
+		tmpl, err := parseHTMLTemplates(templateDir)
+		if err != nil {
+			g.check(fmt.Errorf("error: -report-template-dir: %s", err))
+		}
+		g.htmlTemplates = tmpl
 	}
 
 	return flags.Args()
 }
 
+// check exits if there is an error,
+// writing the -debug-dump file before.
+func (g *gobco) check(err error) {
+	if err != nil && g.collecting {
+		panic(packageError{err})
+	}
+	if err != nil {
+		// The error may come from a command that was interrupted.
+		g.stopIfInterrupted()
+		g.writeDebugDump(err)
+	}
+	if err != nil && g.checkCode != 0 {
+		g.errf("%s", err)
+		exit(g.checkCode)
+	}
+	g.logger.check(err)
+}
+
+// checkAs makes check exit with the given code,
+// until the returned function restores the previous code.
+func (g *gobco) checkAs(exitCode int) func() {
+	prev := g.checkCode
+	g.checkCode = exitCode
+	return func() { g.checkCode = prev }
+}
+
+// fail records the exit code of the first failure of the run,
+// while gobco continues to produce its report.
+func (g *gobco) fail(exitCode int) {
+	if g.exitCode == exitOK {
+		g.exitCode = exitCode
+	}
+}
+
+// packageError is an error that only affects a single package,
+// see -keep-going.
+type packageError struct {
+	err error
+}
+
+type failedPackage struct {
+	arg string
+	err error
+}
+
+// forPackage runs the action for a single package.
+// With -keep-going, it returns the error or panic of the action
+// instead of exiting.
+func (g *gobco) forPackage(action func()) (err error) {
+	defer g.checkAs(exitBuild)()
+
+	if !g.keepGoing {
+		action()
+		return nil
+	}
+
+	g.collecting = true
+	defer func() {
+		g.collecting = false
+		if r := recover(); r != nil {
+			if pe, ok := r.(packageError); ok {
+				err = pe.err
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	action()
+	return nil
+}
+
+// reportFailedPackages lists the packages that could not be
+// instrumented with -keep-going, after the report of the others.
+func (g *gobco) reportFailedPackages() {
+	for _, failed := range g.failed {
+		g.errf("gobco: could not instrument %s: %s",
+			failed.arg, strings.TrimPrefix(failed.err.Error(), "error: "))
+	}
+	if len(g.failed) > 0 {
+		g.fail(exitBuild)
+	}
+}
+
+// profileTestArgs converts the -profile options to the corresponding
+// options for 'go test'. Since 'go test' runs in the temporary directory,
+// the profile files are made absolute, so that they end up relative
+// to the current working directory.
+func profileTestArgs(profiles []string) ([]string, error) {
+	var args []string
+	for _, profile := range profiles {
+		eq := strings.IndexByte(profile, '=')
+		if eq <= 0 || eq == len(profile)-1 {
+			return nil, fmt.Errorf("error: -profile must have the form kind=file, not %q", profile)
+		}
+		kind, filename := profile[:eq], profile[eq+1:]
+
+		switch kind {
+		case "cpu", "mem", "block", "mutex":
+		default:
+			return nil, fmt.Errorf("error: unknown profile kind %q, "+
+				"must be one of cpu, mem, block, mutex", kind)
+		}
+
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-"+kind+"profile", abs)
+	}
+	return args, nil
+}
+
+// resolveOutputPaths makes the paths of the output files absolute,
+// including those in the options for 'go test'.
+// Since 'go test' runs in the temporary directory,
+// relative paths would otherwise end up there.
+func (g *gobco) resolveOutputPaths() {
+	for _, filename := range []*string{
+		&g.statsFilename, &g.outputFilename, &g.htmlFilename,
+		&g.historyFilename, &g.debugDumpFilename, &g.goCoverFilename,
+	} {
+		if *filename != "" {
+			abs, err := filepath.Abs(*filename)
+			g.check(err)
+			*filename = abs
+		}
+	}
+
+	args, err := absTestOutputArgs(g.goTestArgs)
+	g.check(err)
+	g.goTestArgs = args
+}
+
+// absTestOutputArgs makes the files and directories
+// from the options for 'go test' absolute,
+// such as in -coverprofile=c.out or -outputdir dir.
+func absTestOutputArgs(args []string) ([]string, error) {
+	isOutput := func(name string) bool {
+		switch strings.TrimPrefix(strings.TrimPrefix(name, "-"), "test.") {
+		case "blockprofile", "coverprofile", "cpuprofile", "memprofile",
+			"mutexprofile", "trace", "outputdir", "o":
+			return true
+		}
+		return false
+	}
+
+	result := append([]string(nil), args...)
+	for i := 0; i < len(result); i++ {
+		arg := result[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if eq := strings.IndexByte(arg, '='); eq > 0 {
+			if isOutput(arg[1:eq]) && arg[eq+1:] != "" {
+				abs, err := filepath.Abs(arg[eq+1:])
+				if err != nil {
+					return nil, err
+				}
+				result[i] = arg[:eq+1] + abs
+			}
+		} else if isOutput(arg[1:]) && i+1 < len(result) {
+			abs, err := filepath.Abs(result[i+1])
+			if err != nil {
+				return nil, err
+			}
+			result[i+1] = abs
+			i++
+		}
+	}
+	return result, nil
+}
+
+// loadConfig sets the options from the configuration file
+// that have not been given on the command line.
+//
+// The file is a JSON object that maps option names to their values,
+// for example {"branch": true, "test": ["-vet=off"]}.
+// For the repeatable option "test",
+// the values from the file come before those from the command line.
+func (g *gobco) loadConfig(flags *flag.FlagSet, filename string) error {
+	explicit := filename != ""
+	if !explicit {
+		filename = ".gobco.json"
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil && !explicit && os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var options map[string]interface{}
+	if err := json.Unmarshal(content, &options); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := flags.Lookup(name)
+		if f == nil || name == "config" || name == "help" ||
+			name == "version" || name == "version-json" {
+			return fmt.Errorf("%s: unknown option %q", filename, name)
+		}
+
+		var values []string
+		switch value := options[name].(type) {
+		case []interface{}:
+			for _, elem := range value {
+				values = append(values, fmt.Sprint(elem))
+			}
+		case float64:
+			values = append(values, strconv.FormatFloat(value, 'f', -1, 64))
+		default:
+			values = append(values, fmt.Sprint(value))
+		}
+
+		if slice, ok := f.Value.(*sliceFlag); ok {
+			fromCommandLine := *slice.values
+			*slice.values = append(values, fromCommandLine...)
+			continue
+		}
+		if given[name] {
+			continue
+		}
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("%s: option %q: %s", filename, name, err)
+			}
+		}
+	}
+	return nil
+}
+
 func (g *gobco) parseArgs(args []string) {
 	if len(args) == 0 {
 		args = []string{"."}
 	}
+	args, err := expandPatterns(args, buildTags(g.goTestArgs))
+	g.check(err)
+
+	if len(args) > 1 && len(g.profiles) > 0 {
+		g.check(fmt.Errorf("error: -profile only works with a single package"))
+	}
+
+	instrDirs := map[string]string{}
+	for _, info := range g.dedupArgs(args) {
+		arg := info.arg
+
+		// In module mode, each argument gets its own copy of the module.
+		// In GOPATH mode, the package directory is determined by
+		// the import path, so a package cannot be instrumented twice.
+		if prev, ok := instrDirs[info.instrDir]; ok {
+			g.check(fmt.Errorf("error: %q and %q refer to the same package", prev, arg))
+		}
+		instrDirs[info.instrDir] = arg
 
-	assert(len(args) <= 1, "checking multiple packages doesn't work yet")
+		g.args = append(g.args, info)
+	}
+}
 
+// expandPatterns replaces each argument of the form "dir/..."
+// with the directories below dir that contain a Go package,
+// like the go command.
+// The directories named "testdata" or "vendor" or starting with "." or "_"
+// are skipped, as well as the directories of nested modules.
+// Before that, the wildcards and braces in the arguments are expanded,
+// see expandGlob.
+func expandPatterns(args []string, tags []string) ([]string, error) {
+	ctx := build.Default
+	ctx.BuildTags = tags
+
+	var globbed []string
 	for _, arg := range args {
-		arg = filepath.FromSlash(arg)
-		g.args = append(g.args, g.classify(arg))
+		matches, err := expandGlob(arg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		globbed = append(globbed, matches...)
+	}
+
+	var result []string
+	for _, arg := range globbed {
+		slashed := filepath.ToSlash(arg)
+		if slashed != "..." && !strings.HasSuffix(slashed, "/...") {
+			result = append(result, arg)
+			continue
+		}
+
+		root := filepath.FromSlash(strings.TrimSuffix(strings.TrimSuffix(slashed, "..."), "/"))
+		if root == "" {
+			root = "."
+		}
+		found := false
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if path != root {
+				name := info.Name()
+				if name == "testdata" || name == "vendor" ||
+					strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			if !isPackageDir(ctx, path) {
+				return nil
+			}
+			result = append(result, filepath.Clean(path))
+			found = true
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error: %s", err)
+		}
+		if !found {
+			return nil, fmt.Errorf("error: %q matches no packages", arg)
+		}
 	}
+	return result, nil
 }
 
-// classify determines how to handle the argument, depending on whether it is
-// a single file or directory, and whether it is located in a Go module or not.
-func (g *gobco) classify(arg string) argInfo {
-	st, err := os.Stat(arg)
-	isDir := err == nil && st.IsDir()
+// expandGlob expands the wildcards and braces in the argument,
+// as not all shells do that, in particular those on Windows.
+// An argument that exists literally, or that has no wildcards,
+// is taken as is.
+// The argument matches the directories that contain a Go package
+// and the Go files, or for "pattern/...", all directories,
+// whose packages are then found by expandPatterns.
+func expandGlob(arg string, ctx build.Context) ([]string, error) {
+	slashed := filepath.ToSlash(arg)
+	dots := slashed == "..." || strings.HasSuffix(slashed, "/...")
+	pattern := slashed
+	if dots {
+		pattern = strings.TrimSuffix(strings.TrimSuffix(slashed, "..."), "/")
+	}
+	if !strings.ContainsAny(pattern, "*?[{") {
+		return []string{arg}, nil
+	}
+	if _, err := os.Stat(filepath.FromSlash(pattern)); err == nil {
+		return []string{arg}, nil
+	}
 
-	dir := arg
-	base := ""
-	if !isDir {
-		dir = filepath.Dir(dir)
-		base = filepath.Base(arg)
+	var result []string
+	seen := map[string]bool{}
+	for _, alt := range expandBraces(pattern) {
+		matches, err := filepath.Glob(filepath.FromSlash(alt))
+		if err != nil {
+			return nil, fmt.Errorf("error: %q: %s", arg, err)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || seen[match] {
+				continue
+			}
+			if !info.IsDir() {
+				// Single files are accepted arguments as well.
+				if !dots && strings.HasSuffix(match, ".go") {
+					seen[match] = true
+					result = append(result, match)
+				}
+				continue
+			}
+			if dots {
+				seen[match] = true
+				result = append(result, filepath.Join(match, "..."))
+			} else if isPackageDir(ctx, match) {
+				seen[match] = true
+				result = append(result, match)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("error: %q matches no packages", arg)
 	}
+	return result, nil
+}
 
-	if moduleRoot, moduleRel := g.findInModule(dir); moduleRoot != "" {
-		copyDst := "module-" + randomHex(8) // Must be outside 'gopath/'.
-		packageDir := filepath.Join(copyDst, moduleRel)
-		return argInfo{
-			arg:       arg,
-			argDir:    dir,
-			module:    true,
-			copySrc:   moduleRoot,
-			copyDst:   copyDst,
-			instrFile: base,
-			instrDir:  packageDir,
+// expandBraces expands the first group of alternatives in braces,
+// such as "cmd/{client,server}", and then those in the results.
+// A brace without its partner is taken literally.
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open == -1 {
+		return []string{pattern}
+	}
+
+	var alts []string
+	depth, start := 0, open+1
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alts = append(alts, pattern[start:i])
+				start = i + 1
+			}
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			alts = append(alts, pattern[start:i])
+			var result []string
+			for _, alt := range alts {
+				result = append(result, expandBraces(pattern[:open]+alt+pattern[i+1:])...)
+			}
+			return result
+		}
+	}
+	return []string{pattern}
+}
+
+// isPackageDir returns whether the directory contains Go files
+// that are built with the tags from the context.
+func isPackageDir(ctx build.Context, dir string) bool {
+	var noGo *build.NoGoError
+	_, err := ctx.ImportDir(dir, 0)
+	return !errors.As(err, &noGo)
+}
+
+// dedupArgs classifies the arguments and removes those whose code
+// is already instrumented by an earlier argument, such as "./pkg"
+// after "pkg", or a single file of a package that is also given
+// as a whole, so that each condition is only counted once.
+func (g *gobco) dedupArgs(args []string) []argInfo {
+	type key struct {
+		dir  string
+		file string
+	}
+
+	var infos []argInfo
+	var keys []key
+	whole := map[string]string{}
+	for _, arg := range args {
+		arg = filepath.FromSlash(arg)
+		info := g.classify(arg)
+
+		dir, err := filepath.Abs(info.argDir)
+		g.check(err)
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if info.instrFile == "" {
+			if _, ok := whole[dir]; !ok {
+				whole[dir] = arg
+			}
+		}
+		infos = append(infos, info)
+		keys = append(keys, key{dir, info.instrFile})
+	}
+
+	var result []argInfo
+	seen := map[key]string{}
+	for i, info := range infos {
+		k := keys[i]
+		prev, ok := seen[k]
+		if !ok && k.file != "" {
+			prev, ok = whole[k.dir]
+		}
+		if ok {
+			g.infof("gobco: skipping %q, as %q already covers it", info.arg, prev)
+			continue
+		}
+		seen[k] = info.arg
+		result = append(result, info)
+	}
+	return result
+}
+
+// classify determines how to handle the argument, depending on whether it is
+// a single file or directory, and whether it is located in a Go module or not.
+func (g *gobco) classify(arg string) argInfo {
+	if arg == "" {
+		g.check(fmt.Errorf("error: the argument must not be empty; " +
+			"use \".\" for the package in the current directory"))
+	}
+
+	st, err := os.Stat(arg)
+	isDir := err == nil && st.IsDir()
+
+	dir := arg
+	base := ""
+	if !isDir {
+		dir = filepath.Dir(dir)
+		base = filepath.Base(arg)
+	}
+
+	if moduleRoot, moduleRel := g.findInModule(dir); moduleRoot != "" {
+		copyDst := "module-" + randomHex(8) // Must be outside 'gopath/'.
+		workspace, err := findWorkspace(moduleRoot)
+		g.check(err)
+		workspaceDst := ""
+		if workspace != "" {
+			absModuleRoot, err := filepath.Abs(moduleRoot)
+			g.check(err)
+			workspaceRel, err := filepath.Rel(workspace, absModuleRoot)
+			g.check(err)
+			workspaceDst = "workspace-" + randomHex(8)
+			copyDst = filepath.Join(workspaceDst, workspaceRel)
+		}
+		packageDir := filepath.Join(copyDst, moduleRel)
+		return argInfo{
+			arg:          arg,
+			argDir:       dir,
+			module:       true,
+			copySrc:      moduleRoot,
+			copyDst:      copyDst,
+			workspace:    workspace,
+			workspaceDst: workspaceDst,
+			instrFile:    base,
+			instrDir:     packageDir,
+		}
+	}
+
+	if relDir := g.findInGopath(dir); relDir != "" {
+		copySrc, copyRel, err := internalRoot(dir, relDir)
+		g.check(err)
+		return argInfo{
+			arg:       arg,
+			argDir:    dir,
+			module:    false,
+			copySrc:   copySrc,
+			copyDst:   filepath.Join("gopath", copyRel),
+			instrFile: base,
+			instrDir:  filepath.Join("gopath", relDir),
+		}
+	}
+
+	if filepath.Clean(dir) == "." {
+		cwd, err := os.Getwd()
+		g.check(err)
+		g.check(fmt.Errorf("error: argument %q refers to the current directory %s, "+
+			"which must be inside a Go module or GOPATH", arg, cwd))
+	}
+	g.check(fmt.Errorf("error: argument %q must be inside a Go module or GOPATH", arg))
+	panic("unreachable")
+}
+
+// findInGopath returns the directory relative to the enclosing GOPATH,
+// starting with "src", or "" if the directory is not inside GOPATH.
+// The directory 'src' itself is not a package, as its import path
+// would be empty.
+func (g *gobco) findInGopath(arg string) string {
+	gopaths := g.gopaths()
+
+	abs, err := filepath.Abs(arg)
+	g.check(err)
+
+	for _, gopath := range filepath.SplitList(gopaths) {
+		if gopath == "" {
+			continue
+		}
+		src, err := filepath.Abs(filepath.Join(gopath, "src"))
+		g.check(err)
+
+		rel := relativeInside(src, abs)
+		if rel == "" {
+			// The current working directory may have been reached
+			// via a symlink, or GOPATH may contain one.
+			realSrc, err1 := filepath.EvalSymlinks(src)
+			realAbs, err2 := filepath.EvalSymlinks(abs)
+			if err1 == nil && err2 == nil {
+				rel = relativeInside(realSrc, realAbs)
+			}
+		}
+		if rel == "." {
+			g.check(fmt.Errorf("error: argument %q is the directory %s itself, "+
+				"which is not a package; please name a package below it", arg, src))
+		}
+		if rel != "" {
+			return filepath.Join("src", rel)
+		}
+	}
+	return ""
+}
+
+// internalRoot returns the directory that is copied to the temporary
+// GOPATH for the package in dir, together with its path relative to
+// GOPATH, starting with "src", like relDir.
+//
+// The go command only allows importing a package below an 'internal'
+// directory from the tree rooted at the parent of that directory.
+// A package that imports "a/internal/b" is therefore copied along
+// with the whole tree of "a", as "a/internal/b" would otherwise be
+// imported from the original GOPATH, which is outside the tree of the
+// copied package.
+func internalRoot(dir, relDir string) (string, string, error) {
+	for {
+		rel := strings.TrimPrefix(relDir, "src")
+		pkgPath := filepath.ToSlash(strings.TrimPrefix(rel, string(filepath.Separator)))
+		parent, err := outermostInternalParent(dir, pkgPath)
+		if err != nil || parent == "" {
+			return dir, relDir, err
+		}
+		// Going up from "." needs an absolute path.
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			return "", "", err
+		}
+		for pkgPath != parent {
+			dir = filepath.Dir(dir)
+			relDir = filepath.Dir(relDir)
+			pkgPath = path.Dir(pkgPath)
+		}
+	}
+}
+
+// outermostInternalParent returns the outermost of the proper ancestors
+// of pkgPath whose 'internal' packages are imported by the code in dir
+// or its subdirectories, or "" if there is none.
+func outermostInternalParent(dir, pkgPath string) (string, error) {
+	parent := ""
+	fset := token.NewFileSet()
+	err := filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() && filename != dir &&
+			(name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+
+		f, err := parser.ParseFile(fset, filename, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil // Leave the error message to the go command.
+		}
+		for _, imp := range f.Imports {
+			importPath, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			p := internalParent(importPath)
+			if p != "" && strings.HasPrefix(pkgPath, p+"/") && (parent == "" || len(p) < len(parent)) {
+				parent = p
+			}
+		}
+		return nil
+	})
+	return parent, err
+}
+
+// internalParent returns the import path of the parent of the last
+// 'internal' element of the import path, as that element determines
+// which packages may import it, or "" if there is none.
+func internalParent(importPath string) string {
+	switch {
+	case strings.HasSuffix(importPath, "/internal"):
+		return strings.TrimSuffix(importPath, "/internal")
+	case strings.Contains(importPath, "/internal/"):
+		return importPath[:strings.LastIndex(importPath, "/internal/")]
+	}
+	return ""
+}
+
+// relativeInside returns the path of target relative to dir,
+// or "" if target is not inside dir.
+// If target is dir itself, the result is ".".
+func relativeInside(dir, target string) string {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return rel
+}
+
+func (g *gobco) gopaths() string {
+	gopaths := os.Getenv("GOPATH")
+	if gopaths != "" {
+		return gopaths
+	}
+
+	home, err := os.UserHomeDir()
+	g.check(err)
+	return filepath.Join(home, "go")
+}
+
+func (g *gobco) findInModule(dir string) (string, string) {
+	moduleRoot, moduleRel, err := findInModule(dir)
+	g.check(err)
+	return moduleRoot, moduleRel
+}
+
+// findInModule finds path of moduleRoot and relative path from the moduleRoot to dir
+func findInModule(dir string) (moduleRoot, moduleRel string, err error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	abs := absDir
+	for {
+		if _, err := os.Lstat(filepath.Join(abs, "go.mod")); err == nil {
+			rel, err := filepath.Rel(abs, absDir)
+			if err != nil {
+				return "", "", err
+			}
+
+			root := abs
+			if rel == "." {
+				root = dir
+			}
+
+			return root, rel, nil
+		}
+
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", "", nil
+		}
+		abs = parent
+	}
+}
+
+// prepareTmp copies the source files to the temporary directory.
+//
+// Later, gobco.instrumenter will overwrite some of these files.
+func (g *gobco) prepareTmp() {
+	if g.statsFilename != "" {
+		if err := checkWritable(g.statsFilename); err != nil {
+			g.check(fmt.Errorf("error: cannot write the stats file: %s", err))
+		}
+		if g.appendStats {
+			g.appendTo = g.statsFilename
+			g.statsFilename = g.file("gobco-counts.json")
+		}
+	} else {
+		g.statsFilename = g.file("gobco-counts.json")
+	}
+
+	if len(g.matrix) == 0 {
+		g.copySources()
+	}
+
+	g.testEnv = g.goCacheEnv()
+	if g.cross != "" {
+		g.testEnv = append(g.testEnv, "GOOS="+build.Default.GOOS, "GOARCH="+build.Default.GOARCH)
+	}
+}
+
+// copySources copies the packages from the arguments
+// to the temporary directory.
+func (g *gobco) copySources() {
+	// TODO: Research how "package/..." is handled by other go commands.
+	for _, arg := range g.args {
+		if g.requireTests {
+			g.check(checkHasTests(arg, buildTags(g.goTestArgs)))
+		}
+		if arg.workspace != "" {
+			g.check(copyDir(arg.workspace, g.file(arg.workspaceDst)))
+		} else {
+			g.check(copyDir(arg.copySrc, g.file(arg.copyDst)))
+		}
+
+		// The local replacements outside the copied tree
+		// still refer to the original directories.
+		if arg.module {
+			root := arg.copySrc
+			if arg.workspace != "" {
+				root = arg.workspace
+			}
+			goMod := g.file(filepath.Join(arg.copyDst, "go.mod"))
+			g.check(resolveReplacements(goMod, arg.copySrc, root))
+		}
+		g.provideSink(arg)
+	}
+}
+
+// goCacheEnv returns the environment variables for the module cache
+// and the build cache of 'go test'.
+// By default, these are the caches of the host,
+// so that the dependencies are neither downloaded nor compiled again,
+// even though GOPATH differs in the build environment.
+// With -isolated, both caches are in the temporary directory.
+func (g *gobco) goCacheEnv() []string {
+	out, err := exec.Command("go", "env", "GOMODCACHE", "GOCACHE", "GOFLAGS").Output()
+	if err != nil {
+		g.check(fmt.Errorf("error: go env: %s", err))
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\r\n"), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	modCache, buildCache, goFlags := lines[0], lines[1], lines[2]
+
+	if g.isolated {
+		// The module cache is read-only by default,
+		// which would prevent removing the temporary directory.
+		return []string{
+			"GOMODCACHE=" + g.file("gomodcache"),
+			"GOCACHE=" + g.file("gocache"),
+			"GOFLAGS=" + strings.TrimSpace(goFlags+" -modcacherw"),
+		}
+	}
+	return []string{
+		"GOMODCACHE=" + modCache,
+		"GOCACHE=" + buildCache,
+	}
+}
+
+// checkWritable ensures that the file can be written,
+// creating its parent directories if necessary,
+// so that the tests don't run in vain.
+// An existing file is left unchanged, a new file is removed again.
+func checkWritable(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(filename)
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		return os.Remove(filename)
+	}
+	return nil
+}
+
+func (g *gobco) instrument() bool {
+	if len(g.matrix) > 0 {
+		return g.instrumentMatrix()
+	}
+	return g.instrumentPackages()
+}
+
+// instrumentPackages instruments the packages from the arguments,
+// leaving out those that cannot be instrumented with -keep-going.
+func (g *gobco) instrumentPackages() bool {
+	changed := g.changedLines()
+
+	found := false
+	var instrumented []argInfo
+	for _, arg := range g.args {
+		done := false
+		err := g.forPackage(func() { done = g.instrumentArg(arg, changed) })
+		if err != nil {
+			g.failed = append(g.failed, failedPackage{arg.arg, err})
+			continue
+		}
+		instrumented = append(instrumented, arg)
+		found = found || done
+	}
+	g.args = instrumented
+	return found
+}
+
+// instrumentArg instruments the package of a single argument
+// and returns whether it had anything to instrument.
+func (g *gobco) instrumentArg(arg argInfo, changed changedLines) bool {
+	found := false
+	ignore, err := loadGobcoIgnore(arg.copySrc, arg.argDir)
+	g.check(err)
+	instrDst := g.file(arg.instrDir)
+	g.check(checkBuildable(arg, buildTags(g.goTestArgs)))
+
+	dir, key := g.cacheEntry(arg, changed)
+	var cached *cachedResult
+	if key != "" {
+		cached = g.loadCached(dir, key, instrDst)
+	}
+	if cached != nil {
+		found = true
+		g.infof("Reused the instrumentation of %s from %s", arg.arg, dir)
+		in := cached.instrumenter()
+		g.checkConditionLimit(in)
+		g.checkUnprintable(in)
+	} else {
+		in := g.newInstrumenter(g.immediately, changed)
+		in.ignore = ignore
+		if g.coverDeps {
+			in.registry, in.deps = g.instrumentDeps(arg, changed)
+		}
+		done := in.instrument(arg.argDir, arg.instrFile, instrDst)
+		g.check(in.checkGeneratedCode())
+		g.check(in.checkUniqueConditions())
+		g.checkConditionLimit(in)
+		g.checkUnprintable(in)
+		if done {
+			found = true
+			g.infof("Instrumented %s to %s", arg.arg, instrDst)
+			if key != "" {
+				g.storeCached(dir, key, arg.argDir, instrDst, newCachedResult(in))
+			}
+		}
+		g.dump.addInstrumented(in)
+		g.kept.addInstrumented(in, instrDst)
+		g.uninstrumented = append(g.uninstrumented, in.uninstrumented...)
+	}
+
+	if g.includeUntested {
+		d := g.newInstrumenter(false, changed)
+		d.ignore = ignore
+		d.allFiles = true
+		d.instrument(arg.argDir, arg.instrFile, "")
+		g.discovered = append(g.discovered, d.conditions()...)
+	}
+	return found
+}
+
+// checkUnprintable reports the files whose instrumented code
+// could not be printed, which is a bug in gobco.
+// With -keep-going, these files stay uninstrumented,
+// and the other files are covered as usual.
+func (g *gobco) checkUnprintable(in *instrumenter) {
+	for _, file := range in.unprintable {
+		msg := fmt.Sprintf("cannot print the instrumented code of %s: %s; "+
+			"this is a bug in gobco, please report it", file.filename, file.err)
+		if !g.keepGoing {
+			g.check(fmt.Errorf("error: %s", msg))
+		}
+		g.warnf("gobco: %s; leaving the file uninstrumented", msg)
+	}
+}
+
+// checkConditionLimit reports the files that were skipped
+// because they have too many conditions,
+// and stops if all packages together have too many conditions.
+func (g *gobco) checkConditionLimit(in *instrumenter) {
+	for _, file := range in.skipped {
+		g.warnf("gobco: not instrumenting %s, as its %d conditions "+
+			"are more than -max-conditions=%d", file.filename, file.conds, g.maxConditions)
+	}
+
+	g.instrumentedConds += len(in.conds)
+	if g.maxConditions > 0 && g.instrumentedConds > g.maxConditions {
+		g.check(fmt.Errorf("error: the packages have more than "+
+			"-max-conditions=%d conditions", g.maxConditions))
+	}
+}
+
+// printConditions prints the location and code of each condition
+// that would be instrumented, without instrumenting or testing anything.
+func (g *gobco) printConditions() {
+	changed := g.changedLines()
+	for _, arg := range g.args {
+		in := g.newInstrumenter(false, changed)
+		ignore, err := loadGobcoIgnore(arg.copySrc, arg.argDir)
+		g.check(err)
+		in.ignore = ignore
+		in.instrument(arg.argDir, arg.instrFile, "")
+		for _, cond := range in.conds {
+			g.outf("%s: %s", g.location(cond.pos), cond.text)
+		}
+	}
+}
+
+// emitInstrumented prints the instrumented code of a single file,
+// without instrumenting or testing anything else.
+func (g *gobco) emitInstrumented() {
+	in := g.newInstrumenter(false, nil)
+	g.check(in.emit(g.emitFile, g.stdout))
+}
+
+// changedLines returns the lines that changed since the -diff-base,
+// or nil to cover all lines.
+func (g *gobco) changedLines() changedLines {
+	if g.diffBase == "" {
+		return nil
+	}
+	changed, err := gitChangedLines(g.argDirs(), g.diffBase)
+	g.check(err)
+	return changed
+}
+
+// argDirs returns the directories of all arguments,
+// which may belong to different git repositories.
+func (g *gobco) argDirs() []string {
+	var dirs []string
+	for _, arg := range g.args {
+		dirs = append(dirs, arg.argDir)
+	}
+	return dirs
+}
+
+func (g *gobco) newInstrumenter(immediately bool, changed changedLines) *instrumenter {
+	var diffOut io.Writer
+	if g.showDiff {
+		diffOut = g.stderr
+	}
+	var since time.Time
+	if g.since > 0 {
+		since = time.Now().Add(-g.since)
+	}
+
+	return &instrumenter{
+		branch:         g.branch,
+		coverTest:      g.coverTest,
+		immediately:    immediately,
+		listAll:        g.listAll,
+		compact:        g.statsCompact,
+		strictJSON:     g.strictJSON,
+		buildTags:      buildTags(g.goTestArgs),
+		attributeTests: g.attributeTests,
+		flushInterval:  g.flushInterval,
+		diffOut:        diffOut,
+		changed:        changed,
+		since:          since,
+		exportedOnly:   g.exportedOnly,
+		skipMain:       g.skipMain,
+		maxConds:       g.maxConditions,
+		kinds:          g.kinds,
+		pkg:            map[*ast.Package]*types.Package{},
+		typ:            map[ast.Expr]types.Type{},
+		val:            map[ast.Expr]constant.Value{},
+		marked:         map[ast.Expr]bool{},
+		exprSubst:      map[ast.Expr]*exprSubst{},
+		stmtRef:        map[ast.Stmt]*ast.Stmt{},
+		stmtSubst:      map[ast.Stmt]ast.Stmt{},
+	}
+}
+
+// instrumentDeps instruments the packages from the main module
+// that the package under test depends on,
+// returning the import path of the registry package
+// and the import paths of the instrumented dependencies.
+func (g *gobco) instrumentDeps(arg argInfo, changed changedLines) (string, []string) {
+	if !arg.module {
+		g.check(fmt.Errorf("error: -cover-deps requires %q to be in a Go module", arg.arg))
+	}
+
+	deps, err := listModuleDeps(arg.argDir)
+	g.check(err)
+	if len(deps) == 0 {
+		return "", nil
+	}
+
+	moduleRoot, err := filepath.Abs(arg.copySrc)
+	g.check(err)
+	moduleName, err := getModuleName(arg.copySrc)
+	g.check(err)
+
+	registryDst := g.file(filepath.Join(arg.copyDst, "gobcoregistry"))
+	if _, err := os.Stat(registryDst); err == nil {
+		g.check(fmt.Errorf("error: -cover-deps requires that the module " +
+			"has no directory named 'gobcoregistry'"))
+	}
+	writeGobcoRegistry(registryDst)
+	registry := moduleName + "/gobcoregistry"
+
+	cwd, err := os.Getwd()
+	g.check(err)
+
+	var instrumented []string
+	for _, dep := range deps {
+		rel, err := filepath.Rel(moduleRoot, dep.dir)
+		g.check(err)
+		dstDir := g.file(filepath.Join(arg.copyDst, rel))
+
+		// Report the locations in the same style as for the package
+		// under test.
+		srcDir := dep.dir
+		if !filepath.IsAbs(arg.argDir) {
+			if relSrc, err := filepath.Rel(cwd, dep.dir); err == nil {
+				srcDir = relSrc
+			}
+		}
+
+		// Apart from the locations, the instrumented code only depends
+		// on the module, which is the same for all its arguments.
+		prev, ok := g.instrumentedDeps[dep.dir]
+		if ok && prev.srcDir == srcDir && prev.registry == registry {
+			g.check(reuseDep(prev, dstDir))
+			if prev.done {
+				instrumented = append(instrumented, dep.importPath)
+				g.infof("Reused the instrumented dependency %s from %s", dep.importPath, prev.dstDir)
+			}
+			continue
+		}
+
+		// Only the package under test persists the counters.
+		in := g.newInstrumenter(false, changed)
+		in.coverTest = false
+		in.registry = registry
+		in.registerAs = dep.importPath
+		in.ignore, err = loadGobcoIgnore(moduleRoot, dep.dir)
+		g.check(err)
+		done := in.instrument(srcDir, "", dstDir)
+		g.check(in.checkGeneratedCode())
+		g.check(in.checkUniqueConditions())
+		g.checkConditionLimit(in)
+		g.checkUnprintable(in)
+		if done {
+			instrumented = append(instrumented, dep.importPath)
+			g.infof("Instrumented dependency %s to %s", dep.importPath, dstDir)
+		}
+		g.dump.addInstrumented(in)
+		g.kept.addInstrumented(in, dstDir)
+
+		if g.instrumentedDeps == nil {
+			g.instrumentedDeps = map[string]instrumentedDep{}
+		}
+		g.instrumentedDeps[dep.dir] = instrumentedDep{
+			srcDir: srcDir, dstDir: dstDir, registry: registry, done: done}
+	}
+	return registry, instrumented
+}
+
+// instrumentedDep is a dependency that has been instrumented
+// for one of the arguments, see -cover-deps.
+type instrumentedDep struct {
+	srcDir   string
+	dstDir   string
+	registry string
+	done     bool
+}
+
+// reuseDep copies the instrumented files of a dependency
+// that has already been instrumented for another argument,
+// since each argument has its own copy of the module.
+func reuseDep(prev instrumentedDep, dstDir string) error {
+	files, err := os.ReadDir(prev.dstDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		err = copyFile(filepath.Join(prev.dstDir, file.Name()), filepath.Join(dstDir, file.Name()), info.Mode())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moduleDep is a package from the main module.
+type moduleDep struct {
+	importPath string
+	dir        string
+}
+
+// listModuleDeps lists the packages from the main module
+// that the package in dir depends on, sorted by import path.
+// The test dependencies and the package itself are not included.
+func listModuleDeps(dir string) ([]moduleDep, error) {
+	format := "{{if .DepOnly}}{{if .Module}}{{if .Module.Main}}" +
+		"{{.ImportPath}}\t{{.Dir}}" +
+		"{{end}}{{end}}{{end}}"
+	cmd := exec.Command("go", "list", "-deps", "-f", format, ".")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("go list -deps: %s\n%s", err, exitErr.Stderr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []moduleDep
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 {
+			deps = append(deps, moduleDep{fields[0], fields[1]})
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].importPath < deps[j].importPath
+	})
+	return deps, nil
+}
+
+func (g *gobco) runGoTest() {
+	if len(g.matrix) > 0 {
+		g.runMatrix()
+		return
+	}
+	g.runPackageTests()
+}
+
+// runPackageTests runs 'go test' on the instrumented packages.
+func (g *gobco) runPackageTests() {
+	type packageRun struct {
+		gopaths       string
+		statsFilename string
+		goTestArgs    []string
+		skip          bool
+		exitCode      int
+		duration      time.Duration
+		stdout        bytes.Buffer
+		stderr        bytes.Buffer
+		done          chan struct{}
+	}
+
+	runs := make([]*packageRun, len(g.args))
+	var statsFilenames, profileFilenames []string
+	for i, arg := range g.args {
+		// The instrumented code of each package only knows its own
+		// conditions, so each package needs its own file.
+		statsFilename := g.statsFilename
+		if len(g.args) > 1 {
+			statsFilename = g.file(fmt.Sprintf("gobco-counts-%d.json", i))
+		}
+		statsFilenames = append(statsFilenames, statsFilename)
+
+		gopaths := ""
+		if !arg.module {
+			gopaths = g.gopaths()
+		}
+
+		// Each package writes its own statement coverage profile,
+		// as they would otherwise overwrite each other.
+		goTestArgs := g.goTestArgs
+		if g.goCoverFilename != "" {
+			profile := g.file(fmt.Sprintf("gobco-cover-%d.out", i))
+			profileFilenames = append(profileFilenames, profile)
+			goTestArgs = append(append([]string(nil), goTestArgs...), "-coverprofile="+profile)
+		}
+
+		runs[i] = &packageRun{
+			gopaths:       gopaths,
+			statsFilename: statsFilename,
+			goTestArgs:    goTestArgs,
+			done:          make(chan struct{}),
+		}
+		if g.verifyCompile && !g.verifyCompiles(arg, gopaths) {
+			g.fail(exitBuild)
+			runs[i].skip = true
+		}
+	}
+
+	// When the packages are tested concurrently, the output of each
+	// package is collected and then printed in the order of the arguments.
+	buffered := g.parallel > 1 && len(g.args) > 1
+	// The command has already been checked in parseCommandLine.
+	runner, _ := splitOptions(g.testRunner)
+	t := goTest{g.hideTestStdout, g.runPattern, g.count, g.testBinaryArgs, runner, g.testEnv}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < g.parallel && w < len(g.args); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run := runs[i]
+				if !run.skip {
+					out := &g.logger
+					if buffered {
+						out = &logger{stdout: &run.stdout, stderr: &run.stderr, level: g.level}
+					}
+					run.exitCode, run.duration = t.run(
+						g.args[i],
+						run.goTestArgs,
+						g.verbose,
+						run.gopaths,
+						run.statsFilename,
+						&g.buildEnv,
+						out,
+					)
+				}
+				close(run.done)
+			}
+		}()
+	}
+	go func() {
+		for i := range g.args {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for i, run := range runs {
+		<-run.done
+		_, _ = run.stdout.WriteTo(g.stdout)
+		_, _ = run.stderr.WriteTo(g.stderr)
+		if run.skip {
+			continue
+		}
+
+		arg := g.args[i]
+		if run.exitCode != 0 {
+			g.fail(exitTestFailure)
+		}
+		g.durations = append(g.durations, testDuration{arg.arg, run.duration})
+		g.dump.GoTest = append(g.dump.GoTest, debugGoTest{
+			g.file(arg.instrDir),
+			t.command(g.verbose, run.goTestArgs),
+			run.statsFilename,
+			run.exitCode,
+			run.duration,
+		})
+	}
+	wg.Wait()
+
+	if len(g.args) > 1 {
+		g.combineStats(statsFilenames)
+	}
+	if g.goCoverFilename != "" {
+		g.writeStatementProfile(profileFilenames)
+	}
+}
+
+// writeStatementProfile writes the statement coverage profiles
+// of the packages to the -go-cover file.
+func (g *gobco) writeStatementProfile(profileFilenames []string) {
+	f, err := os.Create(g.goCoverFilename)
+	g.check(err)
+	err = mergeStatementProfiles(f, profileFilenames)
+	closeErr := f.Close()
+	g.check(err)
+	g.check(closeErr)
+	g.infof("Wrote the statement coverage to %s", g.goCoverFilename)
+}
+
+// verifyCompiles builds the instrumented code together with its tests
+// before running them, to distinguish errors in the instrumentation
+// from those in the code.
+// If only the instrumented code fails to build, the temporary directory
+// is kept for investigation.
+func (g *gobco) verifyCompiles(arg argInfo, gopaths string) bool {
+	instrDir := g.file(arg.instrDir)
+	env := goTest{extraEnv: g.testEnv}.env(g.tmpdir, gopaths, "")
+	out, err := g.goTestCompile(instrDir, buildFlags(g.goTestArgs), env)
+	if err == nil {
+		return true
+	}
+
+	// A build error in the code itself is reported by 'go test' in detail.
+	if _, err := g.goTestCompile(arg.argDir, buildFlags(g.goTestArgs), os.Environ()); err != nil {
+		g.infof("The code in %s does not compile, even without instrumentation", arg.arg)
+		return true
+	}
+
+	g.keep = true
+	g.errf("error: the instrumented code of %s does not compile, "+
+		"although the original code does, which is probably a bug in gobco", arg.arg)
+	g.errf("The instrumented code is in %s:", instrDir)
+	g.errf("%s", strings.TrimSuffix(out, "\n"))
+	return false
+}
+
+// goTestCompile compiles the package in dir together with its tests,
+// without running them or writing any files,
+// and returns the output of 'go test -c'.
+func (g *gobco) goTestCompile(dir string, flags []string, env []string) (string, error) {
+	args := append([]string{"test", "-c", "-o", os.DevNull}, flags...)
+	return g.runGo(dir, append(args, "."), env)
+}
+
+// runGo runs the go command in dir and returns its combined output.
+func (g *gobco) runGo(dir string, args []string, env []string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.Dir = dir
+	cmd.Env = env
+	g.debugf("Running %q in %q", "go "+strings.Join(args, " "), dir)
+	err := g.runCmd(cmd)
+	return out.String(), err
+}
+
+// buildFlags returns the options for 'go test' that also apply to 'go build'.
+func buildFlags(goTestArgs []string) []string {
+	var flags []string
+	for _, arg := range goTestArgs {
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			name = name[:eq]
+		}
+		switch name {
+		case "tags", "mod", "modfile", "race", "gcflags", "ldflags", "trimpath":
+			flags = append(flags, arg)
+		}
+	}
+	return flags
+}
+
+// combineStats collects the counts from the 'go test' run of each package
+// into a single file. A package that is given several times,
+// such as once as a directory and once as a single file,
+// contributes its conditions only once.
+// Packages whose tests could not be run don't have counts and are skipped.
+func (g *gobco) combineStats(statsFilenames []string) {
+	var combined []condition
+	found := false
+	for _, filename := range statsFilenames {
+		conds, err := g.load(filename)
+		if err != nil {
+			continue
+		}
+		combined = mergeConditions(combined, conds)
+		found = true
+	}
+	if found {
+		g.writeStats(g.statsFilename, combined)
+	}
+}
+
+// mergeStats adds the counts from this run to those from the -append file,
+// keeping the conditions that were not instrumented in this run,
+// and writes the result back to that file.
+// If this run didn't produce any counts, the file is left unchanged.
+func (g *gobco) mergeStats() {
+	if g.appendTo == "" {
+		return
+	}
+
+	conds, err := g.load(g.statsFilename)
+	if err != nil {
+		return
+	}
+
+	merged, err := g.load(g.appendTo)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		g.check(err)
+	}
+	g.writeStats(g.appendTo, mergeConditions(merged, conds))
+
+	g.statsFilename = g.appendTo
+}
+
+// nonConstant returns the conditions that are not constant at compile time.
+func nonConstant(conds []condition) []condition {
+	var result []condition
+	for _, cond := range conds {
+		if cond.Constant == "" {
+			result = append(result, cond)
+		}
+	}
+	return result
+}
+
+// includeUntested adds the discovered conditions for which the stats
+// have no record, such as those from files that are excluded from the build,
+// as never evaluated. The conditions are ordered as discovered,
+// followed by the remaining ones from the stats, such as those from
+// the dependencies.
+func includeUntested(discovered, conds []condition) []condition {
+	type key struct {
+		start string
+		code  string
+	}
+
+	// In the unlikely case that several conditions have the same key,
+	// they are matched in order.
+	index := map[key][]int{}
+	for i, cond := range conds {
+		k := key{cond.Start, cond.Code}
+		index[k] = append(index[k], i)
+	}
+
+	var all []condition
+	used := make([]bool, len(conds))
+	for _, cond := range discovered {
+		k := key{cond.Start, cond.Code}
+		if indexes := index[k]; len(indexes) > 0 {
+			index[k] = indexes[1:]
+			used[indexes[0]] = true
+			all = append(all, conds[indexes[0]])
+		} else {
+			all = append(all, cond)
+		}
+	}
+	for i, cond := range conds {
+		if !used[i] {
+			all = append(all, cond)
+		}
+	}
+	return all
+}
+
+// redirectOutput makes the report go to the -output file,
+// returning the function that restores the output to stdout.
+func (g *gobco) redirectOutput() (restore func()) {
+	if g.outputFilename == "" {
+		return func() {}
+	}
+
+	f, err := os.Create(g.outputFilename)
+	g.check(err)
+	stdout := g.stdout
+	g.stdout = f
+	return func() {
+		g.stdout = stdout
+		g.check(f.Close())
+	}
+}
+
+// writeStats writes the conditions in the same format
+// as the instrumented code.
+func (g *gobco) writeStats(filename string, conds []condition) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if !g.statsCompact {
+		encoder.SetIndent("", "\t")
+	}
+	encoder.SetEscapeHTML(false)
+	g.check(encoder.Encode(conds))
+	g.check(os.WriteFile(filename, buf.Bytes(), 0o666))
+}
+
+// mergeConditions adds the counts of the conditions to the previous ones.
+// Conditions are identified by their start and their code,
+// as several conditions may start at the same position, as in 'a && b'.
+// New conditions are appended in their original order.
+func mergeConditions(prev, conds []condition) []condition {
+	type key struct {
+		start string
+		code  string
+	}
+
+	merged := append([]condition(nil), prev...)
+	index := map[key]int{}
+	for i, cond := range merged {
+		index[key{cond.Start, cond.Code}] = i
+	}
+
+	for _, cond := range conds {
+		if i, ok := index[key{cond.Start, cond.Code}]; ok {
+			merged[i].TrueCount += cond.TrueCount
+			merged[i].FalseCount += cond.FalseCount
+			merged[i].Tests = mergeTests(merged[i].Tests, cond.Tests)
+		} else {
+			index[key{cond.Start, cond.Code}] = len(merged)
+			merged = append(merged, cond)
+		}
+	}
+	return merged
+}
+
+// mergeTests returns the sorted union of the test names.
+func mergeTests(prev, tests []string) []string {
+	if len(tests) == 0 {
+		return prev
+	}
+	seen := map[string]bool{}
+	var merged []string
+	for _, test := range append(append([]string(nil), prev...), tests...) {
+		if !seen[test] {
+			seen[test] = true
+			merged = append(merged, test)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// printTimings lists the duration of each 'go test' run, slowest first.
+func (g *gobco) printTimings() {
+	if !g.timings && !g.verbose {
+		return
+	}
+
+	durations := append([]testDuration(nil), g.durations...)
+	sort.SliceStable(durations, func(i, j int) bool {
+		return durations[i].duration > durations[j].duration
+	})
+
+	printf := g.debugf
+	if g.timings {
+		printf = g.outf
+	}
+	for _, d := range durations {
+		printf("Testing %s took %s", d.arg, d.duration.Round(time.Millisecond))
+	}
+}
+
+func (g *gobco) printOutput() {
+	conds, err := g.load(g.statsFilename)
+	if err != nil && g.exitCode != 0 {
+		return // skip silently, 'go test' has already reported the cause
+	}
+	if err != nil {
+		g.logger.errf("%s", err)
+		g.fail(exitError)
+		return
+	}
+	if g.includeUntested {
+		conds = includeUntested(g.discovered, conds)
+	}
+	if g.excludeConstant {
+		conds = nonConstant(conds)
+	}
+	if g.embedSource {
+		conds = g.withSource(conds)
+	}
+
+	cnt, total := 0, 0
+	for _, c := range conds {
+		cnt += coveredUnits(c, g.lenientErrors, g.metric)
+		total += countedUnits(c, g.metric)
+	}
+
+	kind := "Condition coverage"
+	if g.branch {
+		kind = "Branch coverage"
+	}
+	switch g.format {
+	case "shields":
+		g.printShieldsBadge(cnt, total)
+	case "gocover":
+		g.check(writeGoCoverProfile(g.stdout, g.redactedConds(conds), g.lenientErrors))
+	case "markdown":
+		g.check(writeMarkdown(g.stdout, kind, conds, g.lenientErrors, g.listAll, g.displayFile))
+	case "json":
+		g.check(writeJSONReport(g.stdout, g.branch, g.redactedConds(conds), g.lenientErrors, g.listAll))
+	case "jsonl":
+		g.check(writeJSONLines(g.stdout, g.redactedConds(conds), g.lenientErrors, g.listAll))
+	case "prometheus":
+		g.check(writePrometheus(g.stdout, g.branch, conds, g.lenientErrors, g.displayFile))
+	default:
+		if g.tui && g.browse(conds) {
+			g.outf("%s: %d/%d%s", kind, cnt, total, g.metricSuffix())
+		} else {
+			g.printReport(kind, conds, cnt, total)
+		}
+	}
+
+	g.checkPerFileThreshold(conds)
+	g.checkMinBranches(conds)
+	g.checkFailFast(conds)
+
+	if g.htmlFilename != "" || g.open {
+		g.writeHTMLReport(kind, conds)
+	}
+
+	if g.historyFilename != "" {
+		g.recordHistory(cnt, total)
+	}
+
+	if g.onFinish != "" {
+		g.finishReport = newFinishReport(g.branch, conds, g.lenientErrors)
+	}
+}
+
+// printReport prints the coverage as text, for humans.
+func (g *gobco) printReport(kind string, conds []condition, cnt, total int) {
+	g.outf("")
+	g.outf("%s: %d/%d%s", kind, cnt, total, g.metricSuffix())
+	if g.runPattern != "" {
+		g.outf("(covered by the tests matching %q, "+
+			"the total still includes all conditions)", g.runPattern)
+	}
+	if g.goCoverCompat {
+		g.printGoCoverSummary(cnt, total)
+	}
+	if g.diffCoverage != "" {
+		g.printDiffCoverage(kind, conds)
+	}
+
+	if g.focus != nil {
+		g.printFocus(conds)
+	} else if g.newUncovered {
+		g.printNewUncovered(conds)
+	} else if g.byFile {
+		g.printByFile(conds)
+	} else if g.tree {
+		g.printTree(conds)
+	} else if g.pretty {
+		g.printPretty(conds)
+	} else {
+		g.printConds(conds)
+	}
+
+	g.printSuspectConstant(conds)
+	g.printSkewed(conds)
+	g.printSkipped()
+}
+
+// metricSuffix describes the unit of the coverage in the summary line
+// for -metric=conditions, to distinguish it from the default,
+// which counts both outcomes of each condition.
+func (g *gobco) metricSuffix() string {
+	if g.metric != "conditions" {
+		return ""
+	}
+	unit := "conditions"
+	if g.branch {
+		unit = "branches"
+	}
+	return fmt.Sprintf(" %s with both outcomes covered", unit)
+}
+
+// printDiffCoverage prints the coverage of the conditions
+// on the lines that changed since the -diff-coverage ref,
+// which is the coverage of the change under review.
+func (g *gobco) printDiffCoverage(kind string, conds []condition) {
+	changed, err := gitChangedLines(g.argDirs(), g.diffCoverage)
+	g.check(err)
+
+	label := "Diff " + strings.ToLower(kind[:1]) + kind[1:]
+	cnt, total := changed.coverage(conds, g.lenientErrors)
+	if total == 0 {
+		g.outf("%s: no conditions on the changed lines", label)
+		return
+	}
+	g.outf("%s: %d/%d (%.1f%%)", label, cnt, total, coveragePercent(cnt, total))
+}
+
+// printShieldsBadge prints the coverage as JSON for a shields.io badge.
+func (g *gobco) printShieldsBadge(cnt, total int) {
+	badge := newShieldsBadge(g.branch, cnt, total, g.badgeThresholds)
+	js, err := json.Marshal(badge)
+	g.check(err)
+	g.outf("%s", js)
+}
+
+// printGoCoverSummary prints the coverage in the same form as
+// 'go test -cover', so that existing scripts can parse it.
+func (g *gobco) printGoCoverSummary(covered, total int) {
+	kind, unit := "condition", "conditions"
+	if g.branch {
+		kind, unit = "branch", "branches"
+	}
+	if total == 0 {
+		g.outf("%s coverage: [no %s]", kind, unit)
+		return
+	}
+	g.outf("%s coverage: %.1f%% of %s",
+		kind, 100*float64(covered)/float64(total), unit)
+}
+
+// weighted returns the conditions in the order in which they are listed.
+// With -weight depth, the most deeply nested conditions come first,
+// since these are the hardest to reach from the tests.
+// When grouping by function, the order only changes within each function.
+func (g *gobco) weighted(conds []condition) []condition {
+	if g.weight != "depth" {
+		return conds
+	}
+
+	sorted := append([]condition(nil), conds...)
+	start := 0
+	for end := range sorted {
+		last := end == len(sorted)-1
+		if !last && (g.groupBy != "func" || sorted[end+1].Func == sorted[start].Func) {
+			continue
+		}
+		group := sorted[start : end+1]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Depth > group[j].Depth
+		})
+		start = end + 1
+	}
+	return sorted
+}
+
+// printSuspectConstant lists the conditions that were evaluated often
+// but always had the same outcome, which suggests dead code
+// or a bug in the condition.
+func (g *gobco) printSuspectConstant(conds []condition) {
+	if g.suspectConstant <= 0 {
+		return
+	}
+
+	found := false
+	for _, cond := range conds {
+		onlyOneWay := (cond.TrueCount == 0) != (cond.FalseCount == 0)
+		if !onlyOneWay || cond.TrueCount+cond.FalseCount < g.suspectConstant {
+			continue
+		}
+		if g.lenientErrors && cond.ErrorCheck {
+			continue
+		}
+		if cond.Constant != "" {
+			continue // it is known to be constant
+		}
+		if cond.TrueCount == 0 && cond.IgnoreTrue || cond.FalseCount == 0 && cond.IgnoreFalse {
+			continue
+		}
+		if !found {
+			g.outf("")
+			g.outf("Possibly constant conditions:")
+			found = true
+		}
+		g.outf("%s: possibly constant condition %q %s",
+			g.location(cond.Start), g.displayCode(cond.Code), describeCounts(cond.TrueCount, cond.FalseCount))
+	}
+
+	if found {
+		g.fail(exitError)
+	}
+}
+
+// printSkewed lists the conditions that were both true and false,
+// but one of the outcomes makes up more than 99% of the evaluations.
+// Such conditions are nearly constant in practice,
+// which often hints at a copy-and-paste mistake or a missing test case.
+// Unlike the possibly constant conditions, they don't fail the run.
+func (g *gobco) printSkewed(conds []condition) {
+	if !g.skew {
+		return
+	}
+
+	found := false
+	for _, cond := range conds {
+		if cond.TrueCount == 0 || cond.FalseCount == 0 {
+			continue
+		}
+		total := cond.TrueCount + cond.FalseCount
+		majority, outcome := cond.TrueCount, "true"
+		if cond.FalseCount > cond.TrueCount {
+			majority, outcome = cond.FalseCount, "false"
+		}
+		if 100*majority <= 99*total {
+			continue
+		}
+		if !found {
+			g.outf("")
+			g.outf("Skewed conditions:")
+			found = true
+		}
+		g.outf("%s: skewed condition %q %s (%.1f%% %s)",
+			g.location(cond.Start), g.displayCode(cond.Code),
+			describeCounts(cond.TrueCount, cond.FalseCount),
+			coveragePercent(majority, total), outcome)
+	}
+}
+
+// printSkipped lists the files of the packages under test
+// that were not instrumented, so that the coverage doesn't appear
+// to include them. With -matrix, a file only counts as skipped
+// if it was not instrumented with any of the tag sets.
+func (g *gobco) printSkipped() {
+	if !g.reportSkipped {
+		return
+	}
+
+	instrumented := map[string]bool{}
+	for _, filename := range g.dump.Instrumented {
+		instrumented[filename] = true
+	}
+	var files []uninstrumentedFile
+	reported := map[string]bool{}
+	for _, file := range g.uninstrumented {
+		if !instrumented[file.filename] && !reported[file.filename] {
+			reported[file.filename] = true
+			files = append(files, file)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].filename < files[j].filename
+	})
+
+	g.outf("")
+	if len(files) == 0 {
+		g.outf("All files were instrumented.")
+		return
+	}
+	g.outf("Files that were not instrumented:")
+	for _, file := range files {
+		g.outf("%s: %s (%s)",
+			g.displayFile(file.filename), file.reason, skipReasons[file.reason])
+	}
+}
+
+// writeHTMLReport writes the coverage report as HTML
+// and optionally opens it in a web browser.
+func (g *gobco) writeHTMLReport(kind string, conds []condition) {
+	g.writeHTMLFile(func(w io.Writer) error {
+		return writeHTML(w, g.reportTemplates(), kind, g.redactedConds(conds), g.lenientErrors)
+	})
+}
+
+// writeHTMLDiffReport compares the coverage from 2 stats files.
+// The locations in the stats files are interpreted
+// relative to the current working directory.
+func (g *gobco) writeHTMLDiffReport() {
+	old, err := g.load(g.diffStats[0])
+	g.check(err)
+	cur, err := g.load(g.diffStats[1])
+	g.check(err)
+
+	kind := "Condition coverage"
+	if g.branch {
+		kind = "Branch coverage"
+	}
+	g.writeHTMLFile(func(w io.Writer) error {
+		return writeHTMLDiff(w, g.reportTemplates(), kind, old, cur, g.lenientErrors, g.sourceLines)
+	})
+}
+
+// reportTemplates returns the templates for the HTML reports.
+func (g *gobco) reportTemplates() *htmltemplate.Template {
+	if g.htmlTemplates != nil {
+		return g.htmlTemplates
+	}
+	return defaultHTMLTemplates
+}
+
+// writeHTMLFile writes an HTML report to the -html file,
+// or to a temporary file, and optionally opens it in the browser.
+func (g *gobco) writeHTMLFile(write func(w io.Writer) error) {
+	if g.htmlFilename == "" {
+		// Not in tmpdir, as the browser may need the file after cleanUp.
+		f, err := os.CreateTemp("", "gobco-*.html")
+		g.check(err)
+		g.check(f.Close())
+		g.htmlFilename = f.Name()
+	}
+
+	f, err := os.Create(g.htmlFilename)
+	g.check(err)
+	err = write(f)
+	closeErr := f.Close()
+	g.check(err)
+	g.check(closeErr)
+	g.infof("Wrote the HTML report to %s", g.htmlFilename)
+
+	if g.open {
+		g.openInBrowser(g.htmlFilename)
+	}
+}
+
+// openInBrowser opens the file in the default web browser,
+// without waiting for the browser to finish.
+func (g *gobco) openInBrowser(filename string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", filename)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", filename)
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			g.warnf("gobco: not opening %s since there is no display", filename)
+			return
+		}
+		cmd = exec.Command("xdg-open", filename)
+	}
+
+	if err := cmd.Start(); err != nil {
+		g.warnf("gobco: cannot open %s: %s", filename, err)
+	}
+}
+
+// handleSignals stops the 'go test' process that may currently be running
+// when gobco is interrupted or terminated.
+// The main goroutine then cleans up in stopIfInterrupted,
+// as soon as the interrupted command has returned.
+// The returned function stops handling the signals.
+func (g *gobco) handleSignals() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		select {
+		case sig := <-signals:
+			g.errf("gobco: %s", sig)
+			g.interrupt(sig)
+		case <-done:
+		}
+	}()
+
+	// If a signal arrived, wait for the handler,
+	// so that the exit code is 130 instead of the one from 'go test'.
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		<-finished
+		g.stopIfInterrupted()
+	}
+}
+
+// stopIfInterrupted exits with code 130 if gobco has received a signal,
+// after running the -after command, writing the -debug-dump file
+// and removing the temporary directory.
+// It must only be called on the main goroutine,
+// which is the only one that reads the files in the temporary directory.
+func (g *gobco) stopIfInterrupted() {
+	g.mu.Lock()
+	sig := g.signal
+	g.mu.Unlock()
+	if sig == nil {
+		return
+	}
+
+	g.runAfter()
+	g.exitCode = exitInterrupted
+	g.writeDebugDump(fmt.Errorf("gobco: %s", sig))
+	g.cleanUp()
+	exit(exitInterrupted)
+}
+
+func (g *gobco) cleanUp() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cleanedUp {
+		return
+	}
+	g.cleanedUp = true
+
+	if g.keep {
+		g.writeKeptIndex()
+	}
+	tmpdir := g.tmpdir
+	if g.outer != "" {
+		tmpdir = g.outer
+	}
+	if g.keep || g.keepOnFailure && g.exitCode != 0 {
+		g.errf("")
+		g.errf("gobco: the temporary files are in %s", tmpdir)
+	} else {
+		err := os.RemoveAll(tmpdir)
+		if err != nil {
+			g.infof("%s", err)
+		}
+	}
+}
+
+// load reads the conditions from the stats file,
+// or from stdin if the filename is "-".
+// A file that was never created is distinguished from an empty file,
+// as the latter means that writing the file failed halfway.
+func (g *gobco) load(filename string) ([]condition, error) {
+	if filename == "-" {
+		return g.decodeStats(stdin, "<stdin>")
+	}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("error: the stats file %s was never created: %w", filename, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		closeErr := file.Close()
+		g.check(closeErr)
+	}()
+
+	return g.decodeStats(file, filename)
+}
+
+// decodeStats reads the conditions in JSON format,
+// naming the stats file in the error messages.
+func (g *gobco) decodeStats(r io.Reader, filename string) ([]condition, error) {
+	var data []condition
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	if g.strictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(&data)
+	if err == io.EOF {
+		return nil, fmt.Errorf("error: the stats file %s is empty", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: the stats file %s is invalid: %s", filename, err)
+	}
+
+	// Stats files from older versions of gobco only have the Start.
+	for i := range data {
+		if data[i].File == "" {
+			data[i].File, data[i].Line, data[i].Col, _ = splitStart(data[i].Start)
+		}
+	}
+
+	return data, nil
+}
+
+// isReported returns whether printCond prints the condition.
+func (g *gobco) isReported(cond condition) bool {
+	return g.listAll || !fullyCovered(cond, g.lenientErrors)
+}
+
+// printConds prints the individual conditions, in the order of -weight.
+func (g *gobco) printConds(conds []condition) {
+	listed := g.weighted(conds)
+	groupStart, printedGroup := 0, -1
+	for ci, cond := range listed {
+		if ci > 0 && cond.Func != listed[ci-1].Func {
+			groupStart = ci
+		}
+		if g.groupBy == "func" && g.isReported(cond) && groupStart != printedGroup {
+			g.printFuncHeader(listed[groupStart:])
+			printedGroup = groupStart
+		}
+		g.printCond(cond)
+		if g.failFast && !fullyCovered(cond, g.lenientErrors) {
+			g.fail(exitThreshold)
+			break
+		}
+	}
+}
+
+// printByFile prints a single line per file,
+// with the number of covered outcomes instead of the conditions.
+func (g *gobco) printByFile(conds []condition) {
+	unit := "conditions"
+	if g.branch {
+		unit = "branches"
+	}
+	for _, file := range coverageByFile(conds, g.lenientErrors, g.metric, g.displayFile) {
+		percent := 100
+		if file.total > 0 {
+			percent = 100 * file.covered / file.total
+		}
+		g.outf("%s: %d/%d %s (%d%%)",
+			file.filename, file.covered, file.total, unit, percent)
+	}
+}
+
+// fileCoverage is the coverage of the conditions from a single file.
+type fileCoverage struct {
+	filename string
+	covered  int
+	total    int
+}
+
+// coverageByFile groups the conditions by their file,
+// in the order in which the files first appear,
+// counting the coverage according to the -metric.
+func coverageByFile(conds []condition, lenientErrors bool, metric string, displayFile func(filename string) string) []fileCoverage {
+	var files []fileCoverage
+	index := map[string]int{}
+	for _, cond := range conds {
+		filename := displayFile(cond.File)
+		i, seen := index[filename]
+		if !seen {
+			i = len(files)
+			index[filename] = i
+			files = append(files, fileCoverage{filename: filename})
 		}
+		files[i].covered += coveredUnits(cond, lenientErrors, metric)
+		files[i].total += countedUnits(cond, metric)
 	}
+	return files
+}
 
-	if relDir := g.findInGopath(dir); relDir != "" {
-		relDir := filepath.Join("gopath", relDir)
-		return argInfo{
-			arg:       arg,
-			argDir:    dir,
-			module:    false,
-			copySrc:   dir,
-			copyDst:   relDir,
-			instrFile: base,
-			instrDir:  relDir,
+// checkPerFileThreshold fails the run if the coverage of any file
+// is below the -per-file-threshold,
+// so that a well-tested file cannot hide the untested ones.
+func (g *gobco) checkPerFileThreshold(conds []condition) {
+	if g.perFileThreshold <= 0 {
+		return
+	}
+
+	var below []fileCoverage
+	for _, file := range coverageByFile(conds, g.lenientErrors, g.metric, g.displayFile) {
+		if coveragePercent(file.covered, file.total) < g.perFileThreshold {
+			below = append(below, file)
 		}
 	}
+	if len(below) == 0 {
+		return
+	}
 
-	g.check(fmt.Errorf("error: argument %q must be inside GOPATH", arg))
-	panic("unreachable")
+	g.errf("error: the coverage of these files is below -per-file-threshold=%g:",
+		g.perFileThreshold)
+	for _, file := range below {
+		g.errf("  %s: %d/%d (%.1f%%)", file.filename, file.covered, file.total,
+			coveragePercent(file.covered, file.total))
+	}
+	g.fail(exitThreshold)
 }
 
-// findInGopath returns the directory relative to the enclosing GOPATH, if any.
-func (g *gobco) findInGopath(arg string) string {
-	gopaths := g.gopaths()
-
-	abs, err := filepath.Abs(arg)
-	g.check(err)
-
-	for _, gopath := range filepath.SplitList(gopaths) {
+// checkMinBranches fails the run if the report has fewer conditions
+// than -min-branches, since a suspiciously small number of conditions
+// hints at files that were left out by mistake,
+// such as by the build tags or by .gobcoignore.
+func (g *gobco) checkMinBranches(conds []condition) {
+	if len(conds) >= g.minBranches {
+		return
+	}
 
-		rel, err := filepath.Rel(gopath, abs)
-		g.check(err)
+	g.errf("error: only %d conditions were instrumented, "+
+		"but -min-branches requires at least %d", len(conds), g.minBranches)
+	g.fail(exitThreshold)
+}
 
-		if strings.HasPrefix(rel, "src") {
-			return rel
+// checkFailFast fails the run if any condition is not fully covered.
+// The text report already stops at the first such condition,
+// see printConds, while the other formats list all conditions.
+func (g *gobco) checkFailFast(conds []condition) {
+	if !g.failFast {
+		return
+	}
+	for _, cond := range conds {
+		if !fullyCovered(cond, g.lenientErrors) {
+			g.fail(exitThreshold)
+			return
 		}
 	}
-	return ""
 }
 
-func (g *gobco) gopaths() string {
-	gopaths := os.Getenv("GOPATH")
-	if gopaths != "" {
-		return gopaths
+// printPretty prints the reported conditions as a table,
+// followed by the totals of all conditions.
+// On a terminal, the status is colored.
+func (g *gobco) printPretty(conds []condition) {
+	color := g.useColor(g.stdout)
+
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "LOCATION\tTRUE\tFALSE\tSTATUS\n")
+	covered, total, trueCount, falseCount := 0, 0, 0, 0
+	for _, cond := range g.weighted(conds) {
+		covered += coveredOutcomes(cond, g.lenientErrors)
+		total += countedOutcomes(cond)
+		trueCount += cond.TrueCount
+		falseCount += cond.FalseCount
+		if !g.isReported(cond) {
+			continue
+		}
+		status := prettyStatus(cond, g.lenientErrors)
+		if color {
+			code := "31" // red
+			if fullyCovered(cond, g.lenientErrors) {
+				code = "32" // green
+			}
+			status = "\x1b[" + code + "m" + status + "\x1b[0m"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n",
+			g.location(cond.Start), cond.TrueCount, cond.FalseCount, status)
 	}
+	percent := 100
+	if total > 0 {
+		percent = 100 * covered / total
+	}
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%d/%d covered (%d%%)\n",
+		trueCount, falseCount, covered, total, percent)
+	_ = tw.Flush()
 
-	home, err := os.UserHomeDir()
-	g.check(err)
-	return filepath.Join(home, "go")
+	g.outf("")
+	g.outf("%s", strings.TrimSuffix(sb.String(), "\n"))
 }
 
-func (g *gobco) findInModule(dir string) (string, string) {
-	moduleRoot, moduleRel, err := findInModule(dir)
-	g.check(err)
-	return moduleRoot, moduleRel
+// prettyStatus summarizes the coverage of a condition in a few words.
+func prettyStatus(cond condition, lenientErrors bool) string {
+	switch {
+	case fullyCovered(cond, lenientErrors):
+		return "covered"
+	case cond.Constant != "":
+		return "constant " + cond.Constant
+	case cond.TrueCount == 0 && cond.FalseCount == 0:
+		return "never evaluated"
+	case cond.TrueCount == 0:
+		return "never true"
+	default:
+		return "never false"
+	}
 }
 
-// findInModule finds path of moduleRoot and relative path from the moduleRoot to dir
-func findInModule(dir string) (moduleRoot, moduleRel string, err error) {
-	absDir, err := filepath.Abs(dir)
-	if err != nil {
-		return "", "", err
-	}
+// useColor returns whether the output to w may be colored,
+// which is only the case for a terminal.
+// All colored output must be guarded by this function,
+// so that -no-color and NO_COLOR apply to it.
+func (g *gobco) useColor(w io.Writer) bool {
+	return g.colorAllowed() && isTerminal(w)
+}
 
-	abs := absDir
-	for {
-		if _, err := os.Lstat(filepath.Join(abs, "go.mod")); err == nil {
-			rel, err := filepath.Rel(abs, absDir)
-			if err != nil {
-				return "", "", err
-			}
+// colorAllowed returns whether coloring the output is allowed at all.
+// Following https://no-color.org, a non-empty NO_COLOR
+// environment variable disables the colors, just like -no-color.
+func (g *gobco) colorAllowed() bool {
+	return !g.noColor && os.Getenv("NO_COLOR") == ""
+}
 
-			root := abs
-			if rel == "." {
-				root = dir
-			}
+// isTerminal returns whether the output goes directly to a terminal,
+// rather than to a file or a pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-			return root, rel, nil
+// printFuncHeader starts a group of conditions from the same function,
+// printing the function name and the number of covered outcomes.
+func (g *gobco) printFuncHeader(conds []condition) {
+	fn := conds[0].Func
+	covered, total := 0, 0
+	for _, cond := range conds {
+		if cond.Func != fn {
+			break
 		}
+		covered += coveredOutcomes(cond, g.lenientErrors)
+		total += countedOutcomes(cond)
+	}
 
-		parent := filepath.Dir(abs)
-		if parent == abs {
-			return "", "", nil
-		}
-		abs = parent
+	name := fn
+	if name == "" {
+		name = "(outside functions)"
 	}
+	g.outf("")
+	g.outf("%s: %d/%d", name, covered, total)
 }
 
-// prepareTmp copies the source files to the temporary directory.
-//
-// Later, gobco.instrumenter will overwrite some of these files.
-func (g *gobco) prepareTmp() {
-	if g.statsFilename != "" {
-		var err error
-		g.statsFilename, err = filepath.Abs(g.statsFilename)
-		g.check(err)
+func (g *gobco) printCond(cond condition) {
+	if g.isReported(cond) {
+		g.printCondDetails(cond)
+	}
+}
+
+// printCondDetails prints the condition, even if it is fully covered.
+func (g *gobco) printCondDetails(cond condition) {
+	start := g.location(cond.Start)
+	if g.template != nil {
+		report := newConditionReport(cond, g.lenientErrors)
+		report.Start = start
+		var sb strings.Builder
+		g.check(g.template.Execute(&sb, report))
+		g.outf("%s", strings.TrimSuffix(sb.String(), "\n"))
 	} else {
-		g.statsFilename = g.file("gobco-counts.json")
+		g.outf("%s: condition %q %s",
+			start, g.displayCode(cond.Code), describeCondition(cond))
 	}
 
-	// TODO: Research how "package/..." is handled by other go commands.
-	for _, arg := range g.args {
-		dstDir := g.file(arg.copyDst)
-		g.check(copyDir(arg.copySrc, dstDir))
+	if g.explain {
+		if explanation := explainCondition(cond, g.lenientErrors); explanation != "" {
+			g.outf("    %s", explanation)
+		}
+	}
+
+	if g.context > 0 {
+		g.printContext(cond)
 	}
 }
 
-func (g *gobco) instrument() bool {
-	in := instrumenter{
-		g.branch,
-		g.coverTest,
-		g.immediately,
-		g.listAll,
-		false,
-		nil,
-		map[*ast.Package]*types.Package{},
-		map[ast.Expr]types.Type{},
-		nil,
-		0,
-		map[ast.Expr]bool{},
-		map[ast.Expr]*exprSubst{},
-		map[ast.Stmt]*ast.Stmt{},
-		map[ast.Stmt]ast.Stmt{},
-		false,
-		nil,
+// location formats the start of a condition according to -path-style.
+// The original form is relative to the current working directory
+// if the package was given as a relative path.
+// The relative form only keeps the base name of the file,
+// as all files of a package are in the same directory.
+func (g *gobco) location(start string) string {
+	filename, _, ok := parseStart(start)
+	if !ok {
+		return start
 	}
+	return g.displayFile(filename) + start[len(filename):]
+}
 
-	found := false
-	for _, arg := range g.args {
-		instrDst := g.file(arg.instrDir)
-		if in.instrument(arg.argDir, arg.instrFile, instrDst) {
-			found = true
-			g.verbosef("Instrumented %s to %s", arg.arg, instrDst)
-		}
+// displayCode returns the code of a condition for the text report,
+// shortened to -max-code-width, so that a condition spanning
+// several lines doesn't flood the terminal.
+// The other formats keep the full code.
+func (g *gobco) displayCode(code string) string {
+	return truncateCode(code, g.maxCodeWidth)
+}
+
+// displayFile returns the file name in the form of the -path-style,
+// with the directory redacted if -redact-paths is given.
+func (g *gobco) displayFile(filename string) string {
+	switch g.pathStyle {
+	case "relative":
+		filename = filepath.Base(filename)
+	case "absolute":
+		abs, err := filepath.Abs(filename)
+		g.check(err)
+		filename = abs
 	}
-	return found
+	if g.redactPaths {
+		filename = redactPath(filename)
+	}
+	return filename
 }
 
-func (g *gobco) runGoTest() {
-	for _, arg := range g.args {
-		gopaths := ""
-		if !arg.module {
-			gopaths = g.gopaths()
-		}
-		g.exitCode = goTest{}.run(
-			arg,
-			g.goTestArgs,
-			g.verbose,
-			gopaths,
-			g.statsFilename,
-			&g.buildEnv,
-		)
+// redactPath replaces the directory of the file with a short hash,
+// keeping the base name, so that a report can be shared
+// without revealing the directory structure.
+// The same directory always results in the same hash.
+func redactPath(filename string) string {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		return base
 	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(filepath.Clean(dir))))
+	return filepath.Join(hex.EncodeToString(sum[:4]), base)
 }
 
-func (g *gobco) printOutput() {
-	conds, err := g.load(g.statsFilename)
-	if err != nil && g.exitCode != 0 {
-		return // skip silently
+// redactedConds returns the conditions with their file names redacted,
+// for the exporters that write the conditions as they are.
+// The conditions from the stats file are left unchanged.
+func (g *gobco) redactedConds(conds []condition) []condition {
+	if !g.redactPaths {
+		return conds
 	}
-	if err != nil {
-		g.logger.errf("%s", err)
+	redacted := make([]condition, len(conds))
+	for i, cond := range conds {
+		cond.Start = g.location(cond.Start)
+		cond.File = g.displayFile(cond.File)
+		redacted[i] = cond
 	}
+	return redacted
+}
 
-	cnt := 0
-	for _, c := range conds {
-		if c.TrueCount > 0 {
-			cnt++
+// printContext prints the source code around the condition,
+// underlining the code of the condition.
+func (g *gobco) printContext(cond condition) {
+	for _, line := range g.sourceContext(cond, g.context) {
+		marker := " "
+		if line.Line == cond.Line {
+			marker = ">"
 		}
-		if c.FalseCount > 0 {
-			cnt++
+		g.outf("%s %5d  %s", marker, line.Line, line.Text)
+		if line.Line == cond.Line {
+			if underline := underlineCondition(line.Text, cond); underline != "" {
+				g.outf("%s %5s  %s", " ", "", underline)
+			}
 		}
 	}
+}
 
-	kind := "Condition coverage"
-	if g.branch {
-		kind = "Branch coverage"
+// sourceLine is a numbered line of source code.
+type sourceLine struct {
+	Line int
+	Text string
+}
+
+// sourceContext returns the lines of source code around the condition,
+// n lines before and after the line in which the condition starts.
+func (g *gobco) sourceContext(cond condition, n int) []sourceLine {
+	filename, line, ok := parseStart(cond.Start)
+	if !ok {
+		return nil
 	}
-	g.outf("")
-	g.outf("%s: %d/%d", kind, cnt, len(conds)*2)
+	lines := g.sourceLines(filename)
 
-	for _, cond := range conds {
-		g.printCond(cond)
+	from := line - n
+	if from < 1 {
+		from = 1
 	}
+	to := line + n
+	if to > len(lines) {
+		to = len(lines)
+	}
+
+	var context []sourceLine
+	for i := from; i <= to; i++ {
+		context = append(context, sourceLine{i, lines[i-1]})
+	}
+	return context
 }
 
-func (g *gobco) cleanUp() {
-	if g.keep {
-		g.errf("")
-		g.errf("gobco: the temporary files are in %s", g.tmpdir)
-	} else {
-		err := os.RemoveAll(g.tmpdir)
-		if err != nil {
-			g.verbosef("%s", err)
+// withSource returns the conditions together with the source code
+// around them, for -embed-source.
+// The conditions from the stats file are left unchanged.
+func (g *gobco) withSource(conds []condition) []condition {
+	n := g.context
+	if n == 0 {
+		n = 2
+	}
+	embedded := make([]condition, len(conds))
+	for i, cond := range conds {
+		cond.Source = g.sourceContext(cond, n)
+		embedded[i] = cond
+	}
+	return embedded
+}
+
+// underlineCondition returns the line that marks the code of the condition
+// below the line of source code in which the condition starts.
+// The tabs from the source code are kept, so that the marks align.
+// For stats files without the end of the conditions,
+// only the start is marked.
+func underlineCondition(text string, cond condition) string {
+	from, to, ok := conditionSpan(text, cond)
+	if !ok {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, r := range text[:from] {
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
 		}
 	}
+	n := utf8.RuneCountInString(text[from:to])
+	if n == 0 {
+		n = 1
+	}
+	sb.WriteString(strings.Repeat("^", n))
+	return sb.String()
 }
 
-func (g *gobco) load(filename string) ([]condition, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// conditionSpan returns the byte offsets of the code of the condition
+// in the line of source code in which the condition starts.
+// If the condition continues on the next line, the span extends
+// to the end of the line.
+// Without the end of the condition, the span is empty.
+func conditionSpan(text string, cond condition) (from, to int, ok bool) {
+	if cond.Col < 1 || cond.Col-1 > len(text) {
+		return 0, 0, false
+	}
+	from = cond.Col - 1
+	switch {
+	case cond.EndLine == 0:
+		to = from
+	case cond.EndLine > cond.Line:
+		to = len(text)
+	case cond.EndCol-1 >= from && cond.EndCol-1 <= len(text):
+		to = cond.EndCol - 1
+	default:
+		return 0, 0, false
 	}
+	return from, to, true
+}
 
-	defer func() {
-		closeErr := file.Close()
-		g.check(closeErr)
-	}()
+// sourceLines returns the lines of the given file,
+// reading each file only once.
+func (g *gobco) sourceLines(filename string) []string {
+	if lines, found := g.sources[filename]; found {
+		return lines
+	}
 
-	var data []condition
-	decoder := json.NewDecoder(bufio.NewReader(file))
-	decoder.DisallowUnknownFields()
-	g.check(decoder.Decode(&data))
+	var lines []string
+	content, err := os.ReadFile(filename)
+	if err == nil {
+		text := strings.TrimSuffix(string(content), "\n")
+		lines = strings.Split(text, "\n")
+	} else {
+		g.debugf("%s", err)
+	}
 
-	return data, nil
+	if g.sources == nil {
+		g.sources = map[string][]string{}
+	}
+	g.sources[filename] = lines
+	return lines
 }
 
-func (g *gobco) printCond(cond condition) {
+// parseStart is like splitStart, without the column.
+func parseStart(start string) (filename string, line int, ok bool) {
+	filename, line, _, ok = splitStart(start)
+	return
+}
 
-	trueCount := cond.TrueCount
-	falseCount := cond.FalseCount
-	if !g.listAll && trueCount > 0 && falseCount > 0 {
-		return
+// splitStart splits a location of the form "file.go:line:column".
+// Since the line and column are taken from the end,
+// the file name may contain colons, as in "C:\src\main.go:17:13".
+func splitStart(start string) (filename string, line, col int, ok bool) {
+	colColon := strings.LastIndexByte(start, ':')
+	if colColon < 0 {
+		return "", 0, 0, false
 	}
-
-	start := cond.Start
-	code := cond.Code
-	switch {
-	case trueCount == 0 && falseCount == 0:
-		g.outf("%s: condition %q was never evaluated",
-			start, code)
-	case trueCount == 0 && falseCount == 1:
-		g.outf("%s: condition %q was once false but never true",
-			start, code)
-	case trueCount == 0:
-		g.outf("%s: condition %q was %d times false but never true",
-			start, code, falseCount)
-	case trueCount == 1 && falseCount == 0:
-		g.outf("%s: condition %q was once true but never false",
-			start, code)
-	case trueCount == 1 && falseCount == 1:
-		g.outf("%s: condition %q was once true and once false",
-			start, code)
-	case trueCount == 1:
-		g.outf("%s: condition %q was once true and %d times false",
-			start, code, falseCount)
-	case falseCount == 0:
-		g.outf("%s: condition %q was %d times true but never false",
-			start, code, trueCount)
-	case falseCount == 1:
-		g.outf("%s: condition %q was %d times true and once false",
-			start, code, trueCount)
-	default:
-		g.outf("%s: condition %q was %d times true and %d times false",
-			start, code, trueCount, falseCount)
+	lineColon := strings.LastIndexByte(start[:colColon], ':')
+	if lineColon < 0 {
+		return "", 0, 0, false
+	}
+	line, err := strconv.Atoi(start[lineColon+1 : colColon])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	col, err = strconv.Atoi(start[colColon+1:])
+	if err != nil {
+		return "", 0, 0, false
 	}
+	return start[:lineColon], line, col, true
 }
 
 // goTest groups the functions that run 'go test' with the proper arguments.
-type goTest struct{}
+type goTest struct {
+	// Whether the output of 'go test' to stdout is discarded,
+	// unless the tests fail, in which case it goes to stderr.
+	hideStdout bool
+	// If non-empty, only the tests matching this regular expression run.
+	runPattern string
+	// How often each test runs, 0 meaning once.
+	count int
+	// The arguments for the test binary, such as flags for TestMain.
+	binaryArgs []string
+	// If non-empty, the command that runs the tests instead of 'go test',
+	// receiving the remaining arguments for 'go test'.
+	runner []string
+	// The additional environment variables,
+	// which override those from the environment of gobco.
+	extraEnv []string
+}
 
 func (t goTest) run(
 	arg argInfo,
@@ -421,28 +3608,48 @@ func (t goTest) run(
 	gopaths string,
 	statsFilename string,
 	e *buildEnv,
-) int {
-	args := t.args(verbose, extraArgs)
-	goTest := exec.Command("go", args[1:]...)
-	goTest.Stdout = e.stdout
-	goTest.Stderr = e.stderr
+	out *logger,
+) (int, time.Duration) {
+	args := t.command(verbose, extraArgs)
+	goTest := exec.Command(args[0], args[1:]...)
+	var hidden bytes.Buffer
+	goTest.Stdout = out.stdout
+	if t.hideStdout {
+		goTest.Stdout = &hidden
+	}
+	goTest.Stderr = out.stderr
 	goTest.Dir = e.file(arg.instrDir)
 	goTest.Env = t.env(e.tmpdir, gopaths, statsFilename)
 
 	cmdline := strings.Join(args, " ")
-	e.verbosef("Running %q in %q", cmdline, goTest.Dir)
+	out.debugf("Running %q in %q", cmdline, goTest.Dir)
 
-	err := goTest.Run()
+	start := time.Now()
+	err := e.runCmd(goTest)
+	duration := time.Since(start)
 	if err != nil {
-		e.errf("go test %s: %s", arg.arg, err)
-		return 1
+		// With '-v', the details of the failed tests go to stdout.
+		_, _ = hidden.WriteTo(out.stderr)
+		out.errf("go test %s: %s", arg.arg, err)
+		return 1, duration
 	} else {
-		e.verbosef("Finished %s", cmdline)
-		return 0
+		out.debugf("Finished %s", cmdline)
+		return 0, duration
+	}
+}
+
+// command returns the command line that runs the tests,
+// which is either 'go test' or the -test-runner
+// followed by the arguments for 'go test'.
+func (t goTest) command(verbose bool, extraArgs []string) []string {
+	args := t.args(verbose, extraArgs)
+	if len(t.runner) == 0 {
+		return args
 	}
+	return append(append([]string(nil), t.runner...), args[2:]...)
 }
 
-func (goTest) args(verbose bool, extraArgs []string) []string {
+func (t goTest) args(verbose bool, extraArgs []string) []string {
 	args := []string{"go", "test"}
 
 	if verbose {
@@ -456,17 +3663,89 @@ func (goTest) args(verbose bool, extraArgs []string) []string {
 	// each time.
 	//
 	// Without this option, 'go test' sometimes needs twice the time.
-	args = append(args, "-test.count", "1")
+	count := t.count
+	if count == 0 {
+		count = 1
+	}
+	args = append(args, "-test.count", strconv.Itoa(count))
+
+	if t.runPattern != "" {
+		args = append(args, "-run", t.runPattern)
+	}
 
 	args = append(args, ".")
 
 	// 'go test' allows flags even after packages.
 	args = append(args, extraArgs...)
 
+	// Everything after -args is passed to the test binary.
+	if len(t.binaryArgs) > 0 {
+		args = append(append(args, "-args"), t.binaryArgs...)
+	}
 	return args
 }
 
-func (goTest) env(tmpdir, gopaths, statsFilename string) []string {
+// buildTags returns the build tags from the options for 'go test'.
+func buildTags(args []string) []string {
+	for i := len(args) - 1; i >= 0; i-- {
+		arg := strings.TrimPrefix(args[i], "-")
+		tags := ""
+		switch {
+		case strings.HasPrefix(arg, "-tags="), strings.HasPrefix(arg, "tags="):
+			tags = args[i][strings.Index(args[i], "=")+1:]
+		case (arg == "-tags" || arg == "tags") && i+1 < len(args):
+			tags = args[i+1]
+		default:
+			continue
+		}
+		if tags == "" {
+			return nil
+		}
+		return strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return nil
+}
+
+// checkBuildable ensures that the build tags select at least one
+// of the Go files of the package, as otherwise 'go test' would fail
+// with an error message that doesn't mention the build tags.
+func checkBuildable(arg argInfo, tags []string) error {
+	if arg.instrFile != "" {
+		return nil
+	}
+
+	ctx := build.Default
+	ctx.BuildTags = tags
+	pkg, err := ctx.ImportDir(arg.argDir, 0)
+	if _, noGo := err.(*build.NoGoError); !noGo || len(pkg.IgnoredGoFiles) == 0 {
+		return nil // Other errors are reported by 'go test'.
+	}
+
+	if len(tags) == 0 {
+		return fmt.Errorf("error: no buildable Go files for package %s", arg.arg)
+	}
+	return fmt.Errorf("error: no buildable Go files for package %s with tags %q",
+		arg.arg, strings.Join(tags, ","))
+}
+
+// checkHasTests implements -require-tests, which ensures that the package
+// has test files, as otherwise all its conditions are reported as never
+// evaluated, which looks like poor tests instead of missing tests.
+func checkHasTests(arg argInfo, tags []string) error {
+	ctx := build.Default
+	ctx.BuildTags = tags
+	pkg, err := ctx.ImportDir(arg.argDir, 0)
+	if err != nil {
+		return nil // Reported by checkBuildable or by 'go test'.
+	}
+	if len(pkg.TestGoFiles) > 0 || len(pkg.XTestGoFiles) > 0 {
+		return nil
+	}
+	return fmt.Errorf("error: package %s has no test files, "+
+		"so none of its conditions can be covered", arg.arg)
+}
+
+func (t goTest) env(tmpdir, gopaths, statsFilename string) []string {
 
 	var env []string
 
@@ -474,6 +3753,10 @@ func (goTest) env(tmpdir, gopaths, statsFilename string) []string {
 		if gopaths == "" && strings.HasPrefix(envVar, "GOPATH=") {
 			continue
 		}
+		// The copied go.work file, if any, is found in a parent directory.
+		if strings.HasPrefix(envVar, "GOWORK=") && envVar != "GOWORK=off" {
+			continue
+		}
 		env = append(env, envVar)
 	}
 
@@ -484,6 +3767,7 @@ func (goTest) env(tmpdir, gopaths, statsFilename string) []string {
 		env = append(env, "GO111MODULE=off")
 	}
 
+	env = append(env, t.extraEnv...)
 	env = append(env, "GOBCO_STATS="+statsFilename)
 
 	return env
@@ -494,17 +3778,144 @@ func (goTest) env(tmpdir, gopaths, statsFilename string) []string {
 type buildEnv struct {
 	tmpdir string
 	*logger
+
+	// Coordinates interrupting gobco with the normal program flow.
+	mu          sync.Mutex
+	running     map[*exec.Cmd]bool // The commands that are currently running.
+	interrupted bool               // Whether to not start any further commands.
+	signal      os.Signal          // The signal that interrupted gobco.
+	cleanedUp   bool               // Whether tmpdir has already been cleaned up.
+
+	// During -matrix, the temporary directory of the whole run,
+	// while tmpdir is the subdirectory of the current tag set.
+	outer string
 }
 
 func (e *buildEnv) init(l *logger) {
 
-	tmpdir := filepath.Join(os.TempDir(), "gobco-"+randomHex(8))
+	tmpdir := tmpdirName("")
+
+	// Only the current user may access the copied code and the stats.
+	// Since os.Mkdir fails if the directory already exists,
+	// no other user can have prepared it in advance.
+	// The same holds for the directory that replaces this one
+	// with -seed or -tmp-prefix, see reinit.
+	l.check(os.Mkdir(tmpdir, 0o700))
+
+	l.debugf("The temporary working directory is %s", tmpdir)
+
+	e.tmpdir = tmpdir
+	e.logger = l
+}
+
+// runCmd runs the command, unless gobco has been interrupted,
+// in which case the command is not started,
+// or its running process is stopped.
+func (e *buildEnv) runCmd(cmd *exec.Cmd) error {
+	e.mu.Lock()
+	if e.interrupted {
+		e.mu.Unlock()
+		return fmt.Errorf("interrupted")
+	}
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err == nil {
+		if e.running == nil {
+			e.running = map[*exec.Cmd]bool{}
+		}
+		e.running[cmd] = true
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Wait()
+
+	e.mu.Lock()
+	delete(e.running, cmd)
+	e.mu.Unlock()
+	return err
+}
+
+// interrupt forwards the signal to the running commands, if any,
+// and prevents further commands from being started.
+func (e *buildEnv) interrupt(sig os.Signal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.interrupted = true
+	e.signal = sig
+	for cmd := range e.running {
+		if cmd.Process == nil {
+			continue
+		}
+		if err := signalProcessGroup(cmd, sig); err != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+// reinit replaces the still empty temporary directory
+// with a new one, after the random source has been seeded
+// or the -tmp-prefix has been given.
+//
+// With -seed, the name of the directory is predictable,
+// so it may already exist, be it from an interrupted run,
+// from a concurrent run with the same seed,
+// or prepared by another user. In each of these cases,
+// gobco stops instead of touching the existing directory.
+func (e *buildEnv) reinit(prefix string) {
+	tmpdir := tmpdirName(prefix)
+	if err := os.Mkdir(tmpdir, 0o700); err != nil {
+		if os.IsExist(err) {
+			err = fmt.Errorf("error: the temporary directory %s already exists, "+
+				"probably from another run with the same seed; "+
+				"remove it or use a different seed", tmpdir)
+		}
+		e.check(err)
+	}
+	e.check(os.Remove(e.tmpdir))
+	e.tmpdir = tmpdir
+	e.debugf("The temporary working directory is now %s", e.tmpdir)
+}
 
-	l.check(os.MkdirAll(tmpdir, 0o777))
+// tmpdirName returns a new name for the temporary directory,
+// such as "gobco-0123456789abcdef" or "gobco-job-42-0123456789abcdef".
+// The random suffix keeps concurrent runs apart.
+func tmpdirName(prefix string) string {
+	name := "gobco-" + randomHex(8)
+	if prefix != "" {
+		name = "gobco-" + prefix + "-" + randomHex(8)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
 
-	l.verbosef("The temporary working directory is %s", tmpdir)
+// validTmpPrefix returns whether the prefix can be used
+// in the name of the temporary directory.
+func validTmpPrefix(prefix string) bool {
+	for _, r := range prefix {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return prefix != "." && prefix != ".."
+}
 
-	*e = buildEnv{tmpdir, l}
+// enterSubdir makes the subdirectory of the temporary directory
+// the temporary directory, until the returned function is called.
+func (e *buildEnv) enterSubdir(name string) (leave func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.outer = e.tmpdir
+	e.tmpdir = filepath.Join(e.tmpdir, name)
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.tmpdir, e.outer = e.outer, ""
+	}
 }
 
 // file returns the absolute path of the given path, which is interpreted
@@ -513,22 +3924,46 @@ func (e *buildEnv) file(rel string) string {
 	return filepath.Join(e.tmpdir, filepath.FromSlash(rel))
 }
 
+// logLevel determines which messages are written to stderr.
+type logLevel int
+
+const (
+	levelError logLevel = iota // only the errors
+	levelWarn                  // also the problems that gobco works around
+	levelInfo                  // also what gobco does
+	levelDebug                 // also the details, such as the go commands
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+func parseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if name == levelName {
+			return logLevel(level), nil
+		}
+	}
+	return 0, fmt.Errorf("error: -log-level must be "+
+		"\"error\", \"warn\", \"info\" or \"debug\", not %q", name)
+}
+
 // logger provides basic logging and error checking.
 type logger struct {
 	stdout  io.Writer
 	stderr  io.Writer
-	verbose bool
+	level   logLevel
+	verbose bool // same as levelDebug
 }
 
 func (l *logger) init(stdout io.Writer, stderr io.Writer) {
 	l.stdout = stdout
 	l.stderr = stderr
+	l.level = levelWarn
 }
 
 func (l *logger) check(err error) {
 	if err != nil {
 		l.errf("%s", err)
-		exit(1)
+		exit(exitError)
 	}
 }
 
@@ -540,12 +3975,24 @@ func (l *logger) errf(format string, args ...interface{}) {
 	_, _ = fmt.Fprintf(l.stderr, format+"\n", args...)
 }
 
-func (l *logger) verbosef(format string, args ...interface{}) {
-	if l.verbose {
+func (l *logger) logf(level logLevel, format string, args ...interface{}) {
+	if l.level >= level {
 		l.errf(format, args...)
 	}
 }
 
+func (l *logger) warnf(format string, args ...interface{}) {
+	l.logf(levelWarn, format, args...)
+}
+
+func (l *logger) infof(format string, args ...interface{}) {
+	l.logf(levelInfo, format, args...)
+}
+
+func (l *logger) debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+
 // argInfo describes the properties of an item that will be instrumented.
 //
 // If it is inside GOPATH, it or its containing directory is copied, otherwise
@@ -579,6 +4026,13 @@ type argInfo struct {
 	// traditional packages are copied to 'gopath/src/$pkgname'.
 	copyDst string
 
+	// For a module that is part of a workspace, the directory
+	// of the go.work file, which is copied to workspaceDst instead,
+	// so that the module can import from the other modules.
+	// In that case, copyDst is inside workspaceDst.
+	workspace    string
+	workspaceDst string
+
 	// The single file in which to instrument the code, relative to instrDir,
 	// or "" to instrument the whole package.
 	instrFile string
@@ -588,9 +4042,45 @@ type argInfo struct {
 	instrDir string
 }
 
+// testDuration records how long 'go test' took for a single argument.
+type testDuration struct {
+	arg      string
+	duration time.Duration
+}
+
 type condition struct {
-	Start      string
+	Start string // For example "main.go:17:13".
+	// The parts of Start, so that file names containing colons,
+	// such as C:\src\main.go, need not be parsed.
+	File       string
+	Line       int
+	Col        int
 	Code       string
 	TrueCount  int
 	FalseCount int
+	Func       string // The enclosing function, such as "(*T).Method".
+	Depth      int    // The number of enclosing control flow statements.
+	// Identifies the condition independently of its location,
+	// derived from the function, the code and an ordinal.
+	ID string
+	// Whether the condition compares an error to nil, see -lenient-errors.
+	ErrorCheck bool
+	// The outcomes that are excluded from the coverage by the
+	// //gobco:ignore-true and //gobco:ignore-false directives.
+	IgnoreTrue  bool
+	IgnoreFalse bool
+	// Either "true" or "false" for a condition that is constant
+	// at compile time, see -exclude-constant.
+	Constant string
+	// The tests that evaluated the condition, sorted by name,
+	// see -attribute-tests.
+	Tests []string `json:",omitempty"`
+	// Where the condition ends, exclusively,
+	// so that the reports can highlight the exact code.
+	// Stats files from older versions of gobco don't have these fields.
+	EndLine int `json:",omitempty"`
+	EndCol  int `json:",omitempty"`
+	// The source code around the condition, see -embed-source.
+	// The stats files don't contain it.
+	Source []sourceLine `json:",omitempty"`
 }
@@ -1,13 +1,36 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
+// TestMain keeps the instrumentation cache of the tests
+// separate from the user's cache.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gobco-cache-")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("GOBCO_CACHE", dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 type exited int
 
 type Suite struct {
@@ -55,6 +78,7 @@ func (s *Suite) TearDownTest() {
 	}
 
 	exit = os.Exit
+	stdin = os.Stdin
 }
 
 func (s *Suite) CheckContains(output, str string) {
@@ -139,6 +163,65 @@ func Test_gobco_parseCommandLine(t *testing.T) {
 	}})
 }
 
+func Test_gobco_parseCommandLine__multiple_packages(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	g.parseCommandLine([]string{"gobco",
+		"testdata/siblings/one/calc",
+		"testdata/siblings/two/calc",
+		"testdata/failing/fail.go"})
+
+	moduleRoot, err := filepath.Abs(".")
+	s.CheckEquals(err, nil)
+	s.CheckEquals(len(g.args), 3)
+	dst0, dst1, dst2 := g.args[0].copyDst, g.args[1].copyDst, g.args[2].copyDst
+	s.CheckEquals(dst0 != dst1 && dst0 != dst2 && dst1 != dst2, true)
+	s.CheckEquals(g.args, []argInfo{{
+		arg:       filepath.FromSlash("testdata/siblings/one/calc"),
+		argDir:    filepath.FromSlash("testdata/siblings/one/calc"),
+		module:    true,
+		copySrc:   moduleRoot,
+		copyDst:   dst0,
+		instrFile: "",
+		instrDir:  filepath.Join(dst0, "testdata", "siblings", "one", "calc"),
+	}, {
+		arg:       filepath.FromSlash("testdata/siblings/two/calc"),
+		argDir:    filepath.FromSlash("testdata/siblings/two/calc"),
+		module:    true,
+		copySrc:   moduleRoot,
+		copyDst:   dst1,
+		instrFile: "",
+		instrDir:  filepath.Join(dst1, "testdata", "siblings", "two", "calc"),
+	}, {
+		arg:       filepath.FromSlash("testdata/failing/fail.go"),
+		argDir:    filepath.FromSlash("testdata/failing"),
+		module:    true,
+		copySrc:   moduleRoot,
+		copyDst:   dst2,
+		instrFile: "fail.go",
+		instrDir:  filepath.Join(dst2, "testdata", "failing"),
+	}})
+}
+
+func Test_gobco_parseCommandLine__multiple_packages_profile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-profile", "cpu=cpu.out",
+				"testdata/siblings/one/calc", "testdata/siblings/two/calc"})
+		},
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -profile only works with a single package\n")
+}
+
 func Test_gobco_parseCommandLine__keep(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
@@ -151,27 +234,42 @@ func Test_gobco_parseCommandLine__keep(t *testing.T) {
 	s.CheckEquals(g.keep, true)
 }
 
-func Test_gobco_parseCommandLine__go_test_options(t *testing.T) {
+func Test_gobco_cleanUp__keep_on_failure(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	g := s.newGobco()
+	test := func(exitCode int, kept bool) {
+		g := s.newGobco()
+		g.parseCommandLine([]string{"gobco", "-keep-on-failure", "testdata/oddeven"})
+		g.prepareTmp()
+		g.exitCode = exitCode
 
-	g.parseCommandLine([]string{"gobco", "-test", "-vet=off", "-test", "help", "pkg"})
+		g.cleanUp()
 
-	s.CheckEquals(g.exitCode, 0)
-	s.CheckEquals(g.goTestArgs, []string{"-vet=off", "help"})
+		_, err := os.Stat(g.tmpdir)
+		s.CheckEquals(err == nil, kept)
+		if kept {
+			s.CheckEquals(s.Stderr(), "\ngobco: the temporary files are in "+g.tmpdir+"\n")
+			s.CheckEquals(os.RemoveAll(g.tmpdir), nil)
+		} else {
+			s.CheckEquals(s.Stderr(), "")
+		}
+	}
+
+	test(0, false)
+	test(1, true)
 }
 
-func Test_gobco_parseCommandLine__two_packages(t *testing.T) {
+func Test_gobco_parseCommandLine__go_test_options(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	var g gobco
+	g := s.newGobco()
 
-	s.CheckPanics(
-		func() { g.parseCommandLine([]string{"gobco", "pkg1", "pkg2"}) },
-		"checking multiple packages doesn't work yet")
+	g.parseCommandLine([]string{"gobco", "-test", "-vet=off", "-test", "help", "pkg"})
+
+	s.CheckEquals(g.exitCode, 0)
+	s.CheckEquals(g.goTestArgs, []string{"-vet=off", "help"})
 }
 
 func Test_gobco_parseCommandLine__usage(t *testing.T) {
@@ -187,27 +285,206 @@ func Test_gobco_parseCommandLine__usage(t *testing.T) {
 	s.CheckEquals(s.Stdout(), "")
 	s.CheckEquals(s.Stderr(), ""+
 		"flag provided but not defined: -invalid\n"+
-		"usage: gobco [options] package...\n"+
+		"usage: gobco [options] package... [-- test binary flags]\n"+
+		"  -after command\n"+
+		"    \trun the command after the tests, even if they fail\n"+
+		"  -append\n"+
+		"    \tmerge the coverage into the existing -stats file instead of overwriting it\n"+
+		"  -append-history file\n"+
+		"    \tappend the coverage of this run as a JSON line to this file\n"+
+		"  -attribute-tests\n"+
+		"    \trecord in the stats file which tests evaluated each condition\n"+
+		"  -badge-thresholds yellow,green\n"+
+		"    \tthe yellow,green percentages for the color of the -format=shields badge (default \"60,80\")\n"+
+		"  -baseline file\n"+
+		"    \tthe stats file of an earlier run, for -new-uncovered and -skip-above\n"+
+		"  -baseline-auto file\n"+
+		"    \tuse this stats file as -baseline if it exists, and write the stats of a passing run to it\n"+
+		"  -before command\n"+
+		"    \trun the command before the tests, and only run the tests if it succeeds\n"+
 		"  -branch\n"+
 		"    \tcover branches, not conditions\n"+
+		"  -by-file\n"+
+		"    \tprint the coverage of each file instead of the individual conditions\n"+
+		"  -check-only\n"+
+		"    \tonly instrument the packages and compile them with their tests, without running the tests\n"+
+		"  -compare\n"+
+		"    \tprint the differences between the old and new stats files from the arguments\n"+
+		"  -config file\n"+
+		"    \tread default options from this JSON file instead of .gobco.json\n"+
+		"  -context N\n"+
+		"    \tprint N lines of source code around each reported condition\n"+
+		"  -count N\n"+
+		"    \trun each test N times, accumulating the coverage of all runs (default 1)\n"+
+		"  -cover-deps\n"+
+		"    \tcover the packages from the same module that the package depends on\n"+
 		"  -cover-test\n"+
 		"    \tcover the test code as well\n"+
+		"  -cross platform\n"+
+		"    \tbuild and test for another platform of the form GOOS/GOARCH\n"+
+		"  -debug-dump file\n"+
+		"    \twrite the decisions of this run as JSON to this file, for bug reports\n"+
+		"  -diff-base ref\n"+
+		"    \tonly cover the lines that changed since the git ref\n"+
+		"  -diff-coverage ref\n"+
+		"    \talso report the coverage of the lines that changed since the git ref\n"+
+		"  -embed-source\n"+
+		"    \tinclude the source code around each condition in the JSON and HTML reports, with the number of lines from -context, or 2\n"+
+		"  -emit\n"+
+		"    \tonly print the instrumented code of the single file from the arguments\n"+
+		"  -exclude-constant\n"+
+		"    \tleave out the conditions that are constant at compile time\n"+
+		"  -explain\n"+
+		"    \texplain why each uncovered condition is not covered, with a hint for the missing test\n"+
+		"  -exported-only\n"+
+		"    \tonly cover the conditions in exported functions and methods\n"+
+		"  -fail-fast\n"+
+		"    \tfail if any condition is not fully covered, and stop the text report at the first one\n"+
+		"  -fail-on-new-uncovered\n"+
+		"    \twith -new-uncovered, fail if there are any such conditions (default true)\n"+
+		"  -flush-interval duration\n"+
+		"    \tpersist the coverage every duration while the tests run, so that a crash loses at most one interval\n"+
+		"  -focus location\n"+
+		"    \tonly report the conditions at this location, either file:line or file:line:col\n"+
+		"  -format format\n"+
+		"    \tprint the report in this format: text, shields (a shields.io badge), gocover (a profile for 'go tool cover'), markdown, json, jsonl (a line per condition) or prometheus (default \"text\")\n"+
+		"  -go-cover file\n"+
+		"    \talso write the statement coverage profile of 'go test' to this file\n"+
+		"  -go-cover-compat\n"+
+		"    \talso print the coverage in the format of 'go test -cover'\n"+
+		"  -group-by func\n"+
+		"    \tgroup the reported conditions by func\n"+
 		"  -help\n"+
 		"    \tprint the available command line options\n"+
+		"  -hide-test-stdout\n"+
+		"    \tdiscard the output of 'go test' to stdout unless the tests fail\n"+
+		"  -history-summary\n"+
+		"    \tprint how the coverage developed in the recent runs, requires -append-history\n"+
+		"  -html file\n"+
+		"    \twrite the coverage report as HTML to this file\n"+
+		"  -html-diff\n"+
+		"    \tcompare the old and new stats files from the arguments in an HTML report\n"+
 		"  -immediately\n"+
 		"    \tpersist the coverage immediately at each check point\n"+
+		"  -include-covered\n"+
+		"    \tlist also the fully covered conditions, in every -format; same as -list-all\n"+
+		"  -include-untested\n"+
+		"    \talso report the conditions from files that are excluded from the build\n"+
+		"  -isolated\n"+
+		"    \tuse separate module and build caches for the tests, instead of those of the host\n"+
+		"  -json-test-output\n"+
+		"    \tpass -json to 'go test' and forward its events to stdout, requires -output\n"+
 		"  -keep\n"+
 		"    \tdon't remove the temporary working directory\n"+
+		"  -keep-going\n"+
+		"    \tif a package cannot be instrumented, continue with the other packages\n"+
+		"  -keep-on-failure\n"+
+		"    \tdon't remove the temporary working directory if gobco fails\n"+
+		"  -kinds kinds\n"+
+		"    \tonly cover the conditions of these comma-separated kinds (default \"if,for,switch,typeswitch,expr\")\n"+
+		"  -lenient-errors\n"+
+		"    \tcount comparisons between an error and nil as covered if one outcome is covered\n"+
 		"  -list-all\n"+
 		"    \tat finish, print also those conditions that are fully covered\n"+
+		"  -list-conditions\n"+
+		"    \tonly print the conditions that would be instrumented, without running the tests\n"+
+		"  -log-level level\n"+
+		"    \tlog the messages up to this level: error, warn, info or debug (default \"warn\")\n"+
+		"  -matrix tags\n"+
+		"    \trun the tests once per -matrix option, with these comma-separated build tags, and report the union of the coverage\n"+
+		"  -max-code-width N\n"+
+		"    \tshorten the code of the conditions in the text report to N characters, 0 means unlimited (default 80)\n"+
+		"  -max-conditions N\n"+
+		"    \tskip the files with more than N conditions, and stop if all packages have more, 0 means unlimited (default 100000)\n"+
+		"  -metric unit\n"+
+		"    \tcount the coverage by unit, either branches (both outcomes of each condition) or conditions (only those with both outcomes covered) (default \"branches\")\n"+
+		"  -min-branches N\n"+
+		"    \tfail if fewer than N conditions were instrumented, which hints at files that were skipped by mistake\n"+
+		"  -new-uncovered\n"+
+		"    \tonly report the uncovered conditions that were covered in the -baseline or didn't exist there\n"+
+		"  -no-cache\n"+
+		"    \tinstrument the code even if the instrumented files are cached\n"+
+		"  -no-color\n"+
+		"    \tnever color the output, same as setting NO_COLOR\n"+
+		"  -on-finish command\n"+
+		"    \trun the command after printing the report, passing it the report as JSON\n"+
+		"  -open\n"+
+		"    \topen the HTML report in a web browser\n"+
+		"  -output file\n"+
+		"    \twrite the coverage report to this file instead of stdout\n"+
+		"  -parallel N\n"+
+		"    \trun the tests of up to N packages at the same time, defaulting to the number of CPUs\n"+
+		"  -path-style style\n"+
+		"    \tprint the locations in the style original, relative or absolute (default \"original\")\n"+
+		"  -per-file-threshold percent\n"+
+		"    \tfail if the coverage of any file is below this percent\n"+
+		"  -pretty\n"+
+		"    \tprint the conditions as a table with aligned columns\n"+
+		"  -profile kind=file\n"+
+		"    \twrite a profile of the instrumented tests, as kind=file, with kind one of cpu, mem, block, mutex\n"+
+		"  -quiet\n"+
+		"    \tonly log errors, same as -log-level=error\n"+
+		"  -redact-paths\n"+
+		"    \treplace the directories in the reports with a hash, keeping the file names\n"+
+		"  -report-skipped\n"+
+		"    \tlist the files that were not instrumented, with the reason\n"+
+		"  -report-template-dir dir\n"+
+		"    \tread the templates and styles of the HTML reports from this dir\n"+
+		"  -require-tests\n"+
+		"    \tfail if a package has no test files, instead of reporting its conditions as uncovered\n"+
+		"  -run regexp\n"+
+		"    \tonly run the tests matching the regexp, still counting all conditions\n"+
+		"  -seed seed\n"+
+		"    \tmake the temporary directory names reproducible using the seed\n"+
+		"  -show-diff\n"+
+		"    \tprint the changes that the instrumentation made to each file\n"+
+		"  -since duration\n"+
+		"    \tonly cover the files that were modified in the last duration, such as 24h\n"+
+		"  -skew\n"+
+		"    \tlist the conditions that went one way in more than 99% of their evaluations\n"+
+		"  -skip-above percent\n"+
+		"    \tdon't instrument the packages whose coverage in the -baseline is at least this percent\n"+
+		"  -skip-main\n"+
+		"    \tdo not cover the conditions in the function main of package main\n"+
 		"  -stats file\n"+
 		"    \tload and persist the JSON coverage data to this file\n"+
+		"  -stats-compact\n"+
+		"    \twrite the JSON coverage data without indentation\n"+
+		"  -stats-pretty\n"+
+		"    \twrite the JSON coverage data indented by tabs, which is the default\n"+
+		"  -strict-json\n"+
+		"    \tfail on unknown fields in the stats file instead of ignoring them\n"+
+		"  -strict-version\n"+
+		"    \tfail if the gobco version doesn't match the .gobco.version file, instead of warning\n"+
+		"  -suspect-constant N\n"+
+		"    \tfail for conditions that were evaluated at least N times but only ever one way\n"+
+		"  -template template\n"+
+		"    \treport each condition using the template, either a file or one of default, oneline, tsv\n"+
 		"  -test option\n"+
 		"    \tpass the option to \"go test\", such as -vet=off\n"+
+		"  -test-runner command\n"+
+		"    \trun the tests with this command followed by the arguments for 'go test', instead of 'go test'\n"+
+		"  -timings\n"+
+		"    \tprint how long the tests took for each package\n"+
+		"  -tmp-prefix prefix\n"+
+		"    \tinclude the prefix in the name of the temporary directory, such as a CI job ID\n"+
+		"  -tree\n"+
+		"    \tprint the coverage of each directory and file as a tree instead of the individual conditions\n"+
+		"  -tui\n"+
+		"    \tbrowse the uncovered conditions and their source code in the terminal\n"+
 		"  -verbose\n"+
-		"    \tshow progress messages\n"+
+		"    \tshow progress messages, same as -log-level=debug\n"+
+		"  -verify-compile\n"+
+		"    \tbuild the instrumented code and its tests before running them, to detect errors in the instrumentation (default true)\n"+
 		"  -version\n"+
-		"    \tprint the gobco version\n")
+		"    \tprint the gobco version\n"+
+		"  -version-json\n"+
+		"    \tprint the gobco version, the Go version and the commit as JSON\n"+
+		"  -warn-overhead-pct N\n"+
+		"    \twarn if the instrumented tests of a package take more than N percent longer than the original tests\n"+
+		"  -weight depth\n"+
+		"    \treport the most deeply nested conditions first, by depth\n")
+
 }
 
 func Test_gobco_parseCommandLine__help(t *testing.T) {
@@ -223,27 +500,206 @@ func Test_gobco_parseCommandLine__help(t *testing.T) {
 		exited(0))
 
 	s.CheckEquals(stdout.String(), ""+
-		"usage: gobco [options] package...\n"+
+		"usage: gobco [options] package... [-- test binary flags]\n"+
+		"  -after command\n"+
+		"    \trun the command after the tests, even if they fail\n"+
+		"  -append\n"+
+		"    \tmerge the coverage into the existing -stats file instead of overwriting it\n"+
+		"  -append-history file\n"+
+		"    \tappend the coverage of this run as a JSON line to this file\n"+
+		"  -attribute-tests\n"+
+		"    \trecord in the stats file which tests evaluated each condition\n"+
+		"  -badge-thresholds yellow,green\n"+
+		"    \tthe yellow,green percentages for the color of the -format=shields badge (default \"60,80\")\n"+
+		"  -baseline file\n"+
+		"    \tthe stats file of an earlier run, for -new-uncovered and -skip-above\n"+
+		"  -baseline-auto file\n"+
+		"    \tuse this stats file as -baseline if it exists, and write the stats of a passing run to it\n"+
+		"  -before command\n"+
+		"    \trun the command before the tests, and only run the tests if it succeeds\n"+
 		"  -branch\n"+
 		"    \tcover branches, not conditions\n"+
+		"  -by-file\n"+
+		"    \tprint the coverage of each file instead of the individual conditions\n"+
+		"  -check-only\n"+
+		"    \tonly instrument the packages and compile them with their tests, without running the tests\n"+
+		"  -compare\n"+
+		"    \tprint the differences between the old and new stats files from the arguments\n"+
+		"  -config file\n"+
+		"    \tread default options from this JSON file instead of .gobco.json\n"+
+		"  -context N\n"+
+		"    \tprint N lines of source code around each reported condition\n"+
+		"  -count N\n"+
+		"    \trun each test N times, accumulating the coverage of all runs (default 1)\n"+
+		"  -cover-deps\n"+
+		"    \tcover the packages from the same module that the package depends on\n"+
 		"  -cover-test\n"+
 		"    \tcover the test code as well\n"+
+		"  -cross platform\n"+
+		"    \tbuild and test for another platform of the form GOOS/GOARCH\n"+
+		"  -debug-dump file\n"+
+		"    \twrite the decisions of this run as JSON to this file, for bug reports\n"+
+		"  -diff-base ref\n"+
+		"    \tonly cover the lines that changed since the git ref\n"+
+		"  -diff-coverage ref\n"+
+		"    \talso report the coverage of the lines that changed since the git ref\n"+
+		"  -embed-source\n"+
+		"    \tinclude the source code around each condition in the JSON and HTML reports, with the number of lines from -context, or 2\n"+
+		"  -emit\n"+
+		"    \tonly print the instrumented code of the single file from the arguments\n"+
+		"  -exclude-constant\n"+
+		"    \tleave out the conditions that are constant at compile time\n"+
+		"  -explain\n"+
+		"    \texplain why each uncovered condition is not covered, with a hint for the missing test\n"+
+		"  -exported-only\n"+
+		"    \tonly cover the conditions in exported functions and methods\n"+
+		"  -fail-fast\n"+
+		"    \tfail if any condition is not fully covered, and stop the text report at the first one\n"+
+		"  -fail-on-new-uncovered\n"+
+		"    \twith -new-uncovered, fail if there are any such conditions (default true)\n"+
+		"  -flush-interval duration\n"+
+		"    \tpersist the coverage every duration while the tests run, so that a crash loses at most one interval\n"+
+		"  -focus location\n"+
+		"    \tonly report the conditions at this location, either file:line or file:line:col\n"+
+		"  -format format\n"+
+		"    \tprint the report in this format: text, shields (a shields.io badge), gocover (a profile for 'go tool cover'), markdown, json, jsonl (a line per condition) or prometheus (default \"text\")\n"+
+		"  -go-cover file\n"+
+		"    \talso write the statement coverage profile of 'go test' to this file\n"+
+		"  -go-cover-compat\n"+
+		"    \talso print the coverage in the format of 'go test -cover'\n"+
+		"  -group-by func\n"+
+		"    \tgroup the reported conditions by func\n"+
 		"  -help\n"+
 		"    \tprint the available command line options\n"+
+		"  -hide-test-stdout\n"+
+		"    \tdiscard the output of 'go test' to stdout unless the tests fail\n"+
+		"  -history-summary\n"+
+		"    \tprint how the coverage developed in the recent runs, requires -append-history\n"+
+		"  -html file\n"+
+		"    \twrite the coverage report as HTML to this file\n"+
+		"  -html-diff\n"+
+		"    \tcompare the old and new stats files from the arguments in an HTML report\n"+
 		"  -immediately\n"+
 		"    \tpersist the coverage immediately at each check point\n"+
+		"  -include-covered\n"+
+		"    \tlist also the fully covered conditions, in every -format; same as -list-all\n"+
+		"  -include-untested\n"+
+		"    \talso report the conditions from files that are excluded from the build\n"+
+		"  -isolated\n"+
+		"    \tuse separate module and build caches for the tests, instead of those of the host\n"+
+		"  -json-test-output\n"+
+		"    \tpass -json to 'go test' and forward its events to stdout, requires -output\n"+
 		"  -keep\n"+
 		"    \tdon't remove the temporary working directory\n"+
+		"  -keep-going\n"+
+		"    \tif a package cannot be instrumented, continue with the other packages\n"+
+		"  -keep-on-failure\n"+
+		"    \tdon't remove the temporary working directory if gobco fails\n"+
+		"  -kinds kinds\n"+
+		"    \tonly cover the conditions of these comma-separated kinds (default \"if,for,switch,typeswitch,expr\")\n"+
+		"  -lenient-errors\n"+
+		"    \tcount comparisons between an error and nil as covered if one outcome is covered\n"+
 		"  -list-all\n"+
 		"    \tat finish, print also those conditions that are fully covered\n"+
+		"  -list-conditions\n"+
+		"    \tonly print the conditions that would be instrumented, without running the tests\n"+
+		"  -log-level level\n"+
+		"    \tlog the messages up to this level: error, warn, info or debug (default \"warn\")\n"+
+		"  -matrix tags\n"+
+		"    \trun the tests once per -matrix option, with these comma-separated build tags, and report the union of the coverage\n"+
+		"  -max-code-width N\n"+
+		"    \tshorten the code of the conditions in the text report to N characters, 0 means unlimited (default 80)\n"+
+		"  -max-conditions N\n"+
+		"    \tskip the files with more than N conditions, and stop if all packages have more, 0 means unlimited (default 100000)\n"+
+		"  -metric unit\n"+
+		"    \tcount the coverage by unit, either branches (both outcomes of each condition) or conditions (only those with both outcomes covered) (default \"branches\")\n"+
+		"  -min-branches N\n"+
+		"    \tfail if fewer than N conditions were instrumented, which hints at files that were skipped by mistake\n"+
+		"  -new-uncovered\n"+
+		"    \tonly report the uncovered conditions that were covered in the -baseline or didn't exist there\n"+
+		"  -no-cache\n"+
+		"    \tinstrument the code even if the instrumented files are cached\n"+
+		"  -no-color\n"+
+		"    \tnever color the output, same as setting NO_COLOR\n"+
+		"  -on-finish command\n"+
+		"    \trun the command after printing the report, passing it the report as JSON\n"+
+		"  -open\n"+
+		"    \topen the HTML report in a web browser\n"+
+		"  -output file\n"+
+		"    \twrite the coverage report to this file instead of stdout\n"+
+		"  -parallel N\n"+
+		"    \trun the tests of up to N packages at the same time, defaulting to the number of CPUs\n"+
+		"  -path-style style\n"+
+		"    \tprint the locations in the style original, relative or absolute (default \"original\")\n"+
+		"  -per-file-threshold percent\n"+
+		"    \tfail if the coverage of any file is below this percent\n"+
+		"  -pretty\n"+
+		"    \tprint the conditions as a table with aligned columns\n"+
+		"  -profile kind=file\n"+
+		"    \twrite a profile of the instrumented tests, as kind=file, with kind one of cpu, mem, block, mutex\n"+
+		"  -quiet\n"+
+		"    \tonly log errors, same as -log-level=error\n"+
+		"  -redact-paths\n"+
+		"    \treplace the directories in the reports with a hash, keeping the file names\n"+
+		"  -report-skipped\n"+
+		"    \tlist the files that were not instrumented, with the reason\n"+
+		"  -report-template-dir dir\n"+
+		"    \tread the templates and styles of the HTML reports from this dir\n"+
+		"  -require-tests\n"+
+		"    \tfail if a package has no test files, instead of reporting its conditions as uncovered\n"+
+		"  -run regexp\n"+
+		"    \tonly run the tests matching the regexp, still counting all conditions\n"+
+		"  -seed seed\n"+
+		"    \tmake the temporary directory names reproducible using the seed\n"+
+		"  -show-diff\n"+
+		"    \tprint the changes that the instrumentation made to each file\n"+
+		"  -since duration\n"+
+		"    \tonly cover the files that were modified in the last duration, such as 24h\n"+
+		"  -skew\n"+
+		"    \tlist the conditions that went one way in more than 99% of their evaluations\n"+
+		"  -skip-above percent\n"+
+		"    \tdon't instrument the packages whose coverage in the -baseline is at least this percent\n"+
+		"  -skip-main\n"+
+		"    \tdo not cover the conditions in the function main of package main\n"+
 		"  -stats file\n"+
 		"    \tload and persist the JSON coverage data to this file\n"+
+		"  -stats-compact\n"+
+		"    \twrite the JSON coverage data without indentation\n"+
+		"  -stats-pretty\n"+
+		"    \twrite the JSON coverage data indented by tabs, which is the default\n"+
+		"  -strict-json\n"+
+		"    \tfail on unknown fields in the stats file instead of ignoring them\n"+
+		"  -strict-version\n"+
+		"    \tfail if the gobco version doesn't match the .gobco.version file, instead of warning\n"+
+		"  -suspect-constant N\n"+
+		"    \tfail for conditions that were evaluated at least N times but only ever one way\n"+
+		"  -template template\n"+
+		"    \treport each condition using the template, either a file or one of default, oneline, tsv\n"+
 		"  -test option\n"+
 		"    \tpass the option to \"go test\", such as -vet=off\n"+
+		"  -test-runner command\n"+
+		"    \trun the tests with this command followed by the arguments for 'go test', instead of 'go test'\n"+
+		"  -timings\n"+
+		"    \tprint how long the tests took for each package\n"+
+		"  -tmp-prefix prefix\n"+
+		"    \tinclude the prefix in the name of the temporary directory, such as a CI job ID\n"+
+		"  -tree\n"+
+		"    \tprint the coverage of each directory and file as a tree instead of the individual conditions\n"+
+		"  -tui\n"+
+		"    \tbrowse the uncovered conditions and their source code in the terminal\n"+
 		"  -verbose\n"+
-		"    \tshow progress messages\n"+
+		"    \tshow progress messages, same as -log-level=debug\n"+
+		"  -verify-compile\n"+
+		"    \tbuild the instrumented code and its tests before running them, to detect errors in the instrumentation (default true)\n"+
 		"  -version\n"+
-		"    \tprint the gobco version\n")
+		"    \tprint the gobco version\n"+
+		"  -version-json\n"+
+		"    \tprint the gobco version, the Go version and the commit as JSON\n"+
+		"  -warn-overhead-pct N\n"+
+		"    \twarn if the instrumented tests of a package take more than N percent longer than the original tests\n"+
+		"  -weight depth\n"+
+		"    \treport the most deeply nested conditions first, by depth\n")
+
 	s.CheckEquals(stderr.String(), "")
 
 	g.cleanUp()
@@ -263,6 +719,363 @@ func Test_gobco_parseCommandLine__version(t *testing.T) {
 	s.CheckEquals(s.Stderr(), "")
 }
 
+func Test_gobco_parseCommandLine__version_json(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-version-json"}) },
+		exited(0))
+
+	s.CheckEquals(s.Stdout(), ""+
+		"{\"version\":\""+version+"\","+
+		"\"goVersion\":\""+runtime.Version()+"\","+
+		"\"commit\":\"\"}\n")
+	s.CheckEquals(s.Stderr(), "")
+}
+
+func Test_gobco_parseCommandLine__template_error(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-template", "nonexistent"}) },
+		exited(2))
+
+	s.CheckContains(s.Stderr(), "nonexistent")
+}
+
+func Test_gobco_parseCommandLine__tmp_prefix(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-tmp-prefix", "job-42", "testdata/failing"})
+	defer g.cleanUp()
+
+	name := filepath.Base(g.tmpdir)
+	s.CheckEquals(strings.HasPrefix(name, "gobco-job-42-"), true)
+	s.CheckEquals(len(name), len("gobco-job-42-")+16)
+	_, err := os.Stat(g.tmpdir)
+	s.CheckEquals(err, nil)
+
+	g = s.newGobco()
+	defer g.cleanUp()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-tmp-prefix", "../up", "pkg"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -tmp-prefix must only contain letters, digits, '.', '_' and '-', not \"../up\"\n")
+}
+
+func Test_buildEnv_init__permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	perm := func(path string) os.FileMode {
+		st, err := os.Stat(path)
+		s.CheckEquals(err, nil)
+		return st.Mode().Perm()
+	}
+
+	g := s.newGobco()
+	defer g.cleanUp()
+	s.CheckEquals(perm(g.tmpdir), os.FileMode(0o700))
+
+	g.parseCommandLine([]string{"gobco", "-tmp-prefix", "perm", "testdata/oddeven"})
+	s.CheckEquals(perm(g.tmpdir), os.FileMode(0o700))
+
+	g.prepareTmp()
+	s.CheckEquals(perm(g.file(g.args[0].copyDst)), os.FileMode(0o700))
+	s.CheckEquals(perm(g.file(g.args[0].instrDir)), os.FileMode(0o700))
+}
+
+func Test_gobco_parseCommandLine__seed(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+	defer func() { randomSource = rand.Reader }()
+
+	instrument := func() (string, map[string]string) {
+		g := s.newGobco()
+		g.parseCommandLine([]string{"gobco", "-seed", "reproducible", "testdata/failing"})
+		g.prepareTmp()
+		g.instrument()
+
+		files := map[string]string{}
+		instrDst := g.file(g.args[0].instrDir)
+		for _, rel := range listRegularFiles(instrDst) {
+			content, err := os.ReadFile(filepath.Join(instrDst, rel))
+			s.CheckEquals(err, nil)
+			files[rel] = string(content)
+		}
+		g.cleanUp()
+		return instrDst, files
+	}
+
+	dir1, files1 := instrument()
+	dir2, files2 := instrument()
+
+	s.CheckEquals(dir1, dir2)
+	s.CheckEquals(files1, files2)
+}
+
+// Test_gobco_parseCommandLine__seed_exists ensures that a run with -seed
+// doesn't remove the temporary directory of another run with the same seed.
+func Test_gobco_parseCommandLine__seed_exists(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+	defer func() { randomSource = rand.Reader }()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-seed", "concurrent", "testdata/failing"})
+	defer g.cleanUp()
+	marker := filepath.Join(g.tmpdir, "marker")
+	s.CheckEquals(os.WriteFile(marker, nil, 0o600), nil)
+
+	other := s.newGobco()
+	s.CheckPanics(
+		func() { other.parseCommandLine([]string{"gobco", "-seed", "concurrent", "testdata/failing"}) },
+		exited(1))
+	other.cleanUp()
+	s.CheckEquals(s.Stderr(), ""+
+		"error: the temporary directory "+g.tmpdir+" already exists, "+
+		"probably from another run with the same seed; "+
+		"remove it or use a different seed\n")
+
+	_, err := os.Stat(marker)
+	s.CheckEquals(err, nil)
+}
+
+func Test_gobco_parseCommandLine__group_by_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-group-by", "file"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -group-by must be \"func\", not \"file\"\n")
+}
+
+func Test_gobco_parseCommandLine__weight_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-weight", "size"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -weight must be \"depth\", not \"size\"\n")
+}
+
+func Test_gobco_parseCommandLine__cross_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-cross", "windows"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -cross must have the form GOOS/GOARCH, not \"windows\"\n")
+}
+
+func Test_gobco_parseCommandLine__append_without_stats(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-append", "pkg"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -append requires -stats\n")
+}
+
+func Test_gobco_parseCommandLine__profile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco",
+		"-test", "-short",
+		"-profile", "cpu=cpu.out",
+		"-profile", "mem=" + filepath.FromSlash("/tmp/mem.out"),
+		"testdata/append"})
+
+	cpu, err := filepath.Abs("cpu.out")
+	s.CheckEquals(err, nil)
+	mem, err := filepath.Abs(filepath.FromSlash("/tmp/mem.out"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(g.goTestArgs, []string{
+		"-short",
+		"-cpuprofile", cpu,
+		"-memprofile", mem,
+	})
+}
+
+func Test_profileTestArgs__errors(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(profile string, expected string) {
+		args, err := profileTestArgs([]string{profile})
+		s.CheckEquals(args, []string(nil))
+		s.CheckEquals(err.Error(), expected)
+	}
+
+	test("cpu.out",
+		"error: -profile must have the form kind=file, not \"cpu.out\"")
+	test("=cpu.out",
+		"error: -profile must have the form kind=file, not \"=cpu.out\"")
+	test("cpu=",
+		"error: -profile must have the form kind=file, not \"cpu=\"")
+	test("trace=trace.out",
+		"error: unknown profile kind \"trace\", must be one of cpu, mem, block, mutex")
+}
+
+func Test_absTestOutputArgs(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := func(rel string) string { return filepath.Join(wd, rel) }
+
+	args, err := absTestOutputArgs([]string{
+		"-short", "-run", "Test",
+		"-coverprofile=c.out", "-test.cpuprofile", "cpu.out",
+		"-outputdir", "out", "-trace=", "-o=" + abs("t.test"),
+	})
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{
+		"-short", "-run", "Test",
+		"-coverprofile=" + abs("c.out"), "-test.cpuprofile", abs("cpu.out"),
+		"-outputdir", abs("out"), "-trace=", "-o=" + abs("t.test"),
+	})
+}
+
+// Since 'go test' runs in the temporary directory,
+// the relative paths of the output files are resolved
+// against the directory from which gobco is run.
+func Test_gobcoMain__relative_output_paths(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	pkg, err := filepath.Abs("testdata/oddeven")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	s.RunMain(0, "gobco",
+		"-stats", "out/stats.json",
+		"-html", "out/report.html",
+		"-append-history", "history.jsonl",
+		"-output", "report.txt",
+		"-test", "-coverprofile=cover.out",
+		pkg)
+
+	for _, name := range []string{
+		"out/stats.json", "out/report.html", "history.jsonl", "report.txt", "cover.out",
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		s.CheckEquals(err, nil)
+	}
+}
+
+func Test_gobco_parseCommandLine__config(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	config := filepath.Join(t.TempDir(), "gobco.json")
+	err := os.WriteFile(config, []byte(`{
+		"branch": true,
+		"context": 3,
+		"list-all": true,
+		"test": ["-vet=off", "-short"]
+	}`), 0o666)
+	s.CheckEquals(err, nil)
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco",
+		"-config", config, "-list-all=false", "-test", "-run=X", "pkg"})
+
+	s.CheckEquals(g.branch, true)
+	s.CheckEquals(g.context, 3)
+	s.CheckEquals(g.listAll, false)
+	s.CheckEquals(g.goTestArgs, []string{"-vet=off", "-short", "-run=X"})
+}
+
+func Test_gobco_parseCommandLine__env_options(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	setenv(t, "GOBCO_OPTS", "-branch -context 3 -test '-run=Test A'")
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-context", "1", "-test", "-short", "pkg"})
+
+	s.CheckEquals(g.branch, true)
+	s.CheckEquals(g.context, 1)
+	s.CheckEquals(g.goTestArgs, []string{"-run=Test A", "-short"})
+	s.CheckEquals(g.args[0].arg, "pkg")
+}
+
+func Test_gobco_parseCommandLine__env_options_error(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	setenv(t, "GOBCO_OPTS", "-test '-run=X")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "pkg"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: GOBCO_OPTS: unfinished ' quote\n")
+}
+
+func Test_gobco_parseCommandLine__config_errors(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	test := func(content string, expectedErr string) {
+		config := filepath.Join(dir, "gobco.json")
+		s.CheckEquals(os.WriteFile(config, []byte(content), 0o666), nil)
+
+		g := s.newGobco()
+		s.CheckPanics(
+			func() { g.parseCommandLine([]string{"gobco", "-config", config}) },
+			exited(2))
+		s.CheckEquals(s.Stderr(), config+": "+expectedErr+"\n")
+	}
+
+	test(`{"unknown": 1}`, `unknown option "unknown"`)
+	test(`{"config": "other.json"}`, `unknown option "config"`)
+	test(`{"context": "many"}`,
+		`option "context": parse error`)
+	test(`[]`,
+		"json: cannot unmarshal array into Go value of type map[string]interface {}")
+}
+
 func Test_gobco_prepareTmp(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
@@ -321,15 +1134,15 @@ func Test_gobco_printCond(t *testing.T) {
 
 	g := s.newGobco()
 
-	g.printCond(condition{"location", "zero-zero", 0, 0})
-	g.printCond(condition{"location", "zero-once", 0, 1})
-	g.printCond(condition{"location", "zero-many", 0, 5})
-	g.printCond(condition{"location", "once-zero", 1, 0})
-	g.printCond(condition{"location", "once-once", 1, 1})
-	g.printCond(condition{"location", "once-many", 1, 5})
-	g.printCond(condition{"location", "many-zero", 5, 0})
-	g.printCond(condition{"location", "many-once", 5, 1})
-	g.printCond(condition{"location", "many-many", 5, 5})
+	g.printCond(condition{Start: "location", Code: "zero-zero"})
+	g.printCond(condition{Start: "location", Code: "zero-once", FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "zero-many", FalseCount: 5})
+	g.printCond(condition{Start: "location", Code: "once-zero", TrueCount: 1})
+	g.printCond(condition{Start: "location", Code: "once-once", TrueCount: 1, FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "once-many", TrueCount: 1, FalseCount: 5})
+	g.printCond(condition{Start: "location", Code: "many-zero", TrueCount: 5})
+	g.printCond(condition{Start: "location", Code: "many-once", TrueCount: 5, FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "many-many", TrueCount: 5, FalseCount: 5})
 
 	expectedOut := "" +
 		"location: condition \"zero-zero\" was never evaluated\n" +
@@ -347,15 +1160,15 @@ func Test_gobco_printCond__listAll(t *testing.T) {
 	g := s.newGobco()
 
 	g.listAll = true
-	g.printCond(condition{"location", "zero-zero", 0, 0})
-	g.printCond(condition{"location", "zero-once", 0, 1})
-	g.printCond(condition{"location", "zero-many", 0, 5})
-	g.printCond(condition{"location", "once-zero", 1, 0})
-	g.printCond(condition{"location", "once-once", 1, 1})
-	g.printCond(condition{"location", "once-many", 1, 5})
-	g.printCond(condition{"location", "many-zero", 5, 0})
-	g.printCond(condition{"location", "many-once", 5, 1})
-	g.printCond(condition{"location", "many-many", 5, 5})
+	g.printCond(condition{Start: "location", Code: "zero-zero"})
+	g.printCond(condition{Start: "location", Code: "zero-once", FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "zero-many", FalseCount: 5})
+	g.printCond(condition{Start: "location", Code: "once-zero", TrueCount: 1})
+	g.printCond(condition{Start: "location", Code: "once-once", TrueCount: 1, FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "once-many", TrueCount: 1, FalseCount: 5})
+	g.printCond(condition{Start: "location", Code: "many-zero", TrueCount: 5})
+	g.printCond(condition{Start: "location", Code: "many-once", TrueCount: 5, FalseCount: 1})
+	g.printCond(condition{Start: "location", Code: "many-many", TrueCount: 5, FalseCount: 5})
 
 	expectedOut := "" +
 		"location: condition \"zero-zero\" was never evaluated\n" +
@@ -370,145 +1183,3546 @@ func Test_gobco_printCond__listAll(t *testing.T) {
 	s.CheckEquals(s.Stdout(), expectedOut)
 }
 
-func Test_gobco_cleanup(t *testing.T) {
+func Test_gobco_printCond__maxCodeWidth(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
 	g := s.newGobco()
-	g.parseCommandLine([]string{"gobco", "-verbose", "testdata/failing"})
-	g.prepareTmp()
 
-	g.instrument()
+	g.maxCodeWidth = 20
+	g.printCond(condition{Start: "location", Code: "short"})
+	g.printCond(condition{Start: "location", Code: "name == \"a\" ||\n\tname == \"b\""})
 
-	instrDst := g.file(g.args[0].instrDir)
-	s.CheckEquals(listRegularFiles(instrDst), []string{
-		"fail.go",
-		"fail_test.go",
-		"gobco_fixed.go",
-		"gobco_no_testmain_test.go",
-		"gobco_variable.go",
-		"random.go"})
+	s.CheckEquals(s.Stdout(), ""+
+		"location: condition \"short\" was never evaluated\n"+
+		"location: condition \"name == \\\"a\\\" ||\\n\\tn...\" was never evaluated\n")
+}
 
-	g.cleanUp()
+func Test_gobco_printCond__context(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
 
-	_, err := os.Stat(instrDst)
-	s.CheckEquals(os.IsNotExist(err), true)
+	g := s.newGobco()
 
-	_ = s.Stderr()
+	g.context = 1
+	g.printCond(condition{Start: "testdata/failing/fail.go:10:5", File: "testdata/failing/fail.go", Line: 10, Col: 5, Code: "Bar(a) == 10", FalseCount: 1, EndLine: 10, EndCol: 17})
+	// Stats files from older versions of gobco don't record the end.
+	g.printCond(condition{Start: "testdata/failing/fail.go:1:1", File: "testdata/failing/fail.go", Line: 1, Col: 1, Code: "first"})
+
+	s.CheckEquals(s.Stdout(), ""+
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true\n"+
+		"      9  \t}\n"+
+		">    10  \tif Bar(a) == 10 {\n"+
+		"         \t   ^^^^^^^^^^^^\n"+
+		"     11  \t\treturn true\n"+
+		"testdata/failing/fail.go:1:1: condition \"first\" was never evaluated\n"+
+		">     1  package main\n"+
+		"         ^\n"+
+		"      2  \n")
+	s.CheckEquals(len(g.sources), 1)
 }
 
-func Test_gobcoMain__test_fails(t *testing.T) {
+func Test_underlineCondition(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	actualExitCode := gobcoMain(&s.out, &s.err, "gobco", "-verbose", "testdata/failing")
-	s.CheckEquals(actualExitCode, 1)
+	test := func(text string, col, endLine, endCol int, expected string) {
+		cond := condition{Line: 5, Col: col, EndLine: endLine, EndCol: endCol}
+		s.CheckEquals(underlineCondition(text, cond), expected)
+	}
 
-	stdout := s.Stdout()
-	stderr := s.Stderr()
+	// Several conditions on the same line.
+	test("\tif a > 0 && b {", 5, 5, 10, "\t   ^^^^^")
+	test("\tif a > 0 && b {", 14, 5, 15, "\t            ^")
+	// The marks count the characters, not the bytes.
+	test("\tif ä == 'ö' {", 5, 5, 15, "\t   ^^^^^^^^")
+	// A condition that continues on the next line.
+	test("\treturn a &&", 9, 6, 5, "\t       ^^^^")
+	// Without the end, only the start is marked.
+	test("\tif a {", 5, 0, 0, "\t   ^")
+	// The source code has changed since.
+	test("\tif a {", 20, 5, 21, "")
+}
 
-	s.CheckNotContains(stderr, "[build failed]")
-	s.CheckContains(stdout, "Condition coverage: 5/8")
+func Test_gobco_printCond__pathStyle(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	cond := condition{Start: "testdata/failing/fail.go:10:5", File: "testdata/failing/fail.go", Line: 10, Col: 5, Code: "Bar(a) == 10", FalseCount: 1}
+	abs, err := filepath.Abs("testdata/failing/fail.go")
+	s.CheckEquals(err, nil)
+
+	g.pathStyle = "original"
+	g.printCond(cond)
+	g.pathStyle = "relative"
+	g.printCond(cond)
+	g.pathStyle = "absolute"
+	g.printCond(cond)
+
+	s.CheckEquals(s.Stdout(), ""+
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true\n"+
+		"fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true\n"+
+		abs+":10:5: condition \"Bar(a) == 10\" was once false but never true\n")
 }
 
-func Test_gobcoMain__single_file(t *testing.T) {
+func Test_redactPath(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	// "go test" returns 1 because one of the tests fails.
-	stdout, stderr := s.RunMain(1, "gobco", "-list-all", "testdata/failing/fail.go")
+	redacted := redactPath(filepath.FromSlash("testdata/failing/fail.go"))
+
+	s.CheckEquals(filepath.Base(redacted), "fail.go")
+	s.CheckEquals(len(filepath.Dir(redacted)), 8)
+	s.CheckEquals(redactPath(filepath.FromSlash("testdata/failing/fail_test.go")),
+		filepath.Join(filepath.Dir(redacted), "fail_test.go"))
+	s.CheckEquals(redactPath(filepath.FromSlash("testdata/failing/./fail.go")), redacted)
+	s.CheckNotContains(redactPath(filepath.FromSlash("testdata/other/fail.go")), redacted)
+	s.CheckEquals(redactPath("fail.go"), "fail.go")
+}
+
+func Test_gobco_printCond__redactPaths(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.redactPaths = true
+	cond := condition{Start: "testdata/failing/fail.go:10:5", File: "testdata/failing/fail.go", Line: 10, Col: 5, Code: "Bar(a) == 10", FalseCount: 1}
+	redacted := redactPath("testdata/failing/fail.go")
+
+	g.printCond(cond)
+	g.pathStyle = "absolute"
+	g.printCond(cond)
+
+	abs, err := filepath.Abs("testdata/failing/fail.go")
+	s.CheckEquals(err, nil)
+	s.CheckEquals(s.Stdout(), ""+
+		redacted+":10:5: condition \"Bar(a) == 10\" was once false but never true\n"+
+		redactPath(abs)+":10:5: condition \"Bar(a) == 10\" was once false but never true\n")
+
+	g.pathStyle = "original"
+	conds := g.redactedConds([]condition{cond})
+	s.CheckEquals(conds[0].Start, redacted+":10:5")
+	s.CheckEquals(conds[0].File, redacted)
+	s.CheckEquals(cond.Start, "testdata/failing/fail.go:10:5")
+}
+
+func Test_gobco_parseCommandLine__log_level(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(expected logLevel, args ...string) {
+		g := s.newGobco()
+		g.parseCommandLine(append(append([]string{"gobco"}, args...), "testdata/failing"))
+		s.CheckEquals(g.level, expected)
+		s.CheckEquals(g.verbose, expected == levelDebug)
+	}
+
+	test(levelWarn)
+	test(levelError, "-quiet")
+	test(levelInfo, "-log-level", "info")
+	test(levelDebug, "-log-level=debug")
+	test(levelDebug, "-verbose")
+	test(levelDebug, "-log-level=error", "-verbose")
+}
+
+func Test_gobco_parseCommandLine__log_level_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-log-level", "trace"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -log-level must be \"error\", \"warn\", \"info\" or \"debug\", not \"trace\"\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-verbose", "-quiet"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -verbose and -quiet contradict each other\n")
+}
+
+func Test_gobco_parseCommandLine__path_style_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-path-style", "tmp"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -path-style must be \"original\", \"relative\" or \"absolute\", not \"tmp\"\n")
+}
+
+func Test_gobco_printGoCoverSummary(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	g.printGoCoverSummary(5, 8)
+	g.printGoCoverSummary(2, 3)
+	g.printGoCoverSummary(0, 0)
+	g.branch = true
+	g.printGoCoverSummary(1, 1)
+	g.printGoCoverSummary(0, 0)
+
+	s.CheckEquals(s.Stdout(), ""+
+		"condition coverage: 62.5% of conditions\n"+
+		"condition coverage: 66.7% of conditions\n"+
+		"condition coverage: [no conditions]\n"+
+		"branch coverage: 100.0% of branches\n"+
+		"branch coverage: [no branches]\n")
+}
+
+func Test_gobco_printSuspectConstant(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.suspectConstant = 10
+
+	g.printSuspectConstant([]condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "rare", TrueCount: 9},
+		{Start: "a.go:2:1", File: "a.go", Line: 2, Col: 1, Code: "always true", TrueCount: 10},
+		{Start: "a.go:3:1", File: "a.go", Line: 3, Col: 1, Code: "always false", FalseCount: 1000},
+		{Start: "a.go:4:1", File: "a.go", Line: 4, Col: 1, Code: "both", TrueCount: 1000, FalseCount: 1},
+		{Start: "a.go:5:1", File: "a.go", Line: 5, Col: 1, Code: "never"},
+	})
+
+	s.CheckEquals(s.Stdout(), ""+
+		"\n"+
+		"Possibly constant conditions:\n"+
+		"a.go:2:1: possibly constant condition \"always true\" was 10 times true but never false\n"+
+		"a.go:3:1: possibly constant condition \"always false\" was 1000 times false but never true\n")
+	s.CheckEquals(g.exitCode, 1)
+}
+
+func Test_gobco_printSkewed(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.skew = true
+
+	g.printSkewed([]condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "balanced", TrueCount: 50, FalseCount: 50},
+		{Start: "a.go:2:1", File: "a.go", Line: 2, Col: 1, Code: "exactly 99%", TrueCount: 99, FalseCount: 1},
+		{Start: "a.go:3:1", File: "a.go", Line: 3, Col: 1, Code: "mostly true", TrueCount: 1000, FalseCount: 1},
+		{Start: "a.go:4:1", File: "a.go", Line: 4, Col: 1, Code: "mostly false", TrueCount: 2, FalseCount: 999},
+		{Start: "a.go:5:1", File: "a.go", Line: 5, Col: 1, Code: "always true", TrueCount: 1000},
+	})
+
+	s.CheckEquals(s.Stdout(), ""+
+		"\n"+
+		"Skewed conditions:\n"+
+		"a.go:3:1: skewed condition \"mostly true\" was 1000 times true and once false (99.9% true)\n"+
+		"a.go:4:1: skewed condition \"mostly false\" was 2 times true and 999 times false (99.8% false)\n")
+	s.CheckEquals(g.exitCode, 0)
+}
+
+func Test_gobco_printTimings(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.timings = true
+	g.durations = []testDuration{
+		{"fast", 1500 * time.Microsecond},
+		{"slow", 3 * time.Second},
+		{"medium", 20 * time.Millisecond},
+	}
+
+	g.printTimings()
+
+	s.CheckEquals(s.Stdout(), ""+
+		"Testing slow took 3s\n"+
+		"Testing medium took 20ms\n"+
+		"Testing fast took 2ms\n")
+}
+
+func Test_gobco_reportOverhead(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.warnOverheadPct = 50
+
+	g.reportOverhead("fast", 140*time.Millisecond, 100*time.Millisecond)
+	g.reportOverhead("exact", 150*time.Millisecond, 100*time.Millisecond)
+	g.reportOverhead("slow", 3*time.Second, 1200*time.Millisecond)
+	g.reportOverhead("unknown", time.Second, 0)
+
+	s.CheckEquals(s.Stderr(), ""+
+		"gobco: testing slow took 3s instrumented and 1.2s uninstrumented, "+
+		"which is 150% longer; consider listing its hot files in .gobcoignore\n")
+}
+
+func Test_gobco_parseCommandLine__warn_overhead_pct(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-warn-overhead-pct", "-5", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -warn-overhead-pct must not be negative, not -5\n")
+}
+
+func Test_gobco_cleanup(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-verbose", "testdata/failing"})
+	g.prepareTmp()
+
+	g.instrument()
+
+	instrDst := g.file(g.args[0].instrDir)
+	s.CheckEquals(listRegularFiles(instrDst), []string{
+		"fail.go",
+		"fail_test.go",
+		"gobco_fixed.go",
+		"gobco_no_testmain_test.go",
+		"gobco_variable.go",
+		"random.go"})
+
+	g.cleanUp()
+
+	_, err := os.Stat(instrDst)
+	s.CheckEquals(os.IsNotExist(err), true)
+
+	_ = s.Stderr()
+}
+
+func Test_gobcoMain__test_fails(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	actualExitCode := gobcoMain(&s.out, &s.err, "gobco", "-verbose", "testdata/failing")
+	s.CheckEquals(actualExitCode, 6)
+
+	stdout := s.Stdout()
+	stderr := s.Stderr()
+
+	s.CheckNotContains(stderr, "[build failed]")
+	s.CheckContains(stdout, "Condition coverage: 5/8")
+}
+
+func Test_gobcoMain__single_file(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// "go test" returns 1 because one of the tests fails.
+	stdout, stderr := s.RunMain(6, "gobco", "-list-all", "testdata/failing/fail.go")
+
+	s.CheckNotContains(stdout, "[build failed]")
+	s.CheckNotContains(stderr, "[build failed]")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/6",
+		"testdata/failing/fail.go:4:14: condition \"i < 10\" was 10 times true and once false",
+		"testdata/failing/fail.go:7:6: condition \"a < 1000\" was 5 times true and once false",
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
+		// testdata/failing/random.go is not listed here
+		// since that file is not mentioned in the command line.
+	})
+}
+
+func Test_gobcoMain__multiple_files(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// "go test" returns 1 because one of the tests fails.
+	stdout, stderr := s.RunMain(6, "gobco", "-list-all", "testdata/failing")
+
+	s.CheckNotContains(stdout, "[build failed]")
+	s.CheckNotContains(stderr, "[build failed]")
+	// Ensure that the files in the output are sorted.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"testdata/failing/fail.go:4:14: condition \"i < 10\" was 10 times true and once false",
+		"testdata/failing/fail.go:7:6: condition \"a < 1000\" was 5 times true and once false",
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
+		"testdata/failing/random.go:8:9: condition \"x == 4\" was never evaluated",
+	})
+}
+
+func Test_gobcoMain__TestMain(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "testdata/testmain")
+
+	s.CheckNotContains(stdout, "[build failed]")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/testmain/main.go:8:9: " +
+			"condition \"i > 0\" was once true but never false",
+	})
+	s.CheckContains(stdout, "begin original TestMain")
+	s.CheckContains(stdout, "end original TestMain")
+	_ = stderr
+}
+
+func Test_gobcoMain__TestMainTest(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "testdata/testmaintest")
+
+	s.CheckContains(stdout, "Condition coverage: 1/2")
+	_ = stderr
+}
+
+func Test_gobcoMain__TestMain_return(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/testmainreturn")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/testmainreturn/return.go:4:9: " +
+			"condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__TestMain_exit_in_helper(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/testmainexit")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/testmainexit/exit.go:4:9: " +
+			"condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__TestMain_stats(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The instrumented TestMain loads the counters of the earlier run.
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	s.RunMain(0, "gobco", "-stats", stats, "testdata/testmain")
+	stdout, _ := s.RunMain(0, "gobco", "-stats", stats, "testdata/testmain")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/testmain/main.go:8:9: " +
+			"condition \"i > 0\" was 2 times true but never false",
+	})
+}
+
+func Test_gobcoMain__package_initialization(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	expected := func(times string) []string {
+		return []string{
+			"Condition coverage: 5/8",
+			"pkginit.go:9:15: condition \"len(os.Getenv(verboseEnv)) > 0\" was " + times + " false but never true",
+			"pkginit.go:9:49: condition \"len(os.Args) > 100\" was " + times + " false but never true",
+			"pkginit.go:14:5: condition \"verbose\" was " + times + " false but never true",
+		}
+	}
+
+	stdout, stderr := s.RunMain(0, "gobco", "-path-style=relative", "testdata/pkginit")
+	s.CheckEquals(s.GobcoLines(stdout), expected("once"))
+	s.CheckEquals(stderr, "")
+
+	// The conditions from the package initialization are evaluated
+	// before the counters of the earlier run are loaded,
+	// which must neither overwrite them nor be overwritten by them.
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	s.RunMain(0, "gobco", "-immediately", "-stats", stats, "testdata/pkginit")
+	stdout, stderr = s.RunMain(0, "gobco", "-immediately", "-stats", stats, "-path-style=relative", "testdata/pkginit")
+	s.CheckEquals(s.GobcoLines(stdout), expected("2 times"))
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__flush_interval(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The test binary exits before the counters are persisted
+	// at the end of the tests, so only the periodic flush records them.
+	stdout, _ := s.RunMain(exitTestFailure, "gobco", "testdata/crash")
+	s.CheckNotContains(stdout, "Condition coverage")
+
+	stdout, _ = s.RunMain(exitTestFailure, "gobco", "-flush-interval", "200ms", "testdata/crash")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/crash/crash.go:4:9: condition \"x > 0\" was once true but never false",
+	})
+
+	// The final flush replaces the periodic ones,
+	// so nothing is counted twice.
+	stdout, stderr := s.RunMain(0, "gobco", "-flush-interval", "1ms", "testdata/samecond")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"testdata/samecond/samecond.go:6:9: condition \"a\" was 2 times true but never false",
+		"testdata/samecond/samecond.go:6:19: condition \"a\" was once true but never false",
+		"testdata/samecond/samecond.go:6:25: condition \"b\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-flush-interval", "1s", "-immediately", "testdata/crash"})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -flush-interval cannot be combined with -immediately, "+
+		"which already persists the coverage at each check point\n")
+}
+
+// Test_gobcoMain__flush_interval_cover_deps ensures that persisting
+// the counters periodically doesn't race with the tests,
+// which evaluate the conditions of the dependencies at the same time.
+func Test_gobcoMain__flush_interval_cover_deps(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-deps", "-flush-interval", "1ms",
+		"-test", "-race", "testdata/flushdeps")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/4",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__attribute_tests(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	s.RunMain(0, "gobco", "-attribute-tests", "-stats", stats, "testdata/attribution")
+
+	content, err := os.ReadFile(stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conds []condition
+	if err := json.Unmarshal(content, &conds); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{}
+	for _, cond := range conds {
+		tests[cond.Code] = cond.Tests
+	}
+	s.CheckEquals(tests, map[string][]string{
+		"x > 0":  {"TestBoth", "TestBoth/negative", "TestBoth/positive", "TestPositive"},
+		"x < 10": {"TestPositive"},
+		"x == 0": nil,
+	})
+
+	// Without the option, the stats file stays as before.
+	plain := filepath.Join(t.TempDir(), "plain.json")
+	s.RunMain(0, "gobco", "-stats", plain, "testdata/attribution")
+	content, err = os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CheckNotContains(string(content), "Tests")
+}
+
+// The conditions in example functions are covered like those
+// in test functions, and the examples count as tests.
+func Test_gobcoMain__examples(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, _ := s.RunMain(0, "gobco", "-list-all", "testdata/example")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+		"testdata/example/example.go:5:5: condition \"x < 0\" was once true and once false",
+	})
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	stdout, _ = s.RunMain(0, "gobco", "-cover-test", "-attribute-tests", "-list-all",
+		"-stats", stats, "testdata/example")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/4",
+		"testdata/example/example.go:5:5: condition \"x < 0\" was once true and once false",
+		"testdata/example/example_test.go:11:6: condition \"x < 0\" was once true and once false",
+	})
+
+	content, err := os.ReadFile(stats)
+	s.CheckEquals(err, nil)
+	var conds []condition
+	s.CheckEquals(json.Unmarshal(content, &conds), nil)
+	s.CheckEquals(len(conds), 2)
+	s.CheckEquals(conds[0].Tests, []string{"ExampleAbs"})
+	s.CheckEquals(conds[1].Tests, []string{"ExampleAbs"})
+}
+
+func Test_gobcoMain__exported_only(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-exported-only", "-list-all",
+		"-path-style=relative", "testdata/exported")
+
+	// The conditions in nonZero, small and full are not covered,
+	// neither is the function literal in small.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 8/14",
+		"exported.go:5:15: condition \"len(os.Args) > 100\" was once false but never true",
+		"exported.go:8:9: condition \"x > 0\" was once true and once false",
+		"exported.go:8:18: condition \"nonZero(x)\" was once true but never false",
+		"exported.go:17:36: condition \"x > 0\" was 2 times true but never false",
+		"exported.go:19:6: condition \"keep(x)\" was 2 times true but never false",
+		"exported.go:19:17: condition \"small(x)\" was once true and once false",
+		"exported.go:33:41: condition \"c.n == 0\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+// In an if-else chain, the final else branch is covered as well,
+// even if the last condition in the chain is a complex condition.
+func Test_gobcoMain__else_chain(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, _ := s.RunMain(0, "gobco", "-list-all", "testdata/elsechain")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 10/12",
+		"testdata/elsechain/sign.go:6:5: condition \"x > 0 && y > 0\" was once true and 2 times false",
+		"testdata/elsechain/sign.go:6:5: condition \"x > 0\" was 2 times true and once false",
+		"testdata/elsechain/sign.go:6:14: condition \"y > 0\" was once true and once false",
+		"testdata/elsechain/sign.go:8:12: condition \"x < 0 || y < 0\" was 2 times true but never false",
+		"testdata/elsechain/sign.go:8:12: condition \"x < 0\" was once true and once false",
+		"testdata/elsechain/sign.go:8:21: condition \"y < 0\" was once true but never false",
+	})
+}
+
+func Test_gobcoMain__guard_clauses(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// Each operand of a guard clause is counted once per evaluation,
+	// and the operands skipped by short-circuit evaluation not at all.
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/guard")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 10/10",
+		"testdata/guard/guard.go:6:6: condition \"valid\" was 5 times true and once false",
+		"testdata/guard/guard.go:9:5: condition \"x == nil\" was once true and 4 times false",
+		"testdata/guard/guard.go:9:17: condition \"len(x) == 0\" was 2 times true and 2 times false",
+		"testdata/guard/guard.go:10:6: condition \"fallback != nil\" was 2 times true and once false",
+		"testdata/guard/guard.go:10:25: condition \"*fallback > 0\" was once true and once false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__condition_end(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	s.RunMain(0, "gobco", "-stats", stats, "testdata/elsechain")
+
+	conds, err := s.newGobco().load(stats)
+	s.CheckEquals(err, nil)
+	var ends []string
+	for _, cond := range conds {
+		ends = append(ends, fmt.Sprintf("%d:%d-%d:%d %s",
+			cond.Line, cond.Col, cond.EndLine, cond.EndCol, cond.Code))
+	}
+	s.CheckEquals(ends, []string{
+		"6:5-6:19 x > 0 && y > 0",
+		"6:5-6:10 x > 0",
+		"6:14-6:19 y > 0",
+		"8:12-8:26 x < 0 || y < 0",
+		"8:12-8:17 x < 0",
+		"8:21-8:26 y < 0",
+	})
+}
+
+func Test_gobcoMain__generated_names(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The code defines a constant with the same name as the variable
+	// that gobco would naively generate for the switch tag.
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/collision")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+		"testdata/collision/kind.go:10:7: condition \"x == gobco0\" was once true and once false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__embed(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The package and its test embed files,
+	// which must be available in the instrumented copy.
+	stdout, stderr := s.RunMain(0, "gobco", "-no-cache", "testdata/embed")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/embed/embed.go:13:5: condition \"len(name) == 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__assembly(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// Add is declared without a body and implemented in assembly
+	// on amd64, while the other platforms use a Go implementation.
+	// Each platform only sees its own declaration.
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/asm")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/asm/clamp.go:5:5: condition \"x < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-include-untested", "testdata/asm")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/asm/clamp.go:5:5: condition \"x < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__overlapping_args(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	single, _ := s.RunMain(0, "gobco", "-list-all", "testdata/exported")
+
+	// The same package in another spelling and a single file from it
+	// are only instrumented and counted once.
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "-verbose",
+		"testdata/exported/exported.go", "testdata/exported", "./testdata/exported/")
+
+	s.CheckEquals(s.GobcoLines(stdout), s.GobcoLines(single))
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 11/20")
+	s.CheckContains(stderr, ""+
+		"gobco: skipping \"testdata/exported/exported.go\", "+
+		"as \"testdata/exported\" already covers it\n")
+	s.CheckContains(stderr, ""+
+		"gobco: skipping \"./testdata/exported/\", "+
+		"as \"testdata/exported\" already covers it\n")
+}
+
+func Test_gobcoMain__skip_main(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-skip-main", "-list-all",
+		"-path-style=relative", "testdata/skipmain")
+
+	// The conditions in main and in the function literal inside it
+	// are neither instrumented nor counted.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+		"main.go:21:6: condition \"len(arg) > 0\" was once true and once false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, _ = s.RunMain(0, "gobco", "testdata/skipmain")
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 2/8")
+}
+
+func Test_gobcoMain__shuffle(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The counters and the attributed tests must not depend
+	// on the order in which the tests run.
+	var first string
+	for run := 0; run < 3; run++ {
+		stats := filepath.Join(t.TempDir(), "stats.json")
+		stdout, _ := s.RunMain(0, "gobco", "-attribute-tests", "-stats", stats,
+			"-test", "-shuffle=on", "-path-style=relative", "testdata/attribution")
+		s.CheckContains(stdout, "Condition coverage: 3/6")
+
+		content, err := os.ReadFile(stats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			first = string(content)
+		} else {
+			s.CheckEquals(string(content), first)
+		}
+	}
+}
+
+func Test_gobcoMain__max_conditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-max-conditions", "2", "-list-all",
+		"-path-style=relative", "testdata/maxconds")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"small.go:4:9: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "gobco: not instrumenting testdata/maxconds/generated.go, "+
+		"as its 3 conditions are more than -max-conditions=2\n")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-max-conditions", "0", "testdata/maxconds")
+	s.CheckContains(stdout, "Condition coverage: 4/8")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobco_checkConditionLimit(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.maxConditions = 3
+	in := &instrumenter{conds: make([]cond, 2)}
+
+	g.checkConditionLimit(in)
+	s.CheckEquals(g.instrumentedConds, 2)
+
+	s.CheckPanics(func() { g.checkConditionLimit(in) }, exited(1))
+	s.CheckEquals(s.Stderr(), "error: the packages have more than -max-conditions=3 conditions\n")
+}
+
+func Test_gobcoMain__keep_going(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(5, "gobco", "-keep-going", "-path-style=relative",
+		"testdata/keepgoing", "testdata/oddeven")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 0/2",
+		"odd.go:4:9: condition \"x%2 != 0\" was never evaluated",
+	})
+	s.CheckEquals(stderr, ""+
+		"gobco: could not instrument testdata/keepgoing: "+
+		"testdata/keepgoing/keepgoing.go:5:5: gobcoCounts collides with the code "+
+		"that gobco adds to the package; please rename it\n")
+
+	stdout, stderr = s.RunMain(5, "gobco", "-keep-going", "testdata/keepgoing")
+	s.CheckEquals(stdout, "nothing to instrument\n")
+	s.CheckContains(stderr, "gobco: could not instrument testdata/keepgoing: ")
+}
+
+func Test_gobco_fail(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.fail(exitTestFailure)
+	g.fail(exitThreshold)
+
+	// The first failure determines the exit code.
+	s.CheckEquals(g.exitCode, exitTestFailure)
+}
+
+func Test_gobco_checkAs(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	restore := g.checkAs(exitUsage)
+	s.CheckPanics(func() { g.check(errors.New("error: usage")) }, exited(2))
+	restore()
+	s.CheckPanics(func() { g.check(errors.New("error: other")) }, exited(1))
+	s.CheckEquals(s.Stderr(), "error: usage\nerror: other\n")
+}
+
+func Test_gobco_forPackage(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.keepGoing = true
+
+	err := g.forPackage(func() { g.check(errors.New("error: broken")) })
+	s.CheckEquals(err.Error(), "error: broken")
+	s.CheckEquals(g.collecting, false)
+
+	err = g.forPackage(func() { ok(errors.New("instrumenter bug")) })
+	s.CheckEquals(err.Error(), "instrumenter bug")
+
+	s.CheckEquals(g.forPackage(func() {}), nil)
+
+	// Without -keep-going, errors still exit.
+	g.keepGoing = false
+	s.CheckPanics(func() { _ = g.forPackage(func() { g.check(errors.New("error: broken")) }) }, exited(5))
+	s.CheckEquals(s.Stderr(), "error: broken\n")
+}
+
+func Test_gobcoMain__oddeven(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/oddeven")
+
+	s.CheckContains(stdout, "Condition coverage: 0/2")
+	s.CheckContains(stdout, "odd.go:4:9: condition \"x%2 != 0\" was never evaluated")
+	// The condition in even_test.go is not instrumented since
+	// gobco was not run with the '-cover-test' option.
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__blackBox(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-test", "testdata/pkgname")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/8",
+		"testdata/pkgname/black_box_test.go:12:5: " +
+			"condition \"pkgname.Exported(true) != 'E'\" " +
+			"was once false but never true",
+		"testdata/pkgname/main.go:4:5: " +
+			"condition \"cond\" was once true but never false",
+		"testdata/pkgname/main.go:11:5: " +
+			"condition \"cond\" was once true but never false",
+		"testdata/pkgname/white_box_test.go:10:5: " +
+			"condition \"unexported(true) != 'U'\" " +
+			"was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__blackBox_dirname(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/black-box")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/4",
+		"testdata/black-box/blackbox.go:10:5: " +
+			"condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__blackBox_dirname_coverTest(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-test", "testdata/black-box")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/6",
+		"testdata/black-box/blackbox.go:10:5: " +
+			"condition \"x > 0\" was once true but never false",
+		"testdata/black-box/blackbox_test.go:11:6: " +
+			"condition \"blackbox.Sign(x) == 0\" " +
+			"was 2 times false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+// Test_gobcoMain__range_channel ensures that the conditions in a range loop
+// over a channel are counted without changing when the loop ends,
+// in particular for labeled break and continue statements.
+// The tests in the fixture check the results of the loops.
+func Test_gobcoMain__range_channel(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/rangechan")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 6/6",
+		"testdata/rangechan/rangechan.go:12:8: " +
+			"condition \"n < 0\" was once true and 3 times false",
+		"testdata/rangechan/rangechan.go:14:8: " +
+			"condition \"n%2 == 1\" was once true and 2 times false",
+		"testdata/rangechan/rangechan.go:27:6: " +
+			"condition \"i == len(words)-1\" was once true and 2 times false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__same_condition_text(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/samecond")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"testdata/samecond/samecond.go:6:9: " +
+			"condition \"a\" was 2 times true but never false",
+		"testdata/samecond/samecond.go:6:14: " +
+			"condition \"b\" was once true and once false",
+		"testdata/samecond/samecond.go:6:19: " +
+			"condition \"a\" was once true but never false",
+		"testdata/samecond/samecond.go:6:25: " +
+			"condition \"b\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__stats_compact(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+
+	// The first run writes the indented form,
+	// which the second run must be able to load.
+	_, stderr := s.RunMain(0, "gobco", "-stats", stats,
+		"-test", "-run=TestPositive", "testdata/append")
+	s.CheckEquals(stderr, "")
+	content, err := os.ReadFile(stats)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "[\n\t{\n")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-stats", stats, "-stats-compact",
+		"-test", "-run=TestNegative", "testdata/append")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+	content, err = os.ReadFile(stats)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(strings.Count(string(content), "\n"), 1)
+	s.CheckContains(string(content), "[{\"Start\":")
+
+	// The third run loads the compact form and writes the indented form again.
+	_, stderr = s.RunMain(0, "gobco", "-stats", stats, "-stats-pretty",
+		"-test", "-run=TestNegative", "testdata/append")
+	s.CheckEquals(stderr, "")
+	content, err = os.ReadFile(stats)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "[\n\t{\n")
+}
+
+func Test_gobco_parseCommandLine__stats_compact_and_pretty(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-stats-compact", "-stats-pretty", "pkg"})
+		},
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -stats-compact and -stats-pretty are mutually exclusive\n")
+}
+
+// Test_gobcoMain__self_check runs the whole pipeline on a fixture
+// whose counts are known exactly, to catch regressions in the
+// instrumentation that would otherwise only show up as slightly
+// different numbers.
+func Test_gobcoMain__self_check(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(flags []string, expected ...string) {
+		stats := filepath.Join(t.TempDir(), "stats.json")
+		args := append([]string{"gobco"}, flags...)
+		args = append(args, "-stats", stats, "testdata/selfcheck")
+		_, stderr := s.RunMain(0, args...)
+		s.CheckEquals(stderr, "")
+
+		conds, err := s.newGobco().load(stats)
+		s.CheckEquals(err, nil)
+
+		var actual []string
+		for _, cond := range conds {
+			actual = append(actual, fmt.Sprintf("%s %q %d %d",
+				cond.Start, cond.Code, cond.TrueCount, cond.FalseCount))
+		}
+		s.CheckEquals(actual, expected)
+	}
+
+	branch := []string{
+		"testdata/selfcheck/selfcheck.go:7:5 \"x > 1\" 2 1",
+		"testdata/selfcheck/selfcheck.go:9:12 \"x == 1\" 1 0",
+		"testdata/selfcheck/selfcheck.go:18:14 \"i < n\" 3 1",
+		"testdata/selfcheck/selfcheck.go:27:7 \"x == 1\" 1 3",
+		"testdata/selfcheck/selfcheck.go:27:10 \"x == 2\" 1 2",
+		"testdata/selfcheck/selfcheck.go:29:7 \"x == 3\" 1 1",
+	}
+	test([]string{"-branch"}, branch...)
+	test(nil, append(branch,
+		"testdata/selfcheck/selfcheck.go:37:9 \"a\" 2 1",
+		"testdata/selfcheck/selfcheck.go:37:14 \"b\" 1 1",
+		"testdata/selfcheck/selfcheck.go:42:9 \"a\" 1 2",
+		"testdata/selfcheck/selfcheck.go:42:14 \"b\" 1 1")...)
+}
+
+func Test_gobcoMain__concurrent(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/concurrent")
+
+	// No increment gets lost, even though the condition in the
+	// goroutines is evaluated in parallel.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 6/6",
+		"testdata/concurrent/concurrent.go:10:14: condition \"g < goroutines\" was 8 times true and once false",
+		"testdata/concurrent/concurrent.go:14:16: condition \"i < n\" was 80000 times true and 8 times false",
+		"testdata/concurrent/concurrent.go:15:8: condition \"i%2 == 0\" was 40000 times true and 40000 times false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__list_conditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-conditions", "-branch",
+		"testdata/selfcheck", "testdata/lenient")
+
+	s.CheckEquals(stdout, ""+
+		"testdata/selfcheck/selfcheck.go:7:5: x > 1\n"+
+		"testdata/selfcheck/selfcheck.go:9:12: x == 1\n"+
+		"testdata/selfcheck/selfcheck.go:18:14: i < n\n"+
+		"testdata/selfcheck/selfcheck.go:27:7: x == 1\n"+
+		"testdata/selfcheck/selfcheck.go:27:10: x == 2\n"+
+		"testdata/selfcheck/selfcheck.go:29:7: x == 3\n"+
+		"testdata/lenient/parse.go:10:5: err != nil\n"+
+		"testdata/lenient/parse.go:13:5: n < 0\n")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__cross(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+	defer func(goos, goarch string) {
+		build.Default.GOOS, build.Default.GOARCH = goos, goarch
+	}(build.Default.GOOS, build.Default.GOARCH)
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-conditions",
+		"-cross", "windows/amd64", "testdata/cross")
+
+	s.CheckEquals(stdout, ""+
+		"testdata/cross/base.go:5:26: i >= 0\n"+
+		"testdata/cross/base.go:6:6: isSep(path[i])\n"+
+		"testdata/cross/sep_windows.go:4:9: c == '\\\\'\n"+
+		"testdata/cross/sep_windows.go:4:22: c == '/'\n")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__html_diff(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	oldStats := filepath.Join(dir, "old.json")
+	newStats := filepath.Join(dir, "new.json")
+	html := filepath.Join(dir, "diff.html")
+
+	_, stderr := s.RunMain(0, "gobco", "-stats", oldStats,
+		"-test", "-run=TestPositive", "testdata/append")
+	s.CheckEquals(stderr, "")
+	_, stderr = s.RunMain(0, "gobco", "-stats", newStats, "testdata/append")
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-html-diff", "-html", html,
+		oldStats, newStats)
+	s.CheckEquals(stdout, "")
+	s.CheckEquals(stderr, "")
+
+	content, err := os.ReadFile(html)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "<h1>Condition coverage: 1/2 → 2/2</h1>")
+	s.CheckContains(string(content), "<tr class=\"gained\">\n"+
+		"<td class=\"line\">4</td><td><code>\tif <span class=\"gained\">x &gt; 0</span> {</code>\n"+
+		"<div class=\"cond\"><code>x &gt; 0</code> 1/2 → 2/2</div></td>")
+}
+
+// An -output file ending in .html gets a self-contained HTML report,
+// including the source code around the conditions.
+func Test_gobcoMain__output_html(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	html := filepath.Join(t.TempDir(), "coverage.HTML")
+	stdout, stderr := s.RunMain(0, "gobco", "-output", html, "testdata/samecond")
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 5/8")
+	s.CheckEquals(stderr, "")
+
+	content, err := os.ReadFile(html)
+	s.CheckEquals(err, nil)
+	text := string(content)
+	s.CheckContains(text, "<style>\nbody { font-family: sans-serif; }\n")
+	s.CheckContains(text, "<h1>Condition coverage: 5/8</h1>")
+	s.CheckContains(text, ""+
+		"<tr class=\"source\"><td colspan=\"4\"><pre>"+
+		"    4  // Each of them is counted on its own.\n")
+	for _, external := range []string{"href=", "src=", "@import", "url("} {
+		s.CheckNotContains(text, external)
+	}
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-output", "report.html", "-html", "other.html", "."})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -output report.html writes the report as HTML, which contradicts -html\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-output", "report.html", "-format", "markdown", "."})
+		},
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -output report.html writes the report as HTML, which contradicts -format markdown\n")
+}
+
+func Test_gobco_parseCommandLine__html_diff_arguments(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-html-diff", "old.json"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(),
+		"error: -html-diff requires the old and the new stats file as arguments\n")
+}
+
+func Test_gobcoMain__no_args_module(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":          "module example.com/m\n\ngo 1.16\n",
+		"sub/sub.go":      "package sub\n\nfunc F(x int) bool { return x > 0 }\n",
+		"sub/sub_test.go": "package sub\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F(1) }\n",
+	})
+	chdir(t, filepath.Join(root, "sub"))
+
+	stdout, stderr := s.RunMain(0, "gobco")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"sub.go:3:29: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__no_args_gopath(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	gopath := t.TempDir()
+	writeTree(t, gopath, map[string]string{
+		"src/example.com/p/p.go":      "package p\n\nfunc F(x int) bool { return x > 0 }\n",
+		"src/example.com/p/p_test.go": "package p\n\nimport \"testing\"\n\nfunc TestF(t *testing.T) { F(1) }\n",
+	})
+	setenv(t, "GOPATH", gopath)
+
+	// The directory is reached via a symlink to GOPATH.
+	link := filepath.Join(t.TempDir(), "link")
+	s.CheckEquals(os.Symlink(gopath, link), nil)
+	chdir(t, filepath.Join(link, "src", "example.com", "p"))
+
+	stdout, stderr := s.RunMain(0, "gobco")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"p.go:3:29: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__internal(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-deps", "testdata/internal")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/6",
+		"testdata/internal/internal/helper/helper.go:4:5: condition \"x < 0\" was once false but never true",
+		"testdata/internal/internal/helper/helper.go:7:5: condition \"x > 0\" was once true but never false",
+		"testdata/internal/parent.go:6:9: condition \"helper.Sign(x) > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "testdata/internal/internal/helper")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/4",
+		"testdata/internal/internal/helper/helper.go:4:5: condition \"x < 0\" was once true but never false",
+		"testdata/internal/internal/helper/helper.go:7:5: condition \"x > 0\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+// In GOPATH mode, a package that imports an internal package of one of its
+// ancestors must be copied along with that ancestor, as the go command
+// would otherwise refuse to import the internal package from the original
+// GOPATH.
+func Test_gobcoMain__internal_gopath(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	gopath := t.TempDir()
+	writeTree(t, gopath, map[string]string{
+		"src/example.com/p/internal/h/h.go": "" +
+			"package h\n" +
+			"\n" +
+			"func H(x int) bool { return x > 0 }\n",
+		"src/example.com/p/internal/k/k.go": "" +
+			"package k\n" +
+			"\n" +
+			"import \"example.com/p/internal/h\"\n" +
+			"\n" +
+			"func K(x int) bool { return h.H(x) && x < 10 }\n",
+		"src/example.com/p/internal/k/k_test.go": "" +
+			"package k\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestK(t *testing.T) { K(1) }\n",
+	})
+	setenv(t, "GOPATH", gopath)
+	setenv(t, "GO111MODULE", "off")
+	chdir(t, filepath.Join(gopath, "src", "example.com", "p", "internal", "k"))
+	// The type checker resolves the imports using the default context,
+	// which has been initialized from the original environment.
+	defer func(orig string) { build.Default.GOPATH = orig }(build.Default.GOPATH)
+	build.Default.GOPATH = gopath
+
+	stdout, stderr := s.RunMain(0, "gobco")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"k.go:5:29: condition \"h.H(x)\" was once true but never false",
+		"k.go:5:39: condition \"x < 10\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	g.parseArgs(nil)
+	s.CheckEquals(g.args[0].copyDst, filepath.Join("gopath", "src", "example.com", "p"))
+	s.CheckEquals(g.args[0].instrDir, filepath.Join("gopath", "src", "example.com", "p", "internal", "k"))
+}
+
+func Test_gobco_goCacheEnv(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	out, err := exec.Command("go", "env", "GOMODCACHE", "GOCACHE").Output()
+	s.CheckEquals(err, nil)
+	lines := strings.Fields(string(out))
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "testdata/oddeven"})
+	s.CheckEquals(g.goCacheEnv(), []string{
+		"GOMODCACHE=" + lines[0],
+		"GOCACHE=" + lines[1],
+	})
+
+	g = s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-isolated", "testdata/oddeven"})
+	env := g.goCacheEnv()
+	s.CheckEquals(env[:2], []string{
+		"GOMODCACHE=" + filepath.Join(g.tmpdir, "gomodcache"),
+		"GOCACHE=" + filepath.Join(g.tmpdir, "gocache"),
+	})
+	s.CheckEquals(strings.HasSuffix(env[2], " -modcacherw") || env[2] == "GOFLAGS=-modcacherw", true)
+}
+
+func Test_goTest_env(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	setenv(t, "GOFLAGS", "-tags=integration")
+	setenv(t, "GOOS", "linux")
+	setenv(t, "GOWORK", "/path/to/go.work")
+
+	test := goTest{extraEnv: []string{"GOOS=windows", "GOARCH=amd64"}}
+	env := test.env("tmp", "", "stats.json")
+
+	// The settings from the environment flow through,
+	// except for those that would refer to the original code.
+	contains := func(envVar string) bool {
+		for _, e := range env {
+			if e == envVar {
+				return true
+			}
+		}
+		return false
+	}
+	s.CheckEquals(contains("GOFLAGS=-tags=integration"), true)
+	s.CheckEquals(contains("GOWORK=/path/to/go.work"), false)
+
+	// The extra settings come later and thus take precedence.
+	s.CheckEquals(env[len(env)-3:], []string{
+		"GOOS=windows",
+		"GOARCH=amd64",
+		"GOBCO_STATS=stats.json",
+	})
+}
+
+func Test_gobcoMain__host_caches(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The tests check that they use the caches of the host.
+	wantHostCaches := func() {
+		out, err := exec.Command("go", "env", "GOMODCACHE", "GOCACHE").Output()
+		s.CheckEquals(err, nil)
+		lines := strings.Fields(string(out))
+		setenv(t, "WANT_GOMODCACHE", lines[0])
+		setenv(t, "WANT_GOCACHE", lines[1])
+	}
+
+	code := map[string]string{
+		"p.go": "" +
+			"package p\n" +
+			"\n" +
+			"func Same(a, b string) bool { return a == b }\n",
+		"p_test.go": "" +
+			"package p\n" +
+			"\n" +
+			"import (\n" +
+			"\t\"os\"\n" +
+			"\t\"testing\"\n" +
+			")\n" +
+			"\n" +
+			"func TestCaches(t *testing.T) {\n" +
+			"\tif !Same(os.Getenv(\"GOMODCACHE\"), os.Getenv(\"WANT_GOMODCACHE\")) ||\n" +
+			"\t\t!Same(os.Getenv(\"GOCACHE\"), os.Getenv(\"WANT_GOCACHE\")) {\n" +
+			"\t\tt.Error(os.Getenv(\"GOMODCACHE\"), os.Getenv(\"GOCACHE\"))\n" +
+			"\t}\n" +
+			"}\n",
+	}
+
+	// In module mode, GOPATH is not passed to 'go test'.
+	module := t.TempDir()
+	writeTree(t, module, map[string]string{
+		"go.mod":    "module example.com/p\n\ngo 1.16\n",
+		"p.go":      code["p.go"],
+		"p_test.go": code["p_test.go"],
+	})
+	wantHostCaches()
+	stdout, _ := s.RunMain(0, "gobco", module)
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		module + "/p.go:3:38: condition \"a == b\" was 2 times true but never false",
+	})
+
+	// In GOPATH mode, GOPATH points to the build environment.
+	gopath := t.TempDir()
+	writeTree(t, gopath, map[string]string{
+		"src/example.com/p/p.go":      code["p.go"],
+		"src/example.com/p/p_test.go": code["p_test.go"],
+	})
+	setenv(t, "GOPATH", gopath)
+	setenv(t, "GO111MODULE", "off")
+	chdir(t, filepath.Join(gopath, "src", "example.com", "p"))
+	defer func(orig string) { build.Default.GOPATH = orig }(build.Default.GOPATH)
+	build.Default.GOPATH = gopath
+	wantHostCaches()
+
+	stdout, _ = s.RunMain(0, "gobco")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"p.go:3:38: condition \"a == b\" was 2 times true but never false",
+	})
+}
+
+func Test_internalParent(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(internalParent("example.com/p"), "")
+	s.CheckEquals(internalParent("example.com/p/internal"), "example.com/p")
+	s.CheckEquals(internalParent("example.com/p/internal/h"), "example.com/p")
+	s.CheckEquals(internalParent("example.com/internal/p/internal/h"), "example.com/internal/p")
+	s.CheckEquals(internalParent("internal/poll"), "")
+	s.CheckEquals(internalParent("example.com/internalx/p"), "")
+}
+
+func Test_gobco_findInGopath(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	gopath := t.TempDir()
+	writeTree(t, gopath, map[string]string{
+		"src/example.com/p/p.go": "package p\n",
+		"srcx/q/q.go":            "package q\n",
+	})
+	setenv(t, "GOPATH", "relative"+string(filepath.ListSeparator)+gopath)
+
+	g := s.newGobco()
+	s.CheckEquals(g.findInGopath(filepath.Join(gopath, "src", "example.com", "p")),
+		filepath.Join("src", "example.com", "p"))
+	s.CheckEquals(g.findInGopath(filepath.Join(gopath, "srcx", "q")), "")
+	s.CheckEquals(g.findInGopath(gopath), "")
+
+	// The 'src' directory itself is not a package.
+	src := filepath.Join(gopath, "src")
+	s.CheckPanics(
+		func() { g.findInGopath(src) },
+		exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		fmt.Sprintf("error: argument %q is the directory %s itself, ", src, src)+
+		"which is not a package; please name a package below it\n")
+}
+
+func Test_relativeInside(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := filepath.Join(t.TempDir(), "src")
+
+	s.CheckEquals(relativeInside(dir, filepath.Join(dir, "p", "q")), filepath.Join("p", "q"))
+	s.CheckEquals(relativeInside(dir, dir), ".")
+	s.CheckEquals(relativeInside(dir, dir+string(filepath.Separator)), ".")
+	s.CheckEquals(relativeInside(dir, filepath.Dir(dir)), "")
+	s.CheckEquals(relativeInside(dir, dir+"x"), "")
+	s.CheckEquals(relativeInside(dir, filepath.Join(dir, "..", "x")), "")
+	s.CheckEquals(relativeInside(dir, filepath.Join(dir, "..x")), "..x")
+
+	// A relative target cannot be compared to an absolute directory.
+	s.CheckEquals(relativeInside(dir, ""), "")
+	s.CheckEquals(relativeInside(dir, "."), "")
+}
+
+func Test_gobco_parseCommandLine__empty_argument(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", ""}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), ""+
+		"error: the argument must not be empty; "+
+		"use \".\" for the package in the current directory\n")
+}
+
+func Test_gobco_parseCommandLine__outside_module_and_gopath(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	setenv(t, "GOPATH", t.TempDir())
+	chdir(t, t.TempDir())
+	cwd, err := os.Getwd()
+	s.CheckEquals(err, nil)
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), ""+
+		"error: argument \".\" refers to the current directory "+cwd+", "+
+		"which must be inside a Go module or GOPATH\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "p.go"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), ""+
+		"error: argument \"p.go\" refers to the current directory "+cwd+", "+
+		"which must be inside a Go module or GOPATH\n")
+}
+
+// writeTree creates the files below dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for rel, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// chdir changes the working directory until the end of the test.
+// Unlike the absolute path from os.Getwd,
+// the directory is passed on to gobco as given, including symlinks.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	oldPWD, hadPWD := os.LookupEnv("PWD")
+	_ = os.Setenv("PWD", dir)
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+		if hadPWD {
+			_ = os.Setenv("PWD", oldPWD)
+		} else {
+			_ = os.Unsetenv("PWD")
+		}
+	})
+}
+
+// setenv sets the environment variable until the end of the test.
+func setenv(t *testing.T, name, value string) {
+	old, had := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			_ = os.Setenv(name, old)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+}
+
+func Test_gobcoMain__include_untested(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-include-untested", "testdata/untested")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/untested/other.go:9:5: condition \"a > b\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "testdata/untested")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_includeUntested(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	discovered := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "b.go:3:4", File: "b.go", Line: 3, Col: 4, Code: "b", Func: "g", Depth: 1, ID: "id-b"},
+		{Start: "c.go:3:4", File: "c.go", Line: 3, Col: 4, Code: "c", Func: "h", Depth: 1, ID: "id-c"},
+	}
+	conds := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "c.go:3:4", File: "c.go", Line: 3, Col: 4, Code: "c", TrueCount: 1, FalseCount: 1, Func: "h", Depth: 1, ID: "id-c"},
+		{Start: "dep/d.go:3:4", File: "dep/d.go", Line: 3, Col: 4, Code: "d", FalseCount: 1, Func: "d", Depth: 1, ID: "id-d"},
+	}
+
+	s.CheckEquals(includeUntested(discovered, conds), []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "b.go:3:4", File: "b.go", Line: 3, Col: 4, Code: "b", Func: "g", Depth: 1, ID: "id-b"},
+		{Start: "c.go:3:4", File: "c.go", Line: 3, Col: 4, Code: "c", TrueCount: 1, FalseCount: 1, Func: "h", Depth: 1, ID: "id-c"},
+		{Start: "dep/d.go:3:4", File: "dep/d.go", Line: 3, Col: 4, Code: "d", FalseCount: 1, Func: "d", Depth: 1, ID: "id-d"},
+	})
+}
+
+func Test_gobcoMain__ignore_directives(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-suspect-constant", "1", "testdata/directive")
+
+	// The outcomes that are ignored by a directive
+	// neither count for the coverage nor are they suspected to be constant.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/6",
+		"testdata/directive/directive.go:22:9: condition \"x > 0\" was never evaluated",
+		"testdata/directive/directive.go:22:18: condition \"x < 10\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__line_directives(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/linedirective")
+
+	// The condition in Accept comes from grammar.y and is not instrumented.
+	// The condition in Positive is reported at its physical position,
+	// even though a directive says it comes from template.go.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/linedirective/parser.go:12:9: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__json_test_output(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	output := filepath.Join(t.TempDir(), "report.txt")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-json-test-output", "-output", output,
+		"testdata/append")
+
+	// Stdout only contains the events from 'go test'.
+	actions := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		var event struct{ Action string }
+		s.CheckEquals(json.Unmarshal([]byte(line), &event), nil)
+		actions[event.Action] = true
+	}
+	s.CheckEquals(actions["run"], true)
+	s.CheckEquals(actions["pass"], true)
+	s.CheckEquals(stderr, "")
+
+	report, err := os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(report), "\nCondition coverage: 2/2\n")
+}
+
+func Test_gobco_parseCommandLine__json_test_output_without_output(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-json-test-output", "pkg"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -json-test-output requires -output, "+
+		"to keep the report out of the JSON events\n")
+}
+
+func Test_gobcoMain__custom_sink(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The sink is installed by a test file,
+	// and it multiplies the counts by 10.
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/sink")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/sink/sink.go:4:5: condition \"x > 0\" was 10 times true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_buildTags(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(args []string, expected ...string) {
+		s.CheckEquals(buildTags(args), expected)
+	}
+
+	test(nil)
+	test([]string{"-short"})
+	test([]string{"-tags=a,b"}, "a", "b")
+	test([]string{"--tags="})
+	test([]string{"-tags", "a b"}, "a", "b")
+	// Only the last -tags option counts.
+	test([]string{"-tags=a", "-tags=b"}, "b")
+}
+
+func Test_gobcoMain__require_tests(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	arg := argInfo{arg: "testdata/tagged", argDir: "testdata/tagged"}
+	s.CheckEquals(checkHasTests(arg, []string{"integration"}), nil)
+	arg = argInfo{arg: "testdata/branch", argDir: "testdata/branch"}
+	s.CheckEquals(checkHasTests(arg, nil).Error(),
+		"error: package testdata/branch has no test files, "+
+			"so none of its conditions can be covered")
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/untested\n\ngo 1.16\n",
+		"untested.go": "" +
+			"package untested\n" +
+			"\n" +
+			"func Positive(x int) bool { return x > 0 }\n",
+	})
+
+	// Without tests, all conditions are reported as never evaluated.
+	stdout, _ := s.RunMain(0, "gobco", dir)
+	s.CheckContains(stdout, "Condition coverage: 0/2\n")
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-require-tests", dir})
+	defer g.cleanUp()
+	s.CheckPanics(
+		func() { g.prepareTmp() },
+		exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: package "+dir+" has no test files, "+
+		"so none of its conditions can be covered\n")
+}
+
+func Test_gobcoMain__no_buildable_files(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	arg := argInfo{arg: "testdata/tagged", argDir: "testdata/tagged"}
+	s.CheckEquals(checkBuildable(arg, []string{"unit", "slow"}).Error(),
+		"error: no buildable Go files for package testdata/tagged with tags \"unit,slow\"")
+	s.CheckEquals(checkBuildable(arg, nil).Error(),
+		"error: no buildable Go files for package testdata/tagged")
+	s.CheckEquals(checkBuildable(arg, []string{"integration"}), nil)
+
+	// Since 'go test' doesn't get the tag "gobco", neither do the checks.
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"only.go":      "//go:build gobco\n\npackage only\n",
+		"only_test.go": "//go:build gobco\n\npackage only\n",
+	})
+	arg = argInfo{arg: dir, argDir: dir}
+	s.CheckEquals(checkBuildable(arg, nil).Error(),
+		"error: no buildable Go files for package "+dir)
+
+	stdout, stderr := s.RunMain(0, "gobco", "-test", "-tags=integration", "testdata/tagged")
+	s.CheckContains(stdout, "Condition coverage: 1/2")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__matrix(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(validTags(""), true)
+	s.CheckEquals(validTags("unit"), true)
+	s.CheckEquals(validTags("integration,go1.21,with_db"), true)
+	s.CheckEquals(validTags("a b"), false)
+	s.CheckEquals(validTags("a,,b"), false)
+	s.CheckEquals(validTags("!unit"), false)
+
+	// The condition in big.go is only built with the tag 'integration'.
+	// Each of the tag sets covers one outcome of the condition in matrix.go.
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	stdout, stderr := s.RunMain(0, "gobco",
+		"-matrix", "unit", "-matrix", "integration", "-stats", stats,
+		"testdata/matrix")
+	s.CheckContains(stdout, ""+
+		"Condition coverage: 3/4\n"+
+		"testdata/matrix/big.go:7:9: condition \"x > 1000\" was once true but never false\n")
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	conds, err := g.load(stats)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(len(conds), 2)
+
+	// A single tag set only knows the conditions from its files.
+	stdout, _ = s.RunMain(0, "gobco", "-matrix", "unit", "testdata/matrix")
+	s.CheckContains(stdout, "Condition coverage: 1/2\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-matrix", "unit integration", "testdata/matrix"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -matrix must be a comma-separated list of build tags, "+
+		"not \"unit integration\"\n")
+}
+
+func Test_gobcoMain__condition_ID(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	_, stderr := s.RunMain(0, "gobco", "-stats", stats, "testdata/samecond")
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	conds, err := g.load(stats)
+	s.CheckEquals(err, nil)
+
+	var ids []string
+	for _, cond := range conds {
+		ids = append(ids, cond.ID)
+	}
+	s.CheckEquals(ids, []string{
+		conditionID("Same", "a", 0),
+		conditionID("Same", "b", 0),
+		conditionID("Same", "a", 1),
+		conditionID("Same", "b", 1),
+	})
+}
+
+func Test_gobcoMain__cover_deps(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-deps", "testdata/coverdeps")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/6",
+		"testdata/coverdeps/lib/internal/util/util.go:6:9: " +
+			"condition \"x >= 1000\" was once false but never true",
+		"testdata/coverdeps/lib/lib.go:6:5: " +
+			"condition \"util.IsLarge(x)\" was once false but never true",
+		"testdata/coverdeps/main.go:6:5: " +
+			"condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+// A dependency that is shared by several arguments
+// is only instrumented once.
+func Test_gobcoMain__cover_deps_shared(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-cover-deps", "-verbose",
+		"testdata/coverdeps", "testdata/coverdeps/lib")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/6",
+		"testdata/coverdeps/lib/internal/util/util.go:6:9: " +
+			"condition \"x >= 1000\" was once false but never true",
+		"testdata/coverdeps/lib/lib.go:6:5: " +
+			"condition \"util.IsLarge(x)\" was once false but never true",
+		"testdata/coverdeps/main.go:6:5: " +
+			"condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(strings.Count(stderr,
+		"Instrumented dependency github.com/moneyforward/gobco/testdata/coverdeps/lib/internal/util "), 1)
+	s.CheckContains(stderr,
+		"Reused the instrumented dependency github.com/moneyforward/gobco/testdata/coverdeps/lib/internal/util ")
+}
+
+// Test_gobcoMain__cover_deps_load ensures that the counters from the
+// sorted stats file are added to the matching conditions, even though
+// the dependencies come before the package itself in the stats file.
+func Test_gobcoMain__cover_deps_load(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+	for run := 1; run <= 2; run++ {
+		stdout, stderr := s.RunMain(0, "gobco", "-no-cache", "-cover-deps", "-list-all",
+			"-stats", stats, "testdata/coverdeps")
+		times := map[int]string{1: "once", 2: "2 times"}[run]
+
+		s.CheckEquals(s.GobcoLines(stdout), []string{
+			"Condition coverage: 3/6",
+			"testdata/coverdeps/lib/internal/util/util.go:6:9: " +
+				"condition \"x >= 1000\" was " + times + " false but never true",
+			"testdata/coverdeps/lib/lib.go:6:5: " +
+				"condition \"util.IsLarge(x)\" was " + times + " false but never true",
+			"testdata/coverdeps/main.go:6:5: " +
+				"condition \"x > 0\" was " + times + " true but never false",
+		})
+		s.CheckEquals(stderr, "")
+	}
+}
+
+// Test_gobcoMain__stats_sorted ensures that the stats file lists the
+// conditions by their location, even if the dependencies are instrumented
+// after the package itself, and that repeated runs produce the same file.
+func Test_gobcoMain__stats_sorted(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	var first []byte
+	for run := 0; run < 2; run++ {
+		stats := filepath.Join(t.TempDir(), "stats.json")
+		_, stderr := s.RunMain(0, "gobco", "-cover-deps", "-stats", stats,
+			"testdata/coverdeps")
+		s.CheckEquals(stderr, "")
+
+		content, err := os.ReadFile(stats)
+		s.CheckEquals(err, nil)
+		if run == 0 {
+			first = content
+			continue
+		}
+		s.CheckEquals(string(content), string(first))
+	}
+
+	var conds []condition
+	s.CheckEquals(json.Unmarshal(first, &conds), nil)
+	var starts []string
+	for _, cond := range conds {
+		starts = append(starts, cond.Start)
+	}
+	s.CheckEquals(starts, []string{
+		"testdata/coverdeps/lib/internal/util/util.go:6:9",
+		"testdata/coverdeps/lib/lib.go:6:5",
+		"testdata/coverdeps/main.go:6:5",
+	})
+}
+
+func Test_gobcoMain__group_by_func(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(6, "gobco", "-group-by", "func", "testdata/failing")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"",
+		"Foo: 5/6",
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
+		"",
+		"isRandom: 0/2",
+		"testdata/failing/random.go:8:9: condition \"x == 4\" was never evaluated",
+	})
+	s.CheckContains(stderr, "exit status 1")
+}
+
+func Test_gobcoMain__weight_depth(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-weight", "depth", "testdata/weight")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"testdata/weight/weight.go:9:7: condition \"x%2 == 0\" was 3 times false but never true",
+		"testdata/weight/weight.go:8:6: condition \"x > i\" was 3 times true but never false",
+		"testdata/weight/weight.go:4:5: condition \"x < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__lenient_errors(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-lenient-errors", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/4",
+		"testdata/lenient/parse.go:13:5: condition \"n < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/lenient/parse.go:10:5: condition \"err != nil\" was once false but never true",
+		"testdata/lenient/parse.go:13:5: condition \"n < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__exclude_constant(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/constant")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/4",
+		"testdata/constant/abs.go:6:5: condition \"verbose\" is a constant condition (always false)",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-exclude-constant", "testdata/constant")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__by_file(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-by-file", "-cover-test", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/8",
+		"testdata/lenient/parse.go: 2/4 conditions (50%)",
+		"testdata/lenient/parse_test.go: 2/4 conditions (50%)",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-by-file", "-branch", "-path-style=relative", "-cover-test", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Branch coverage: 3/6",
+		"parse.go: 2/4 branches (50%)",
+		"parse_test.go: 1/2 branches (50%)",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__tree(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-tree", "-cover-test", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 4/8",
+		"testdata/lenient/ 4/8 (50%)",
+		"├── parse.go 2/4 (50%)",
+		"└── parse_test.go 2/4 (50%)",
+	})
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-tree", "-by-file", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -tree and -by-file contradict each other\n")
+}
+
+func Test_newCoverageTree(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	root := newCoverageTree([]fileCoverage{
+		{"src/api/handler.go", 6, 8},
+		{"src/api/v1/routes.go", 2, 2},
+		{"src/store/db.go", 3, 6},
+		{"src/store/cache/lru.go", 1, 4},
+		{"main.go", 0, 0},
+	})
+
+	s.CheckEquals(root.lines(""), []string{
+		"├── main.go 0/0 (100%)",
+		"└── src/ 12/20 (60%)",
+		"    ├── api/ 8/10 (80%)",
+		"    │   ├── handler.go 6/8 (75%)",
+		"    │   └── v1/ 2/2 (100%)",
+		"    │       └── routes.go 2/2 (100%)",
+		"    └── store/ 4/10 (40%)",
+		"        ├── cache/ 1/4 (25%)",
+		"        │   └── lru.go 1/4 (25%)",
+		"        └── db.go 3/6 (50%)",
+	})
+
+	// A chain of directories that only contain a single directory
+	// is shown as a single node.
+	root = newCoverageTree([]fileCoverage{
+		{"/home/user/module/pkg/a.go", 1, 2},
+		{"/home/user/module/pkg/b.go", 2, 2},
+	})
+	s.CheckEquals(root.lines(""), []string{
+		"└── /home/user/module/pkg/ 3/4 (75%)",
+		"    ├── a.go 1/2 (50%)",
+		"    └── b.go 2/2 (100%)",
+	})
+}
+
+func Test_gobcoMain__per_file_threshold(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(0, "gobco", "-per-file-threshold", "50",
+		"-cover-test", "testdata/lenient")
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr := s.RunMain(3, "gobco", "-per-file-threshold", "50.5",
+		"-cover-test", "testdata/lenient")
+	s.CheckContains(stdout, "Condition coverage: 4/8\n")
+	s.CheckEquals(stderr, ""+
+		"error: the coverage of these files is below -per-file-threshold=50.5:\n"+
+		"  testdata/lenient/parse.go: 2/4 (50.0%)\n"+
+		"  testdata/lenient/parse_test.go: 2/4 (50.0%)\n")
+
+	// Only the files below the threshold are listed.
+	_, stderr = s.RunMain(6, "gobco", "-per-file-threshold", "50", "testdata/failing")
+	s.CheckContains(stderr, ""+
+		"error: the coverage of these files is below -per-file-threshold=50:\n"+
+		"  testdata/failing/random.go: 0/2 (0.0%)\n")
+	s.CheckNotContains(stderr, "fail.go: ")
+}
+
+func Test_gobco_parseCommandLine__per_file_threshold(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-per-file-threshold", "101", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -per-file-threshold must be between 0 and 100, not 101\n")
+}
+
+func Test_gobcoMain__min_branches(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(0, "gobco", "-min-branches", "2", "testdata/lenient")
+	s.CheckEquals(stderr, "")
+
+	// Without -cover-test, the conditions from the tests are missing.
+	stdout, stderr := s.RunMain(3, "gobco", "-min-branches", "3", "testdata/lenient")
+	s.CheckContains(stdout, "Condition coverage: 2/4\n")
+	s.CheckEquals(stderr, ""+
+		"error: only 2 conditions were instrumented, "+
+		"but -min-branches requires at least 3\n")
+
+	_, stderr = s.RunMain(0, "gobco", "-min-branches", "3", "-cover-test", "testdata/lenient")
+	s.CheckEquals(stderr, "")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-min-branches", "-1", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -min-branches must not be negative, not -1\n")
+}
+
+func Test_gobcoMain__report_skipped(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-report-skipped", "-max-conditions", "1", "testdata/skipped")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/skipped/skipped.go:4:9: condition \"x > 0\" was once true but never false",
+		"",
+		"Files that were not instrumented:",
+		"testdata/skipped/generated.go: gobcoignore (matched by .gobcoignore)",
+		"testdata/skipped/large.go: max-conditions (more conditions than -max-conditions)",
+		"testdata/skipped/plan9.go: build-constraints (excluded by the build constraints)",
+		"testdata/skipped/tool.go: ignore-tag (excluded by the build tag ignore)",
+	})
+	s.CheckEquals(stderr, ""+
+		"gobco: not instrumenting testdata/skipped/large.go, "+
+		"as its 2 conditions are more than -max-conditions=1\n")
+
+	stdout, _ = s.RunMain(0, "gobco", "-report-skipped", "testdata/samecond")
+	s.CheckContains(stdout, "\nAll files were instrumented.\n")
+
+	stdout, _ = s.RunMain(0, "gobco", "testdata/skipped")
+	s.CheckNotContains(stdout, "not instrumented")
+}
+
+func Test_gobcoMain__metric(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-metric", "conditions", "testdata/samecond")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/4 conditions with both outcomes covered",
+		"testdata/samecond/samecond.go:6:9: condition \"a\" was 2 times true but never false",
+		"testdata/samecond/samecond.go:6:19: condition \"a\" was once true but never false",
+		"testdata/samecond/samecond.go:6:25: condition \"b\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	// The threshold refers to the selected metric as well.
+	_, stderr = s.RunMain(0, "gobco", "-per-file-threshold", "50", "testdata/samecond")
+	s.CheckEquals(stderr, "")
+	_, stderr = s.RunMain(3, "gobco", "-metric", "conditions", "-per-file-threshold", "50", "testdata/samecond")
+	s.CheckEquals(stderr, ""+
+		"error: the coverage of these files is below -per-file-threshold=50:\n"+
+		"  testdata/samecond/samecond.go: 1/4 (25.0%)\n")
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-metric", "outcomes", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -metric must be \"branches\" or \"conditions\", not \"outcomes\"\n")
+}
+
+func Test_gobcoMain__pretty(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-pretty", "-list-all", "-path-style=relative", "testdata/lenient")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"",
+		"LOCATION       TRUE  FALSE  STATUS",
+		"parse.go:10:5  0     1      never true",
+		"parse.go:13:5  0     1      never true",
+		"TOTAL          0     2      2/4 covered (50%)",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobco_colorAllowed(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	setenv(t, "NO_COLOR", "")
+	s.CheckEquals(g.colorAllowed(), true)
+
+	setenv(t, "NO_COLOR", "1")
+	s.CheckEquals(g.colorAllowed(), false)
+
+	setenv(t, "NO_COLOR", "")
+	g.noColor = true
+	s.CheckEquals(g.colorAllowed(), false)
+
+	// Only terminals get colors.
+	g.noColor = false
+	s.CheckEquals(g.useColor(&bytes.Buffer{}), false)
+}
+
+func Test_prettyStatus(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(trueCount, falseCount int, constant string, expected string) {
+		cond := condition{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "x", TrueCount: trueCount, FalseCount: falseCount, Constant: constant}
+		s.CheckEquals(prettyStatus(cond, false), expected)
+	}
+
+	test(0, 0, "", "never evaluated")
+	test(0, 3, "", "never true")
+	test(3, 0, "", "never false")
+	test(1, 1, "", "covered")
+	test(0, 3, "false", "constant false")
+}
+
+func Test_gobcoMain__since(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/since\n\ngo 1.16\n",
+		"old.go": "" +
+			"package since\n" +
+			"\n" +
+			"func IsOld(x int) bool {\n" +
+			"\treturn x < 0\n" +
+			"}\n",
+		"new.go": "" +
+			"package since\n" +
+			"\n" +
+			"func IsNew(x int) bool {\n" +
+			"\treturn x > 0\n" +
+			"}\n",
+		"since_test.go": "" +
+			"package since\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestSince(t *testing.T) {\n" +
+			"\t_ = IsOld(1) == IsNew(1)\n" +
+			"}\n",
+	})
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.go"), lastWeek, lastWeek); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := s.RunMain(0, "gobco", "-since", "24h", "-path-style=relative", dir)
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"new.go:4:9: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__log_level(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(0, "gobco", "-log-level=info", "-no-cache", "testdata/lenient")
+	s.CheckContains(stderr, "Instrumented testdata/lenient to ")
+	s.CheckNotContains(stderr, "Running ")
+
+	// The debug dump cannot be written, which is only a warning.
+	dump := filepath.Join(t.TempDir(), "missing", "dump.json")
+	_, stderr = s.RunMain(0, "gobco", "-debug-dump", dump, "testdata/lenient")
+	s.CheckContains(stderr, "gobco: cannot write the debug dump: ")
+
+	_, stderr = s.RunMain(0, "gobco", "-quiet", "-debug-dump", dump, "testdata/lenient")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__run(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/run\n\ngo 1.16\n",
+		"sign.go": "" +
+			"package run\n" +
+			"\n" +
+			"func Sign(x int) int {\n" +
+			"\tif x < 0 {\n" +
+			"\t\treturn -1\n" +
+			"\t}\n" +
+			"\treturn 1\n" +
+			"}\n",
+		"sign_test.go": "" +
+			"package run\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestNegative(t *testing.T) {\n" +
+			"\t_ = Sign(-1)\n" +
+			"}\n" +
+			"\n" +
+			"func TestPositive(t *testing.T) {\n" +
+			"\t_ = Sign(1)\n" +
+			"}\n",
+	})
+
+	stdout, stderr := s.RunMain(0, "gobco", "-run", "Positive", "-path-style=relative", dir)
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"(covered by the tests matching \"Positive\", the total still includes all conditions)",
+		"sign.go:4:5: condition \"x < 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, _ = s.RunMain(0, "gobco", dir)
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+}
+
+func Test_gobcoMain__test_binary_args(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/binaryargs\n\ngo 1.16\n",
+		"greet.go": "" +
+			"package binaryargs\n" +
+			"\n" +
+			"func IsGiven(s string) bool {\n" +
+			"\treturn len(s) > 0\n" +
+			"}\n",
+		"greet_test.go": "" +
+			"package binaryargs\n" +
+			"\n" +
+			"import (\n" +
+			"\t\"flag\"\n" +
+			"\t\"testing\"\n" +
+			")\n" +
+			"\n" +
+			"var greeting = flag.String(\"greeting\", \"\", \"\")\n" +
+			"\n" +
+			"func TestGreeting(t *testing.T) {\n" +
+			"\t_ = IsGiven(*greeting)\n" +
+			"}\n",
+	})
+
+	stdout, stderr := s.RunMain(0, "gobco", "-path-style=relative", dir, "--", "-greeting", "hello")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"greet.go:4:9: condition \"len(s) > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_splitTestBinaryArgs(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(argv []string, expectedArgv, expectedBinaryArgs []string) {
+		actualArgv, actualBinaryArgs := splitTestBinaryArgs(argv)
+		s.CheckEquals(actualArgv, expectedArgv)
+		s.CheckEquals(actualBinaryArgs, expectedBinaryArgs)
+	}
+
+	test([]string{"gobco", "pkg"},
+		[]string{"gobco", "pkg"}, nil)
+	test([]string{"gobco", "-branch", "pkg", "--", "-flag", "--", "x"},
+		[]string{"gobco", "-branch", "pkg"}, []string{"-flag", "--", "x"})
+	test([]string{"gobco", "--"},
+		[]string{"gobco"}, []string{})
+
+	var g goTest
+	g.binaryArgs = []string{"-flag"}
+	s.CheckEquals(g.args(false, []string{"-vet=off"}), []string{
+		"go", "test", "-test.count", "1", ".", "-vet=off",
+		"-args", "-flag"})
+
+	g = goTest{count: 10}
+	s.CheckEquals(g.args(false, nil), []string{
+		"go", "test", "-test.count", "10", "."})
+
+	g = goTest{runner: []string{"gotestsum", "--"}}
+	s.CheckEquals(g.command(false, nil), []string{
+		"gotestsum", "--", "-test.count", "1", "."})
+}
+
+func Test_gobcoMain__test_runner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	log := filepath.Join(t.TempDir(), "log")
+	runner := "sh -c 'echo \"$@\" >> " + log + " && exec go test \"$@\"' runner"
+
+	stdout, stderr := s.RunMain(0, "gobco", "-test-runner", runner, "testdata/collision")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+	content, err := os.ReadFile(log)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(content), "-test.count 1 .\n")
+}
+
+func Test_gobco_parseCommandLine__test_runner(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-test-runner", "'unclosed", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -test-runner requires a command, not \"'unclosed\"\n")
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-test-runner", "gobco-no-such-runner --", "."}) },
+		exited(2))
+	s.CheckContains(s.Stderr(), "error: -test-runner: exec: \"gobco-no-such-runner\": ")
+}
+
+func Test_gobcoMain__count(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The counts accumulate over all runs of the tests.
+	stdout, _ := s.RunMain(0, "gobco", "-list-all", "-count", "3", "testdata/collision")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+		"testdata/collision/kind.go:10:7: condition \"x == gobco0\" was 3 times true and 3 times false",
+	})
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-count", "0"}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -count must be positive, not 0\n")
+}
+
+func Test_gobco_parseCommandLine__run_invalid(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-run", "Test("}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -run: error parsing regexp: missing closing ): `Test(`\n")
+}
+
+func Test_gobcoMain__cache(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+	setenv(t, "GOBCO_CACHE", t.TempDir())
+
+	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "testdata/lenient")
+	s.CheckContains(stderr, "Instrumented testdata/lenient to ")
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 2/4")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-verbose", "testdata/lenient")
+	s.CheckContains(stderr, "Reused the instrumentation of testdata/lenient from ")
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 2/4")
+
+	// Options that change the instrumented code have their own entries.
+	stdout, stderr = s.RunMain(0, "gobco", "-verbose", "-branch", "testdata/lenient")
+	s.CheckContains(stderr, "Instrumented testdata/lenient to ")
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Branch coverage: 2/4")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-verbose", "-no-cache", "testdata/lenient")
+	s.CheckContains(stderr, "Instrumented testdata/lenient to ")
+}
+
+// Test_gobcoMain__cache_max_conditions ensures that a cache hit
+// reports the files that were skipped when the entry was created,
+// and that -max-conditions selects its own entry.
+func Test_gobcoMain__cache_max_conditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+	setenv(t, "GOBCO_CACHE", t.TempDir())
+
+	warning := "gobco: not instrumenting testdata/maxconds/generated.go, " +
+		"as its 3 conditions are more than -max-conditions=2\n"
+
+	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "-max-conditions", "2", "testdata/maxconds")
+	s.CheckContains(stderr, "Instrumented testdata/maxconds to ")
+	s.CheckContains(stderr, warning)
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 1/2")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-verbose", "-max-conditions", "2", "testdata/maxconds")
+	s.CheckContains(stderr, "Reused the instrumentation of testdata/maxconds from ")
+	s.CheckContains(stderr, warning)
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 1/2")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-verbose", "-max-conditions", "0", "testdata/maxconds")
+	s.CheckContains(stderr, "Instrumented testdata/maxconds to ")
+	s.CheckNotContains(stderr, warning)
+	s.CheckEquals(s.GobcoLines(stdout)[0], "Condition coverage: 4/8")
+}
+
+func Test_gobcoMain__verify_compile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(5, "gobco", "testdata/verify")
+
+	s.CheckEquals(stdout, "")
+	s.CheckContains(stderr, "error: the instrumented code of testdata/verify does not compile, "+
+		"although the original code does, which is probably a bug in gobco\n"+
+		"The instrumented code is in ")
+	s.CheckContains(stderr, "./verify.go:9:9: invalid operation: cannot call GobcoCover (variable of type int): int is not a function")
+
+	// The temporary directory is kept for investigation.
+	const kept = "gobco: the temporary files are in "
+	s.CheckContains(stderr, kept)
+	tmpdir := strings.TrimSpace(stderr[strings.Index(stderr, kept)+len(kept):])
+	s.CheckEquals(os.RemoveAll(tmpdir), nil)
+
+	// Without the verification, the error only shows up in 'go test'.
+	stdout, stderr = s.RunMain(6, "gobco", "-verify-compile=false", "testdata/verify")
+
+	s.CheckContains(stdout, "[build failed]")
+	s.CheckContains(stderr, "./verify.go:9:9: invalid operation: cannot call GobcoCover (variable of type int): int is not a function")
+	s.CheckNotContains(stderr, "probably a bug in gobco")
+}
+
+// The verification also compiles the tests,
+// as their instrumentation may be broken as well, see -cover-test.
+func Test_gobco_verifyCompiles__tests(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "testdata/lenient"})
+	g.prepareTmp()
+	g.instrument()
+
+	arg := g.args[0]
+	s.CheckEquals(g.verifyCompiles(arg, ""), true)
+
+	broken := filepath.Join(g.file(arg.instrDir), "broken_test.go")
+	s.CheckEquals(os.WriteFile(broken, []byte("package lenient\n\nvar broken int = \"broken\"\n"), 0o666), nil)
+	s.CheckEquals(g.verifyCompiles(arg, ""), false)
+
+	stderr := s.Stderr()
+	s.CheckContains(stderr, "error: the instrumented code of testdata/lenient does not compile, "+
+		"although the original code does, which is probably a bug in gobco\n")
+	s.CheckContains(stderr, "broken_test.go:3:18: cannot use \"broken\"")
+	s.CheckEquals(g.keep, true)
+
+	g.keep = false
+	g.cleanUp()
+}
+
+func Test_gobcoMain__check_only(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The tests are not run, so there is no report.
+	stdout, stderr := s.RunMain(0, "gobco", "-check-only", "testdata/lenient", "testdata/failing")
+	s.CheckEquals(stdout, ""+
+		"ok  \ttestdata/lenient\n"+
+		"ok  \ttestdata/failing\n")
+	s.CheckEquals(stderr, "")
+
+	// All packages are checked, even if one of them fails.
+	stdout, stderr = s.RunMain(5, "gobco", "-check-only", "testdata/verify", "testdata/keepgoing", "testdata/lenient")
+	s.CheckEquals(stdout, ""+
+		"FAIL\ttestdata/verify\n"+
+		"ok  \ttestdata/lenient\n")
+	s.CheckContains(stderr, "error: the instrumented code of testdata/verify does not compile, "+
+		"although the original code does, which is probably a bug in gobco\n"+
+		"The instrumented code is in ")
+	s.CheckContains(stderr, "./verify.go:9:9: invalid operation: cannot call GobcoCover (variable of type int): int is not a function")
+	s.CheckContains(stderr, "gobco: could not instrument testdata/keepgoing: ")
+
+	const kept = "gobco: the temporary files are in "
+	s.CheckContains(stderr, kept)
+	tmpdir := strings.TrimSpace(stderr[strings.Index(stderr, kept)+len(kept):])
+	s.CheckEquals(os.RemoveAll(tmpdir), nil)
+}
+
+func Test_expandPatterns(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":                  "module example.com/tree\n",
+		"root.go":                 "package tree\n",
+		"api/api.go":              "package api\n",
+		"api/v1/v1_test.go":       "package v1\n",
+		"docs/README.md":          "no Go code\n",
+		"store/testdata/data.go":  "package data\n",
+		"store/_old/old.go":       "package old\n",
+		"store/.hidden/hidden.go": "package hidden\n",
+		"store/vendor/dep/dep.go": "package dep\n",
+		"store/tagged.go":         "//go:build integration\n\npackage store\n",
+		"nested/go.mod":           "module example.com/nested\n",
+		"nested/nested.go":        "package nested\n",
+	})
+
+	join := func(rel string) string { return filepath.Join(dir, filepath.FromSlash(rel)) }
+
+	args, err := expandPatterns([]string{dir + "/...", "other"}, nil)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{dir, join("api"), join("api/v1"), "other"})
+
+	args, err = expandPatterns([]string{join("store") + "/..."}, []string{"integration"})
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{join("store")})
+
+	_, err = expandPatterns([]string{join("docs") + "/..."}, nil)
+	s.CheckEquals(err.Error(), "error: \""+join("docs")+"/...\" matches no packages")
+
+	// Wildcards match the directories that contain a package,
+	// and the Go files.
+	args, err = expandPatterns([]string{join("*")}, nil)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{join("api"), join("nested"), join("root.go")})
+
+	args, err = expandPatterns([]string{join("api/*.go"), join("r??t.go")}, nil)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{join("api/api.go"), join("root.go")})
+
+	// Braces and wildcards compose with "/...".
+	args, err = expandPatterns([]string{join("{api,st*}") + "/..."}, []string{"integration"})
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{join("api"), join("api/v1"), join("store")})
+
+	_, err = expandPatterns([]string{join("x*")}, nil)
+	s.CheckEquals(err.Error(), "error: \""+join("x*")+"\" matches no packages")
+
+	_, err = expandPatterns([]string{join("{docs,store}")}, nil)
+	s.CheckEquals(err.Error(), "error: \""+join("{docs,store}")+"\" matches no packages")
+}
+
+func Test_expandBraces(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(pattern string, expected ...string) {
+		s.CheckEquals(expandBraces(pattern), expected)
+	}
+
+	test("cmd", "cmd")
+	test("cmd/{client,server}", "cmd/client", "cmd/server")
+	test("{a,b}/{c,d}", "a/c", "a/d", "b/c", "b/d")
+	test("x{a,b{c,d}}", "xa", "xbc", "xbd")
+	test("x{,y}", "x", "xy")
+	test("x{a,b", "x{a,b")
+}
+
+// An argument that exists literally is not expanded,
+// even if it looks like a pattern.
+func Test_expandGlob__literal(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"odd[1]/odd.go": "package odd\n",
+		"odd1/odd.go":   "package odd\n",
+	})
+
+	literal := filepath.Join(dir, "odd[1]")
+	args, err := expandGlob(literal, build.Default)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{literal})
+
+	args, err = expandGlob(filepath.Join(dir, "odd?"), build.Default)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(args, []string{filepath.Join(dir, "odd1")})
+}
+
+// If the code doesn't compile even without instrumentation,
+// it's not gobco's fault, and 'go test' reports the details.
+// Type errors are already detected during instrumentation,
+// but not the errors that only the go command detects.
+func Test_gobcoMain__verify_compile_original(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/broken\n\ngo 1.16\n",
+		"broken.go": "" +
+			"package broken\n" +
+			"\n" +
+			"import _ \"embed\"\n" +
+			"\n" +
+			"//go:embed missing.txt\n" +
+			"var missing string\n",
+	})
+
+	stdout, stderr := s.RunMain(6, "gobco", "-verbose", dir)
+
+	s.CheckContains(stderr, "does not compile, even without instrumentation")
+	s.CheckNotContains(stderr, "probably a bug in gobco")
+	s.CheckContains(stdout, "[setup failed]")
+}
+
+func Test_buildFlags(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(
+		buildFlags([]string{"-run=Test", "-tags=a,b", "--mod=vendor", "-race", "-short", "-v"}),
+		[]string{"-tags=a,b", "--mod=vendor", "-race"})
+	s.CheckEquals(buildFlags(nil), []string(nil))
+}
+
+func Test_gobcoMain__emit(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-emit", "testdata/lenient/parse.go")
+
+	s.CheckEquals(stdout, ""+
+		"package lenient\n"+
+		"\n"+
+		"import (\n"+
+		"\t\"errors\"\n"+
+		"\t\"strconv\"\n"+
+		")\n"+
+		"\n"+
+		"func Parse(s string) (int, error) {\n"+
+		"\tn, err := strconv.Atoi(s)\n"+
+		"\tif GobcoCover(0, err != nil) {\n"+
+		"\t\treturn 0, err\n"+
+		"\t}\n"+
+		"\tif GobcoCover(1, n < 0) {\n"+
+		"\t\treturn 0, errors.New(\"negative\")\n"+
+		"\t}\n"+
+		"\treturn n, nil\n"+
+		"}\n")
+	s.CheckEquals(stderr, "")
+
+	// Test files are instrumented as well, as they are given explicitly.
+	stdout, stderr = s.RunMain(0, "gobco", "-emit", "testdata/lenient/parse_test.go")
+
+	s.CheckContains(stdout, "if n, err := Parse(\"5\"); GobcoCover(0, n != 5) || GobcoCover(1, err != nil) {\n")
+	s.CheckEquals(stderr, "")
+}
+
+// Test_gobcoMain__emit_comments ensures that the comments inside and next
+// to the instrumented conditions survive in the formatted file,
+// in particular the directives.
+func Test_gobcoMain__emit_comments(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-emit", "testdata/instrumenter/Comment.go")
+
+	s.CheckContains(stdout, "//go:build linux || !linux\n")
+	s.CheckContains(stdout, ""+
+		"//go:noinline\n"+
+		"func commentInCondition(a, b, c bool) bool {\n"+
+		"\tif GobcoCover(5, a) && // after a\n"+
+		"\t\tGobcoCover(6, b) || /* after b */\n"+
+		"\t\tGobcoCover(7, c) { // after c\n"+
+		"\t\treturn true\n"+
+		"\t}\n"+
+		"\n"+
+		"\t//go:generate echo \"a directive inside a function\"\n"+
+		"\treturn GobcoCover(8, a) ||\n"+
+		"\t\t// before b\n"+
+		"\t\tGobcoCover(9, b)\n"+
+		"}\n"+
+		"\n"+
+		"//go:embed Comment.go\n"+
+		"var commentGo string\n")
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobco_parseCommandLine__emit_arguments(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-emit", "testdata/lenient"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -emit requires a single Go file as argument\n")
+}
+
+func Test_gobcoMain__hide_test_stdout(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-hide-test-stdout", "-verbose", "testdata/lenient")
+
+	s.CheckNotContains(stdout, "=== RUN")
+	s.CheckNotContains(stdout, "ok  \t")
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/lenient/parse.go:10:5: condition \"err != nil\" was once false but never true",
+		"testdata/lenient/parse.go:13:5: condition \"n < 0\" was once false but never true",
+	})
+	s.CheckNotContains(stderr, "=== RUN")
+}
+
+// If the tests fail, their output is shown on stderr instead of stdout.
+func Test_gobcoMain__hide_test_stdout_failing(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(6, "gobco", "-hide-test-stdout", "testdata/failing")
+
+	s.CheckNotContains(stdout, "--- FAIL")
+	s.CheckContains(stderr, "--- FAIL: TestFoo")
+	s.CheckContains(stderr, "go test testdata/failing: exit status 1\n")
+	// The stats file is written nevertheless.
+	s.CheckContains(stdout, "Condition coverage: ")
+}
+
+func Test_gobco_parseCommandLine__hide_test_stdout_json(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco",
+				"-hide-test-stdout", "-json-test-output", "-output=report.txt"})
+		},
+		exited(2))
+
+	s.CheckEquals(s.Stderr(),
+		"error: -hide-test-stdout would discard the JSON events of -json-test-output\n")
+}
+
+func Test_gobcoMain__append_history(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+	head, err := runGit(".", "rev-parse", "HEAD")
+	s.CheckEquals(err, nil)
+
+	_, stderr := s.RunMain(0, "gobco", "-append-history", history, "testdata/lenient")
+	s.CheckEquals(stderr, "")
+	stdout, stderr := s.RunMain(0, "gobco", "-append-history", history, "-history-summary",
+		"-lenient-errors", "testdata/lenient")
+	s.CheckEquals(stderr, "")
+
+	s.CheckContains(stdout, "\n"+
+		"Coverage history: ▁█ 50.0% -> 75.0% (+25.0) over the last 2 runs\n")
+
+	records, err := loadHistory(history)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(len(records), 2)
+	s.CheckEquals(records[0].Commit, strings.TrimSpace(head))
+	s.CheckEquals(records[0].Covered, 2)
+	s.CheckEquals(records[0].Total, 4)
+	s.CheckEquals(records[0].Percent, 50.0)
+	s.CheckEquals(records[1].Covered, 3)
+	s.CheckEquals(records[1].Percent, 75.0)
+}
+
+func Test_gobco_parseCommandLine__history_summary(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-history-summary"}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), "error: -history-summary requires -append-history\n")
+}
+
+func Test_gobco_prepareTmp__stats_not_writable(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"file": ""})
+	stats := filepath.Join(dir, "file", "stats.json")
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-stats", stats, "testdata/lenient"})
+	defer g.cleanUp()
+	s.CheckPanics(g.prepareTmp, exited(1))
+
+	s.CheckEquals(s.Stderr(), "error: cannot write the stats file: "+
+		"mkdir "+filepath.Dir(stats)+": not a directory\n")
+}
+
+func Test_gobco_prepareTmp__stats_parent_dir(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	stats := filepath.Join(dir, "sub", "dir", "stats.json")
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-stats", stats, "testdata/lenient"})
+	g.prepareTmp()
+	defer g.cleanUp()
+
+	// The parent directory is created, but not the file itself,
+	// so that a missing file later means that the tests didn't write it.
+	_, err := os.Stat(filepath.Dir(stats))
+	s.CheckEquals(err, nil)
+	_, err = os.Stat(stats)
+	s.CheckEquals(os.IsNotExist(err), true)
+
+	// A directory cannot be written as a file.
+	s.CheckEquals(checkWritable(filepath.Dir(stats)) != nil, true)
+}
+
+// If the counters cannot be persisted, the instrumented tests say why
+// on stderr, which 'go test' passes on, and they fail.
+func Test_gobcoMain__persist_error(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(6, "gobco", "testdata/sinkfail")
+
+	s.CheckContains(stdout, "PASS\n"+
+		"gobco: cannot persist the coverage counters: "+
+		"the collector is unreachable\n")
+	s.CheckContains(stderr, "go test testdata/sinkfail: exit status 1\n")
+	s.CheckNotContains(stdout, "Condition coverage")
+}
+
+func Test_splitStart(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(start, filename string, line, col int, ok bool) {
+		actualFilename, actualLine, actualCol, actualOK := splitStart(start)
+		s.CheckEquals(actualFilename, filename)
+		s.CheckEquals(actualLine, line)
+		s.CheckEquals(actualCol, col)
+		s.CheckEquals(actualOK, ok)
+	}
+
+	test("main.go:17:13", "main.go", 17, 13, true)
+	test("dir/main.go:1:1", "dir/main.go", 1, 1, true)
+	test("C:\\src\\main.go:17:13", "C:\\src\\main.go", 17, 13, true)
+	test("C:main.go:17:13", "C:main.go", 17, 13, true)
+
+	test("main.go:17", "", 0, 0, false)
+	test("main.go:x:13", "", 0, 0, false)
+	test("main.go:17:x", "", 0, 0, false)
+	test("", "", 0, 0, false)
+}
+
+func Test_gobco_load(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"empty.json":   "",
+		"invalid.json": "[}",
+		"unknown.json": "[{\"Start\": \"a.go:1:1\", \"Unknown\": 1}]",
+		"valid.json":   "[]",
+		"windows.json": "[{\"Start\": \"C:\\\\src\\\\a.go:12:5\"}]",
+	})
+	g := s.newGobco()
+
+	_, err := g.load(filepath.Join(dir, "missing.json"))
+	s.CheckEquals(err.Error(), "error: the stats file "+filepath.Join(dir, "missing.json")+
+		" was never created: open "+filepath.Join(dir, "missing.json")+": no such file or directory")
+	s.CheckEquals(errors.Is(err, os.ErrNotExist), true)
+
+	_, err = g.load(filepath.Join(dir, "empty.json"))
+	s.CheckEquals(err.Error(), "error: the stats file "+filepath.Join(dir, "empty.json")+" is empty")
+
+	_, err = g.load(filepath.Join(dir, "invalid.json"))
+	s.CheckEquals(err.Error(), "error: the stats file "+filepath.Join(dir, "invalid.json")+
+		" is invalid: invalid character '}' looking for beginning of value")
+
+	// Fields from newer versions of gobco are ignored by default.
+	conds, err := g.load(filepath.Join(dir, "unknown.json"))
+	s.CheckEquals(conds, []condition{{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1}})
+	s.CheckEquals(err, nil)
+
+	// Stats files from older versions of gobco only have the Start,
+	// from which the file, line and column are derived.
+	conds, err = g.load(filepath.Join(dir, "windows.json"))
+	s.CheckEquals(conds, []condition{{
+		Start: "C:\\src\\a.go:12:5", File: "C:\\src\\a.go", Line: 12, Col: 5}})
+	s.CheckEquals(err, nil)
+
+	// The filename "-" means stdin.
+	stdin = strings.NewReader("[{\"Start\": \"a.go:2:3\"}]")
+	conds, err = g.load("-")
+	s.CheckEquals(conds, []condition{{Start: "a.go:2:3", File: "a.go", Line: 2, Col: 3}})
+	s.CheckEquals(err, nil)
+
+	_, err = g.load("-")
+	s.CheckEquals(err.Error(), "error: the stats file <stdin> is empty")
+
+	g.strictJSON = true
+	_, err = g.load(filepath.Join(dir, "unknown.json"))
+	s.CheckEquals(err.Error(), "error: the stats file "+filepath.Join(dir, "unknown.json")+
+		" is invalid: json: unknown field \"Unknown\"")
+
+	conds, err = g.load(filepath.Join(dir, "valid.json"))
+	s.CheckEquals(conds, []condition{})
+	s.CheckEquals(err, nil)
+}
+
+func Test_gobcoMain__ignore_build_tag(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/ignore")
 
-	s.CheckNotContains(stdout, "[build failed]")
-	s.CheckNotContains(stderr, "[build failed]")
 	s.CheckEquals(s.GobcoLines(stdout), []string{
-		"Condition coverage: 5/6",
-		"testdata/failing/fail.go:4:14: condition \"i < 10\" was 10 times true and once false",
-		"testdata/failing/fail.go:7:6: condition \"a < 1000\" was 5 times true and once false",
+		"Condition coverage: 1/2",
+		"testdata/ignore/lib.go:6:9: condition \"x < 10\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__append(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stats := filepath.Join(t.TempDir(), "stats.json")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-append", "-stats", stats,
+		"-test", "-run=TestPositive", "testdata/append")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/append/sign.go:4:5: condition \"x > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-append", "-stats", stats,
+		"-test", "-run=TestNegative", "testdata/append")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_mergeConditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	prev := []condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "a && b", TrueCount: 1, Func: "f"},
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "a", TrueCount: 1, Func: "f", Tests: []string{"TestB"}},
+		{Start: "a.go:2:1", File: "a.go", Line: 2, Col: 1, Code: "old", FalseCount: 1, Func: "f"},
+	}
+	conds := []condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "a", FalseCount: 3, Func: "f", Tests: []string{"TestC", "TestA", "TestB"}},
+		{Start: "a.go:3:1", File: "a.go", Line: 3, Col: 1, Code: "new", TrueCount: 2, Func: "g"},
+	}
+
+	s.CheckEquals(mergeConditions(prev, conds), []condition{
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "a && b", TrueCount: 1, Func: "f"},
+		{Start: "a.go:1:1", File: "a.go", Line: 1, Col: 1, Code: "a", TrueCount: 1, FalseCount: 3, Func: "f", Tests: []string{"TestA", "TestB", "TestC"}},
+		{Start: "a.go:2:1", File: "a.go", Line: 2, Col: 1, Code: "old", FalseCount: 1, Func: "f"},
+		{Start: "a.go:3:1", File: "a.go", Line: 3, Col: 1, Code: "new", TrueCount: 2, Func: "g"},
+	})
+	s.CheckEquals(prev[1].FalseCount, 0)
+	s.CheckEquals(prev[1].Tests, []string{"TestB"})
+}
+
+func Test_gobcoMain__show_diff(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	_, stderr := s.RunMain(0, "gobco", "-show-diff", "testdata/append")
+
+	s.CheckContains(stderr, "--- testdata/append/sign.go\n")
+	s.CheckContains(stderr, ""+
+		"@@ -1,7 +1,7 @@\n"+
+		" package sign\n"+
+		" \n"+
+		" func Sign(x int) int {\n"+
+		"-\tif x > 0 {\n"+
+		"+\tif GobcoCover(0, x > 0) {\n"+
+		" \t\treturn 1\n"+
+		" \t}\n"+
+		" \treturn -1\n")
+	s.CheckNotContains(stderr, "sign_test.go")
+}
+
+func Test_gobcoMain__gobcoignore(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/gobcoignore")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/gobcoignore/calc.go:4:5: condition \"x < 0\" was once true but never false",
+		"testdata/gobcoignore/keep_gen.go:6:9: condition \"x == 0\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__multi_line_condition(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/multiline")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/4",
+		"testdata/multiline/multiline.go:4:5: condition \"x >= lo\" was once true but never false",
+		"testdata/multiline/multiline.go:5:3: condition \"x <= hi\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+
+	stdout, stderr = s.RunMain(0, "gobco", "-branch", "testdata/multiline")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Branch coverage: 1/2",
+		"testdata/multiline/multiline.go:4:5: condition \"x >= lo && x <= hi\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
+
+func Test_gobcoMain__profile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	profile := filepath.Join(t.TempDir(), "cpu.out")
+
+	stdout, stderr := s.RunMain(0, "gobco", "-profile", "cpu="+profile, "testdata/append")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 2/2",
+	})
+	s.CheckEquals(stderr, "")
+	st, err := os.Stat(profile)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(st.Size() > 0, true)
+}
+
+func Test_gobcoMain__multiple_packages(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(6, "gobco",
+		"testdata/siblings/one/calc",
+		"testdata/siblings/two/calc",
+		"testdata/failing/fail.go")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 8/10",
+		"testdata/siblings/one/calc/calc.go:4:9: condition \"x > 0\" was once true but never false",
 		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
-		// testdata/failing/random.go is not listed here
-		// since that file is not mentioned in the command line.
 	})
+	s.CheckContains(stderr, "go test testdata/failing/fail.go: exit status 1")
 }
 
-func Test_gobcoMain__multiple_files(t *testing.T) {
+func Test_gobcoMain__parallel(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	// "go test" returns 1 because one of the tests fails.
-	stdout, stderr := s.RunMain(1, "gobco", "-list-all", "testdata/failing")
+	stdout, stderr := s.RunMain(6, "gobco", "-parallel", "3",
+		"testdata/siblings/one/calc",
+		"testdata/siblings/two/calc",
+		"testdata/failing/fail.go")
 
-	s.CheckNotContains(stdout, "[build failed]")
-	s.CheckNotContains(stderr, "[build failed]")
-	// Ensure that the files in the output are sorted.
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 8/10",
+		"testdata/siblings/one/calc/calc.go:4:9: condition \"x > 0\" was once true but never false",
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
+	})
+	s.CheckContains(stderr, "go test testdata/failing/fail.go: exit status 1")
+
+	// The output of the packages is not interleaved,
+	// and it comes in the order of the arguments.
+	one := strings.Index(stdout, "testdata/siblings/one/calc\t")
+	two := strings.Index(stdout, "testdata/siblings/two/calc\t")
+	failing := strings.Index(stdout, "--- FAIL: TestFoo")
+	s.CheckEquals(one >= 0 && one < two && two < failing, true)
+}
+
+func Test_gobco_parseCommandLine__parallel(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "."})
+	s.CheckEquals(g.parallel, runtime.NumCPU())
+
+	g = s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-parallel", "-1", "."}) },
+		exited(2))
+	s.CheckEquals(s.Stderr(), "error: -parallel must not be negative, not -1\n")
+}
+
+func Test_gobcoMain__same_package_twice(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, _ := s.RunMain(6, "gobco", "testdata/failing", "testdata/failing/fail.go")
+
+	// The single file is already covered by its package,
+	// so its conditions are not counted twice.
 	s.CheckEquals(s.GobcoLines(stdout), []string{
 		"Condition coverage: 5/8",
-		"testdata/failing/fail.go:4:14: condition \"i < 10\" was 10 times true and once false",
-		"testdata/failing/fail.go:7:6: condition \"a < 1000\" was 5 times true and once false",
 		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
 		"testdata/failing/random.go:8:9: condition \"x == 4\" was never evaluated",
 	})
 }
 
-func Test_gobcoMain__TestMain(t *testing.T) {
+func Test_gobcoMain__go_cover_compat(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "testdata/testmain")
+	stdout, _ := s.RunMain(6, "gobco", "-go-cover-compat", "testdata/failing")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 5/8",
+		"condition coverage: 62.5% of conditions",
+		"testdata/failing/fail.go:10:5: condition \"Bar(a) == 10\" was once false but never true",
+		"testdata/failing/random.go:8:9: condition \"x == 4\" was never evaluated",
+	})
+}
+
+func Test_gobcoMain__read_only_source(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeReadOnlyTree(t, dir, map[string]string{
+		"go.mod": "module example.com/readonly\n\ngo 1.16\n",
+		"sign.go": "" +
+			"package readonly\n" +
+			"\n" +
+			"func IsNegative(x int) bool {\n" +
+			"\treturn x < 0\n" +
+			"}\n",
+		"sign_test.go": "" +
+			"package readonly\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestIsNegative(t *testing.T) {\n" +
+			"\tif IsNegative(1) {\n" +
+			"\t\tt.Error(\"wrong\")\n" +
+			"\t}\n" +
+			"}\n",
+	})
+
+	stdout, stderr := s.RunMain(0, "gobco", "-path-style", "relative", dir)
 
-	s.CheckNotContains(stdout, "[build failed]")
 	s.CheckEquals(s.GobcoLines(stdout), []string{
 		"Condition coverage: 1/2",
-		"testdata/testmain/main.go:8:9: " +
-			"condition \"i > 0\" was once true but never false",
+		"sign.go:4:9: condition \"x < 0\" was once false but never true",
 	})
-	s.CheckContains(stdout, "begin original TestMain")
-	s.CheckContains(stdout, "end original TestMain")
-	_ = stderr
+	s.CheckEquals(stderr, "")
 }
 
-func Test_gobcoMain__TestMainTest(t *testing.T) {
+func Test_gobcoMain__debug_dump(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	stdout, stderr := s.RunMain(0, "gobco", "-verbose", "testdata/testmaintest")
+	filename := filepath.Join(t.TempDir(), "dump.json")
 
-	s.CheckContains(stdout, "Condition coverage: 1/2")
-	_ = stderr
+	_, stderr := s.RunMain(6, "gobco", "-debug-dump", filename, "testdata/failing")
+	s.CheckContains(stderr, "exit status 1")
+
+	content, err := os.ReadFile(filename)
+	s.CheckEquals(err, nil)
+	var dump debugDump
+	s.CheckEquals(json.Unmarshal(content, &dump), nil)
+
+	s.CheckEquals(dump.Version, version)
+	s.CheckEquals(len(dump.Args), 1)
+	s.CheckEquals(dump.Args[0].Arg, filepath.FromSlash("testdata/failing"))
+	s.CheckEquals(dump.TmpDir != "", true)
+	s.CheckEquals(dump.Instrumented, []string{
+		filepath.FromSlash("testdata/failing/fail.go"),
+		filepath.FromSlash("testdata/failing/random.go"),
+	})
+	s.CheckEquals(dump.Conditions[2], debugCond{
+		filepath.FromSlash("testdata/failing/fail.go") + ":10:5", "Bar(a) == 10", "Foo"})
+	s.CheckEquals(len(dump.GoTest), 1)
+	s.CheckEquals(dump.GoTest[0].Command, []string{"go", "test", "-test.count", "1", "."})
+	s.CheckEquals(dump.GoTest[0].ExitCode, 1)
+	s.CheckEquals(dump.ExitCode, 6)
+	s.CheckEquals(dump.Error, "")
 }
 
-func Test_gobcoMain__oddeven(t *testing.T) {
+func Test_gobcoMain__debug_dump_error(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	stdout, stderr := s.RunMain(0, "gobco", "testdata/oddeven")
+	filename := filepath.Join(t.TempDir(), "dump.json")
 
-	s.CheckContains(stdout, "Condition coverage: 0/2")
-	s.CheckContains(stdout, "odd.go:4:9: condition \"x%2 != 0\" was never evaluated")
-	// The condition in even_test.go is not instrumented since
-	// gobco was not run with the '-cover-test' option.
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco",
+				"-debug-dump", filename, "-template", "testdata/nonexistent"})
+		},
+		exited(2))
+
+	content, err := os.ReadFile(filename)
+	s.CheckEquals(err, nil)
+	var dump debugDump
+	s.CheckEquals(json.Unmarshal(content, &dump), nil)
+	s.CheckEquals(dump.ExitCode, 1)
+	s.CheckContains(dump.Error, "testdata/nonexistent")
+	s.CheckContains(s.Stderr(), "testdata/nonexistent")
+}
+
+func Test_gobcoMain__recover(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/recover")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 8/8",
+		"testdata/recover/recover.go:8:22: " +
+			"condition \"r != nil\" was once true and once false",
+		"testdata/recover/recover.go:18:14: " +
+			"condition \"recover() != nil\" was once true and once false",
+		"testdata/recover/recover.go:28:8: " +
+			"condition \"recover().(type) == nil\" was once true and 2 times false",
+		"testdata/recover/recover.go:30:8: " +
+			"condition \"recover().(type) == error\" was once true and once false",
+	})
 	s.CheckEquals(stderr, "")
 }
 
-func Test_gobcoMain__blackBox(t *testing.T) {
+// The deferred function assigns to the named result err.
+// The tests in the fixture check the wrapped error messages,
+// so they would fail if the instrumented code returned the unwrapped error.
+func Test_gobcoMain__deferred_error_wrapping(t *testing.T) {
 	s := NewSuite(t)
 	defer s.TearDownTest()
 
-	stdout, stderr := s.RunMain(0, "gobco", "-cover-test", "testdata/pkgname")
+	stdout, stderr := s.RunMain(0, "gobco", "-list-all", "testdata/deferwrap")
 
 	s.CheckEquals(s.GobcoLines(stdout), []string{
-		"Condition coverage: 4/8",
-		"testdata/pkgname/main.go:4:5: " +
-			"condition \"cond\" was once true but never false",
-		"testdata/pkgname/main.go:11:5: " +
-			"condition \"cond\" was once true but never false",
-		"testdata/pkgname/white_box_test.go:10:5: " +
-			"condition \"unexported(true) != 'U'\" " +
-			"was once false but never true",
-		"testdata/pkgname/black_box_test.go:12:5: " +
-			"condition \"pkgname.Exported(true) != 'E'\" " +
-			"was once false but never true",
+		"Condition coverage: 6/6",
+		"testdata/deferwrap/deferwrap.go:15:6: " +
+			"condition \"err != nil\" was 2 times true and once false",
+		"testdata/deferwrap/deferwrap.go:21:5: " +
+			"condition \"err == nil\" was 2 times true and once false",
+		"testdata/deferwrap/deferwrap.go:21:19: " +
+			"condition \"n < 0\" was once true and once false",
 	})
 	s.CheckEquals(stderr, "")
+
+	stdout, _ = s.RunMain(0, "gobco", "-branch", "testdata/deferwrap")
+	s.CheckContains(stdout, "Branch coverage: 4/4\n")
+}
+
+func Test_gobcoMain__interrupt(t *testing.T) {
+	if os.Getenv("GOBCO_TEST_INTERRUPT") != "" {
+		gobcoMain(os.Stdout, os.Stderr, "gobco", "-verbose", "testdata/sleep")
+		return
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("cannot send signals on Windows")
+	}
+
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_gobcoMain__interrupt$")
+	cmd.Env = append(os.Environ(), "GOBCO_TEST_INTERRUPT=1")
+	stderr, err := cmd.StderrPipe()
+	s.CheckEquals(err, nil)
+	s.CheckEquals(cmd.Start(), nil)
+
+	// Running "go test ..." in "/tmp/gobco-.../module-..."
+	instrDir := ""
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Running ") {
+			instrDir = line[strings.LastIndex(line[:len(line)-1], "\"")+1 : len(line)-1]
+			break
+		}
+	}
+	s.CheckEquals(cmd.Process.Signal(os.Interrupt), nil)
+	for scanner.Scan() {
+		continue
+	}
+
+	err = cmd.Wait()
+	exitErr, ok := err.(*exec.ExitError)
+	s.CheckEquals(ok, true)
+	if ok {
+		s.CheckEquals(exitErr.ExitCode(), 130)
+	}
+	s.CheckNotContains(instrDir, "\"")
+	_, err = os.Stat(instrDir)
+	s.CheckEquals(os.IsNotExist(err), true)
+}
+
+func Test_gobco_stopIfInterrupted(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "testdata/branch"})
+	g.prepareTmp()
+
+	// Without a signal, gobco continues.
+	g.stopIfInterrupted()
+	s.CheckEquals(g.exitCode, 0)
+
+	// The signal handler only records the signal,
+	// the cleanup happens on the main goroutine.
+	g.interrupt(os.Interrupt)
+	_, err := os.Stat(g.tmpdir)
+	s.CheckEquals(err, nil)
+
+	s.CheckPanics(
+		func() { g.stopIfInterrupted() },
+		exited(130))
+	s.CheckEquals(g.exitCode, 130)
+	_, err = os.Stat(g.tmpdir)
+	s.CheckEquals(os.IsNotExist(err), true)
 }
 
 func Test_gobcoMain__condition(t *testing.T) {
@@ -556,3 +4770,53 @@ func Test_gobcoMain__branch(t *testing.T) {
 	})
 	s.CheckEquals(stderr, "")
 }
+
+func Test_gobcoMain__fail_fast(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(3, "gobco", "-fail-fast", "./testdata/branch")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 0/12",
+		"testdata/branch/branch.go:6:5: " +
+			"condition \"x > 0\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+
+	// The other formats list all conditions but still fail.
+	stdout, _ = s.RunMain(3, "gobco", "-fail-fast", "-pretty", "./testdata/branch")
+	s.CheckContains(stdout, "TOTAL")
+	report := filepath.Join(t.TempDir(), "report.json")
+	s.RunMain(3, "gobco", "-fail-fast", "-format", "json", "-output", report, "./testdata/branch")
+	content, err := os.ReadFile(report)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "\"x > 0\"")
+}
+
+func Test_gobco_checkUnprintable(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	in := &instrumenter{unprintable: []unprintableFile{
+		{"p.go", errors.New("p.go:3:9: expected operand")},
+	}}
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.checkUnprintable(in) },
+		exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: cannot print the instrumented code of p.go: "+
+		"p.go:3:9: expected operand; "+
+		"this is a bug in gobco, please report it\n")
+
+	g = s.newGobco()
+	g.keepGoing = true
+	g.checkUnprintable(in)
+	s.CheckEquals(s.Stderr(), ""+
+		"gobco: cannot print the instrumented code of p.go: "+
+		"p.go:3:9: expected operand; "+
+		"this is a bug in gobco, please report it; "+
+		"leaving the file uninstrumented\n")
+}
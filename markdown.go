@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMarkdown writes the coverage as a Markdown document,
+// for bots that comment on pull requests.
+// The document starts with the total coverage,
+// followed by a collapsible table of the files
+// and the list of the conditions that are not fully covered,
+// or of all conditions if includeCovered is set.
+func writeMarkdown(w io.Writer, kind string, conds []condition, lenientErrors, includeCovered bool, displayFile func(filename string) string) error {
+	files := coverageByFile(conds, lenientErrors, "branches", displayFile)
+	allCovered, allTotal := 0, 0
+	for _, file := range files {
+		allCovered += file.covered
+		allTotal += file.total
+	}
+
+	var sb strings.Builder
+	out := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(&sb, format+"\n", args...)
+	}
+
+	out("## %s: %d/%d (%.1f%%)", kind, allCovered, allTotal,
+		coveragePercent(allCovered, allTotal))
+	out("")
+	out("<details>")
+	out("<summary>Coverage by file</summary>")
+	out("")
+	out("| File | Covered | Total | Percent |")
+	out("| --- | ---: | ---: | ---: |")
+	for _, file := range files {
+		out("| %s | %d | %d | %.1f%% |",
+			strings.Replace(file.filename, "|", "\\|", -1),
+			file.covered, file.total, coveragePercent(file.covered, file.total))
+	}
+	out("")
+	out("</details>")
+	out("")
+
+	if includeCovered {
+		out("### Conditions")
+	} else {
+		out("### Uncovered conditions")
+	}
+	out("")
+	listed := 0
+	for _, cond := range conds {
+		if !includeCovered && fullyCovered(cond, lenientErrors) {
+			continue
+		}
+		out("- %s: %s %s",
+			markdownCode(fmt.Sprintf("%s:%d", displayFile(cond.File), cond.Line)),
+			markdownCode(cond.Code), describeCondition(cond))
+		listed++
+	}
+	if listed == 0 && includeCovered {
+		out("There are no conditions.")
+	} else if listed == 0 {
+		out("All conditions are covered.")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// markdownCode formats the text as inline code.
+// The text is put on a single line, and if it contains backticks,
+// such as in raw strings, the surrounding backticks are longer.
+func markdownCode(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_writeMarkdown(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+		{Start: "b.go:7:2", File: "b.go", Line: 7, Col: 2, Code: "a &&\n\t\tb"},
+	}
+
+	var sb strings.Builder
+	err := writeMarkdown(&sb, "Condition coverage", conds, false, false,
+		func(filename string) string { return filename })
+
+	s.CheckEquals(err, nil)
+	s.CheckEquals(sb.String(), ""+
+		"## Condition coverage: 3/6 (50.0%)\n"+
+		"\n"+
+		"<details>\n"+
+		"<summary>Coverage by file</summary>\n"+
+		"\n"+
+		"| File | Covered | Total | Percent |\n"+
+		"| --- | ---: | ---: | ---: |\n"+
+		"| a.go | 3 | 4 | 75.0% |\n"+
+		"| b.go | 0 | 2 | 0.0% |\n"+
+		"\n"+
+		"</details>\n"+
+		"\n"+
+		"### Uncovered conditions\n"+
+		"\n"+
+		"- `a.go:4`: `y` was once true but never false\n"+
+		"- `b.go:7`: `a && b` was never evaluated\n")
+}
+
+func Test_writeMarkdown__includeCovered(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+	}
+	identity := func(filename string) string { return filename }
+
+	var sb strings.Builder
+	err := writeMarkdown(&sb, "Condition coverage", conds, false, true, identity)
+
+	s.CheckEquals(err, nil)
+	s.CheckContains(sb.String(), ""+
+		"### Conditions\n"+
+		"\n"+
+		"- `a.go:3`: `x > 0` was once true and once false\n"+
+		"- `a.go:4`: `y` was once true but never false\n")
+
+	sb.Reset()
+	err = writeMarkdown(&sb, "Condition coverage", nil, false, true, identity)
+
+	s.CheckEquals(err, nil)
+	s.CheckContains(sb.String(), ""+
+		"### Conditions\n"+
+		"\n"+
+		"There are no conditions.\n")
+}
+
+func Test_markdownCode(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(markdownCode("x > 0"), "`x > 0`")
+	s.CheckEquals(markdownCode("s == `a`"), "`` s == `a` ``")
+	s.CheckEquals(markdownCode("s == \"``\""), "```s == \"``\"```")
+}
+
+func Test_gobcoMain__format_markdown(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	output := filepath.Join(t.TempDir(), "coverage.md")
+	s.RunMain(0, "gobco", "-format", "markdown", "-output", output, "testdata/oddeven")
+
+	content, err := os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "## Condition coverage: 0/2 (0.0%)\n")
+	s.CheckContains(string(content), ""+
+		"- `testdata/oddeven/odd.go:4`: `x%2 != 0` was never evaluated\n")
+}
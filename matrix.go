@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// instrumentMatrix implements -matrix, which copies and instruments
+// the packages once for each tag set, as the build tags select
+// different files, and thus different conditions.
+// Afterwards, g.args contains the packages that could be instrumented
+// for at least one of the tag sets.
+func (g *gobco) instrumentMatrix() bool {
+	args := g.args
+	found := false
+	g.forEachTagSet(func(i int) {
+		g.args = args
+		g.copySources()
+		found = g.instrumentPackages() || found
+		g.matrixArgs = append(g.matrixArgs, g.args)
+	})
+
+	instrumented := map[string]bool{}
+	for _, setArgs := range g.matrixArgs {
+		for _, arg := range setArgs {
+			instrumented[arg.arg] = true
+		}
+	}
+	g.args = nil
+	for _, arg := range args {
+		if instrumented[arg.arg] {
+			g.args = append(g.args, arg)
+		}
+	}
+
+	// A package that fails for several tag sets is only reported once.
+	reported := map[string]bool{}
+	var failed []failedPackage
+	for _, f := range g.failed {
+		if !reported[f.arg] {
+			reported[f.arg] = true
+			failed = append(failed, f)
+		}
+	}
+	g.failed = failed
+
+	// The files that are excluded from the build are discovered
+	// for each tag set.
+	g.discovered = mergeConditions(nil, g.discovered)
+	return found
+}
+
+// runMatrix runs the tests once for each tag set of -matrix
+// and combines the counts into the stats file.
+// The conditions that are only built with some of the tag sets
+// are part of the result, so that the coverage refers to the union
+// of the conditions from all tag sets.
+func (g *gobco) runMatrix() {
+	args, statsFilename, goCoverFilename := g.args, g.statsFilename, g.goCoverFilename
+	var statsFilenames, profileFilenames []string
+	g.forEachTagSet(func(i int) {
+		g.args = g.matrixArgs[i]
+		g.statsFilename = g.file("gobco-counts.json")
+		statsFilenames = append(statsFilenames, g.statsFilename)
+		if goCoverFilename != "" {
+			g.goCoverFilename = g.file("gobco-cover.out")
+			profileFilenames = append(profileFilenames, g.goCoverFilename)
+		}
+		g.runPackageTests()
+	})
+	g.args, g.statsFilename, g.goCoverFilename = args, statsFilename, goCoverFilename
+
+	g.combineStats(statsFilenames)
+	if g.goCoverFilename != "" {
+		g.writeStatementProfile(profileFilenames)
+	}
+}
+
+// forEachTagSet runs the action once for each tag set of -matrix,
+// in a separate subdirectory of the temporary directory.
+// The tags of the set are added to those from the options for 'go test'.
+func (g *gobco) forEachTagSet(action func(i int)) {
+	goTestArgs := g.goTestArgs
+	defer func() { g.goTestArgs = goTestArgs }()
+
+	for i, set := range g.matrix {
+		tags := append(buildTags(goTestArgs), splitTags(set)...)
+		g.goTestArgs = append(append([]string(nil), goTestArgs...),
+			"-tags="+strings.Join(tags, ","))
+		g.infof("Running with the tags %q", strings.Join(tags, ","))
+
+		func() {
+			defer g.enterSubdir(fmt.Sprintf("matrix-%d", i))()
+			action(i)
+		}()
+	}
+}
+
+// splitTags splits a comma-separated list of build tags.
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// validTags returns whether the tags are a comma-separated list
+// of build tags. The empty list is valid, it runs the tests
+// without any tags other than those from the options for 'go test'.
+func validTags(tags string) bool {
+	for _, tag := range splitTags(tags) {
+		if tag == "" {
+			return false
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+				r == '.' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
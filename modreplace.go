@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resolveReplacements rewrites the replace directives in the copied
+// go.mod file whose directories are outside the copied tree,
+// so that they still refer to the original directories.
+// The relative directories are interpreted relative to moduleRoot,
+// the copied tree is that of root,
+// which is either the module root or the workspace directory.
+func resolveReplacements(goMod, moduleRoot, root string) error {
+	content, err := os.ReadFile(goMod)
+	if err != nil {
+		return err
+	}
+	absModuleRoot, err := filepath.Abs(moduleRoot)
+	if err != nil {
+		return err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	changed := false
+	for i, line := range lines {
+		code := line
+		if idx := strings.Index(code, "//"); idx >= 0 {
+			code = code[:idx]
+		}
+		arrow := strings.Index(code, "=>")
+		if arrow < 0 {
+			continue
+		}
+
+		// Only a target starting with "." or "/" is a directory,
+		// otherwise it is a module path.
+		target := strings.Fields(code[arrow+len("=>"):])
+		if len(target) != 1 {
+			continue
+		}
+		dir, err := strconv.Unquote(target[0])
+		if err != nil {
+			dir = target[0]
+		}
+		if !strings.HasPrefix(dir, ".") && !filepath.IsAbs(dir) {
+			continue
+		}
+
+		absDir := dir
+		if !filepath.IsAbs(dir) {
+			absDir = filepath.Join(absModuleRoot, filepath.FromSlash(dir))
+		}
+		if st, err := os.Stat(absDir); err != nil || !st.IsDir() {
+			return fmt.Errorf("error: the directive %q in %s "+
+				"refers to the directory %s, which does not exist",
+				strings.TrimSpace(code), filepath.Join(moduleRoot, "go.mod"), absDir)
+		}
+
+		rel, err := filepath.Rel(absRoot, absDir)
+		if filepath.IsAbs(dir) || err == nil && rel != ".." &&
+			!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		replacement := filepath.ToSlash(absDir)
+		if strings.ContainsAny(replacement, " \t\"'`") {
+			replacement = strconv.Quote(replacement)
+		}
+		rest := line[len(strings.TrimRight(code, " \t")):]
+		lines[i] = line[:arrow] + "=> " + replacement + rest
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return os.WriteFile(goMod, []byte(strings.Join(lines, "\n")), 0o666)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_resolveReplacements(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	s.CheckEquals(err, nil)
+	writeTree(t, dir, map[string]string{
+		"m/go.mod":        "module example.org/m\n",
+		"m/vendor/a/a.go": "package a\n",
+		"lib/lib.go":      "package lib\n",
+		"ws/other/x.go":   "package x\n",
+	})
+	moduleRoot := filepath.Join(dir, "m")
+
+	test := func(goMod, root, expected string) {
+		copied := filepath.Join(t.TempDir(), "go.mod")
+		s.CheckEquals(os.WriteFile(copied, []byte(goMod), 0o666), nil)
+
+		err := resolveReplacements(copied, moduleRoot, root)
+
+		if strings.HasPrefix(expected, "error: ") {
+			s.CheckEquals(strings.Replace(err.Error(), dir, "DIR", -1), expected)
+			return
+		}
+		s.CheckEquals(err, nil)
+		content, err := os.ReadFile(copied)
+		s.CheckEquals(err, nil)
+		s.CheckEquals(strings.Replace(string(content), filepath.ToSlash(dir), "DIR", -1), expected)
+	}
+
+	// Module paths and directories inside the copied tree stay the same.
+	test("replace example.org/a => example.org/b v1.0.0\n", moduleRoot,
+		"replace example.org/a => example.org/b v1.0.0\n")
+	test("replace example.org/a v1.0.0 => ./vendor/a\n", moduleRoot,
+		"replace example.org/a v1.0.0 => ./vendor/a\n")
+
+	// Directories outside the copied tree refer to the originals.
+	test("replace example.org/lib => ../lib\n", moduleRoot,
+		"replace example.org/lib => DIR/lib\n")
+	test("replace (\n\texample.org/lib => \"../lib\" // comment\n)\n", moduleRoot,
+		"replace (\n\texample.org/lib => DIR/lib // comment\n)\n")
+
+	// In a workspace, the whole workspace directory is copied.
+	test("replace example.org/lib => ../lib\n", dir,
+		"replace example.org/lib => ../lib\n")
+
+	test("replace example.org/gone => ../gone\n", moduleRoot,
+		"error: the directive \"replace example.org/gone => ../gone\" "+
+			"in "+filepath.Join("DIR", "m", "go.mod")+" refers to the directory "+
+			filepath.Join("DIR", "gone")+", which does not exist")
+}
+
+func Test_gobcoMain__replace(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/replace/app")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 1/2",
+		"testdata/replace/app/app.go:7:9: condition \"lib.Sign(x) > 0\" was once true but never false",
+	})
+	s.CheckEquals(stderr, "")
+}
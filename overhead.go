@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// warnOverhead implements -warn-overhead-pct, which runs the tests
+// of the original code once more, to estimate how much the instrumentation
+// slows them down, and warns about the packages where the slowdown
+// exceeds the bound.
+//
+// The estimate only uses the build flags from the options for 'go test',
+// as the other options may write output files, such as cover profiles.
+func (g *gobco) warnOverhead() {
+	if g.warnOverheadPct == 0 {
+		return
+	}
+
+	instrumented := map[string]time.Duration{}
+	for _, d := range g.durations {
+		instrumented[d.arg] = d.duration
+	}
+	for _, arg := range g.args {
+		duration, found := instrumented[arg.arg]
+		if !found {
+			continue
+		}
+		original, err := g.timeOriginalTests(arg)
+		if err != nil {
+			g.debugf("Cannot estimate the overhead for %s: %s", arg.arg, err)
+			continue
+		}
+		g.reportOverhead(arg.arg, duration, original)
+	}
+}
+
+// timeOriginalTests runs the tests of the uninstrumented package
+// and returns how long they took.
+func (g *gobco) timeOriginalTests(arg argInfo) (time.Duration, error) {
+	count := g.count
+	if count == 0 {
+		count = 1
+	}
+	args := []string{"test", "-test.count", strconv.Itoa(count)}
+	if g.runPattern != "" {
+		args = append(args, "-run", g.runPattern)
+	}
+	args = append(args, ".")
+	args = append(args, buildFlags(g.goTestArgs)...)
+	if len(g.testBinaryArgs) > 0 {
+		args = append(append(args, "-args"), g.testBinaryArgs...)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.Dir = arg.argDir
+	cmd.Env = append(os.Environ(), g.testEnv...)
+	g.debugf("Running %q in %q", "go "+strings.Join(args, " "), arg.argDir)
+
+	start := time.Now()
+	err := g.runCmd(cmd)
+	return time.Since(start), err
+}
+
+// reportOverhead warns if the instrumented tests took
+// more than -warn-overhead-pct percent longer than the original tests.
+func (g *gobco) reportOverhead(arg string, instrumented, original time.Duration) {
+	if original <= 0 {
+		return
+	}
+	pct := 100 * (instrumented - original).Seconds() / original.Seconds()
+	if pct <= g.warnOverheadPct {
+		return
+	}
+	g.warnf("gobco: testing %s took %s instrumented and %s uninstrumented, "+
+		"which is %.0f%% longer; consider listing its hot files in .gobcoignore",
+		arg, instrumented.Round(time.Millisecond), original.Round(time.Millisecond), pct)
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command the leader of a new process group,
+// so that it can be stopped together with the processes it starts,
+// such as the test binary that 'go test' runs.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends the signal to the command
+// and the processes it started.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	if sig, ok := sig.(syscall.Signal); ok {
+		return syscall.Kill(-cmd.Process.Pid, sig)
+	}
+	return cmd.Process.Signal(sig)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows,
+// where the process is killed instead.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the command,
+// as Windows does not support sending signals to other processes.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Kill()
+}
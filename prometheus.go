@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writePrometheus writes the coverage as metrics
+// in the Prometheus text exposition format,
+// for pushing them to a Pushgateway.
+// The totals are labeled by the kind of coverage,
+// the per-file metrics are grouped like in -by-file.
+func writePrometheus(w io.Writer, branch bool, conds []condition, lenientErrors bool, displayFile func(filename string) string) error {
+	kind := "condition"
+	if branch {
+		kind = "branch"
+	}
+
+	files := coverageByFile(conds, lenientErrors, "branches", displayFile)
+	allCovered, allTotal := 0, 0
+	for _, file := range files {
+		allCovered += file.covered
+		allTotal += file.total
+	}
+
+	var sb strings.Builder
+	out := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(&sb, format+"\n", args...)
+	}
+	gauge := func(name, help string) {
+		out("# HELP %s %s", name, help)
+		out("# TYPE %s gauge", name)
+	}
+
+	gauge("gobco_branch_covered", "The number of covered outcomes of the conditions.")
+	out("gobco_branch_covered{kind=%s} %d", prometheusLabel(kind), allCovered)
+	gauge("gobco_branch_total", "The number of outcomes of the conditions.")
+	out("gobco_branch_total{kind=%s} %d", prometheusLabel(kind), allTotal)
+
+	gauge("gobco_file_branch_covered", "The number of covered outcomes of the conditions in the file.")
+	for _, file := range files {
+		out("gobco_file_branch_covered{kind=%s,file=%s} %d",
+			prometheusLabel(kind), prometheusLabel(file.filename), file.covered)
+	}
+	gauge("gobco_file_branch_total", "The number of outcomes of the conditions in the file.")
+	for _, file := range files {
+		out("gobco_file_branch_total{kind=%s,file=%s} %d",
+			prometheusLabel(kind), prometheusLabel(file.filename), file.total)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// prometheusLabel quotes the label value,
+// escaping backslashes, double quotes and newlines.
+func prometheusLabel(value string) string {
+	r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	return "\"" + r.Replace(value) + "\""
+}
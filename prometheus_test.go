@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_writePrometheus(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	conds := []condition{
+		{Start: "a.go:3:5", File: "a.go", Line: 3, Col: 5, Code: "x > 0", TrueCount: 1, FalseCount: 1},
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "y", TrueCount: 1},
+		{Start: "b\"c.go:7:2", File: "b\"c.go", Line: 7, Col: 2, Code: "z"},
+	}
+
+	var sb strings.Builder
+	err := writePrometheus(&sb, true, conds, false,
+		func(filename string) string { return filename })
+
+	s.CheckEquals(err, nil)
+	s.CheckEquals(sb.String(), ""+
+		"# HELP gobco_branch_covered The number of covered outcomes of the conditions.\n"+
+		"# TYPE gobco_branch_covered gauge\n"+
+		"gobco_branch_covered{kind=\"branch\"} 3\n"+
+		"# HELP gobco_branch_total The number of outcomes of the conditions.\n"+
+		"# TYPE gobco_branch_total gauge\n"+
+		"gobco_branch_total{kind=\"branch\"} 6\n"+
+		"# HELP gobco_file_branch_covered The number of covered outcomes of the conditions in the file.\n"+
+		"# TYPE gobco_file_branch_covered gauge\n"+
+		"gobco_file_branch_covered{kind=\"branch\",file=\"a.go\"} 3\n"+
+		"gobco_file_branch_covered{kind=\"branch\",file=\"b\\\"c.go\"} 0\n"+
+		"# HELP gobco_file_branch_total The number of outcomes of the conditions in the file.\n"+
+		"# TYPE gobco_file_branch_total gauge\n"+
+		"gobco_file_branch_total{kind=\"branch\",file=\"a.go\"} 4\n"+
+		"gobco_file_branch_total{kind=\"branch\",file=\"b\\\"c.go\"} 2\n")
+}
+
+func Test_prometheusLabel(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(prometheusLabel("a.go"), `"a.go"`)
+	s.CheckEquals(prometheusLabel(`C:\src\"a".go`), `"C:\\src\\\"a\".go"`)
+	s.CheckEquals(prometheusLabel("a\nb"), `"a\nb"`)
+}
+
+func Test_gobcoMain__format_prometheus(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	output := filepath.Join(t.TempDir(), "coverage.prom")
+	s.RunMain(0, "gobco", "-format", "prometheus", "-output", output, "testdata/oddeven")
+
+	content, err := os.ReadFile(output)
+	s.CheckEquals(err, nil)
+	s.CheckContains(string(content), "gobco_branch_covered{kind=\"condition\"} 0\n")
+	s.CheckContains(string(content), "gobco_branch_total{kind=\"condition\"} 2\n")
+	s.CheckContains(string(content), ""+
+		"gobco_file_branch_total{kind=\"condition\",file=\"testdata/oddeven/odd.go\"} 2\n")
+}
+
+func Test_gobco_parseCommandLine__format_prometheus_without_output(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+	s.CheckPanics(
+		func() { g.parseCommandLine([]string{"gobco", "-format", "prometheus", "."}) },
+		exited(2))
+
+	s.CheckEquals(s.Stderr(), ""+
+		"error: -format prometheus requires -output, "+
+		"to keep the output of 'go test' out of the metrics\n")
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// builtinTemplates are the named templates for the '-template' option.
+var builtinTemplates = map[string]string{
+	"default": "{{.Start}}: condition {{printf \"%q\" .Code}} {{.Description}}",
+	"oneline": "{{.Start}}: {{.Code}} ({{.Percent}}%)",
+	"tsv":     "{{.Start}}\t{{.TrueCount}}\t{{.FalseCount}}\t{{.Code}}",
+}
+
+// conditionReport is the data that is passed to the report template.
+type conditionReport struct {
+	condition
+
+	// Whether the condition was both true and false,
+	// not counting the ignored outcomes.
+	Covered bool
+	// Which part of the outcomes was covered: 0, 50 or 100.
+	Percent int
+	// For example "was once true but never false".
+	Description string
+}
+
+func newConditionReport(cond condition, lenientErrors bool) conditionReport {
+	percent := 100
+	if counted := countedOutcomes(cond); counted > 0 {
+		percent = 100 * coveredOutcomes(cond, lenientErrors) / counted
+	}
+	return conditionReport{
+		cond,
+		percent == 100,
+		percent,
+		describeCondition(cond),
+	}
+}
+
+// coveredOutcomes returns how many of the counted outcomes
+// of the condition are covered. With lenientErrors, a comparison between
+// an error and nil counts as fully covered as soon as one of its outcomes
+// is covered, as the error path is often hard to reach in tests.
+func coveredOutcomes(cond condition, lenientErrors bool) int {
+	if lenientErrors && cond.ErrorCheck && cond.TrueCount+cond.FalseCount > 0 {
+		return countedOutcomes(cond)
+	}
+	n := 0
+	if cond.TrueCount > 0 && !cond.IgnoreTrue {
+		n++
+	}
+	if cond.FalseCount > 0 && !cond.IgnoreFalse {
+		n++
+	}
+	return n
+}
+
+// countedOutcomes returns how many of the 2 outcomes of the condition
+// count for the coverage, which excludes those from the
+// //gobco:ignore-true and //gobco:ignore-false directives.
+func countedOutcomes(cond condition) int {
+	n := 2
+	if cond.IgnoreTrue {
+		n--
+	}
+	if cond.IgnoreFalse {
+		n--
+	}
+	return n
+}
+
+// coveredUnits returns how many of the counted units of the condition
+// are covered. With -metric=branches, the units are its outcomes.
+// With -metric=conditions, the condition itself is the only unit,
+// and it is only covered if all of its counted outcomes are covered.
+func coveredUnits(cond condition, lenientErrors bool, metric string) int {
+	if metric != "conditions" {
+		return coveredOutcomes(cond, lenientErrors)
+	}
+	if countedOutcomes(cond) > 0 && fullyCovered(cond, lenientErrors) {
+		return 1
+	}
+	return 0
+}
+
+// countedUnits returns how many units of the condition
+// count for the coverage, see coveredUnits.
+func countedUnits(cond condition, metric string) int {
+	if metric != "conditions" {
+		return countedOutcomes(cond)
+	}
+	if countedOutcomes(cond) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// fullyCovered returns whether all counted outcomes
+// of the condition are covered.
+func fullyCovered(cond condition, lenientErrors bool) bool {
+	return coveredOutcomes(cond, lenientErrors) == countedOutcomes(cond)
+}
+
+// parseReportTemplate parses either one of the builtin templates
+// or the template from the given file.
+func parseReportTemplate(name string) (*template.Template, error) {
+	text, found := builtinTemplates[name]
+	if !found {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch references to undefined fields before running the tests.
+	err = tmpl.Execute(io.Discard, newConditionReport(condition{}, false))
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// builtinHTMLTemplates are the templates for the HTML reports,
+// by their filename in the -report-template-dir.
+// The pages include the styles via the "template" action.
+var builtinHTMLTemplates = map[string]string{
+	"report.html": htmlReportPage,
+	"report.css":  htmlReportStyle,
+	"diff.html":   htmlDiffPage,
+	"diff.css":    htmlDiffStyle,
+}
+
+// defaultHTMLTemplates are the HTML templates
+// when there is no -report-template-dir.
+var defaultHTMLTemplates = mustParseHTMLTemplates("")
+
+func mustParseHTMLTemplates(dir string) *htmltemplate.Template {
+	tmpl, err := parseHTMLTemplates(dir)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// parseHTMLTemplates parses all files from the directory as templates
+// for the HTML reports, each named after its filename,
+// and falls back to the built-in templates for the missing ones.
+// Besides overriding the built-in templates, the directory may contain
+// further templates that the others include.
+func parseHTMLTemplates(dir string) (*htmltemplate.Template, error) {
+	texts := map[string]string{}
+	for name, text := range builtinHTMLTemplates {
+		texts[name] = text
+	}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			texts[entry.Name()] = string(content)
+		}
+	}
+
+	names := make([]string, 0, len(texts))
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tmpl := htmltemplate.New("")
+	for _, name := range names {
+		if _, err := tmpl.New(name).Parse(texts[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Catch references to undefined fields before running the tests.
+	sample := condition{Start: "x.go:1:1", File: "x.go", Line: 1, Col: 1, Code: "x", TrueCount: 1, Func: "f", Depth: 1, ID: "id-x", EndLine: 1, EndCol: 2}
+	removed := sample
+	removed.ID = "id-removed"
+	err := writeHTML(io.Discard, tmpl, "", []condition{sample}, false)
+	if err == nil {
+		err = writeHTMLDiff(io.Discard, tmpl, "", []condition{sample, removed}, []condition{sample}, false,
+			func(string) []string { return []string{"x"} })
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+const htmlReportPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Kind}}</title>
+<style>
+{{template "report.css" .}}</style>
+</head>
+<body>
+<h1>{{.Kind}}: {{.Covered}}/{{.Total}}</h1>
+<table>
+<tr><th>Location</th><th>Condition</th><th>True</th><th>False</th></tr>
+{{range .Conds}}<tr class="{{if .Covered}}covered{{else if .Percent}}partial{{else}}uncovered{{end}}">
+<td>{{.Start}}</td><td><code>{{.Code}}</code></td><td class="count">{{.TrueCount}}</td><td class="count">{{.FalseCount}}</td>
+</tr>
+{{if .Source}}<tr class="source"><td colspan="4"><pre>{{range .Source}}{{printf "%5d" .Line}}  {{.Text}}
+{{end}}</pre></td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`
+
+const htmlReportStyle = `body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { padding: 0.2em 0.6em; text-align: left; }
+td.count { text-align: right; }
+tr.uncovered { background-color: #fdd; }
+tr.partial { background-color: #ffd; }
+tr.covered { background-color: #dfd; }
+code { white-space: pre; }
+tr.source pre { margin: 0 0 0.4em 0; }
+`
+
+// writeHTML writes the coverage report as a self-contained HTML page,
+// using the template "report.html".
+func writeHTML(w io.Writer, tmpl *htmltemplate.Template, kind string, conds []condition, lenientErrors bool) error {
+	data := struct {
+		Kind    string
+		Covered int
+		Total   int
+		Conds   []conditionReport
+	}{kind, 0, 0, nil}
+
+	for _, cond := range conds {
+		data.Covered += coveredOutcomes(cond, lenientErrors)
+		data.Total += countedOutcomes(cond)
+		data.Conds = append(data.Conds, newConditionReport(cond, lenientErrors))
+	}
+
+	return tmpl.ExecuteTemplate(w, "report.html", data)
+}
+
+// conditionDelta describes how the coverage of a condition changed
+// from an old run to a new run.
+type conditionDelta struct {
+	condition
+
+	// The number of covered outcomes in each run,
+	// out of the outcomes that count in the new run.
+	OldCovered int
+	NewCovered int
+	Outcomes   int
+	// Either "gained", "lost" or "same".
+	Status string
+	// Whether the condition does not exist in the old run.
+	Added bool
+}
+
+// compareConditions matches the conditions from the new run
+// with those from the old run, preferably by their ID,
+// falling back to their location and code for stats files without IDs.
+// The conditions that only exist in the old run are returned as removed.
+func compareConditions(old, cur []condition, lenientErrors bool) (deltas []conditionDelta, removed []condition) {
+	type key struct {
+		start string
+		code  string
+	}
+
+	byID := map[string]int{}
+	byKey := map[key]int{}
+	for i, cond := range old {
+		if cond.ID != "" {
+			byID[cond.ID] = i
+		}
+		byKey[key{cond.Start, cond.Code}] = i
+	}
+
+	matched := make([]bool, len(old))
+	for _, cond := range cur {
+		oldCovered := 0
+		added := true
+		i, found := byID[cond.ID]
+		if !found || cond.ID == "" {
+			i, found = byKey[key{cond.Start, cond.Code}]
+		}
+		if found && !matched[i] {
+			matched[i] = true
+			added = false
+			// Compare the old counts under the current directives.
+			prev := cond
+			prev.TrueCount, prev.FalseCount = old[i].TrueCount, old[i].FalseCount
+			oldCovered = coveredOutcomes(prev, lenientErrors)
+		}
+
+		newCovered := coveredOutcomes(cond, lenientErrors)
+		status := "same"
+		if newCovered > oldCovered {
+			status = "gained"
+		} else if newCovered < oldCovered {
+			status = "lost"
+		}
+		deltas = append(deltas, conditionDelta{
+			cond, oldCovered, newCovered, countedOutcomes(cond), status, added,
+		})
+	}
+
+	for i, cond := range old {
+		if !matched[i] {
+			removed = append(removed, cond)
+		}
+	}
+	return
+}
+
+const htmlDiffPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Kind}}</title>
+<style>
+{{template "diff.css" .}}</style>
+</head>
+<body>
+<h1>{{.Kind}}: {{.OldCovered}}/{{.OldTotal}} → {{.NewCovered}}/{{.NewTotal}}</h1>
+<p>{{.Gained}} gained, {{.Lost}} lost, {{len .Removed}} removed</p>
+{{range .Files}}<h2>{{.Name}}</h2>
+<table>
+{{range .Lines}}<tr{{if .Status}} class="{{.Status}}"{{end}}>
+<td class="line">{{.Number}}</td><td><code>{{range .Parts}}{{if .Status}}<span class="{{.Status}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}{{end}}</code>{{range .Conds}}
+<div class="cond"><code>{{.Code}}</code> {{.OldCovered}}/{{.Outcomes}} → {{.NewCovered}}/{{.Outcomes}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}{{if .Removed}}<h2>Removed conditions</h2>
+<table>
+{{range .Removed}}<tr class="same"><td>{{.Start}}</td><td><code>{{.Code}}</code></td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`
+
+const htmlDiffStyle = `body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td { padding: 0 0.6em; vertical-align: top; }
+td.line { text-align: right; color: #888; }
+tr.gained { background-color: #dfd; }
+tr.lost { background-color: #fdd; }
+tr.same { background-color: #eee; }
+div.cond { font-size: smaller; }
+span.gained { background-color: #9e9; text-decoration: underline; }
+span.lost { background-color: #e99; text-decoration: underline; }
+span.same { background-color: #ccc; text-decoration: underline; }
+code { white-space: pre; }
+`
+
+// htmlDiffLine is a line of source code in the HTML diff report,
+// together with the conditions that start in this line.
+type htmlDiffLine struct {
+	Number int
+	Text   string
+	// The same as Text, split at the boundaries of the conditions.
+	Parts  []htmlDiffPart
+	Status string // The most notable status of the conditions.
+	Conds  []conditionDelta
+}
+
+// htmlDiffPart is a piece of a line of source code in the HTML diff report.
+type htmlDiffPart struct {
+	Text string
+	// The status of the innermost condition that covers the text,
+	// or "" if the text doesn't belong to any condition.
+	Status string
+}
+
+// splitDiffLine splits the line of source code at the boundaries
+// of the conditions that start in this line, so that the report
+// can highlight the exact code of each condition,
+// even if the line contains several conditions.
+func splitDiffLine(text string, conds []conditionDelta) []htmlDiffPart {
+	type span struct {
+		from, to int
+		status   string
+	}
+	var spans []span
+	for _, delta := range conds {
+		if from, to, ok := conditionSpan(text, delta.condition); ok {
+			spans = append(spans, span{from, to, delta.Status})
+		}
+	}
+
+	// Outer conditions such as 'a && b' come before their operands,
+	// which then override the status of their part of the text.
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].from < spans[j].from ||
+			spans[i].from == spans[j].from && spans[i].to > spans[j].to
+	})
+	status := make([]string, len(text))
+	for _, sp := range spans {
+		for k := sp.from; k < sp.to; k++ {
+			status[k] = sp.status
+		}
+	}
+
+	var parts []htmlDiffPart
+	start := 0
+	for k := 1; k <= len(text); k++ {
+		if k == len(text) || status[k] != status[start] {
+			parts = append(parts, htmlDiffPart{text[start:k], status[start]})
+			start = k
+		}
+	}
+	return parts
+}
+
+// writeHTMLDiff writes an HTML page that shows the source code
+// of the files from the new run, highlighting the conditions
+// whose coverage changed since the old run,
+// using the template "diff.html".
+func writeHTMLDiff(
+	w io.Writer,
+	tmpl *htmltemplate.Template,
+	kind string,
+	old, cur []condition,
+	lenientErrors bool,
+	sourceLines func(filename string) []string,
+) error {
+	type file struct {
+		Name  string
+		Lines []htmlDiffLine
+	}
+	data := struct {
+		Kind       string
+		OldCovered int
+		OldTotal   int
+		NewCovered int
+		NewTotal   int
+		Gained     int
+		Lost       int
+		Files      []file
+		Removed    []condition
+	}{Kind: kind}
+
+	for _, cond := range old {
+		data.OldCovered += coveredOutcomes(cond, lenientErrors)
+		data.OldTotal += countedOutcomes(cond)
+	}
+
+	deltas, removed := compareConditions(old, cur, lenientErrors)
+	data.Removed = removed
+
+	// The conditions per file and line, in order of their first appearance.
+	var filenames []string
+	byLine := map[string]map[int][]conditionDelta{}
+	for _, delta := range deltas {
+		data.NewCovered += delta.NewCovered
+		data.NewTotal += delta.Outcomes
+		switch delta.Status {
+		case "gained":
+			data.Gained++
+		case "lost":
+			data.Lost++
+		}
+
+		filename, line := delta.File, delta.Line
+		if filename == "" {
+			continue
+		}
+		if byLine[filename] == nil {
+			byLine[filename] = map[int][]conditionDelta{}
+			filenames = append(filenames, filename)
+		}
+		byLine[filename][line] = append(byLine[filename][line], delta)
+	}
+
+	for _, filename := range filenames {
+		conds := byLine[filename]
+		texts := sourceLines(filename)
+
+		// Without the source code, at least show the conditions.
+		var numbers []int
+		for n := range texts {
+			numbers = append(numbers, n+1)
+		}
+		if texts == nil {
+			for n := range conds {
+				numbers = append(numbers, n)
+			}
+			sort.Ints(numbers)
+		}
+
+		f := file{Name: filename}
+		for _, n := range numbers {
+			line := htmlDiffLine{Number: n, Conds: conds[n]}
+			if n <= len(texts) {
+				line.Text = texts[n-1]
+				line.Parts = splitDiffLine(line.Text, line.Conds)
+			}
+			for _, delta := range line.Conds {
+				if line.Status != "lost" && delta.Status != "same" {
+					line.Status = delta.Status
+				} else if line.Status == "" {
+					line.Status = "same"
+				}
+			}
+			f.Lines = append(f.Lines, line)
+		}
+		data.Files = append(data.Files, f)
+	}
+
+	return tmpl.ExecuteTemplate(w, "diff.html", data)
+}
+
+// describeCondition describes how often a condition was true or false,
+// or that it is constant by design, which doesn't need any further tests.
+func describeCondition(cond condition) string {
+	if cond.Constant != "" {
+		return "is a constant condition (always " + cond.Constant + ")"
+	}
+	return describeCounts(cond.TrueCount, cond.FalseCount)
+}
+
+// describeCounts describes how often a condition was true or false.
+func describeCounts(trueCount, falseCount int) string {
+	switch {
+	case trueCount == 0 && falseCount == 0:
+		return "was never evaluated"
+	case trueCount == 0 && falseCount == 1:
+		return "was once false but never true"
+	case trueCount == 0:
+		return fmt.Sprintf("was %d times false but never true", falseCount)
+	case trueCount == 1 && falseCount == 0:
+		return "was once true but never false"
+	case trueCount == 1 && falseCount == 1:
+		return "was once true and once false"
+	case trueCount == 1:
+		return fmt.Sprintf("was once true and %d times false", falseCount)
+	case falseCount == 0:
+		return fmt.Sprintf("was %d times true but never false", trueCount)
+	case falseCount == 1:
+		return fmt.Sprintf("was %d times true and once false", trueCount)
+	default:
+		return fmt.Sprintf("was %d times true and %d times false",
+			trueCount, falseCount)
+	}
+}
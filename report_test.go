@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseReportTemplate(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(name string, cond condition, expected string) {
+		tmpl, err := parseReportTemplate(name)
+		s.CheckEquals(err, nil)
+		var sb strings.Builder
+		s.CheckEquals(tmpl.Execute(&sb, newConditionReport(cond, false)), nil)
+		s.CheckEquals(sb.String(), expected)
+	}
+
+	cond := condition{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "x > 0", TrueCount: 2}
+	test("default", cond, "main.go:3:4: condition \"x > 0\" was 2 times true but never false")
+	test("oneline", cond, "main.go:3:4: x > 0 (50%)")
+	test("tsv", cond, "main.go:3:4\t2\t0\tx > 0")
+
+	file := filepath.Join(t.TempDir(), "custom.tmpl")
+	s.CheckEquals(os.WriteFile(file, []byte("{{if not .Covered}}{{.Code}}{{end}}\n"), 0o666), nil)
+	test(file, cond, "x > 0\n")
+	test(file, condition{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "x > 0", TrueCount: 1, FalseCount: 1}, "\n")
+}
+
+func Test_parseReportTemplate__errors(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	syntax := filepath.Join(dir, "syntax.tmpl")
+	s.CheckEquals(os.WriteFile(syntax, []byte("{{.Start"), 0o666), nil)
+	field := filepath.Join(dir, "field.tmpl")
+	s.CheckEquals(os.WriteFile(field, []byte("{{.Unknown}}"), 0o666), nil)
+
+	for _, name := range []string{syntax, field, filepath.Join(dir, "missing")} {
+		tmpl, err := parseReportTemplate(name)
+		s.CheckEquals(tmpl == nil, true)
+		s.CheckEquals(err != nil, true)
+	}
+}
+
+func Test_writeHTML(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	var sb strings.Builder
+	err := writeHTML(&sb, defaultHTMLTemplates, "Condition coverage", []condition{
+		{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "x < 0"},
+		{Start: "main.go:4:4", File: "main.go", Line: 4, Col: 4, Code: "s == \"<b>\"", TrueCount: 1},
+		{Start: "main.go:5:4", File: "main.go", Line: 5, Col: 4, Code: "ok", TrueCount: 1, FalseCount: 1},
+	}, false)
+
+	s.CheckEquals(err, nil)
+	html := sb.String()
+	s.CheckContains(html, "<h1>Condition coverage: 3/6</h1>")
+	s.CheckContains(html, "<tr class=\"uncovered\">\n<td>main.go:3:4</td>")
+	s.CheckContains(html, "<tr class=\"partial\">\n<td>main.go:4:4</td>"+
+		"<td><code>s == &#34;&lt;b&gt;&#34;</code></td>")
+	s.CheckContains(html, "<tr class=\"covered\">\n<td>main.go:5:4</td>")
+}
+
+func Test_parseHTMLTemplates(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"report.css": "body { color: navy; }\n",
+		"report.html": "" +
+			"<style>{{template \"report.css\"}}</style>\n" +
+			"{{template \"header.html\" .}}\n" +
+			"{{range .Conds}}<p>{{.Start}} {{.Percent}}% {{.Description}}</p>\n{{end}}",
+		"header.html": "<h1>{{.Kind}}: {{.Covered}} of {{.Total}}</h1>",
+	})
+
+	tmpl, err := parseHTMLTemplates(dir)
+	s.CheckEquals(err, nil)
+
+	var sb strings.Builder
+	err = writeHTML(&sb, tmpl, "Condition coverage", []condition{
+		{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "x < 0", TrueCount: 1},
+	}, false)
+	s.CheckEquals(err, nil)
+	s.CheckEquals(sb.String(), ""+
+		"<style>body { color: navy; }\n</style>\n"+
+		"<h1>Condition coverage: 1 of 2</h1>\n"+
+		"<p>main.go:3:4 50% was once true but never false</p>\n")
+
+	// The diff report still uses the built-in templates.
+	sb.Reset()
+	err = writeHTMLDiff(&sb, tmpl, "Condition coverage", nil, nil, false,
+		func(string) []string { return nil })
+	s.CheckEquals(err, nil)
+	s.CheckContains(sb.String(), "<h1>Condition coverage: 0/0 → 0/0</h1>")
+	s.CheckContains(sb.String(), "tr.gained { background-color: #dfd; }")
+}
+
+func Test_parseHTMLTemplates__errors(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	syntax := t.TempDir()
+	writeTree(t, syntax, map[string]string{"report.html": "{{.Kind"})
+	field := t.TempDir()
+	writeTree(t, field, map[string]string{"diff.html": "{{range .Files}}{{.Unknown}}{{end}}"})
+
+	for _, dir := range []string{syntax, field, filepath.Join(field, "missing")} {
+		tmpl, err := parseHTMLTemplates(dir)
+		s.CheckEquals(tmpl == nil, true)
+		s.CheckEquals(err != nil, true)
+	}
+}
+
+func Test_gobco_parseCommandLine__report_template_dir(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	g := s.newGobco()
+
+	s.CheckPanics(
+		func() {
+			g.parseCommandLine([]string{"gobco", "-report-template-dir", "testdata/missing"})
+		},
+		exited(2))
+
+	s.CheckContains(s.Stderr(), "error: -report-template-dir: open testdata/missing: ")
+}
+
+func Test_coveredOutcomes(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(trueCount, falseCount int, errorCheck bool, strict, lenient int) {
+		cond := condition{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "err != nil", TrueCount: trueCount, FalseCount: falseCount, ErrorCheck: errorCheck}
+		s.CheckEquals(coveredOutcomes(cond, false), strict)
+		s.CheckEquals(coveredOutcomes(cond, true), lenient)
+	}
+
+	test(0, 0, false, 0, 0)
+	test(1, 0, false, 1, 1)
+	test(0, 1, false, 1, 1)
+	test(1, 1, false, 2, 2)
+	test(0, 0, true, 0, 0)
+	test(1, 0, true, 1, 2)
+	test(0, 1, true, 1, 2)
+	test(1, 1, true, 2, 2)
+}
+
+func Test_coveredOutcomes__ignored(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(trueCount, falseCount int, ignoreTrue, ignoreFalse bool, covered, counted, percent int) {
+		cond := condition{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "x > 0", TrueCount: trueCount, FalseCount: falseCount, IgnoreTrue: ignoreTrue, IgnoreFalse: ignoreFalse}
+		s.CheckEquals(coveredOutcomes(cond, false), covered)
+		s.CheckEquals(countedOutcomes(cond), counted)
+		s.CheckEquals(fullyCovered(cond, false), covered == counted)
+		s.CheckEquals(newConditionReport(cond, false).Percent, percent)
+	}
+
+	test(0, 0, false, false, 0, 2, 0)
+	test(1, 0, false, false, 1, 2, 50)
+	test(0, 0, true, false, 0, 1, 0)
+	test(1, 0, true, false, 0, 1, 0)
+	test(0, 1, true, false, 1, 1, 100)
+	test(1, 1, true, false, 1, 1, 100)
+	test(1, 0, false, true, 1, 1, 100)
+	test(1, 1, true, true, 0, 0, 100)
+}
+
+func Test_compareConditions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	old := []condition{
+		{Start: "a.go:3:4", File: "a.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", Func: "f", Depth: 1},
+		{Start: "a.go:6:4", File: "a.go", Line: 6, Col: 4, Code: "d", TrueCount: 1, Func: "f", Depth: 1, ID: "id-d"},
+	}
+	cur := []condition{
+		// Moved to another line, still matched by its ID.
+		{Start: "a.go:13:4", File: "a.go", Line: 13, Col: 4, Code: "a", TrueCount: 1, Func: "f", Depth: 1, ID: "id-a"},
+		{Start: "a.go:4:4", File: "a.go", Line: 4, Col: 4, Code: "b", TrueCount: 1, FalseCount: 1, Func: "f", Depth: 1, ID: "id-b"},
+		// Matched by its location and code.
+		{Start: "a.go:5:4", File: "a.go", Line: 5, Col: 4, Code: "c", Func: "f", Depth: 1},
+		{Start: "a.go:7:4", File: "a.go", Line: 7, Col: 4, Code: "e", TrueCount: 1, Func: "f", Depth: 1, ID: "id-e"},
+	}
+
+	deltas, removed := compareConditions(old, cur, false)
+
+	var actual []string
+	for _, delta := range deltas {
+		actual = append(actual, fmt.Sprintf("%s %d %d %s %v",
+			delta.Code, delta.OldCovered, delta.NewCovered, delta.Status, delta.Added))
+	}
+	s.CheckEquals(actual, []string{
+		"a 2 1 lost false",
+		"b 1 2 gained false",
+		"c 0 0 same false",
+		"e 0 1 gained true",
+	})
+	s.CheckEquals(removed, old[3:])
+}
+
+func Test_writeHTMLDiff(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	sources := map[string][]string{
+		"main.go": {"package main", "", "if a && b {", "}", "if c {", "}"},
+	}
+	old := []condition{
+		{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, ID: "id-a"},
+		{Start: "main.go:3:9", File: "main.go", Line: 3, Col: 9, Code: "b", TrueCount: 1, ID: "id-b"},
+		{Start: "main.go:5:4", File: "main.go", Line: 5, Col: 4, Code: "c", TrueCount: 1, FalseCount: 1, ID: "id-c"},
+		{Start: "gone.go:5:4", File: "gone.go", Line: 5, Col: 4, Code: "<gone>", TrueCount: 1, FalseCount: 1, ID: "id-gone"},
+	}
+	cur := []condition{
+		{Start: "main.go:3:4", File: "main.go", Line: 3, Col: 4, Code: "a", TrueCount: 1, FalseCount: 1, ID: "id-a"},
+		{Start: "main.go:3:9", File: "main.go", Line: 3, Col: 9, Code: "b", TrueCount: 1, FalseCount: 1, ID: "id-b"},
+		{Start: "main.go:5:4", File: "main.go", Line: 5, Col: 4, Code: "c", FalseCount: 1, ID: "id-c"},
+		{Start: "other.go:7:2", File: "other.go", Line: 7, Col: 2, Code: "d", ID: "id-d"},
+	}
+
+	var sb strings.Builder
+	err := writeHTMLDiff(&sb, defaultHTMLTemplates, "Condition coverage", old, cur, false,
+		func(filename string) []string { return sources[filename] })
+
+	s.CheckEquals(err, nil)
+	html := sb.String()
+	s.CheckContains(html, "<h1>Condition coverage: 7/8 → 5/8</h1>")
+	s.CheckContains(html, "<p>1 gained, 1 lost, 1 removed</p>")
+	s.CheckContains(html, "<tr>\n<td class=\"line\">2</td><td><code></code></td>\n</tr>")
+	s.CheckContains(html, "<tr class=\"gained\">\n<td class=\"line\">3</td>"+
+		"<td><code>if a &amp;&amp; b {</code>\n"+
+		"<div class=\"cond\"><code>a</code> 2/2 → 2/2</div>\n"+
+		"<div class=\"cond\"><code>b</code> 1/2 → 2/2</div></td>")
+	s.CheckContains(html, "<tr class=\"lost\">\n<td class=\"line\">5</td>")
+	// Without the source code, only the lines with conditions are shown.
+	s.CheckContains(html, "<h2>other.go</h2>\n<table>\n"+
+		"<tr class=\"same\">\n<td class=\"line\">7</td><td><code></code>\n"+
+		"<div class=\"cond\"><code>d</code> 0/2 → 0/2</div></td>\n</tr>\n</table>")
+	s.CheckContains(html, "<td>gone.go:5:4</td><td><code>&lt;gone&gt;</code></td>")
+}
+
+func Test_splitDiffLine(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	delta := func(col, endCol int, status string) conditionDelta {
+		cond := condition{Line: 3, Col: col, EndLine: 3, EndCol: endCol}
+		return conditionDelta{condition: cond, Status: status}
+	}
+	text := "if a > 0 && b {"
+
+	// The operands override the status of the whole condition.
+	parts := splitDiffLine(text, []conditionDelta{
+		delta(4, 9, "gained"),
+		delta(13, 14, "lost"),
+		delta(4, 14, "same"),
+	})
+
+	s.CheckEquals(parts, []htmlDiffPart{
+		{"if ", ""},
+		{"a > 0", "gained"},
+		{" && ", "same"},
+		{"b", "lost"},
+		{" {", ""},
+	})
+
+	// Without the end of the conditions, nothing is highlighted.
+	parts = splitDiffLine(text, []conditionDelta{{condition: condition{Line: 3, Col: 4}}})
+
+	s.CheckEquals(parts, []htmlDiffPart{{text, ""}})
+}
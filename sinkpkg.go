@@ -0,0 +1,113 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The instrumented code persists its counters through the package
+// gobcosink, in which the tests may install a custom sink.
+// Unless the code under test is from the gobco module itself,
+// the build environment gets a copy of that package,
+// since the code under test need not depend on gobco.
+//
+// In module mode, the copy is a stub module that contains only the
+// package gobcosink. If the code under test depends on the real module
+// github.com/moneyforward/gobco, the copied go.mod replaces it with the
+// stub as well, so importing any other package from gobco fails to build.
+
+// sinkModule is the module that provides the package gobcosink.
+const sinkModule = "github.com/moneyforward/gobco"
+
+//go:embed gobcosink/sink.go
+var sinkSource string
+
+// provideSink makes the package gobcosink available
+// to the instrumented code of the argument.
+func (g *gobco) provideSink(arg argInfo) {
+	if !arg.module {
+		dir := g.file(filepath.Join("gopath", "src", sinkModule, "gobcosink"))
+		g.check(writeSinkPackage(dir))
+		return
+	}
+
+	moduleName, err := getModuleName(arg.copySrc)
+	g.check(err)
+	if moduleName == sinkModule {
+		return
+	}
+
+	moduleDir, err := filepath.Abs(g.file("gobcosink-module"))
+	g.check(err)
+	g.check(writeSinkPackage(filepath.Join(moduleDir, "gobcosink")))
+	writeFile(filepath.Join(moduleDir, "go.mod"), "module "+sinkModule+"\n\ngo 1.16\n")
+	replacement := filepath.ToSlash(moduleDir)
+
+	// The copied go.mod file replaces any version of gobco
+	// that the code under test depends on,
+	// so that the package fits the instrumented code.
+	copyDst := g.file(arg.copyDst)
+	out, err := g.runGo(copyDst, []string{"mod", "edit",
+		"-require=" + sinkModule + "@v0.0.0",
+		"-replace=" + sinkModule + "=" + replacement,
+	}, os.Environ())
+	if err != nil {
+		g.check(fmt.Errorf("error: cannot add the module %s to %s: %s",
+			sinkModule, filepath.Join(arg.copySrc, "go.mod"), strings.TrimSpace(out)))
+	}
+
+	vendor := filepath.Join(copyDst, "vendor")
+	if _, err := os.Stat(filepath.Join(vendor, "modules.txt")); err == nil {
+		g.check(vendorSinkPackage(vendor, replacement))
+	}
+}
+
+// vendorSinkPackage adds the package gobcosink to the vendor directory,
+// as 'go mod vendor' would do,
+// since the go command only builds vendored packages
+// if the vendor directory exists.
+func vendorSinkPackage(vendor, replacement string) error {
+	if err := writeSinkPackage(filepath.Join(vendor, filepath.FromSlash(sinkModule), "gobcosink")); err != nil {
+		return err
+	}
+
+	modulesTxt := filepath.Join(vendor, "modules.txt")
+	content, err := os.ReadFile(modulesTxt)
+	if err != nil {
+		return err
+	}
+
+	// A vendored version of gobco is replaced.
+	var lines []string
+	skip := false
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			fields := strings.Fields(line)
+			skip = len(fields) >= 2 && fields[1] == sinkModule
+		}
+		if !skip && line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines = append(lines, "\n")
+	}
+
+	lines = append(lines,
+		"# "+sinkModule+" v0.0.0 => "+replacement+"\n",
+		"## explicit; go 1.16\n",
+		sinkModule+"/gobcosink\n",
+		"# "+sinkModule+" => "+replacement+"\n")
+	return os.WriteFile(modulesTxt, []byte(strings.Join(lines, "")), 0o666)
+}
+
+// writeSinkPackage writes the package gobcosink to the directory.
+func writeSinkPackage(dir string) error {
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "sink.go"), []byte(sinkSource), 0o666)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_gobcoMain__sink_outside_gobco(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod": "module example.com/x\n\ngo 1.16\n",
+		"x.go":   "package x\n\nfunc Pos(i int) bool { return i > 0 }\n",
+		"x_test.go": "package x\n\nimport \"testing\"\n\n" +
+			"func TestPos(t *testing.T) {\n\tif !Pos(1) {\n\t\tt.Fail()\n\t}\n}\n",
+	})
+
+	stdout, _ := s.RunMain(0, "gobco", dir)
+
+	s.CheckContains(stdout, "Condition coverage: 1/2")
+}
+
+func Test_gobcoMain__sink_vendor(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// Without GOFLAGS=-mod=mod, the go command uses the vendor directory.
+	setenv(t, "GOFLAGS", "")
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":             "module example.com/x\n\ngo 1.16\n",
+		"vendor/modules.txt": "",
+		"x.go":               "package x\n\nfunc Pos(i int) bool { return i > 0 }\n",
+		"x_test.go": "package x\n\nimport \"testing\"\n\n" +
+			"func TestPos(t *testing.T) {\n\tif !Pos(1) {\n\t\tt.Fail()\n\t}\n}\n",
+	})
+
+	stdout, _ := s.RunMain(0, "gobco", dir)
+
+	s.CheckContains(stdout, "Condition coverage: 1/2")
+}
+
+func Test_vendorSinkPackage(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	vendor := t.TempDir()
+	writeTree(t, vendor, map[string]string{
+		"modules.txt": "" +
+			"# example.com/a v1.0.0\n" +
+			"## explicit\n" +
+			"example.com/a\n" +
+			"# github.com/moneyforward/gobco v1.3.0\n" +
+			"## explicit; go 1.16\n" +
+			"github.com/moneyforward/gobco/gobcosink\n" +
+			"# example.com/b v1.0.0",
+	})
+
+	s.CheckEquals(vendorSinkPackage(vendor, "/tmp/sink"), nil)
+
+	content, err := os.ReadFile(filepath.Join(vendor, "modules.txt"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(content), ""+
+		"# example.com/a v1.0.0\n"+
+		"## explicit\n"+
+		"example.com/a\n"+
+		"# example.com/b v1.0.0\n"+
+		"# github.com/moneyforward/gobco v0.0.0 => /tmp/sink\n"+
+		"## explicit; go 1.16\n"+
+		"github.com/moneyforward/gobco/gobcosink\n"+
+		"# github.com/moneyforward/gobco => /tmp/sink\n")
+
+	source, err := os.ReadFile(filepath.Join(vendor, "github.com", "moneyforward", "gobco", "gobcosink", "sink.go"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(string(source), sinkSource)
+}
@@ -11,24 +11,87 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moneyforward/gobco/gobcosink"
 )
 
 type gobcoOptions struct {
-	immediately bool
-	listAll     bool
+	immediately    bool
+	listAll        bool
+	statsCompact   bool
+	strictJSON     bool
+	attributeTests bool
+	// If positive, the counters are persisted periodically
+	// while the tests run, see -flush-interval.
+	flushInterval time.Duration
 }
 
 type gobcoStats struct {
+	// Guards the counters, since the conditions may be evaluated
+	// by several goroutines at the same time.
+	mu    sync.Mutex
 	conds []gobcoCond
+	// Whether persisting the counters has failed,
+	// to report the error only once.
+	persistFailed bool
+	// Whether the counters from the stats file have been loaded,
+	// which happens when the tests start.
+	// Before that, package-level variables and init functions
+	// may already have evaluated some conditions.
+	loaded bool
+	// The names of the tests that are currently running,
+	// see GobcoEnterTest.
+	running []string
+	// Stops the periodic persisting of the counters, see flushPeriodically.
+	stopFlush chan struct{}
+	// Whether the counters have been persisted at the end of the tests,
+	// after which the periodic persisting must not overwrite them.
+	finished bool
 }
 
-type gobcoCond struct {
+// gobcoCond is an alias for an unnamed struct type,
+// so that the counters from different packages have identical types,
+// see gobcoDeps and gobcosink.Cond.
+type gobcoCond = struct {
 	Start      string
+	File       string
+	Line       int
+	Col        int
 	Code       string
 	TrueCount  int
 	FalseCount int
+	Func       string
+	Depth      int
+	ID         string
+	ErrorCheck bool
+	// The outcomes that are excluded from the coverage by the
+	// //gobco:ignore-true and //gobco:ignore-false directives.
+	IgnoreTrue  bool
+	IgnoreFalse bool
+	// Either "true" or "false" for a condition that is constant
+	// at compile time.
+	Constant string
+	// The tests that evaluated the condition, sorted by name,
+	// see -attribute-tests.
+	Tests []string `json:",omitempty"`
+	// Where the condition ends, exclusively.
+	EndLine int `json:",omitempty"`
+	EndCol  int `json:",omitempty"`
 }
 
+// gobcoDeps provides access to the counters of the instrumented
+// dependencies of the package under test, see the -cover-deps option.
+// The counters are stored in the same file as the counters of this package.
+//
+// Since the tests may still evaluate the conditions of the dependencies
+// while the counters are persisted, see -flush-interval, each dependency
+// only passes its counters to the callback while it holds its lock,
+// see GobcoConds.
+var gobcoDeps []func(f func(conds []gobcoCond))
+
 func (st *gobcoStats) filename() string {
 	filename := os.Getenv("GOBCO_STATS")
 	if filename == "" {
@@ -43,7 +106,13 @@ func (st *gobcoStats) check(err error) {
 	}
 }
 
+// load adds the counters from the stats file of an earlier run
+// to the counters of this run.
+// Since the stats file is sorted by location, see gobcoSorted,
+// the counters are matched by their location and code, not by index.
 func (st *gobcoStats) load(filename string) {
+	st.loaded = true
+
 	file, err := os.Open(filename)
 	if err != nil && os.IsNotExist(err) {
 		return
@@ -53,70 +122,226 @@ func (st *gobcoStats) load(filename string) {
 
 	var data []gobcoCond
 	decoder := json.NewDecoder(bufio.NewReader(file))
-	decoder.DisallowUnknownFields()
+	if gobcoOpts.strictJSON {
+		decoder.DisallowUnknownFields()
+	}
 	st.check(decoder.Decode(&data))
 
-	if len(st.conds) != len(data) {
+	if len(st.all()) != len(data) {
 		msg := fmt.Sprintf(
 			"gobco: stats file '%s' must have exactly %d coverage counters",
-			filename, len(st.conds))
+			filename, len(st.all()))
+		panic(msg)
+	}
+
+	byKey := make(map[gobcoKey]*gobcoCond, len(data))
+	for i := range data {
+		byKey[gobcoKey{data[i].Start, data[i].Code}] = &data[i]
+	}
+	ok := gobcoAddCounts(st.conds, byKey)
+	for _, dep := range gobcoDeps {
+		dep(func(conds []gobcoCond) {
+			ok = gobcoAddCounts(conds, byKey) && ok
+		})
+	}
+	if !ok {
+		msg := fmt.Sprintf(
+			"gobco: stats file '%s' doesn't match the instrumented conditions",
+			filename)
 		panic(msg)
 	}
-	st.conds = data
 }
 
-func (st *gobcoStats) merge(other *gobcoStats) {
-	type key struct {
-		start string
-		code  string
+// gobcoKey identifies a condition in the stats file.
+type gobcoKey struct {
+	start string
+	code  string
+}
+
+// gobcoAddCounts adds the counters from the stats file to the conditions
+// and returns whether each condition was found in the stats file.
+func gobcoAddCounts(conds []gobcoCond, data map[gobcoKey]*gobcoCond) bool {
+	ok := true
+	for i := range conds {
+		datum := data[gobcoKey{conds[i].Start, conds[i].Code}]
+		if datum == nil {
+			ok = false
+			continue
+		}
+		conds[i].TrueCount += datum.TrueCount
+		conds[i].FalseCount += datum.FalseCount
+		for _, test := range datum.Tests {
+			conds[i].Tests = gobcoAddTest(conds[i].Tests, test)
+		}
+	}
+	return ok
+}
+
+// all returns the counters of this package,
+// followed by a snapshot of those of the instrumented dependencies.
+func (st *gobcoStats) all() []gobcoCond {
+	conds := st.conds
+	for _, dep := range gobcoDeps {
+		dep(func(depConds []gobcoCond) {
+			conds = append(conds[:len(conds):len(conds)], depConds...)
+			for i := len(conds) - len(depConds); i < len(conds); i++ {
+				conds[i].Tests = append([]string(nil), conds[i].Tests...)
+			}
+		})
 	}
+	return conds
+}
 
-	m := make(map[key]*gobcoCond)
+func (st *gobcoStats) merge(other *gobcoStats) {
+	m := make(map[gobcoKey]*gobcoCond)
 	for i, cond := range st.conds {
-		m[key{cond.Start, cond.Code}] = &st.conds[i]
+		m[gobcoKey{cond.Start, cond.Code}] = &st.conds[i]
 	}
 
 	for i := range other.conds {
 		datum := &other.conds[i]
-		cond := m[key{datum.Start, datum.Code}]
+		cond := m[gobcoKey{datum.Start, datum.Code}]
 		datum.TrueCount += cond.TrueCount
 		datum.FalseCount += cond.FalseCount
+		for _, test := range cond.Tests {
+			datum.Tests = gobcoAddTest(datum.Tests, test)
+		}
 	}
 }
 
-func (st *gobcoStats) persist() {
-	// TODO: First write to a temporary file.
-	file, err := os.Create(st.filename())
-	st.check(err)
-
-	defer func() { st.check(file.Close()) }()
+// gobcoAddTest adds the test to the sorted list of tests,
+// so that the stats file doesn't depend on the order of the tests,
+// such as with 'go test -shuffle=on'.
+func gobcoAddTest(tests []string, test string) []string {
+	i := sort.SearchStrings(tests, test)
+	if i < len(tests) && tests[i] == test {
+		return tests
+	}
+	tests = append(tests, "")
+	copy(tests[i+1:], tests[i:])
+	tests[i] = test
+	return tests
+}
 
-	buf := bufio.NewWriter(file)
+// persist passes the counters to the sink, see gobcosink.Set,
+// and returns whether that worked.
+// Errors are reported on stderr, from where gobco passes them on,
+// instead of panicking, which would hide the results of the tests.
+func (st *gobcoStats) persist() bool {
+	def := gobcosink.FileSink{Filename: st.filename(), Compact: gobcoOpts.statsCompact}
+	err := gobcosink.Persist(gobcoSorted(st.all()), def)
+	if err != nil && !st.persistFailed {
+		_, _ = fmt.Fprintf(os.Stderr, "gobco: cannot persist the coverage counters: %s\n", err)
+		st.persistFailed = true
+	}
+	return err == nil
+}
 
-	encoder := json.NewEncoder(buf)
-	encoder.SetIndent("", "\t")
-	encoder.SetEscapeHTML(false)
-	st.check(encoder.Encode(st.conds))
-	st.check(buf.Flush())
+// gobcoSorted returns the conditions ordered by their location,
+// so that the stats file doesn't depend on the order in which
+// the files and the dependencies were instrumented.
+// The counters themselves stay in the order of their indexes.
+func gobcoSorted(conds []gobcoCond) []gobcoCond {
+	sorted := append([]gobcoCond(nil), conds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := &sorted[i], &sorted[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return sorted
 }
 
 func (st *gobcoStats) cover(idx int, cond bool) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
 	counts := &st.conds[idx]
 	if cond {
 		counts.TrueCount++
 	} else {
 		counts.FalseCount++
 	}
+	// Parallel tests cannot be told apart, so the condition
+	// is attributed to all tests that are currently running.
+	for _, test := range st.running {
+		counts.Tests = gobcoAddTest(counts.Tests, test)
+	}
 
-	if gobcoOpts.immediately {
+	// During package initialization, the stats file may still contain
+	// the counters of an earlier run, which must not be overwritten.
+	if gobcoOpts.immediately && st.loaded {
 		st.persist()
 	}
 
 	return cond
 }
 
+// start loads the counters of an earlier run.
+// It is called at the beginning of TestMain,
+// after the package and the instrumented dependencies are initialized.
+func (st *gobcoStats) start() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.loaded {
+		return
+	}
+	st.load(st.filename())
+	if gobcoOpts.immediately {
+		st.persist()
+	}
+	if gobcoOpts.flushInterval > 0 {
+		st.flushPeriodically()
+	}
+}
+
+// flushPeriodically persists the counters at the -flush-interval,
+// so that a crash of the tests loses at most the counts of one interval.
+// Since the counters always contain the counts of the whole run,
+// including those loaded at the start, persisting them several times
+// doesn't count anything twice.
+func (st *gobcoStats) flushPeriodically() {
+	stop := make(chan struct{})
+	st.stopFlush = stop
+	ticker := time.NewTicker(gobcoOpts.flushInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				st.mu.Lock()
+				if !st.finished {
+					st.persist()
+				}
+				st.mu.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
 func (st *gobcoStats) finish(exitCode int) int {
-	st.persist()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !st.loaded {
+		st.load(st.filename())
+	}
+	if st.stopFlush != nil {
+		close(st.stopFlush)
+		st.stopFlush = nil
+	}
+	st.finished = true
+	if !st.persist() && exitCode == 0 {
+		return 1
+	}
 	return exitCode
 }
 
@@ -126,7 +351,63 @@ func GobcoCover(idx int, cond bool) bool {
 	return gobcoCounts.cover(idx, cond)
 }
 
+// GobcoStart needs to be exported to black-box test packages.
+func GobcoStart() {
+	gobcoCounts.start()
+}
+
+// enterTest records that the test is running,
+// until the returned function is called.
+func (st *gobcoStats) enterTest(name string) func() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !gobcoOpts.attributeTests {
+		return func() {}
+	}
+	st.running = append(st.running, name)
+	return func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+
+		for i, test := range st.running {
+			if test == name {
+				st.running = append(st.running[:i], st.running[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// GobcoEnterTest is called at the beginning of each test function
+// if the -attribute-tests option is given.
+// It needs to be exported to black-box test packages.
+func GobcoEnterTest(name string) func() {
+	return gobcoCounts.enterTest(name)
+}
+
 // GobcoFinish needs to be exported to black-box test packages.
 func GobcoFinish(code int) int {
 	return gobcoCounts.finish(code)
 }
+
+// GobcoFinishReturn is deferred in TestMain, for the case that TestMain
+// returns instead of calling os.Exit, which is allowed since Go 1.15.
+// The testing package then exits with the exit code from m.Run,
+// unless the counters cannot be persisted.
+// It needs to be exported to black-box test packages.
+func GobcoFinishReturn() {
+	if gobcoCounts.finish(0) != 0 {
+		os.Exit(1)
+	}
+}
+
+// GobcoConds gives the package under test access to the counters
+// of this package, in case this package is one of its dependencies.
+// The counters must not be accessed after f returns.
+func GobcoConds(f func(conds []gobcoCond)) {
+	gobcoCounts.mu.Lock()
+	defer gobcoCounts.mu.Unlock()
+
+	f(gobcoCounts.conds)
+}
@@ -12,8 +12,7 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	gobcoCounts.load(gobcoCounts.filename())
+	gobcoCounts.start()
 	exitCode := m.Run()
-	gobcoCounts.persist()
-	os.Exit(exitCode)
+	os.Exit(gobcoCounts.finish(exitCode))
 }
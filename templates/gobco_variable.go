@@ -11,17 +11,29 @@
 package main
 
 var gobcoOpts = gobcoOptions{
-	immediately: true,
-	listAll:     true,
+	immediately:    true,
+	listAll:        true,
+	statsCompact:   false,
+	strictJSON:     false,
+	attributeTests: false,
+	flushInterval:  0,
 }
 
 var gobcoCounts = gobcoStats{
 	conds: []gobcoCond{
 		{
-			Start:      "code.go:5:2",
-			Code:       "i > 0",
-			TrueCount:  0,
-			FalseCount: 0,
+			Start:       "code.go:5:2",
+			Code:        "i > 0",
+			TrueCount:   0,
+			FalseCount:  0,
+			Func:        "f",
+			Depth:       1,
+			ID:          "0123456789abcdef",
+			ErrorCheck:  false,
+			IgnoreTrue:  false,
+			IgnoreFalse: false,
+			Constant:    "",
+			Tests:       nil,
 		},
 	},
 }
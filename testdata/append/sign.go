@@ -0,0 +1,8 @@
+package sign
+
+func Sign(x int) int {
+	if x > 0 {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,15 @@
+package sign
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if Sign(5) != 1 {
+		t.Error("wrong")
+	}
+}
+
+func TestNegative(t *testing.T) {
+	if Sign(-5) != -1 {
+		t.Error("wrong")
+	}
+}
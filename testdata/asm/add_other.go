@@ -0,0 +1,8 @@
+//go:build !amd64
+// +build !amd64
+
+package asm
+
+func Add(a, b int) int {
+	return a + b
+}
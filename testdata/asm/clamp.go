@@ -0,0 +1,9 @@
+package asm
+
+// Clamp increments x, but never goes below 1.
+func Clamp(x int) int {
+	if x < 0 {
+		return 1
+	}
+	return Add(x, 1)
+}
@@ -0,0 +1,9 @@
+package asm
+
+import "testing"
+
+func TestClamp(t *testing.T) {
+	if Clamp(3) != 4 {
+		t.Error("wrong")
+	}
+}
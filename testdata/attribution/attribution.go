@@ -0,0 +1,13 @@
+package attribution
+
+func Positive(x int) bool {
+	return x > 0
+}
+
+func Small(x int) bool {
+	return x < 10
+}
+
+func Zero(x int) bool {
+	return x == 0
+}
@@ -0,0 +1,25 @@
+package attribution
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(3) || !Small(3) {
+		t.Error("3 is positive and small")
+	}
+}
+
+func TestBoth(t *testing.T) {
+	t.Run("negative", func(t *testing.T) {
+		if Positive(-3) {
+			t.Error("-3 is not positive")
+		}
+	})
+	t.Run("positive", func(t *testing.T) {
+		if !Positive(5) {
+			t.Error("5 is positive")
+		}
+	})
+}
+
+func TestUnnamed(_ *testing.T) {
+}
@@ -0,0 +1,14 @@
+package blackbox
+
+// The directory name differs from the package name,
+// and it is not a valid identifier.
+
+func Sign(x int) int {
+	if x < 0 {
+		return -1
+	}
+	if x > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+package blackbox_test
+
+import (
+	"testing"
+
+	"github.com/moneyforward/gobco/testdata/black-box"
+)
+
+func TestSign(t *testing.T) {
+	for _, x := range []int{-5, 5} {
+		if blackbox.Sign(x) == 0 {
+			t.Errorf("Sign(%d) == 0", x)
+		}
+	}
+}
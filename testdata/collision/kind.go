@@ -0,0 +1,14 @@
+package collision
+
+// The instrumented code of a switch statement stores the tag
+// in a generated variable, whose name must not shadow this constant.
+const gobco0 = 5
+
+// Kind names the number.
+func Kind(x int) string {
+	switch x {
+	case gobco0:
+		return "five"
+	}
+	return "other"
+}
@@ -0,0 +1,9 @@
+package collision
+
+import "testing"
+
+func TestKind(t *testing.T) {
+	if Kind(5) != "five" || Kind(3) != "other" {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,25 @@
+package concurrent
+
+import "sync"
+
+// Count evaluates a condition n times in each of the goroutines.
+func Count(goroutines, n int) int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	evens := 0
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if i%2 == 0 {
+					mu.Lock()
+					evens++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return evens
+}
@@ -0,0 +1,9 @@
+package concurrent
+
+import "testing"
+
+func TestCount(t *testing.T) {
+	if evens := Count(8, 10000); evens != 40000 {
+		t.Error(evens)
+	}
+}
@@ -0,0 +1,13 @@
+package constant
+
+const verbose = false
+
+func Abs(x int) int {
+	if verbose {
+		println(x)
+	}
+	if x < 0 {
+		return -x
+	}
+	return x
+}
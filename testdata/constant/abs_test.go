@@ -0,0 +1,9 @@
+package constant
+
+import "testing"
+
+func TestAbs(t *testing.T) {
+	if Abs(-3) != 3 || Abs(3) != 3 {
+		t.Error()
+	}
+}
@@ -0,0 +1,7 @@
+package util
+
+// IsLarge is only reachable from the package under test
+// via package lib, as it is internal to that package.
+func IsLarge(x int) bool {
+	return x >= 1000
+}
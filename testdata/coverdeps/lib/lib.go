@@ -0,0 +1,10 @@
+package lib
+
+import "github.com/moneyforward/gobco/testdata/coverdeps/lib/internal/util"
+
+func Describe(x int) string {
+	if util.IsLarge(x) {
+		return "large"
+	}
+	return "small"
+}
@@ -0,0 +1,10 @@
+package coverdeps
+
+import "github.com/moneyforward/gobco/testdata/coverdeps/lib"
+
+func Classify(x int) string {
+	if x > 0 {
+		return lib.Describe(x)
+	}
+	return "non-positive"
+}
@@ -0,0 +1,9 @@
+package coverdeps
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	if Classify(5) != "small" {
+		t.Fail()
+	}
+}
@@ -0,0 +1,5 @@
+package crash
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,17 @@
+package crash
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCrash stops the test binary without letting gobco
+// persist the counters at the end of the tests.
+func TestCrash(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+	time.Sleep(500 * time.Millisecond)
+	go func() { panic("crash") }()
+	time.Sleep(time.Second)
+}
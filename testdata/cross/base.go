@@ -0,0 +1,11 @@
+package cross
+
+// Base returns the last element of the path.
+func Base(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if isSep(path[i]) {
+			return path[i+1:]
+		}
+	}
+	return path
+}
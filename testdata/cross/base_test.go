@@ -0,0 +1,9 @@
+package cross
+
+import "testing"
+
+func TestBase(t *testing.T) {
+	if Base("dir/file") != "file" {
+		t.Error("wrong")
+	}
+}
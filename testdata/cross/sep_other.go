@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package cross
+
+func isSep(c byte) bool {
+	return c == '/'
+}
@@ -0,0 +1,5 @@
+package cross
+
+func isSep(c byte) bool {
+	return c == '\\' || c == '/'
+}
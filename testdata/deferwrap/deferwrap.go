@@ -0,0 +1,25 @@
+package deferwrap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var errNegative = errors.New("negative")
+
+// Parse wraps its error in a deferred function,
+// which modifies the named result after the return statement.
+func Parse(s string) (n int, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("parse %q: %w", s, err)
+		}
+	}()
+
+	n, err = strconv.Atoi(s)
+	if err == nil && n < 0 {
+		return 0, errNegative
+	}
+	return n, err
+}
@@ -0,0 +1,25 @@
+package deferwrap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	if n, err := Parse("12"); n != 12 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+
+	_, err := Parse("-1")
+	if !errors.Is(err, errNegative) {
+		t.Errorf("got %v", err)
+	}
+	if err == nil || err.Error() != `parse "-1": negative` {
+		t.Errorf("the deferred function must wrap the error, got %v", err)
+	}
+
+	_, err = Parse("x")
+	if err == nil || err.Error() != `parse "x": strconv.Atoi: parsing "x": invalid syntax` {
+		t.Errorf("the deferred function must wrap the error, got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package directive
+
+func Sign(x int) int {
+	if x > 0 {
+		return 1
+	}
+	if x < 0 { //gobco:ignore-false
+		return -1
+	}
+	return 0
+}
+
+func Check(x int) {
+	//gobco:ignore-true
+	if x == 42 {
+		panic("42")
+	}
+}
+
+func Unused(x int) bool {
+	//gobco:ignore-false since x is always small
+	return x > 0 && x < 10
+}
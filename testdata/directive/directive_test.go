@@ -0,0 +1,10 @@
+package directive
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	if Sign(1) != 1 || Sign(-1) != -1 {
+		t.Error("wrong")
+	}
+	Check(1)
+}
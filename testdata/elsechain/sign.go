@@ -0,0 +1,12 @@
+package elsechain
+
+// Quadrant returns where the point is,
+// ignoring the points on the axes.
+func Quadrant(x, y int) string {
+	if x > 0 && y > 0 {
+		return "upper right"
+	} else if x < 0 || y < 0 {
+		return "elsewhere"
+	}
+	return "on an axis"
+}
@@ -0,0 +1,19 @@
+package elsechain
+
+import "testing"
+
+func TestQuadrant(t *testing.T) {
+	tests := []struct {
+		x, y int
+		want string
+	}{
+		{1, 1, "upper right"},
+		{-1, 1, "elsewhere"},
+		{1, -1, "elsewhere"},
+	}
+	for _, test := range tests {
+		if got := Quadrant(test.x, test.y); got != test.want {
+			t.Errorf("Quadrant(%d, %d) = %q, want %q", test.x, test.y, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package embed
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed greetings/hello.txt
+var hello string
+
+// Greet returns the greeting for the name.
+func Greet(name string) string {
+	if len(name) == 0 {
+		return strings.TrimSpace(hello)
+	}
+	return strings.TrimSpace(hello) + ", " + name
+}
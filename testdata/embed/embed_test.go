@@ -0,0 +1,20 @@
+package embed
+
+import (
+	"embed"
+	"testing"
+)
+
+//go:embed all:greetings
+var greetings embed.FS
+
+func TestGreet(t *testing.T) {
+	if Greet("world") != "Hello, world" {
+		t.Error(Greet("world"))
+	}
+
+	entries, err := greetings.ReadDir("greetings")
+	if err != nil || len(entries) != 2 {
+		t.Error(entries, err)
+	}
+}
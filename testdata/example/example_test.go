@@ -0,0 +1,20 @@
+package example_test
+
+import (
+	"fmt"
+
+	"github.com/moneyforward/gobco/testdata/example"
+)
+
+func ExampleAbs() {
+	for _, x := range []int{-3, 5} {
+		if x < 0 {
+			fmt.Println(example.Abs(x), "from a negative number")
+		} else {
+			fmt.Println(example.Abs(x))
+		}
+	}
+	// Output:
+	// 3 from a negative number
+	// 5
+}
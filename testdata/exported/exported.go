@@ -0,0 +1,35 @@
+package exported
+
+import "os"
+
+var verbose = len(os.Args) > 100
+
+func Positive(x int) bool {
+	return x > 0 && nonZero(x)
+}
+
+func nonZero(x int) bool {
+	return x != 0
+}
+
+func Filter(xs []int) []int {
+	var result []int
+	keep := func(x int) bool { return x > 0 }
+	for _, x := range xs {
+		if keep(x) && small(x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+func small(x int) bool {
+	below := func() bool { return x < 10 }
+	return below()
+}
+
+type Counter struct{ n int }
+
+func (c *Counter) Empty() bool { return c.n == 0 }
+
+func (c *Counter) full() bool { return c.n > 100 }
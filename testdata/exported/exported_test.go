@@ -0,0 +1,12 @@
+package exported
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(3) || Positive(-3) {
+		t.Error("wrong")
+	}
+	if len(Filter([]int{1, 20})) != 1 {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,10 @@
+package flushdeps
+
+import "github.com/moneyforward/gobco/testdata/flushdeps/lib"
+
+func Sign(x int) int {
+	if lib.Positive(x) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+package flushdeps
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSign keeps evaluating the condition of the dependency
+// while the counters are persisted periodically.
+func TestSign(t *testing.T) {
+	for end := time.Now().Add(100 * time.Millisecond); time.Now().Before(end); {
+		if Sign(1) != 1 || Sign(-1) != 0 {
+			t.Fatal("wrong")
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package lib
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,9 @@
+package calc
+
+import "testing"
+
+func TestAbs(t *testing.T) {
+	if Abs(-3) != 3 || Lookup(0) != "zero" || IsZero(1) {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,16 @@
+package guard
+
+// First returns the first element of a non-empty slice,
+// or the fallback.
+func First(valid bool, x []int, fallback *int) int {
+	if !valid {
+		return -1
+	}
+	if x == nil || len(x) == 0 {
+		if fallback != nil && *fallback > 0 {
+			return *fallback
+		}
+		return 0
+	}
+	return x[0]
+}
@@ -0,0 +1,26 @@
+package guard
+
+import "testing"
+
+func TestFirst(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		valid    bool
+		x        []int
+		fallback *int
+		want     int
+	}{
+		{false, []int{5}, nil, -1},
+		{true, nil, nil, 0},
+		{true, []int{}, &zero, 0},
+		{true, []int{}, &one, 1},
+		{true, []int{5}, nil, 5},
+		{true, []int{6, 7}, nil, 6},
+	}
+	for _, test := range tests {
+		if got := First(test.valid, test.x, test.fallback); got != test.want {
+			t.Errorf("First(%v, %v, %v) = %d, want %d",
+				test.valid, test.x, test.fallback, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build ignore
+// +build ignore
+
+// This file is not part of the package, it is only run manually.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		fmt.Println(os.Args[1])
+	}
+}
@@ -0,0 +1,7 @@
+package sample
+
+//go:generate go run gen.go
+
+func IsSmall(x int) bool {
+	return x < 10
+}
@@ -0,0 +1,9 @@
+package sample
+
+import "testing"
+
+func TestIsSmall(t *testing.T) {
+	if !IsSmall(5) {
+		t.Error("wrong")
+	}
+}
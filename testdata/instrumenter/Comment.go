@@ -50,5 +50,23 @@ func comment() {
 	// comment after switch
 }
 
+// commentInCondition covers the comments inside a condition that spans
+// several lines, as well as directives next to instrumented conditions.
+// All of them must survive the instrumentation.
+//
+//go:noinline
+func commentInCondition(a, b, c bool) bool {
+	if a && // after a
+		b || /* after b */
+		c { // after c
+		return true
+	}
+
+	//go:generate echo "a directive inside a function"
+	return a ||
+		// before b
+		b
+}
+
 //go:embed Comment.go
 var commentGo string
@@ -11,3 +11,25 @@ package instrumenter
 func deferStmt() {
 	defer func(args ...interface{}) {}(1, 1 > 0, !false)
 }
+
+// deferStmtNamedResult covers a deferred function that modifies a named
+// result. The instrumented condition must still refer to the named result,
+// so that the assignment affects the value returned by the outer function.
+func deferStmtNamedResult(fail bool) (err error) {
+	defer func() {
+		if err != nil {
+			err = wrapError(err)
+		}
+	}()
+
+	if fail {
+		return errorString("failed")
+	}
+	return nil
+}
+
+type errorString string
+
+func (e errorString) Error() string { return string(e) }
+
+func wrapError(err error) error { return errorString("wrapped: " + err.Error()) }
@@ -10,4 +10,10 @@ package instrumenter
 // Go statements are not instrumented themselves.
 func goStmt() {
 	go func(args ...interface{}) {}(1, 1 > 0, !false)
+
+	// The body of a goroutine is instrumented like any other code.
+	go func(i int) {
+		if i > 0 {
+		}
+	}(3)
 }
@@ -0,0 +1,28 @@
+package instrumenter
+
+// guardClause covers the instrumentation of guard clauses,
+// which are if statements that return early.
+//
+// The condition of a guard clause is instrumented like any other condition.
+// Each operand is counted exactly once per evaluation,
+// and an operand that is skipped by short-circuit evaluation
+// is not counted at all.
+func guardClause(valid bool, x []int, p *int) int {
+	if !valid {
+		return -1
+	}
+
+	if x == nil || len(x) == 0 {
+		return 0
+	}
+
+	if p != nil && *p > 0 {
+		return *p
+	}
+
+	if !(len(x) > 1 && x[0] < x[1]) {
+		return x[0]
+	}
+
+	return x[1]
+}
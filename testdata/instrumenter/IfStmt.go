@@ -63,3 +63,32 @@ func ifStmt(i int, s string, cond bool) string {
 
 	return "other"
 }
+
+// ifElseChain covers the chains of if statements.
+//
+// In condition coverage mode, the whole conditions of the chain are
+// instrumented in addition to their terminal conditions, unless they are
+// terminal conditions themselves. The true outcome of each whole condition
+// counts how often its branch was taken, and the false outcome of the last
+// condition counts how often the final else branch was taken, no matter
+// whether it is written explicitly.
+//
+// In branch coverage mode, the main conditions are instrumented anyway.
+func ifElseChain(a, b, c, d bool, i int) string {
+	s := ""
+	if a && b {
+		s = "first"
+	} else if c || !d {
+		s = "second"
+	} else {
+		s = "third"
+	}
+
+	if i > 0 {
+		i++
+	} else if !(a || i < 0) {
+		i--
+	}
+
+	return fmt.Sprint(s, i)
+}
@@ -0,0 +1,25 @@
+package instrumenter
+
+// lineDirective covers the instrumentation of code that contains
+// '//line' directives, as in the code from code generators.
+//
+// The conditions are recorded at their physical position in this file,
+// not at the position from the directive, since the report, the source
+// context and the changed lines all refer to the physical file.
+//
+// If a directive refers to a file other than Go code,
+// such as the grammar of a yacc parser, the code is considered
+// generated, and its conditions are not instrumented at all.
+func lineDirective(x int) bool {
+//line template.go:100
+	if x > 0 {
+		return x < 10
+	}
+
+//line grammar.y:20
+	if x < -10 {
+		return true
+	}
+
+	/*line template.go:200:5*/ return x == 0 //gobco:ignore-true
+}
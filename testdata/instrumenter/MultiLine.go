@@ -0,0 +1,34 @@
+package instrumenter
+
+// multiLine covers the instrumentation of conditions that span several
+// lines.
+//
+// The instrumented code keeps the line breaks from the original code,
+// while the text of the condition is printed on a single line.
+func multiLine(a, b, c int, s string) bool {
+	if a > 0 &&
+		b > 0 {
+		return true
+	}
+
+	for a < 10 ||
+		b < 10 {
+		a++
+		b++
+	}
+
+	switch {
+	case a > 0 &&
+		b > 0 &&
+		c > 0:
+		return false
+	}
+
+	ok := (a == 1 ||
+		b == 2) &&
+		s != ""
+
+	return ok ||
+		len(s) >
+			c
+}
@@ -0,0 +1,9 @@
+package helper
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	if Sign(-3) != -1 {
+		t.Error()
+	}
+}
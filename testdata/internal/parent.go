@@ -0,0 +1,7 @@
+package parent
+
+import "github.com/moneyforward/gobco/testdata/internal/internal/helper"
+
+func Positive(x int) bool {
+	return helper.Sign(x) > 0
+}
@@ -0,0 +1,9 @@
+package parent
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(5) {
+		t.Error()
+	}
+}
@@ -0,0 +1,9 @@
+package keepgoing
+
+// The name collides with the code that gobco adds to the package,
+// so gobco cannot instrument this package.
+var gobcoCounts = 0
+
+func Positive(x int) bool {
+	return x > gobcoCounts
+}
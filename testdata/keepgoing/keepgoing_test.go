@@ -0,0 +1,9 @@
+package keepgoing
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+}
@@ -0,0 +1,16 @@
+package kinds
+
+func Kinds(x interface{}, n int) bool {
+	if n > 0 {
+		n--
+	}
+	for i := 0; i < n; i++ {
+	}
+	switch n {
+	case 1:
+	}
+	switch x.(type) {
+	case int:
+	}
+	return n == 0
+}
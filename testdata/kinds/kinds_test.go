@@ -0,0 +1,7 @@
+package kinds
+
+import "testing"
+
+func TestKinds(t *testing.T) {
+	Kinds(1, 1)
+}
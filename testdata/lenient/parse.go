@@ -0,0 +1,17 @@
+package lenient
+
+import (
+	"errors"
+	"strconv"
+)
+
+func Parse(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("negative")
+	}
+	return n, nil
+}
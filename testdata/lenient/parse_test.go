@@ -0,0 +1,9 @@
+package lenient
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	if n, err := Parse("5"); n != 5 || err != nil {
+		t.Error(n, err)
+	}
+}
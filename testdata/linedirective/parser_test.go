@@ -0,0 +1,15 @@
+package linedirective
+
+import "testing"
+
+func TestAccept(t *testing.T) {
+	if !Accept(1) {
+		t.Error("1 is accepted")
+	}
+}
+
+func TestPositive(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build integration
+// +build integration
+
+package matrix
+
+func Big(x int) bool {
+	return x > 1000
+}
@@ -0,0 +1,18 @@
+//go:build integration
+// +build integration
+
+package matrix
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	if Sign(-1) != "other" {
+		t.Error("-1 is not positive")
+	}
+}
+
+func TestBig(t *testing.T) {
+	if !Big(5000) {
+		t.Error("5000 is big")
+	}
+}
@@ -0,0 +1,8 @@
+package matrix
+
+func Sign(x int) string {
+	if x > 0 {
+		return "positive"
+	}
+	return "other"
+}
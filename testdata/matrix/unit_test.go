@@ -0,0 +1,12 @@
+//go:build unit
+// +build unit
+
+package matrix
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	if Sign(1) != "positive" {
+		t.Error("1 is positive")
+	}
+}
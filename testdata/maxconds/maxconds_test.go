@@ -0,0 +1,9 @@
+package maxconds
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	if Lookup(2) != 20 || !Positive(Lookup(1)) {
+		t.Error("wrong")
+	}
+}
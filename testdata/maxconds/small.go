@@ -0,0 +1,5 @@
+package maxconds
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,9 @@
+package multiline
+
+func InRange(x, lo, hi int) bool {
+	if x >= lo &&
+		x <= hi {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+package multiline
+
+import "testing"
+
+func TestInRange(t *testing.T) {
+	if !InRange(5, 1, 10) {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,26 @@
+package pkginit
+
+import "os"
+
+// Package-level variables are initialized before any of the tests run,
+// and before TestMain loads the counters of an earlier run.
+const verboseEnv = "PKGINIT_VERBOSE"
+
+var verbose = len(os.Getenv(verboseEnv)) > 0 || len(os.Args) > 100
+
+var limit int
+
+func init() {
+	if verbose {
+		limit = 100
+	} else {
+		limit = 10
+	}
+}
+
+func Clamp(n int) int {
+	if n > limit {
+		return limit
+	}
+	return n
+}
@@ -0,0 +1,9 @@
+package pkginit
+
+import "testing"
+
+func TestClamp(t *testing.T) {
+	if Clamp(20) != 10 || Clamp(5) != 5 {
+		t.Error(Clamp(20), Clamp(5))
+	}
+}
@@ -0,0 +1,33 @@
+package rangechan
+
+// Sum adds the even numbers from the channel,
+// up to the first negative number.
+// The labeled break and continue refer to the range loop,
+// not to the switch statement.
+func Sum(ch <-chan int) int {
+	sum := 0
+loop:
+	for n := range ch {
+		switch {
+		case n < 0:
+			break loop
+		case n%2 == 1:
+			continue loop
+		}
+		sum += n
+	}
+	return sum
+}
+
+// Join joins the words with commas.
+func Join(words []string) string {
+	s := ""
+	for i, w := range words {
+		s += w
+		if i == len(words)-1 {
+			break
+		}
+		s += ","
+	}
+	return s
+}
@@ -0,0 +1,32 @@
+package rangechan
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	ch := make(chan int, 5)
+	for _, n := range []int{2, 3, 4, -1, 6} {
+		ch <- n
+	}
+	close(ch)
+
+	if sum := Sum(ch); sum != 6 {
+		t.Errorf("got %d, want 6", sum)
+	}
+	// The loop stopped at the negative number.
+	if rest := len(ch); rest != 1 {
+		t.Errorf("got %d remaining elements, want 1", rest)
+	}
+
+	// Without a negative number, the loop ends when the channel is closed.
+	ch = make(chan int)
+	close(ch)
+	if sum := Sum(ch); sum != 0 {
+		t.Errorf("got %d, want 0", sum)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if s := Join([]string{"a", "b", "c"}); s != "a,b,c" {
+		t.Errorf("got %q", s)
+	}
+}
@@ -0,0 +1,38 @@
+package recover
+
+import "fmt"
+
+// Div returns an error instead of panicking on a division by zero.
+func Div(a, b int) (q int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	return a / b, nil
+}
+
+// Try reports whether the action panicked.
+func Try(action func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	action()
+	return false
+}
+
+// Kind describes the value with which the action panicked.
+func Kind(action func()) (kind string) {
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+			kind = "none"
+		case error:
+			kind = "error " + r.Error()
+		default:
+			kind = fmt.Sprint(r)
+		}
+	}()
+	action()
+	return ""
+}
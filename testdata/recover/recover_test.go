@@ -0,0 +1,32 @@
+package recover
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDiv(t *testing.T) {
+	if q, err := Div(6, 3); q != 2 || err != nil {
+		t.Error(q, err)
+	}
+}
+
+func TestDiv_zero(t *testing.T) {
+	if _, err := Div(1, 0); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestTry(t *testing.T) {
+	if Try(func() {}) || !Try(func() { panic("boom") }) {
+		t.Error("wrong")
+	}
+}
+
+func TestKind(t *testing.T) {
+	if Kind(func() {}) != "none" ||
+		Kind(func() { panic(errors.New("e")) }) != "error e" ||
+		Kind(func() { panic(3) }) != "3" {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,8 @@
+package app
+
+import "example.com/replace/lib"
+
+// Positive imports a module that is replaced with a local directory.
+func Positive(x int) bool {
+	return lib.Sign(x) > 0
+}
@@ -0,0 +1,9 @@
+package app
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(3) {
+		t.Error()
+	}
+}
@@ -0,0 +1,7 @@
+module example.com/replace/app
+
+go 1.16
+
+require example.com/replace/lib v0.0.0
+
+replace example.com/replace/lib => ../lib
@@ -0,0 +1,3 @@
+module example.com/replace/lib
+
+go 1.16
@@ -0,0 +1,7 @@
+package samecond
+
+// Same contains identical conditions on a single line.
+// Each of them is counted on its own.
+func Same(a, b bool) bool {
+	return a && b || a && !b
+}
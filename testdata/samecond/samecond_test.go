@@ -0,0 +1,9 @@
+package samecond
+
+import "testing"
+
+func TestSame(t *testing.T) {
+	if !Same(true, true) || !Same(true, false) {
+		t.Fail()
+	}
+}
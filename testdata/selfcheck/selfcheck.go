@@ -0,0 +1,43 @@
+// Package selfcheck exercises each kind of condition that gobco
+// instruments, with inputs chosen so that each count is known exactly.
+package selfcheck
+
+// If is called with 1, 2, 3.
+func If(x int) int {
+	if x > 1 {
+		return 1
+	} else if x == 1 {
+		return 2
+	}
+	return 3
+}
+
+// For is called with 3.
+func For(n int) int {
+	sum := 0
+	for i := 0; i < n; i++ {
+		sum += i
+	}
+	return sum
+}
+
+// Switch is called with 1, 2, 3, 4.
+func Switch(x int) string {
+	switch x {
+	case 1, 2:
+		return "small"
+	case 3:
+		return "three"
+	}
+	return "other"
+}
+
+// And is called with (true, true), (true, false), (false, true).
+func And(a, b bool) bool {
+	return a && b
+}
+
+// Or is called with (false, false), (false, true), (true, false).
+func Or(a, b bool) bool {
+	return a || b
+}
@@ -0,0 +1,19 @@
+package selfcheck
+
+import "testing"
+
+func TestSelfCheck(t *testing.T) {
+	for _, x := range []int{1, 2, 3} {
+		If(x)
+	}
+	For(3)
+	for _, x := range []int{1, 2, 3, 4} {
+		Switch(x)
+	}
+	And(true, true)
+	And(true, false)
+	And(false, true)
+	Or(false, false)
+	Or(false, true)
+	Or(true, false)
+}
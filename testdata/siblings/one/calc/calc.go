@@ -0,0 +1,5 @@
+package calc
+
+func IsPositive(x int) bool {
+	return x > 0
+}
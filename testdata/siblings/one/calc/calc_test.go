@@ -0,0 +1,9 @@
+package calc
+
+import "testing"
+
+func TestIsPositive(t *testing.T) {
+	if !IsPositive(1) {
+		t.Error("wrong")
+	}
+}
@@ -0,0 +1,5 @@
+package calc
+
+func IsEven(x int) bool {
+	return x%2 == 0
+}
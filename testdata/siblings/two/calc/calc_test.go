@@ -0,0 +1,9 @@
+package calc
+
+import "testing"
+
+func TestIsEven(t *testing.T) {
+	if IsEven(1) || !IsEven(2) {
+		t.Error("wrong")
+	}
+}
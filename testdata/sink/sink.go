@@ -0,0 +1,8 @@
+package sink
+
+func IsPositive(x int) bool {
+	if x > 0 {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package sink_test
+
+import "github.com/moneyforward/gobco/gobcosink"
+
+// tenfold is a custom sink that multiplies the counts by 10
+// before passing them on to gobco, to show that it is used.
+type tenfold struct{}
+
+func (tenfold) Persist(conds []gobcosink.Cond) error {
+	scaled := make([]gobcosink.Cond, len(conds))
+	for i, cond := range conds {
+		cond.TrueCount *= 10
+		cond.FalseCount *= 10
+		scaled[i] = cond
+	}
+	return gobcosink.Default().Persist(scaled)
+}
+
+func init() {
+	gobcosink.Set(tenfold{})
+}
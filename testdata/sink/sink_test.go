@@ -0,0 +1,13 @@
+package sink_test
+
+import (
+	"testing"
+
+	"github.com/moneyforward/gobco/testdata/sink"
+)
+
+func TestIsPositive(t *testing.T) {
+	if !sink.IsPositive(1) {
+		t.Error("wrong")
+	}
+}
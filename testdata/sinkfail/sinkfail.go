@@ -0,0 +1,5 @@
+package sinkfail
+
+func IsPositive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,19 @@
+package sinkfail
+
+import (
+	"errors"
+
+	"github.com/moneyforward/gobco/gobcosink"
+)
+
+// failing is a sink that cannot persist the counters,
+// like the default sink when the stats file is not writable.
+type failing struct{}
+
+func (failing) Persist([]gobcosink.Cond) error {
+	return errors.New("the collector is unreachable")
+}
+
+func init() {
+	gobcosink.Set(failing{})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	verbose := len(os.Args) > 1 && os.Args[1] == "-v"
+	report := func(n int) {
+		if verbose {
+			fmt.Println(n)
+		}
+	}
+	report(count(os.Args[1:]))
+}
+
+func count(args []string) int {
+	n := 0
+	for _, arg := range args {
+		if len(arg) > 0 {
+			n++
+		}
+	}
+	return n
+}
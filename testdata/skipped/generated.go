@@ -0,0 +1,5 @@
+package skipped
+
+func Generated(x int) bool {
+	return x == 0
+}
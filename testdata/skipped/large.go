@@ -0,0 +1,11 @@
+package skipped
+
+func Sign(x int) int {
+	if x > 0 {
+		return 1
+	}
+	if x < 0 {
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+//go:build plan9
+
+package skipped
+
+func Plan9(x int) bool {
+	return x == 9
+}
@@ -0,0 +1,5 @@
+package skipped
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,9 @@
+//go:build ignore
+
+package main
+
+func main() {
+	if len("tool") > 0 {
+		println("tool")
+	}
+}
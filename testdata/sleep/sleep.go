@@ -0,0 +1,5 @@
+package sleep
+
+func IsLong(seconds int) bool {
+	return seconds > 10
+}
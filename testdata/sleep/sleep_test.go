@@ -0,0 +1,14 @@
+package sleep
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSleep takes long enough that gobco can be interrupted
+// while 'go test' is running.
+func TestSleep(t *testing.T) {
+	if IsLong(60) {
+		time.Sleep(60 * time.Second)
+	}
+}
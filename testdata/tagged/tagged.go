@@ -0,0 +1,8 @@
+//go:build integration
+// +build integration
+
+package tagged
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,12 @@
+//go:build integration
+// +build integration
+
+package tagged
+
+import "testing"
+
+func TestPositive(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+}
@@ -0,0 +1,5 @@
+package testmainexit
+
+func Positive(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,22 @@
+package testmainexit
+
+import (
+	goos "os"
+	"testing"
+)
+
+// TestMain doesn't call os.Exit itself but leaves that to a helper,
+// which imports the package os under a different name.
+func TestMain(m *testing.M) {
+	exit(m.Run())
+}
+
+func exit(code int) {
+	goos.Exit(code)
+}
+
+func TestPositive(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+}
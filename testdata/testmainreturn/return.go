@@ -0,0 +1,5 @@
+package testmainreturn
+
+func Positive(x int) bool {
+	return x > 0
+}
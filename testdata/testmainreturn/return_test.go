@@ -0,0 +1,15 @@
+package testmainreturn
+
+import "testing"
+
+// Since Go 1.15, TestMain need not call os.Exit.
+// When it returns, the testing package exits with the code from m.Run.
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestPositive(t *testing.T) {
+	if !Positive(1) {
+		t.Error("1 is positive")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build gobco_untested
+// +build gobco_untested
+
+package untested
+
+// Max is excluded from the build, therefore its conditions are never
+// evaluated.
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,10 @@
+package verify
+
+// Even declares a local variable that hides the function GobcoCover,
+// which gobco adds to the package.
+// Since gobco doesn't notice this, only the instrumented code
+// fails to compile.
+func Even(x int) bool {
+	GobcoCover := 2
+	return x%GobcoCover == 0
+}
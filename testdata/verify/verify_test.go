@@ -0,0 +1,9 @@
+package verify
+
+import "testing"
+
+func TestEven(t *testing.T) {
+	if !Even(2) {
+		t.Error()
+	}
+}
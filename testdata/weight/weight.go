@@ -0,0 +1,15 @@
+package weight
+
+func Classify(x int) string {
+	if x < 0 {
+		return "negative"
+	}
+	for i := 0; i < 3; i++ {
+		if x > i {
+			if x%2 == 0 {
+				return "even"
+			}
+		}
+	}
+	return "odd"
+}
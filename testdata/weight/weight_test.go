@@ -0,0 +1,9 @@
+package weight
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	if Classify(5) != "odd" {
+		t.Error("wrong")
+	}
+}
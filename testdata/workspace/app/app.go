@@ -0,0 +1,8 @@
+package app
+
+import "example.com/lib"
+
+// Larger imports the other module of the workspace.
+func Larger(a, b int) bool {
+	return lib.Max(a, b) == a && a != b
+}
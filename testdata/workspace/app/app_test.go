@@ -0,0 +1,9 @@
+package app
+
+import "testing"
+
+func TestLarger(t *testing.T) {
+	if !Larger(3, 2) {
+		t.Error()
+	}
+}
@@ -0,0 +1,9 @@
+package lib
+
+import "testing"
+
+func TestMax(t *testing.T) {
+	if Max(1, 2) != 2 {
+		t.Error()
+	}
+}
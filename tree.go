@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// coverageTree is the coverage of a directory or a file,
+// for printing the coverage along the directory structure.
+type coverageTree struct {
+	name     string
+	covered  int
+	total    int
+	children []*coverageTree // Only for directories.
+}
+
+// newCoverageTree sums up the coverage of the files
+// for each of their parent directories.
+// The root node has an empty name and contains
+// the topmost directories or files.
+func newCoverageTree(files []fileCoverage) *coverageTree {
+	root := &coverageTree{}
+	for _, file := range files {
+		node := root
+		node.covered += file.covered
+		node.total += file.total
+		for _, name := range strings.Split(path.Clean(filepath.ToSlash(file.filename)), "/") {
+			node = node.child(name)
+			node.covered += file.covered
+			node.total += file.total
+		}
+	}
+	root.compact()
+	root.sort()
+	return root
+}
+
+// child returns the child node of the given name, adding it if necessary.
+func (t *coverageTree) child(name string) *coverageTree {
+	for _, child := range t.children {
+		if child.name == name {
+			return child
+		}
+	}
+	child := &coverageTree{name: name}
+	t.children = append(t.children, child)
+	return child
+}
+
+// compact merges each directory that only contains a single directory
+// with that directory, so that "a/b/c.go" doesn't need three levels.
+func (t *coverageTree) compact() {
+	for _, child := range t.children {
+		for len(child.children) == 1 && len(child.children[0].children) > 0 {
+			grandchild := child.children[0]
+			child.name += "/" + grandchild.name
+			child.children = grandchild.children
+		}
+		child.compact()
+	}
+}
+
+func (t *coverageTree) sort() {
+	sort.Slice(t.children, func(i, j int) bool {
+		return t.children[i].name < t.children[j].name
+	})
+	for _, child := range t.children {
+		child.sort()
+	}
+}
+
+// label returns the name and the coverage of the node,
+// marking directories by a trailing slash.
+func (t *coverageTree) label() string {
+	name := t.name
+	if len(t.children) > 0 {
+		name += "/"
+	}
+	percent := 100
+	if t.total > 0 {
+		percent = 100 * t.covered / t.total
+	}
+	return fmt.Sprintf("%s %d/%d (%d%%)", name, t.covered, t.total, percent)
+}
+
+// lines returns the lines that show the children of the node,
+// each prefixed with the given indentation.
+func (t *coverageTree) lines(indent string) []string {
+	var lines []string
+	for i, child := range t.children {
+		branch, nested := "├── ", "│   "
+		if i == len(t.children)-1 {
+			branch, nested = "└── ", "    "
+		}
+		lines = append(lines, indent+branch+child.label())
+		lines = append(lines, child.lines(indent+nested)...)
+	}
+	return lines
+}
+
+// printTree prints the coverage of each directory and file,
+// indented along the directory structure.
+func (g *gobco) printTree(conds []condition) {
+	root := newCoverageTree(coverageByFile(conds, g.lenientErrors, g.metric, g.displayFile))
+	for _, top := range root.children {
+		g.outf("%s", top.label())
+		for _, line := range top.lines("") {
+			g.outf("%s", line)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// browser is the terminal UI of the -tui option.
+// It lists the uncovered conditions in the upper pane
+// and shows the source code around the selected condition
+// in the lower pane.
+type browser struct {
+	conds    []condition
+	location func(start string) string
+	source   func(filename string) []string
+
+	selected int
+	top      int // The first condition that is visible in the list.
+	width    int
+	height   int
+}
+
+// browserAction is what the browser does after a key has been pressed.
+type browserAction int
+
+const (
+	browseStay browserAction = iota
+	browseOpen
+	browseQuit
+)
+
+func (b *browser) listHeight() int {
+	h := (b.height - 2) / 2
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// handleKey moves the selection according to the key,
+// which is one of the names returned by readKey.
+func (b *browser) handleKey(key string) browserAction {
+	page := b.listHeight()
+	switch key {
+	case "up", "k":
+		b.selected--
+	case "down", "j":
+		b.selected++
+	case "pgup":
+		b.selected -= page
+	case "pgdn", " ":
+		b.selected += page
+	case "home", "g":
+		b.selected = 0
+	case "end", "G":
+		b.selected = len(b.conds) - 1
+	case "enter", "o", "e":
+		if len(b.conds) > 0 {
+			return browseOpen
+		}
+	case "q", "esc", "ctrl-c":
+		return browseQuit
+	}
+
+	if b.selected >= len(b.conds) {
+		b.selected = len(b.conds) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+	if b.selected < b.top {
+		b.top = b.selected
+	}
+	if b.selected >= b.top+page {
+		b.top = b.selected - page + 1
+	}
+	return browseStay
+}
+
+// lines returns the content of the screen, line by line.
+// The selected condition is shown in reverse video.
+func (b *browser) lines() []string {
+	var lines []string
+	add := func(line string, selected bool) {
+		line = b.fit(line)
+		if selected {
+			line = "\x1b[7m" + line + strings.Repeat(" ", b.width-len([]rune(line))) + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	add(fmt.Sprintf("gobco: %d uncovered conditions "+
+		"(up/down: move, enter: open in $EDITOR, q: quit)", len(b.conds)), false)
+
+	page := b.listHeight()
+	for n := b.top; n < b.top+page; n++ {
+		if n >= len(b.conds) {
+			add("", false)
+			continue
+		}
+		cond := b.conds[n]
+		add(fmt.Sprintf("%s: %s %s",
+			b.location(cond.Start), cond.Code, describeCondition(cond)), n == b.selected)
+	}
+
+	sourceHeight := b.height - 2 - page
+	if len(b.conds) == 0 {
+		add(strings.Repeat("-", b.width), false)
+		return lines
+	}
+
+	cond := b.conds[b.selected]
+	header := "-- " + b.location(cond.Start) + " "
+	if rest := b.width - len([]rune(header)); rest > 0 {
+		header += strings.Repeat("-", rest)
+	}
+	add(header, false)
+
+	filename, line := cond.File, cond.Line
+	if filename == "" {
+		return lines
+	}
+	source := b.source(filename)
+	from := line - sourceHeight/2
+	if from < 1 {
+		from = 1
+	}
+	for n := from; n < from+sourceHeight && n <= len(source); n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		text := strings.Replace(source[n-1], "\t", "    ", -1)
+		add(fmt.Sprintf("%s %5d  %s", marker, n, text), false)
+	}
+	return lines
+}
+
+// fit cuts the line to the width of the screen.
+func (b *browser) fit(line string) string {
+	runes := []rune(line)
+	if len(runes) > b.width {
+		return string(runes[:b.width])
+	}
+	return line
+}
+
+func (b *browser) render(w io.Writer) error {
+	// Move to the top left corner and clear the screen.
+	_, err := io.WriteString(w, "\x1b[H\x1b[2J"+strings.Join(b.lines(), "\r\n"))
+	return err
+}
+
+// readKey reads a single key press from a terminal in raw mode.
+// Printable characters are returned as they are,
+// the other keys by their names, such as "up" or "enter".
+func readKey(r *bufio.Reader) (string, error) {
+	ch, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch ch {
+	case '\r', '\n':
+		return "enter", nil
+	case 3:
+		return "ctrl-c", nil
+	case 0x1b:
+	default:
+		return string(ch), nil
+	}
+
+	// A lone escape is not followed by the rest of a sequence.
+	if r.Buffered() == 0 {
+		return "esc", nil
+	}
+	if next, _ := r.Peek(1); next[0] != '[' && next[0] != 'O' {
+		return "esc", nil
+	}
+	_, _ = r.ReadByte()
+
+	var seq []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+	switch string(seq) {
+	case "A":
+		return "up", nil
+	case "B":
+		return "down", nil
+	case "H", "1~":
+		return "home", nil
+	case "F", "4~":
+		return "end", nil
+	case "5~":
+		return "pgup", nil
+	case "6~":
+		return "pgdn", nil
+	}
+	return "", nil
+}
+
+// browse runs the terminal UI for the uncovered conditions
+// and returns whether that worked.
+// If stdin or stdout is not a terminal,
+// the caller prints the plain report instead.
+func (g *gobco) browse(conds []condition) bool {
+	if !isTerminal(os.Stdin) || !isTerminal(g.stdout) {
+		return false
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		g.debugf("%s", err)
+		return false
+	}
+
+	var listed []condition
+	for _, cond := range g.weighted(conds) {
+		if g.isReported(cond) {
+			listed = append(listed, cond)
+		}
+	}
+	b := browser{conds: listed, location: g.location, source: g.sourceLines}
+
+	enter := func() {
+		_, _ = stty("raw", "-echo")
+		b.height, b.width = terminalSize()
+		// Switch to the alternate screen and hide the cursor.
+		_, _ = io.WriteString(g.stdout, "\x1b[?1049h\x1b[?25l")
+	}
+	leave := func() {
+		_, _ = io.WriteString(g.stdout, "\x1b[?25h\x1b[?1049l")
+		_, _ = stty(saved)
+	}
+
+	enter()
+	defer leave()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		g.check(b.render(g.stdout))
+		key, err := readKey(in)
+		if err != nil {
+			return true
+		}
+		switch b.handleKey(key) {
+		case browseOpen:
+			leave()
+			g.openInEditor(b.conds[b.selected].Start)
+			enter()
+		case browseQuit:
+			return true
+		}
+	}
+}
+
+// openInEditor opens the file at the start of the condition
+// in $VISUAL or $EDITOR, and waits until the editor is closed.
+func (g *gobco) openInEditor(start string) {
+	filename, line, ok := parseStart(start)
+	if !ok {
+		return
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args, err := splitOptions(editor)
+	if err != nil || len(args) == 0 {
+		g.warnf("gobco: cannot open the editor %q", editor)
+		return
+	}
+
+	// Most editors accept "+line" to jump to the line.
+	args = append(args, "+"+strconv.Itoa(line), filename)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = g.stdout
+	cmd.Stderr = g.stderr
+	if err := cmd.Run(); err != nil {
+		g.warnf("gobco: the editor failed: %s", err)
+	}
+}
+
+// stty runs the stty command on the terminal from stdin.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the number of rows and columns of the terminal,
+// defaulting to 24x80.
+func terminalSize() (rows, cols int) {
+	rows, cols = 24, 80
+	out, err := stty("size")
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 2 {
+		if r, err := strconv.Atoi(fields[0]); err == nil && r > 2 {
+			rows = r
+		}
+		if c, err := strconv.Atoi(fields[1]); err == nil && c > 0 {
+			cols = c
+		}
+	}
+	return
+}
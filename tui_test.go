@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func newTestBrowser(conds []condition) *browser {
+	source := []string{
+		"package main",
+		"",
+		"func f(x int) bool {",
+		"\treturn x > 0",
+		"}",
+	}
+	return &browser{
+		conds:    conds,
+		location: func(start string) string { return start },
+		source:   func(string) []string { return source },
+		width:    40,
+		height:   8,
+	}
+}
+
+func Test_browser_lines(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	b := newTestBrowser([]condition{
+		{Start: "a.go:4:9", File: "a.go", Line: 4, Col: 9, Code: "x > 0", Func: "f"},
+		{Start: "a.go:4:20", File: "a.go", Line: 4, Col: 20, Code: "y", TrueCount: 1, Func: "f"},
+	})
+
+	s.CheckEquals(b.lines(), []string{
+		"gobco: 2 uncovered conditions (up/down: ",
+		"\x1b[7ma.go:4:9: x > 0 was never evaluated     \x1b[0m",
+		"a.go:4:20: y was once true but never fal",
+		"",
+		"-- a.go:4:9 ----------------------------",
+		"      3  func f(x int) bool {",
+		">     4      return x > 0",
+		"      5  }",
+	})
+
+	empty := newTestBrowser(nil)
+	s.CheckEquals(empty.lines(), []string{
+		"gobco: 0 uncovered conditions (up/down: ",
+		"",
+		"",
+		"",
+		"----------------------------------------",
+	})
+	s.CheckEquals(empty.handleKey("enter"), browseStay)
+}
+
+func Test_browser_handleKey(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	var conds []condition
+	for i := 0; i < 10; i++ {
+		conds = append(conds, condition{Start: "a.go:4:9", Code: "x > 0"})
+	}
+	b := newTestBrowser(conds)
+
+	test := func(key string, action browserAction, selected, top int) {
+		s.CheckEquals(b.handleKey(key), action)
+		s.CheckEquals(b.selected, selected)
+		s.CheckEquals(b.top, top)
+	}
+
+	test("up", browseStay, 0, 0)
+	test("down", browseStay, 1, 0)
+	test("j", browseStay, 2, 0)
+	test("down", browseStay, 3, 1)
+	test("pgdn", browseStay, 6, 4)
+	test("end", browseStay, 9, 7)
+	test("down", browseStay, 9, 7)
+	test("k", browseStay, 8, 7)
+	test("pgup", browseStay, 5, 5)
+	test("home", browseStay, 0, 0)
+	test("x", browseStay, 0, 0)
+	test("enter", browseOpen, 0, 0)
+	test("q", browseQuit, 0, 0)
+}
+
+func Test_readKey(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	in := bufio.NewReader(strings.NewReader("j\r\x1b[A\x1b[B\x1b[5~\x1b[6~\x1bOH\x1b[F\x1b[2~q\x1b"))
+	var keys []string
+	for {
+		key, err := readKey(in)
+		if err != nil {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	s.CheckEquals(keys, []string{
+		"j", "enter", "up", "down", "pgup", "pgdn", "home", "end", "", "q", "esc",
+	})
+}
+
+func Test_gobcoMain__tui_without_terminal(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// The tests don't run in a terminal,
+	// so the plain report is printed instead.
+	stdout, stderr := s.RunMain(0, "gobco", "-tui", "-path-style=relative", "testdata/oddeven")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 0/2",
+		"odd.go:4:9: condition \"x%2 != 0\" was never evaluated",
+	})
+	s.CheckEquals(stderr, "")
+}
@@ -3,17 +3,28 @@ package main
 import (
 	"crypto/rand"
 	"fmt"
+	"hash/fnv"
 	"io"
+	mathrand "math/rand"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
+// copyDir copies the regular files from src to dst.
+// This includes the files that are not Go code,
+// such as the files for //go:embed, even hidden ones.
+//
+// The copied files and directories are writable, even if the source tree
+// is read-only, as on some CI systems or in the module cache,
+// since the instrumenter overwrites the copied files later.
+// The created directories are only accessible by the current user.
 func copyDir(src string, dst string) error {
 	src = filepath.Clean(src)
 	dst = filepath.Clean(dst)
 
-	err := os.MkdirAll(dst, 0o777)
+	err := os.MkdirAll(dst, 0o700)
 	if err != nil {
 		return err
 	}
@@ -28,9 +39,9 @@ func copyDir(src string, dst string) error {
 				return err
 			}
 			dstPath := filepath.Join(dst, rel)
-			err = os.MkdirAll(filepath.Dir(dstPath), os.ModePerm)
+			err = os.MkdirAll(filepath.Dir(dstPath), 0o700)
 			if err == nil {
-				err = copyFile(path, dstPath)
+				err = copyFile(path, dstPath, info.Mode())
 			}
 		}
 		return err
@@ -39,7 +50,9 @@ func copyDir(src string, dst string) error {
 	return filepath.Walk(src, action)
 }
 
-func copyFile(src string, dst string) (err error) {
+// copyFile copies the content of src to dst.
+// The permissions of dst are 0644, or 0755 if src is executable.
+func copyFile(src string, dst string, mode os.FileMode) (err error) {
 	in, err := os.Open(src)
 	if err != nil {
 		return
@@ -62,13 +75,32 @@ func copyFile(src string, dst string) (err error) {
 		}
 	}()
 
+	perm := os.FileMode(0o644)
+	if mode&0o111 != 0 {
+		perm = 0o755
+	}
+	if err = out.Chmod(perm); err != nil {
+		return
+	}
+
 	_, err = io.Copy(out, in)
 	return
 }
 
+// randomSource provides the randomness for randomHex.
+// It is only replaced to make the output reproducible, see seedRandom.
+var randomSource io.Reader = rand.Reader
+
+// seedRandom makes the future results of randomHex reproducible.
+func seedRandom(seed string) {
+	h := fnv.New64a()
+	_, _ = io.WriteString(h, seed)
+	randomSource = mathrand.New(mathrand.NewSource(int64(h.Sum64())))
+}
+
 func randomHex(n int) string {
 	rnd := make([]byte, n)
-	_, err := io.ReadFull(rand.Reader, rnd[:])
+	_, err := io.ReadFull(randomSource, rnd[:])
 	if err != nil {
 		panic(err)
 	}
@@ -95,6 +127,81 @@ func (s *sliceFlag) Set(str string) error {
 	return nil
 }
 
+// splitOptions splits the options from the GOBCO_OPTS environment variable
+// into words, similar to a shell.
+// Words are separated by whitespace.
+// Single quotes preserve everything up to the next single quote.
+// Double quotes and backslashes work as in the shell,
+// without expanding any variables.
+func splitOptions(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(ch)
+			}
+		case ch == '\\' && i+1 < len(s) &&
+			(quote == 0 || s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inWord = true
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unfinished %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// truncateCode shortens the code to at most width runes,
+// marking the omitted end with "...". A width of 0 means unlimited.
+func truncateCode(code string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(code) <= width {
+		return code
+	}
+
+	const ellipsis = "..."
+	keep := width - len(ellipsis)
+	n := 0
+	for i := range code {
+		if n >= keep {
+			return strings.TrimRight(code[:i], " \t\n") + ellipsis
+		}
+		n++
+	}
+	return code
+}
+
 func ok(err error) {
 	if err != nil {
 		panic(err)
@@ -3,7 +3,9 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"testing"
 )
 
 func listRegularFiles(basedir string) []string {
@@ -24,3 +26,149 @@ func listRegularFiles(basedir string) []string {
 
 	return files
 }
+
+func Test_copyDir__assembly(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dst := filepath.Join(t.TempDir(), "copy")
+
+	s.CheckEquals(copyDir("testdata/asm", dst), nil)
+
+	s.CheckEquals(listRegularFiles(dst), []string{
+		"add_amd64.go",
+		"add_amd64.s",
+		"add_other.go",
+		"clamp.go",
+		"clamp_test.go",
+	})
+}
+
+func Test_copyDir__embed(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dst := filepath.Join(t.TempDir(), "copy")
+
+	s.CheckEquals(copyDir("testdata/embed", dst), nil)
+
+	// The files for //go:embed are copied as well,
+	// including the hidden ones that "all:" patterns refer to.
+	s.CheckEquals(listRegularFiles(dst), []string{
+		"embed.go",
+		"embed_test.go",
+		"greetings/.formal.txt",
+		"greetings/hello.txt",
+	})
+}
+
+func Test_copyDir__read_only(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "copy")
+	writeReadOnlyTree(t, src, map[string]string{
+		"main.go":          "package main\n",
+		"sub/sub.go":       "package sub\n",
+		"scripts/build.sh": "#! /bin/sh\n",
+	})
+	s.CheckEquals(os.Chmod(filepath.Join(src, "scripts", "build.sh"), 0o555), nil)
+
+	s.CheckEquals(copyDir(src, dst), nil)
+
+	s.CheckEquals(listRegularFiles(dst), []string{
+		"main.go",
+		"scripts/build.sh",
+		"sub/sub.go",
+	})
+	for _, rel := range []string{"main.go", "sub/sub.go", "scripts/build.sh"} {
+		filename := filepath.Join(dst, filepath.FromSlash(rel))
+		s.CheckEquals(os.WriteFile(filename, []byte("overwritten\n"), 0o666), nil)
+	}
+	if runtime.GOOS != "windows" {
+		st, err := os.Stat(filepath.Join(dst, "main.go"))
+		s.CheckEquals(err, nil)
+		s.CheckEquals(st.Mode().Perm(), os.FileMode(0o644))
+		st, err = os.Stat(filepath.Join(dst, "scripts", "build.sh"))
+		s.CheckEquals(err, nil)
+		s.CheckEquals(st.Mode().Perm(), os.FileMode(0o755))
+		st, err = os.Stat(filepath.Join(dst, "sub"))
+		s.CheckEquals(err, nil)
+		s.CheckEquals(st.Mode().Perm(), os.FileMode(0o700))
+	}
+}
+
+// writeReadOnlyTree creates the files below dir and makes them read-only,
+// like in a read-only checkout. The permissions are restored when the test
+// finishes, so that the temporary directory can be removed.
+func writeReadOnlyTree(t *testing.T, dir string, files map[string]string) {
+	var dirs []string
+	for rel, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o444); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, filepath.Dir(filename))
+	}
+
+	for _, d := range dirs {
+		if err := os.Chmod(d, 0o555); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, d := range dirs {
+			_ = os.Chmod(d, 0o755)
+		}
+	})
+}
+
+func Test_splitOptions(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(str string, expected ...string) {
+		words, err := splitOptions(str)
+		s.CheckEquals(err, nil)
+		s.CheckEquals(words, expected)
+	}
+
+	test("")
+	test(" \t\n ")
+	test("-branch", "-branch")
+	test("  -branch   -list-all ", "-branch", "-list-all")
+	test("-test '-run=Test A'", "-test", "-run=Test A")
+	test(`-test "-run=Test A"`, "-test", "-run=Test A")
+	test(`-test -run=Test\ A`, "-test", "-run=Test A")
+	test(`'' ""`, "", "")
+	test(`'a\b' "a\b" "a\"b" a\\b`, `a\b`, `a\b`, `a"b`, `a\b`)
+	test(`a'b c'"d e"f`, "ab cd ef")
+	test(`\'`, "'")
+
+	_, err := splitOptions("'unfinished")
+	s.CheckEquals(err.Error(), "unfinished ' quote")
+	_, err = splitOptions(`"unfinished`)
+	s.CheckEquals(err.Error(), `unfinished " quote`)
+}
+
+func Test_truncateCode(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(code string, width int, expected string) {
+		s.CheckEquals(truncateCode(code, width), expected)
+	}
+
+	test("a && b", 0, "a && b")
+	test("a && b", 6, "a && b")
+	test("a && b || c", 10, "a && b...")
+	test("a &&\n\tb || c", 10, "a &&\n\tb...")
+	test("a &&\n\tb || c", 8, "a &&...")
+	test(`s == "quoted"`, 10, `s == "q...`)
+	test("x == \"äöüß\"", 10, "x == \"ä...")
+	test("abcdef", 2, "...")
+}
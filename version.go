@@ -1,3 +1,27 @@
 package main
 
+import (
+	"encoding/json"
+	"runtime"
+)
+
 const version = "1.3.5-snapshot"
+
+// commit is the VCS commit from which gobco was built, if known.
+// It is set when building gobco, using:
+//
+//	go build -ldflags "-X main.commit=$(git rev-parse HEAD)"
+var commit = ""
+
+// versionInfo is the output of the -version-json option.
+type versionInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Commit    string `json:"commit"`
+}
+
+func versionJSON() string {
+	js, err := json.Marshal(versionInfo{version, runtime.Version(), commit})
+	ok(err)
+	return string(js)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checkVersionPin compares the version of gobco with the version
+// that the file .gobco.version in the root of each module requires,
+// so that an accidental upgrade of gobco doesn't silently change
+// the coverage numbers. A mismatch is a warning,
+// or an error with -strict-version.
+func (g *gobco) checkVersionPin() {
+	checked := map[string]bool{}
+	for _, arg := range g.args {
+		filename := filepath.Join(arg.copySrc, ".gobco.version")
+		if checked[filename] {
+			continue
+		}
+		checked[filename] = true
+
+		content, err := os.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		g.check(err)
+
+		constraint := parseVersionFile(string(content))
+		satisfied, err := satisfiesVersion(version, constraint)
+		if err != nil {
+			g.check(fmt.Errorf("error: %s: %s", filename, err))
+		}
+		if satisfied {
+			continue
+		}
+
+		msg := fmt.Sprintf("%s requires gobco %s, but this is gobco %s",
+			filename, constraint, version)
+		if g.strictVersion {
+			g.check(fmt.Errorf("error: %s", msg))
+		}
+		g.warnf("gobco: %s", msg)
+	}
+}
+
+// parseVersionFile returns the version constraint from the content
+// of a .gobco.version file, which is the first line
+// that is neither empty nor a comment starting with '#'.
+func parseVersionFile(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+// satisfiesVersion returns whether the version satisfies
+// each of the comma-separated terms of the constraint.
+//
+// A term is either an exact version such as "1.3.5",
+// a version prefix such as "1.3" that matches all 1.3.x versions,
+// a comparison such as ">=1.3" or "<2",
+// "~1.3.2" for at least 1.3.2 but below 1.4,
+// or "^1.3.2" for at least 1.3.2 but below 2.
+func satisfiesVersion(v, constraint string) (bool, error) {
+	actual, err := parseSemver(v)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(constraint) == "" {
+		return false, fmt.Errorf("missing version constraint")
+	}
+
+	for _, term := range strings.Split(constraint, ",") {
+		term = strings.TrimSpace(term)
+		op := ""
+		for _, candidate := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(term, candidate) {
+				op = candidate
+				break
+			}
+		}
+		required, err := parseSemver(strings.TrimSpace(term[len(op):]))
+		if err != nil {
+			return false, err
+		}
+
+		cmp := actual.compare(required)
+		var ok bool
+		switch op {
+		case "", "=":
+			ok = actual.hasPrefix(required)
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0 || actual.hasPrefix(required)
+		case ">":
+			ok = cmp > 0 && !actual.hasPrefix(required)
+		case "<":
+			ok = cmp < 0
+		case "~":
+			limit := required.parts
+			if limit > 2 {
+				limit = 2
+			}
+			ok = cmp >= 0 && actual.hasPrefix(required.truncate(limit))
+		case "^":
+			limit := 1
+			if required.nums[0] == 0 && required.parts > 1 {
+				limit = 2
+			}
+			ok = cmp >= 0 && actual.hasPrefix(required.truncate(limit))
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// semver is a version of the form major.minor.patch-prerelease,
+// in which minor, patch and prerelease are optional.
+type semver struct {
+	nums [3]int
+	// How many of the numbers are given.
+	parts int
+	pre   string
+}
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	text := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(text, '-'); i != -1 {
+		text, v.pre = text[:i], text[i+1:]
+	}
+	fields := strings.Split(text, ".")
+	if len(fields) > 3 {
+		return semver{}, fmt.Errorf("invalid version %q", s)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return semver{}, fmt.Errorf("invalid version %q", s)
+		}
+		v.nums[i] = n
+	}
+	v.parts = len(fields)
+	return v, nil
+}
+
+// compare compares the versions, treating the missing numbers as 0.
+// A prerelease comes before the release of the same numbers.
+func (v semver) compare(other semver) int {
+	for i := range v.nums {
+		if v.nums[i] != other.nums[i] {
+			if v.nums[i] < other.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == other.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case other.pre == "":
+		return -1
+	case v.pre < other.pre:
+		return -1
+	}
+	return 1
+}
+
+// hasPrefix returns whether the version starts with the given numbers
+// and, if the prefix is a complete version, has the same prerelease.
+func (v semver) hasPrefix(prefix semver) bool {
+	for i := 0; i < prefix.parts; i++ {
+		if v.nums[i] != prefix.nums[i] {
+			return false
+		}
+	}
+	return prefix.parts < 3 || v.pre == prefix.pre
+}
+
+// truncate returns the first n numbers of the version.
+func (v semver) truncate(n int) semver {
+	t := semver{parts: n}
+	copy(t.nums[:n], v.nums[:n])
+	return t
+}
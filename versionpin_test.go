@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_satisfiesVersion(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(v, constraint string, expected bool) {
+		actual, err := satisfiesVersion(v, constraint)
+		s.CheckEquals(err, nil)
+		s.CheckEquals(actual, expected)
+	}
+
+	test("1.3.5", "1.3.5", true)
+	test("1.3.5", "v1.3.5", true)
+	test("1.3.5", "=1.3.5", true)
+	test("1.3.5", "1.3.4", false)
+	test("1.3.5", "1.3", true)
+	test("1.3.5", "1", true)
+	test("1.3.5", "1.4", false)
+	test("1.3.5-snapshot", "1.3.5", false)
+	test("1.3.5-snapshot", "1.3", true)
+
+	test("1.3.5", ">=1.3", true)
+	test("1.3.5", ">= 1.3.6", false)
+	test("1.3.5", ">1.3", false)
+	test("1.3.5", ">1.3.4", true)
+	test("1.3.5", "<2", true)
+	test("1.3.5", "<1.3.5", false)
+	test("1.3.5-snapshot", "<1.3.5", true)
+	test("1.3.5", "<=1.3", true)
+	test("1.3.5", "<=1.2.9", false)
+	test("1.3.5", ">=1.2, <1.4", true)
+	test("1.3.5", ">=1.2, <1.3", false)
+
+	test("1.3.5", "~1.3.2", true)
+	test("1.4.0", "~1.3.2", false)
+	test("1.3.1", "~1.3.2", false)
+	test("1.9.0", "~1", true)
+	test("1.9.0", "^1.3.2", true)
+	test("2.0.0", "^1.3.2", false)
+	test("0.3.5", "^0.3.1", true)
+	test("0.4.0", "^0.3.1", false)
+
+	_, err := satisfiesVersion("1.3.5", ">=one")
+	s.CheckEquals(err.Error(), "invalid version \"one\"")
+	_, err = satisfiesVersion("1.3.5", "1.2.3.4")
+	s.CheckEquals(err.Error(), "invalid version \"1.2.3.4\"")
+	_, err = satisfiesVersion("1.3.5", "")
+	s.CheckEquals(err.Error(), "missing version constraint")
+}
+
+func Test_parseVersionFile(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	s.CheckEquals(parseVersionFile("1.3.5\n"), "1.3.5")
+	s.CheckEquals(parseVersionFile("# pinned for CI\n\n  >=1.3, <2  \n"), ">=1.3, <2")
+	s.CheckEquals(parseVersionFile("# only a comment\n"), "")
+}
+
+func Test_gobcoMain__version_pin(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":    "module example.com/pinned\n",
+		"pinned.go": "package pinned\n\nfunc Positive(x int) bool { return x > 0 }\n",
+		"pinned_test.go": "" +
+			"package pinned\n" +
+			"\n" +
+			"import \"testing\"\n" +
+			"\n" +
+			"func TestPositive(t *testing.T) { Positive(1) }\n",
+	})
+	pin := func(constraint string) {
+		err := os.WriteFile(filepath.Join(dir, ".gobco.version"), []byte(constraint+"\n"), 0o666)
+		s.CheckEquals(err, nil)
+	}
+	filename := filepath.Join(dir, ".gobco.version")
+
+	pin(">=1.0, <99")
+	_, stderr := s.RunMain(0, "gobco", dir)
+	s.CheckEquals(stderr, "")
+
+	pin("0.1.0")
+	stdout, stderr := s.RunMain(0, "gobco", dir)
+	s.CheckContains(stdout, "Condition coverage: 1/2\n")
+	s.CheckEquals(stderr, ""+
+		"gobco: "+filename+" requires gobco 0.1.0, but this is gobco "+version+"\n")
+
+	g := s.newGobco()
+	g.parseCommandLine([]string{"gobco", "-strict-version", dir})
+	s.CheckPanics(g.checkVersionPin, exited(1))
+	s.CheckEquals(s.Stderr(), ""+
+		"error: "+filename+" requires gobco 0.1.0, but this is gobco "+version+"\n")
+
+	pin("latest")
+	g = s.newGobco()
+	g.parseCommandLine([]string{"gobco", dir})
+	s.CheckPanics(g.checkVersionPin, exited(1))
+	s.CheckEquals(s.Stderr(), "error: "+filename+": invalid version \"latest\"\n")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A module that is part of a workspace may import packages
+// from the other modules of the workspace.
+// To resolve these imports in the build environment,
+// the whole directory of the go.work file is copied,
+// including the go.work file itself.
+
+// findWorkspace returns the absolute directory of the go.work file
+// that applies to the module root, or "" if there is none.
+func findWorkspace(moduleRoot string) (string, error) {
+	if os.Getenv("GOWORK") == "off" {
+		return "", nil
+	}
+
+	abs, err := filepath.Abs(moduleRoot)
+	if err != nil {
+		return "", err
+	}
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		goWork := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(goWork); err == nil {
+			return dir, checkWorkspace(goWork)
+		}
+		if filepath.Dir(dir) == dir {
+			return "", nil
+		}
+	}
+}
+
+// checkWorkspace ensures that the go.work file only refers to
+// directories inside the workspace, as the build environment
+// only contains a copy of the workspace directory.
+func checkWorkspace(goWork string) error {
+	content, err := os.ReadFile(goWork)
+	if err != nil {
+		return err
+	}
+
+	inUse := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+
+		var dir string
+		switch {
+		case len(fields) == 0:
+			continue
+		case inUse && fields[0] == ")":
+			inUse = false
+		case inUse:
+			dir = fields[0]
+		case len(fields) == 2 && fields[0] == "use" && fields[1] == "(":
+			inUse = true
+		case len(fields) == 2 && fields[0] == "use":
+			dir = fields[1]
+		default:
+			if idx := strings.Index(line, "=>"); idx >= 0 {
+				// Only a target starting with "." or "/" is a directory,
+				// otherwise it is a module path.
+				target := strings.Fields(line[idx+len("=>"):])
+				if len(target) == 1 && (strings.HasPrefix(target[0], ".") || filepath.IsAbs(target[0])) {
+					dir = target[0]
+				}
+			}
+		}
+
+		dir = strings.Trim(dir, "\"`")
+		if dir == "" {
+			continue
+		}
+		rel := filepath.ToSlash(filepath.Clean(dir))
+		if filepath.IsAbs(dir) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("error: the workspace %s refers to %s, "+
+				"which is outside the workspace directory", goWork, dir)
+		}
+	}
+	return nil
+}
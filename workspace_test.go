@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_checkWorkspace(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	test := func(goWork string, expectedErr string) {
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{"go.work": goWork})
+		err := checkWorkspace(filepath.Join(dir, "go.work"))
+		if expectedErr == "" {
+			s.CheckEquals(err, nil)
+		} else {
+			s.CheckEquals(strings.Replace(err.Error(), dir, "DIR", 1), expectedErr)
+		}
+	}
+
+	test("go 1.18\n\nuse ./a\n", "")
+	test("go 1.18\n\nuse (\n\t./a\n\t./b // comment\n\t\"./c\"\n)\n", "")
+	test("go 1.18\n\nreplace example.org/a => example.org/b v1.0.0\n", "")
+	test("go 1.18\n\nreplace example.org/a v1.0.0 => ./vendor/a\n", "")
+
+	test("go 1.18\n\nuse ../other\n",
+		"error: the workspace "+filepath.Join("DIR", "go.work")+" refers to ../other, "+
+			"which is outside the workspace directory")
+	test("go 1.18\n\nuse (\n\t./a\n\t..\n)\n",
+		"error: the workspace "+filepath.Join("DIR", "go.work")+" refers to .., "+
+			"which is outside the workspace directory")
+	test("go 1.18\n\nreplace (\n\texample.org/a => ../a\n)\n",
+		"error: the workspace "+filepath.Join("DIR", "go.work")+" refers to ../a, "+
+			"which is outside the workspace directory")
+}
+
+func Test_findWorkspace(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"ws/go.work":   "go 1.18\n\nuse ./m\n",
+		"ws/m/go.mod":  "module example.org/m\n",
+		"plain/go.mod": "module example.org/plain\n",
+	})
+	ws, err := filepath.EvalSymlinks(filepath.Join(dir, "ws"))
+	s.CheckEquals(err, nil)
+
+	actual, err := findWorkspace(filepath.Join(ws, "m"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(actual, ws)
+
+	actual, err = findWorkspace(filepath.Join(dir, "plain"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(actual, "")
+
+	setenv(t, "GOWORK", "off")
+	actual, err = findWorkspace(filepath.Join(ws, "m"))
+	s.CheckEquals(err, nil)
+	s.CheckEquals(actual, "")
+}
+
+func Test_gobcoMain__workspace(t *testing.T) {
+	s := NewSuite(t)
+	defer s.TearDownTest()
+
+	// In workspace mode, the go command rejects -mod=mod.
+	setenv(t, "GOFLAGS", "")
+
+	stdout, stderr := s.RunMain(0, "gobco", "testdata/workspace/app", "testdata/workspace/lib")
+
+	s.CheckEquals(s.GobcoLines(stdout), []string{
+		"Condition coverage: 3/6",
+		"testdata/workspace/app/app.go:7:9: condition \"lib.Max(a, b) == a\" was once true but never false",
+		"testdata/workspace/app/app.go:7:31: condition \"a != b\" was once true but never false",
+		"testdata/workspace/lib/lib.go:4:5: condition \"a > b\" was once false but never true",
+	})
+	s.CheckEquals(stderr, "")
+}